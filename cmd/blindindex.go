@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"thanhlv-encryption-decryption/pkg/crypto"
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+var blindIndexCmd = &cobra.Command{
+	Use:   "blind-index",
+	Short: "Generate blind indexes for searching encrypted data",
+	Long: `Generate truncated HMAC-SHA256 blind indexes from a dedicated index key.
+Store the index next to the ciphertext and query on it for equality without decrypting.
+Use a different key from the one that encrypts the data.`,
+	Run: runBlindIndex,
+}
+
+var (
+	blindIndexKey         string
+	blindIndexKeyEnv      string
+	blindIndexKeyEncoding string
+	blindIndexText        string
+	blindIndexFile        string
+	blindIndexOutput      string
+	blindIndexBits        int
+	blindIndexNormalize   string
+	blindIndexFormat      string
+)
+
+func init() {
+	blindIndexCmd.Flags().StringVarP(&blindIndexKey, "key", "k", "", "Index key (base64 encoded)")
+	blindIndexCmd.Flags().StringVarP(&blindIndexKeyEnv, "key-env", "e", "", "Environment variable name containing the index key (base64 encoded)")
+	blindIndexCmd.Flags().StringVar(&blindIndexKeyEncoding, "key-encoding", utils.EncodingBase64, "Encoding of --key and --key-env (base64, base64url, hex, base32, raw, or auto to detect it)")
+	blindIndexCmd.Flags().StringVarP(&blindIndexText, "text", "t", "", "Value to index")
+	blindIndexCmd.Flags().StringVarP(&blindIndexFile, "file", "f", "", "File with one value per line to index (- for standard input)")
+	blindIndexCmd.Flags().StringVarP(&blindIndexOutput, "output", "o", "", "Output file (optional, - for standard output)")
+	blindIndexCmd.Flags().IntVar(&blindIndexBits, "bits", crypto.DefaultBlindIndexBits, "Index size in bits (1-256)")
+	blindIndexCmd.Flags().StringVar(&blindIndexNormalize, "normalize", "", "Comma separated normalization steps (casefold, trim)")
+	blindIndexCmd.Flags().StringVar(&blindIndexFormat, "format", "hex", "Output format (hex, base64)")
+}
+
+func runBlindIndex(cmd *cobra.Command, args []string) {
+	if blindIndexText == "" && blindIndexFile == "" {
+		fmt.Fprintln(os.Stderr, "Error: Either --text or --file must be specified")
+		os.Exit(1)
+	}
+
+	if blindIndexText != "" && blindIndexFile != "" {
+		fmt.Fprintln(os.Stderr, "Error: Cannot specify both --text and --file")
+		os.Exit(1)
+	}
+
+	keyBytes, err := readKey(blindIndexKey, blindIndexKeyEnv, blindIndexKeyEncoding)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	opts := crypto.BlindIndexOptions{Bits: blindIndexBits}
+	if blindIndexNormalize != "" {
+		for _, step := range strings.Split(blindIndexNormalize, ",") {
+			switch strings.TrimSpace(step) {
+			case "casefold":
+				opts.CaseFold = true
+			case "trim":
+				opts.Trim = true
+			default:
+				fmt.Fprintf(os.Stderr, "Error: Unsupported normalization: %s\n", step)
+				os.Exit(1)
+			}
+		}
+	}
+
+	var encode func([]byte) string
+	switch blindIndexFormat {
+	case "hex":
+		encode = hex.EncodeToString
+	case "base64":
+		encode = base64.StdEncoding.EncodeToString
+	default:
+		fmt.Fprintf(os.Stderr, "Error: Unsupported output format: %s\n", blindIndexFormat)
+		os.Exit(1)
+	}
+
+	if blindIndexText != "" {
+		index, err := crypto.BlindIndex(keyBytes, []byte(blindIndexText), opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error computing blind index: %v\n", err)
+			os.Exit(1)
+		}
+
+		if blindIndexOutput != "" {
+			err = utils.WriteFile(blindIndexOutput, []byte(encode(index)+"\n"))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing to output file: %v\n", err)
+				os.Exit(1)
+			}
+			reportOutput(blindIndexOutput, "Blind index written to: %s\n", blindIndexOutput)
+		} else {
+			fmt.Printf("Blind index (%s): %s\n", blindIndexFormat, encode(index))
+		}
+		return
+	}
+
+	data, err := utils.ReadFile(blindIndexFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+		os.Exit(1)
+	}
+
+	// One index per input line, so the output lines up with the input
+	var out bytes.Buffer
+	for i, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		index, err := crypto.BlindIndex(keyBytes, []byte(strings.TrimSuffix(line, "\r")), opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error computing blind index for line %d: %v\n", i+1, err)
+			os.Exit(1)
+		}
+		out.WriteString(encode(index))
+		out.WriteString("\n")
+	}
+
+	if blindIndexOutput != "" {
+		err = utils.WriteFile(blindIndexOutput, out.Bytes())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing to output file: %v\n", err)
+			os.Exit(1)
+		}
+		reportOutput(blindIndexOutput, "Blind indexes written to: %s\n", blindIndexOutput)
+	} else {
+		fmt.Print(out.String())
+	}
+}
@@ -1,9 +1,16 @@
 package cmd
 
 import (
-	"encoding/base64"
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"thanhlv-encryption-decryption/pkg/crypto"
@@ -13,132 +20,572 @@ import (
 var decryptCmd = &cobra.Command{
 	Use:   "decrypt",
 	Short: "Decrypt text or files",
-	Long:  `Decrypt text or files using various algorithms like AES-256-CBC or RSA.`,
-	Run:   runDecrypt,
+	Long: `Decrypt text or files using various algorithms like AES-256-GCM, AES-256-CBC, RSA,
+HPKE (RFC 9180) or format-preserving FF1/FF3-1. The algorithm is read from the envelope;
+pass --legacy and --algorithm for bare ciphertexts from older versions.`,
+	Run: runDecrypt,
 }
 
 var (
-	decryptAlgorithm string
-	decryptInput     string
-	decryptOutput    string
-	decryptKey       string
-	decryptKeyEnv    string
-	decryptText      string
-	decryptFile      string
+	decryptAlgorithm     string
+	decryptInput         string
+	decryptOutput        string
+	decryptKey           string
+	decryptKeyEnv        string
+	decryptText          string
+	decryptFile          string
+	decryptSenderKey     string
+	decryptPSK           string
+	decryptPSKID         string
+	decryptAlphabet      string
+	decryptTweak         string
+	decryptPassphrase    string
+	decryptPassphraseEnv string
+	decryptPrompt        bool
+	decryptLegacy        bool
+	decryptEncoding      string
+	decryptKeyEncoding   string
+	decryptNoRestore     bool
+	decryptIgnoreExpiry  bool
+	decryptMaxSize       string
+	decryptParallel      int
+	decryptRange         string
+	decryptProgress      string
+	decryptResume        bool
 )
 
 func init() {
-	decryptCmd.Flags().StringVarP(&decryptAlgorithm, "algorithm", "a", "aes-256-cbc", "Decryption algorithm (aes-256-cbc, rsa)")
+	decryptCmd.Flags().StringVarP(&decryptAlgorithm, "algorithm", "a", "aes-256-cbc", "Algorithm of --legacy input (aes-256-cbc, rsa, hpke[-x25519|-p256[-aes128gcm|-aes256gcm|-chacha20poly1305]]) or ff1, ff3-1")
 	decryptCmd.Flags().StringVarP(&decryptKey, "key", "k", "", "Decryption key (base64 encoded)")
 	decryptCmd.Flags().StringVarP(&decryptKeyEnv, "key-env", "e", "", "Environment variable name containing the decryption key (base64 encoded)")
+	decryptCmd.Flags().StringVar(&decryptKeyEncoding, "key-encoding", utils.EncodingBase64, "Encoding of --key and --key-env (base64, base64url, hex, base32, raw, or auto to detect it)")
+	decryptCmd.Flags().StringVar(&decryptEncoding, "encoding", utils.EncodingAuto, "Ciphertext encoding (auto, base64, base64url, hex, base32, raw); auto also reads raw files")
 	decryptCmd.Flags().StringVarP(&decryptText, "text", "t", "", "Base64 encoded encrypted text to decrypt")
-	decryptCmd.Flags().StringVarP(&decryptFile, "file", "f", "", "Encrypted file to decrypt")
-	decryptCmd.Flags().StringVarP(&decryptOutput, "output", "o", "", "Output file (optional)")
+	decryptCmd.Flags().StringVarP(&decryptFile, "file", "f", "", "Encrypted file to decrypt (- for standard input)")
+	decryptCmd.Flags().StringVarP(&decryptOutput, "output", "o", "", "Output file (optional, - for standard output)")
+	decryptCmd.Flags().StringVar(&decryptSenderKey, "sender-key", "", "HPKE sender public key for auth mode (base64 encoded)")
+	decryptCmd.Flags().StringVar(&decryptPSK, "psk", "", "HPKE pre-shared key for psk mode, at least 32 bytes (base64 encoded)")
+	decryptCmd.Flags().StringVar(&decryptPSKID, "psk-id", "", "HPKE pre-shared key identifier for psk mode")
+	decryptCmd.Flags().StringVar(&decryptAlphabet, "alphabet", "", "Alphabet for ff1/ff3-1 (default \"0123456789\")")
+	decryptCmd.Flags().StringVar(&decryptTweak, "tweak", "", "Tweak for ff1 (at most 256 bytes) or ff3-1 (exactly 7 bytes)")
+	decryptCmd.Flags().StringVar(&decryptPassphrase, "passphrase", "", "Passphrase for data encrypted with --passphrase")
+	decryptCmd.Flags().StringVar(&decryptPassphraseEnv, "passphrase-env", "", "Environment variable name containing the passphrase")
+	decryptCmd.Flags().BoolVar(&decryptLegacy, "legacy", false, "Input is bare ciphertext without an envelope header (older versions or encrypt --legacy); requires --algorithm")
+	decryptCmd.Flags().BoolVar(&decryptNoRestore, "no-restore", false, "Use only the stored file name; do not restore the stored mode and modification time")
+	decryptCmd.Flags().BoolVar(&decryptIgnoreExpiry, "ignore-expiry", false, "Decrypt data past its expiry time (for recovery)")
+	decryptCmd.Flags().StringVar(&decryptMaxSize, "max-decompressed-size", "1G", "Refuse compressed data that expands beyond this size (bytes, or with K, M, G suffix)")
+	decryptCmd.Flags().IntVar(&decryptParallel, "parallel", 1, "Decrypt file chunks on this many cores (0 for all)")
+	decryptCmd.Flags().StringVar(&decryptRange, "range", "", "Decrypt only bytes START-END (END excluded, open-ended START-) of a streamed file, to standard output unless --output is given")
+	decryptCmd.Flags().StringVar(&decryptProgress, "progress", progressAuto, "Show progress of file decryption on stderr (auto: a bar when stderr is a terminal, json, off)")
+	decryptCmd.Flags().BoolVar(&decryptResume, "resume", false, "Write OUTPUT.partial with a checkpoint and continue an interrupted run from it")
+	decryptCmd.Flags().BoolVar(&decryptPrompt, "prompt", false, "Read the passphrase from the terminal with echo disabled (used when no other key source is given)")
 }
 
 func runDecrypt(cmd *cobra.Command, args []string) {
+	// Piped input is decrypted to standard output unless --output says otherwise
 	if decryptText == "" && decryptFile == "" {
-		fmt.Println("Error: Either --text or --file must be specified")
-		os.Exit(1)
+		if !stdinIsPiped() {
+			fmt.Fprintln(os.Stderr, "Error: Either --text or --file must be specified, or data piped to standard input")
+			os.Exit(1)
+		}
+		decryptFile = utils.Stdio
 	}
 
 	if decryptText != "" && decryptFile != "" {
-		fmt.Println("Error: Cannot specify both --text and --file")
+		fmt.Fprintln(os.Stderr, "Error: Cannot specify both --text and --file")
+		os.Exit(1)
+	}
+
+	if decryptRange != "" && (decryptFile == "" || decryptFile == utils.Stdio) {
+		fmt.Fprintln(os.Stderr, "Error: --range needs an encrypted file given with --file")
+		os.Exit(1)
+	}
+	if decryptResume && (decryptText != "" || decryptRange != "") {
+		fmt.Fprintln(os.Stderr, "Error: --resume cannot be used with --text or --range")
 		os.Exit(1)
 	}
 
 	// Validate key input
-	if decryptKey == "" && decryptKeyEnv == "" {
-		fmt.Println("Error: Either --key or --key-env must be specified")
+	// --prompt only applies when no other key source is given
+	promptMode := decryptPrompt && decryptKey == "" && decryptKeyEnv == "" &&
+		decryptPassphrase == "" && decryptPassphraseEnv == ""
+	passphraseMode := decryptPassphrase != "" || decryptPassphraseEnv != "" || promptMode
+	if passphraseMode {
+		if decryptKey != "" || decryptKeyEnv != "" {
+			fmt.Fprintln(os.Stderr, "Error: Cannot specify --passphrase with --key or --key-env")
+			os.Exit(1)
+		}
+	} else if decryptKey == "" && decryptKeyEnv == "" {
+		fmt.Fprintln(os.Stderr, "Error: Either --key, --key-env, --passphrase or --prompt must be specified")
 		os.Exit(1)
 	}
 
 	if decryptKey != "" && decryptKeyEnv != "" {
-		fmt.Println("Error: Cannot specify both --key and --key-env")
+		fmt.Fprintln(os.Stderr, "Error: Cannot specify both --key and --key-env")
 		os.Exit(1)
 	}
 
-	// Get the key value
-	var keyValue string
-	if decryptKeyEnv != "" {
-		keyValue = os.Getenv(decryptKeyEnv)
-		if keyValue == "" {
-			fmt.Printf("Error: Environment variable '%s' is not set or empty\n", decryptKeyEnv)
+	if err := validateProgress(decryptProgress); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, encoding := range []string{decryptEncoding, decryptKeyEncoding} {
+		if err := utils.ValidateEncoding(encoding, true); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var keyBytes []byte
+	var err error
+	if promptMode {
+		keyBytes, err = promptSecret("Passphrase", false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else if passphraseMode {
+		keyBytes, err = readPassphrase(decryptPassphrase, decryptPassphraseEnv)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
 	} else {
-		keyValue = decryptKey
+		// Get the key value
+		var keyValue string
+		if decryptKeyEnv != "" {
+			keyValue = os.Getenv(decryptKeyEnv)
+			if keyValue == "" {
+				fmt.Fprintf(os.Stderr, "Error: Environment variable '%s' is not set or empty\n", decryptKeyEnv)
+				os.Exit(1)
+			}
+		} else {
+			keyValue = decryptKey
+		}
+
+		// Decode key
+		keyBytes, err = utils.Decode(keyValue, decryptKeyEncoding)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error decoding key: %v\n", err)
+			os.Exit(1)
+		}
 	}
 
-	// Decode base64 key
-	keyBytes, err := base64.StdEncoding.DecodeString(keyValue)
+	// Initialize crypto provider
+	provider, err := crypto.NewCryptoProvider(decryptAlgorithm)
 	if err != nil {
-		fmt.Printf("Error decoding base64 key: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error initializing crypto provider: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Initialize crypto provider
-	provider, err := crypto.NewCryptoProvider(decryptAlgorithm)
+	// HPKE options apply to HPKE envelopes whatever --algorithm says
+	hpkeOptions, err := buildHPKEOptions(decryptSenderKey, decryptPSK, decryptPSKID, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if hpkeProvider, ok := provider.(*crypto.HPKEProvider); ok {
+		hpkeProvider.Options = hpkeOptions
+	} else if decryptLegacy && hpkeOptions != nil {
+		fmt.Fprintln(os.Stderr, "Error: --sender-key, --psk and --psk-id are only supported with HPKE algorithms")
+		os.Exit(1)
+	}
+
+	fpeProvider, isFPE := provider.(*crypto.FPEProvider)
+	if isFPE {
+		if decryptAlphabet != "" {
+			fpeProvider.Alphabet = decryptAlphabet
+		}
+		fpeProvider.Tweak = []byte(decryptTweak)
+	} else if decryptAlphabet != "" || decryptTweak != "" {
+		fmt.Fprintln(os.Stderr, "Error: --alphabet and --tweak are only supported with ff1 and ff3-1")
+		os.Exit(1)
+	}
+
+	maxSize, err := parseByteSize(decryptMaxSize)
 	if err != nil {
-		fmt.Printf("Error initializing crypto provider: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error: invalid --max-decompressed-size: %v\n", err)
 		os.Exit(1)
 	}
+	openOptions := &crypto.OpenOptions{
+		HPKE:                hpkeOptions,
+		IgnoreExpiry:        decryptIgnoreExpiry,
+		MaxDecompressedSize: maxSize,
+		Parallelism:         parallelism(decryptParallel),
+	}
+	// Only envelopes can carry file metadata, which their header flags
+	decrypt := func(data, key []byte) (*crypto.FileMetadata, []byte, error) {
+		switch {
+		case crypto.IsEnvelope(data):
+			return crypto.OpenFileEnvelope(data, key, openOptions)
+		case decryptLegacy:
+			plaintext, err := provider.Decrypt(data, key)
+			return nil, plaintext, err
+		default:
+			return nil, nil, fmt.Errorf("input has no envelope header; use --legacy with --algorithm for ciphertexts from older versions")
+		}
+	}
 
 	var result []byte
 
 	if decryptText != "" {
-		// Decode base64 encrypted text
-		encryptedData, err := base64.StdEncoding.DecodeString(decryptText)
-		if err != nil {
-			fmt.Printf("Error decoding base64 encrypted text: %v\n", err)
-			os.Exit(1)
+		// Format-preserving ciphertexts are plain text, everything else is armored or encoded
+		encryptedData := []byte(decryptText)
+		if crypto.IsArmored(encryptedData) {
+			encryptedData, err = dearmor(encryptedData)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		} else if !isFPE {
+			encryptedData, err = utils.Decode(decryptText, decryptEncoding)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error decoding encrypted text: %v\n", err)
+				os.Exit(1)
+			}
 		}
 
-		// Decrypt text
-		result, err = provider.Decrypt(encryptedData, keyBytes)
+		// Decrypt text; the file metadata of a file's ciphertext means nothing here
+		if isFPE {
+			result, err = provider.Decrypt(encryptedData, keyBytes)
+		} else {
+			_, result, err = decrypt(encryptedData, keyBytes)
+		}
 		if err != nil {
-			fmt.Printf("Error decrypting text: %v\n", err)
-			os.Exit(1)
+			exitDecryptError("text", err)
 		}
 
 		if decryptOutput != "" {
 			err = utils.WriteFile(decryptOutput, result)
 			if err != nil {
-				fmt.Printf("Error writing to output file: %v\n", err)
+				fmt.Fprintf(os.Stderr, "Error writing to output file: %v\n", err)
 				os.Exit(1)
 			}
-			fmt.Printf("Decrypted text written to: %s\n", decryptOutput)
+			reportOutput(decryptOutput, "Decrypted text written to: %s\n", decryptOutput)
 		} else {
 			fmt.Printf("Decrypted text: %s\n", string(result))
 		}
+	} else if decryptRange != "" {
+		if isFPE {
+			fmt.Fprintln(os.Stderr, "Error: --range is not supported with ff1 and ff3-1")
+			os.Exit(1)
+		}
+		start, end, err := parseByteRange(decryptRange)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --range: %v\n", err)
+			os.Exit(1)
+		}
+		outputFile, err := decryptFileRange(keyBytes, openOptions, start, end)
+		if err != nil {
+			exitDecryptError("file", err)
+		}
+		reportOutput(outputFile, "Decrypted range saved to: %s\n", outputFile)
+	} else if decryptResume {
+		if isFPE {
+			fmt.Fprintln(os.Stderr, "Error: --resume is not supported with ff1 and ff3-1")
+			os.Exit(1)
+		}
+		outputFile, err := decryptFileResumable(keyBytes, openOptions)
+		if err != nil {
+			exitDecryptError("file", err)
+		}
+		reportOutput(outputFile, "File decrypted and saved to: %s\n", outputFile)
 	} else {
-		// Decrypt file
-		data, err := utils.ReadFile(decryptFile)
+		// The input is read once, so it may be a pipe
+		file, err := utils.OpenFile(decryptFile)
 		if err != nil {
-			fmt.Printf("Error reading encrypted file: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error reading encrypted file: %v\n", err)
 			os.Exit(1)
 		}
+		r := bufio.NewReader(file)
 
-		result, err = provider.Decrypt(data, keyBytes)
+		// Binary envelopes are decrypted chunk by chunk, so files of any size
+		// decrypt in constant memory. IsEnvelope only looks at the first few bytes.
+		prefix, _ := r.Peek(16)
+		if !isFPE && (decryptEncoding == utils.EncodingAuto || decryptEncoding == utils.EncodingRaw) && crypto.IsEnvelope(prefix) {
+			outputFile, err := decryptFileStream(r, keyBytes, openOptions)
+			file.Close()
+			if err != nil {
+				exitDecryptError("file", err)
+			}
+			reportOutput(outputFile, "File decrypted and saved to: %s\n", outputFile)
+			return
+		}
+
+		// Decrypt file
+		data, err := io.ReadAll(r)
+		file.Close()
 		if err != nil {
-			fmt.Printf("Error decrypting file: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error reading encrypted file: %v\n", err)
 			os.Exit(1)
 		}
-
-		outputFile := decryptOutput
-		if outputFile == "" {
-			if len(decryptFile) > 10 && decryptFile[len(decryptFile)-10:] == ".encrypted" {
-				outputFile = decryptFile[:len(decryptFile)-10]
-			} else {
-				outputFile = decryptFile + ".decrypted"
+		switch {
+		case isFPE:
+		case crypto.IsArmored(data):
+			data, err = dearmor(data)
+		case decryptEncoding != utils.EncodingAuto:
+			data, err = utils.Decode(string(data), decryptEncoding)
+		case !crypto.IsEnvelope(data):
+			// Binary ciphertext practically never decodes as text, so a file that
+			// does holds text-encoded output
+			if decoded, detected, err := utils.DecodeAuto(string(data)); err == nil {
+				utils.DebugLogf("Encrypted file is %s encoded", detected)
+				data = decoded
 			}
 		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error decoding encrypted file: %v\n", err)
+			os.Exit(1)
+		}
+
+		var meta *crypto.FileMetadata
+		if isFPE {
+			result, err = transformLines(data, keyBytes, provider.Decrypt)
+		} else {
+			meta, result, err = decrypt(data, keyBytes)
+		}
+		if err != nil {
+			exitDecryptError("file", err)
+		}
+
+		outputFile, err := decryptOutputFile(meta)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 
 		err = utils.WriteFile(outputFile, result)
 		if err != nil {
-			fmt.Printf("Error writing decrypted file: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error writing decrypted file: %v\n", err)
 			os.Exit(1)
 		}
-		fmt.Printf("File decrypted and saved to: %s\n", outputFile)
+		if meta != nil && !decryptNoRestore {
+			if err := restoreFileMetadata(outputFile, meta); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		reportOutput(outputFile, "File decrypted and saved to: %s\n", outputFile)
+	}
+}
+
+// exitDecryptError reports a failed decryption, with a hint for errors that a flag can override
+func exitDecryptError(what string, err error) {
+	switch {
+	case errors.Is(err, crypto.ErrExpired):
+		fmt.Fprintf(os.Stderr, "Error: %v; use --ignore-expiry to decrypt it anyway\n", err)
+	case errors.Is(err, crypto.ErrDecompressionLimit):
+		fmt.Fprintf(os.Stderr, "Error: %v; raise --max-decompressed-size if the data is trusted\n", err)
+	default:
+		fmt.Fprintf(os.Stderr, "Error decrypting %s: %v\n", what, err)
+	}
+	os.Exit(1)
+}
+
+// decryptOutputFile picks --output, else standard output for standard input, else
+// the stored name next to the encrypted file, else a name guessed from the
+// encrypted file's name
+func decryptOutputFile(meta *crypto.FileMetadata) (string, error) {
+	if decryptOutput != "" {
+		return decryptOutput, nil
+	}
+	if decryptFile == utils.Stdio {
+		return utils.Stdio, nil
+	}
+	if meta != nil {
+		name, err := meta.SafeName()
+		if err != nil {
+			return "", fmt.Errorf("%v; use --output to choose the output file", err)
+		}
+		return filepath.Join(filepath.Dir(decryptFile), name), nil
+	}
+	if len(decryptFile) > 10 && decryptFile[len(decryptFile)-10:] == ".encrypted" {
+		return decryptFile[:len(decryptFile)-10], nil
+	}
+	return decryptFile + ".decrypted", nil
+}
+
+// decryptFileStream decrypts an envelope from r with crypto.NewDecryptReader into
+// the output file and returns its name. The output only replaces an existing file
+// once the whole stream has been authenticated.
+func decryptFileStream(r io.Reader, key []byte, opts *crypto.OpenOptions) (string, error) {
+	total := int64(-1)
+	if decryptFile != utils.Stdio {
+		if info, err := os.Stat(decryptFile); err == nil {
+			total = info.Size()
+		}
 	}
-}
\ No newline at end of file
+	bar := newProgress(decryptProgress, "decrypt", progressName(decryptFile), total)
+	defer bar.finish()
+	if bar != nil {
+		opts.Progress = bar.update
+	}
+
+	meta, plaintext, err := crypto.NewFileDecryptReader(r, key, opts)
+	if err != nil {
+		return "", err
+	}
+	// Stops the read-ahead goroutines when the output fails first
+	if c, ok := plaintext.(io.Closer); ok {
+		defer c.Close()
+	}
+	outputFile, err := decryptOutputFile(meta)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := utils.CreateFileAtomic(outputFile)
+	if err != nil {
+		return "", err
+	}
+	n, err := io.Copy(out, plaintext)
+	if err != nil {
+		out.Abort()
+		return "", err
+	}
+	if err := out.Commit(0644); err != nil {
+		return "", err
+	}
+	utils.DebugLogf("Streamed %d bytes into %s", n, outputFile)
+
+	if meta != nil && !decryptNoRestore {
+		if err := restoreFileMetadata(outputFile, meta); err != nil {
+			return "", err
+		}
+	}
+	return outputFile, nil
+}
+
+// decryptFileRange decrypts bytes start to end of the content of a streamed file,
+// counted after its file metadata, to --output or standard output. Only the chunks
+// holding the range are read. An end of -1 or past the content means the end.
+func decryptFileRange(key []byte, opts *crypto.OpenOptions, start, end int64) (string, error) {
+	file, err := os.Open(decryptFile)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := crypto.NewDecryptReaderAt(file, info.Size(), key, opts)
+	if err != nil {
+		return "", err
+	}
+	size := plaintext.Size()
+	if end < 0 || end > size {
+		end = size
+	}
+	if start > end {
+		return "", fmt.Errorf("range starts past the end of the %d byte file", size)
+	}
+
+	outputFile := decryptOutput
+	if outputFile == "" {
+		outputFile = utils.Stdio
+	}
+	out, err := utils.CreateFileAtomic(outputFile)
+	if err != nil {
+		return "", err
+	}
+	bar := newProgress(decryptProgress, "decrypt", progressName(decryptFile), end-start)
+	defer bar.finish()
+	if _, err := io.Copy(out, bar.reader(io.NewSectionReader(plaintext, start, end-start))); err != nil {
+		out.Abort()
+		return "", err
+	}
+	if err := out.Commit(0644); err != nil {
+		return "", err
+	}
+	utils.DebugLogf("Decrypted bytes %d-%d of %d into %s", start, end, size, outputFile)
+	return outputFile, nil
+}
+
+// parseByteRange parses START-END or START- into offsets, with -1 for an open end.
+// Both accept the K, M and G suffixes of parseByteSize.
+func parseByteRange(s string) (int64, int64, error) {
+	startText, endText, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("%q is not START-END", s)
+	}
+	start, err := parseByteOffset(startText)
+	if err != nil {
+		return 0, 0, err
+	}
+	end := int64(-1)
+	if endText != "" {
+		if end, err = parseByteOffset(endText); err != nil {
+			return 0, 0, err
+		}
+		if end < start {
+			return 0, 0, fmt.Errorf("%q ends before it starts", s)
+		}
+	}
+	return start, end, nil
+}
+
+// parseByteOffset is parseByteSize that also accepts 0
+func parseByteOffset(s string) (int64, error) {
+	if s == "0" {
+		return 0, nil
+	}
+	return parseByteSize(s)
+}
+
+// dearmor decodes an armored block, logging its headers in debug mode
+func dearmor(data []byte) ([]byte, error) {
+	decoded, headers, err := crypto.Dearmor(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range headers {
+		utils.DebugLogf("Armor header: %s: %s", h.Key, h.Value)
+	}
+	return decoded, nil
+}
+
+// restoreFileMetadata applies the stored mode and modification time to a regular
+// output file; standard output and devices such as /dev/stdout are left alone
+func restoreFileMetadata(path string, meta *crypto.FileMetadata) error {
+	if path == utils.Stdio {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	if err := os.Chmod(path, meta.Mode); err != nil {
+		return fmt.Errorf("failed to restore file mode: %w", err)
+	}
+	if !meta.ModTime.IsZero() {
+		if err := os.Chtimes(path, time.Now(), meta.ModTime); err != nil {
+			return fmt.Errorf("failed to restore modification time: %w", err)
+		}
+	}
+	utils.DebugLogf("Restored mode %v and modification time %v on %s", meta.Mode, meta.ModTime, path)
+	return nil
+}
+
+// parseByteSize parses a positive byte count with an optional K, M or G (binary) suffix
+func parseByteSize(s string) (int64, error) {
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(strings.ToUpper(s), "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(strings.ToUpper(s), "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(strings.ToUpper(s), "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 1 || n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("%q is not a positive size", s)
+	}
+	return n * multiplier, nil
+}
@@ -3,7 +3,12 @@ package cmd
 import (
 	"encoding/base64"
 	"fmt"
+	"io"
 	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"thanhlv-encryption-decryption/pkg/crypto"
@@ -13,135 +18,557 @@ import (
 var encryptCmd = &cobra.Command{
 	Use:   "encrypt",
 	Short: "Encrypt text or files",
-	Long:  `Encrypt text or files using various algorithms like AES-256-CBC or RSA.`,
-	Run:   runEncrypt,
+	Long: `Encrypt text or files using various algorithms like AES-256-GCM, AES-256-CBC, RSA,
+HPKE (RFC 9180) or format-preserving FF1/FF3-1. The output is a versioned envelope that
+names the algorithm, so decrypt does not need --algorithm.`,
+	Run: runEncrypt,
 }
 
 var (
-	encryptAlgorithm string
-	encryptInput     string
-	encryptOutput    string
-	encryptKey       string
-	encryptKeyEnv    string
-	encryptText      string
-	encryptFile      string
+	encryptAlgorithm     string
+	encryptInput         string
+	encryptOutput        string
+	encryptKey           string
+	encryptKeyEnv        string
+	encryptText          string
+	encryptFile          string
+	encryptSenderKey     string
+	encryptPSK           string
+	encryptPSKID         string
+	encryptAlphabet      string
+	encryptTweak         string
+	encryptRecipients    []string
+	encryptPassphrase    string
+	encryptPassphraseEnv string
+	encryptPrompt        bool
+	encryptStrengthCheck string
+	encryptLegacy        bool
+	encryptArmor         bool
+	encryptArmorHeaders  []string
+	encryptEncoding      string
+	encryptKeyEncoding   string
+	encryptNoMetadata    bool
+	encryptExpiresIn     string
+	encryptNotAfter      string
+	encryptPadTo         string
+	encryptCompress      string
+	encryptCompressLevel int
+	encryptParallel      int
+	encryptProgress      string
+	encryptResume        bool
 )
 
 func init() {
-	encryptCmd.Flags().StringVarP(&encryptAlgorithm, "algorithm", "a", "aes-256-cbc", "Encryption algorithm (aes-256-cbc, rsa)")
+	encryptCmd.Flags().StringVarP(&encryptAlgorithm, "algorithm", "a", "aes-256-gcm", "Encryption algorithm (aes-256-gcm, aes-256-cbc, rsa, hpke[-x25519|-p256[-aes128gcm|-aes256gcm|-chacha20poly1305]], ff1, ff3-1)")
 	encryptCmd.Flags().StringVarP(&encryptKey, "key", "k", "", "Encryption key (base64 encoded)")
 	encryptCmd.Flags().StringVarP(&encryptKeyEnv, "key-env", "e", "", "Environment variable name containing the encryption key (base64 encoded)")
+	encryptCmd.Flags().StringVar(&encryptKeyEncoding, "key-encoding", utils.EncodingBase64, "Encoding of --key and --key-env (base64, base64url, hex, base32, raw, or auto to detect it)")
+	encryptCmd.Flags().StringVar(&encryptEncoding, "encoding", "", "Ciphertext encoding (base64, base64url, hex, base32, raw; default base64 for --text, raw for files)")
 	encryptCmd.Flags().StringVarP(&encryptText, "text", "t", "", "Text to encrypt")
-	encryptCmd.Flags().StringVarP(&encryptFile, "file", "f", "", "File to encrypt")
-	encryptCmd.Flags().StringVarP(&encryptOutput, "output", "o", "", "Output file (optional)")
+	encryptCmd.Flags().StringVarP(&encryptFile, "file", "f", "", "File to encrypt (- for standard input)")
+	encryptCmd.Flags().StringVarP(&encryptOutput, "output", "o", "", "Output file (optional, - for standard output)")
+	encryptCmd.Flags().StringVar(&encryptSenderKey, "sender-key", "", "HPKE sender private key for auth mode (base64 encoded)")
+	encryptCmd.Flags().StringVar(&encryptPSK, "psk", "", "HPKE pre-shared key for psk mode, at least 32 bytes (base64 encoded)")
+	encryptCmd.Flags().StringVar(&encryptPSKID, "psk-id", "", "HPKE pre-shared key identifier for psk mode")
+	encryptCmd.Flags().StringVar(&encryptAlphabet, "alphabet", "", "Alphabet for ff1/ff3-1 (default \"0123456789\")")
+	encryptCmd.Flags().StringVar(&encryptTweak, "tweak", "", "Tweak for ff1 (at most 256 bytes) or ff3-1 (exactly 7 bytes)")
+	encryptCmd.Flags().StringVar(&encryptPassphrase, "passphrase", "", "Encrypt with a passphrase instead of a key (AES-256-GCM, key derived with --kdf)")
+	encryptCmd.Flags().StringVar(&encryptPassphraseEnv, "passphrase-env", "", "Environment variable name containing the passphrase")
+	encryptCmd.Flags().BoolVar(&encryptPrompt, "prompt", false, "Read the passphrase from the terminal with echo disabled (used when no other key source is given)")
+	encryptCmd.Flags().StringVar(&encryptStrengthCheck, "strength-check", "warn", "What to do with weak passphrases and text keys (warn, reject, off)")
+	encryptCmd.Flags().BoolVar(&encryptLegacy, "legacy", false, "Write bare aes-256-cbc, rsa or hpke output without the envelope header, for older versions")
+	encryptCmd.Flags().StringVar(&encryptExpiresIn, "expires-in", "", "Make the ciphertext expire after this duration (e.g. 90m, 24h, 7d)")
+	encryptCmd.Flags().StringVar(&encryptNotAfter, "not-after", "", "Make the ciphertext expire at this time (RFC 3339, or YYYY-MM-DD for midnight UTC)")
+	encryptCmd.Flags().StringVar(&encryptPadTo, "pad-to", "", "Pad the plaintext to hide its length: bucket (power of two), padme or a size in bytes")
+	encryptCmd.Flags().StringVar(&encryptCompress, "compress", "", "Compress before encrypting (gzip, deflate); do not use on data mixing secrets with attacker-controlled input")
+	encryptCmd.Flags().IntVar(&encryptCompressLevel, "compress-level", 6, "Compression level, 1 (fastest) to 9 (smallest)")
+	encryptCmd.Flags().IntVar(&encryptParallel, "parallel", 1, "Encrypt file chunks on this many cores (0 for all)")
+	encryptCmd.Flags().StringVar(&encryptProgress, "progress", progressAuto, "Show progress of file encryption on stderr (auto: a bar when stderr is a terminal, json, off)")
+	encryptCmd.Flags().BoolVar(&encryptResume, "resume", false, "Write OUTPUT.partial with a checkpoint and continue an interrupted run from it")
+	encryptCmd.Flags().BoolVar(&encryptNoMetadata, "no-metadata", false, "Do not store the file name, mode and modification time in the encrypted file")
+	encryptCmd.Flags().BoolVar(&encryptArmor, "armor", false, "Write an ASCII-armored text block instead of binary or one-line base64 output")
+	encryptCmd.Flags().StringArrayVar(&encryptArmorHeaders, "armor-header", nil, "Header line for --armor output, as \"Key: Value\" (repeatable)")
+	encryptCmd.Flags().StringArrayVarP(&encryptRecipients, "recipient", "r", nil, "Recipient public key (RSA, X25519 or ECIES P-256), base64 encoded or a PEM file path (repeatable)")
 }
 
 func runEncrypt(cmd *cobra.Command, args []string) {
 	utils.DebugLogf("Starting encryption with algorithm: %s", encryptAlgorithm)
 	utils.DebugLogf("Text input: %t, File input: %t", encryptText != "", encryptFile != "")
 
+	// Piped input is encrypted to standard output unless --output says otherwise
 	if encryptText == "" && encryptFile == "" {
-		fmt.Println("Error: Either --text or --file must be specified")
-		os.Exit(1)
+		if !stdinIsPiped() {
+			fmt.Fprintln(os.Stderr, "Error: Either --text or --file must be specified, or data piped to standard input")
+			os.Exit(1)
+		}
+		encryptFile = utils.Stdio
 	}
 
 	if encryptText != "" && encryptFile != "" {
-		fmt.Println("Error: Cannot specify both --text and --file")
+		fmt.Fprintln(os.Stderr, "Error: Cannot specify both --text and --file")
 		os.Exit(1)
 	}
 
 	// Validate key input
-	if encryptKey == "" && encryptKeyEnv == "" {
-		fmt.Println("Error: Either --key or --key-env must be specified")
+	// --prompt only applies when no other key source is given, so scripts can keep it
+	// and supply a key through the environment when no terminal is attached
+	promptMode := encryptPrompt && encryptKey == "" && encryptKeyEnv == "" &&
+		encryptPassphrase == "" && encryptPassphraseEnv == "" && len(encryptRecipients) == 0
+	passphraseMode := encryptPassphrase != "" || encryptPassphraseEnv != "" || promptMode
+	if len(encryptRecipients) > 0 {
+		if encryptKey != "" || encryptKeyEnv != "" || passphraseMode {
+			fmt.Fprintln(os.Stderr, "Error: Cannot specify --recipient with --key, --key-env or --passphrase")
+			os.Exit(1)
+		}
+	} else if passphraseMode {
+		if encryptKey != "" || encryptKeyEnv != "" {
+			fmt.Fprintln(os.Stderr, "Error: Cannot specify --passphrase with --key or --key-env")
+			os.Exit(1)
+		}
+	} else if encryptKey == "" && encryptKeyEnv == "" {
+		fmt.Fprintln(os.Stderr, "Error: Either --key, --key-env, --passphrase or --prompt must be specified")
 		os.Exit(1)
 	}
 
 	if encryptKey != "" && encryptKeyEnv != "" {
-		fmt.Println("Error: Cannot specify both --key and --key-env")
+		fmt.Fprintln(os.Stderr, "Error: Cannot specify both --key and --key-env")
+		os.Exit(1)
+	}
+
+	if err := validateProgress(encryptProgress); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Get the key value
-	var keyValue string
-	if encryptKeyEnv != "" {
-		keyValue = os.Getenv(encryptKeyEnv)
-		if keyValue == "" {
-			fmt.Printf("Error: Environment variable '%s' is not set or empty\n", encryptKeyEnv)
+	if err := utils.ValidateEncoding(encryptKeyEncoding, true); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --key-encoding: %v\n", err)
+		os.Exit(1)
+	}
+	if encryptEncoding != "" {
+		if err := utils.ValidateEncoding(encryptEncoding, false); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --encoding: %v\n", err)
+			os.Exit(1)
+		}
+		if encryptArmor {
+			fmt.Fprintln(os.Stderr, "Error: Cannot specify both --encoding and --armor")
 			os.Exit(1)
 		}
-		utils.DebugLogf("Using key from environment variable: %s", encryptKeyEnv)
-	} else {
-		keyValue = encryptKey
-		utils.DebugLogf("Using key from command line flag")
 	}
 
-	// Decode base64 key
-	utils.DebugLogf("Decoding base64 key of length: %d", len(keyValue))
-	keyBytes, err := base64.StdEncoding.DecodeString(keyValue)
-	if err != nil {
-		fmt.Printf("Error decoding base64 key: %v\n", err)
+	if !passphraseMode && kdfFlagsChanged(cmd) {
+		fmt.Fprintln(os.Stderr, "Error: --kdf options are only supported with --passphrase")
+		os.Exit(1)
+	}
+
+	var keyBytes []byte
+	var err error
+	if promptMode {
+		keyBytes, err = promptSecret("Passphrase", true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else if passphraseMode {
+		keyBytes, err = readPassphrase(encryptPassphrase, encryptPassphraseEnv)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else if len(encryptRecipients) == 0 {
+		// Get the key value
+		var keyValue string
+		if encryptKeyEnv != "" {
+			keyValue = os.Getenv(encryptKeyEnv)
+			if keyValue == "" {
+				fmt.Fprintf(os.Stderr, "Error: Environment variable '%s' is not set or empty\n", encryptKeyEnv)
+				os.Exit(1)
+			}
+			utils.DebugLogf("Using key from environment variable: %s", encryptKeyEnv)
+		} else if encryptKey != "" {
+			keyValue = encryptKey
+			utils.DebugLogf("Using key from command line flag")
+		}
+
+		// Decode key
+		utils.DebugLogf("Decoding %s key of length: %d", encryptKeyEncoding, len(keyValue))
+		keyBytes, err = utils.Decode(keyValue, encryptKeyEncoding)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error decoding key: %v\n", err)
+			os.Exit(1)
+		}
+		utils.DebugLogf("Successfully decoded key, byte length: %d", len(keyBytes))
+	}
+
+	// Passphrases, and AES keys that are plain text rather than random bytes, are
+	// often too weak; random binary keys are not checked
+	if encryptStrengthCheck != "warn" && encryptStrengthCheck != "reject" && encryptStrengthCheck != "off" {
+		fmt.Fprintf(os.Stderr, "Error: Unsupported --strength-check value: %s\n", encryptStrengthCheck)
 		os.Exit(1)
 	}
-	utils.DebugLogf("Successfully decoded key, byte length: %d", len(keyBytes))
+	if encryptStrengthCheck != "off" && (passphraseMode || (strings.HasPrefix(encryptAlgorithm, "aes-256-") && len(encryptRecipients) == 0 && isPrintableText(keyBytes))) {
+		if err := checkPassphrase(keyBytes, encryptStrengthCheck == "reject"); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
 	// Initialize crypto provider
 	utils.DebugLogf("Initializing crypto provider for algorithm: %s", encryptAlgorithm)
-	provider, err := crypto.NewCryptoProvider(encryptAlgorithm)
+	var provider crypto.CryptoProvider
+	if len(encryptRecipients) > 0 {
+		provider, err = newMultiRecipientProvider(encryptRecipients)
+	} else if passphraseMode {
+		provider, err = newPassphraseProvider()
+	} else {
+		provider, err = crypto.NewCryptoProvider(encryptAlgorithm)
+	}
 	if err != nil {
-		fmt.Printf("Error initializing crypto provider: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error initializing crypto provider: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Expiry, padding and compression live in the authenticated envelope header
+	var envelopeOptions crypto.EnvelopeOptions
+	if encryptExpiresIn != "" || encryptNotAfter != "" || encryptPadTo != "" || encryptCompress != "" {
+		if encryptExpiresIn != "" || encryptNotAfter != "" {
+			envelopeOptions.NotAfter, err = parseExpiry(encryptExpiresIn, encryptNotAfter)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			utils.DebugLogf("Ciphertext expires at %s", envelopeOptions.NotAfter.UTC().Format(time.RFC3339))
+		}
+		if encryptPadTo != "" {
+			envelopeOptions.Padding, err = crypto.ParsePaddingScheme(encryptPadTo)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			utils.DebugLogf("Padding plaintext: %s", envelopeOptions.Padding)
+		}
+		if encryptCompress != "" {
+			envelopeOptions.Compression, err = crypto.ParseCompressionAlgorithm(encryptCompress)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if encryptCompressLevel < 1 || encryptCompressLevel > 9 {
+				fmt.Fprintln(os.Stderr, "Error: --compress-level must be between 1 and 9")
+				os.Exit(1)
+			}
+			envelopeOptions.CompressionLevel = encryptCompressLevel
+		}
+		if encryptLegacy {
+			fmt.Fprintln(os.Stderr, "Error: --legacy output cannot carry an expiry time, padding or compression")
+			os.Exit(1)
+		}
+		if err := crypto.SetEnvelopeOptions(provider, envelopeOptions); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if hpkeProvider, ok := provider.(*crypto.HPKEProvider); ok {
+		hpkeProvider.Options, err = buildHPKEOptions(encryptSenderKey, encryptPSK, encryptPSKID, true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else if encryptSenderKey != "" || encryptPSK != "" || encryptPSKID != "" {
+		fmt.Fprintln(os.Stderr, "Error: --sender-key, --psk and --psk-id are only supported with HPKE algorithms")
+		os.Exit(1)
+	}
+
+	fpeProvider, isFPE := provider.(*crypto.FPEProvider)
+	if isFPE && encryptEncoding != "" {
+		fmt.Fprintln(os.Stderr, "Error: --encoding is not supported with ff1 and ff3-1")
+		os.Exit(1)
+	}
+	if isFPE {
+		if encryptAlphabet != "" {
+			fpeProvider.Alphabet = encryptAlphabet
+		}
+		fpeProvider.Tweak = []byte(encryptTweak)
+	} else if encryptAlphabet != "" || encryptTweak != "" {
+		fmt.Fprintln(os.Stderr, "Error: --alphabet and --tweak are only supported with ff1 and ff3-1")
 		os.Exit(1)
 	}
 	utils.DebugLog("Crypto provider initialized successfully")
 
+	// Everything except format-preserving output goes into a self-describing envelope
+	encrypt := func(data, key []byte) ([]byte, error) {
+		return crypto.SealEnvelope(provider, data, key)
+	}
+	if encryptLegacy {
+		switch provider.(type) {
+		case *crypto.AESProvider, *crypto.RSAProvider, *crypto.HPKEProvider:
+			encrypt = provider.Encrypt
+		default:
+			fmt.Fprintln(os.Stderr, "Error: --legacy is only supported with aes-256-cbc, rsa and hpke")
+			os.Exit(1)
+		}
+	} else if isFPE {
+		encrypt = provider.Encrypt
+	}
+
+	var armorHeaders []crypto.ArmorHeader
+	if encryptArmor {
+		if isFPE {
+			fmt.Fprintln(os.Stderr, "Error: --armor is not supported with ff1 and ff3-1")
+			os.Exit(1)
+		}
+		for _, h := range encryptArmorHeaders {
+			header, err := crypto.ParseArmorHeader(h)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			armorHeaders = append(armorHeaders, header)
+		}
+	} else if len(encryptArmorHeaders) > 0 {
+		fmt.Fprintln(os.Stderr, "Error: --armor-header requires --armor")
+		os.Exit(1)
+	}
+
 	var result []byte
 
 	if encryptText != "" {
 		// Encrypt text
 		utils.DebugLogf("Encrypting text of length: %d", len(encryptText))
-		result, err = provider.Encrypt([]byte(encryptText), keyBytes)
+		result, err = encrypt([]byte(encryptText), keyBytes)
 		if err != nil {
-			fmt.Printf("Error encrypting text: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error encrypting text: %v\n", err)
 			os.Exit(1)
 		}
+		if encryptArmor {
+			result = crypto.Armor(result, armorHeaders)
+		} else if encryptEncoding != "" && encryptEncoding != utils.EncodingRaw {
+			result = encodeCiphertext(result, encryptEncoding)
+		}
 
 		if encryptOutput != "" {
 			err = utils.WriteFile(encryptOutput, result)
 			if err != nil {
-				fmt.Printf("Error writing to output file: %v\n", err)
+				fmt.Fprintf(os.Stderr, "Error writing to output file: %v\n", err)
 				os.Exit(1)
 			}
-			fmt.Printf("Encrypted text written to: %s\n", encryptOutput)
+			reportOutput(encryptOutput, "Encrypted text written to: %s\n", encryptOutput)
+		} else if encryptArmor {
+			fmt.Print(string(result))
+		} else if encryptEncoding == utils.EncodingRaw {
+			os.Stdout.Write(result)
+		} else if encryptEncoding != "" {
+			fmt.Printf("Encrypted text (%s): %s", encryptEncoding, string(result))
+		} else if isFPE {
+			fmt.Printf("Encrypted text: %s\n", string(result))
 		} else {
 			fmt.Printf("Encrypted text (base64): %s\n", base64.StdEncoding.EncodeToString(result))
 		}
 	} else {
+		outputFile := encryptOutput
+		if outputFile == "" && encryptFile == utils.Stdio {
+			outputFile = utils.Stdio
+		} else if outputFile == "" {
+			outputFile = encryptFile + ".encrypted"
+		}
+
+		// Name, mode and mtime are encrypted with the content and flagged in the
+		// authenticated header; the other algorithms could not authenticate the flag
+		if !encryptNoMetadata && encryptFile != utils.Stdio && crypto.SupportsEnvelopeOptions(provider) {
+			info, err := os.Stat(encryptFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+				os.Exit(1)
+			}
+			envelopeOptions.FileMetadata = crypto.NewFileMetadata(info)
+			if err := crypto.SetEnvelopeOptions(provider, envelopeOptions); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		// Binary envelope output is written chunk by chunk, so files of any size
+		// encrypt in constant memory
+		if opts, ok := streamOptions(provider); ok && !encryptLegacy && !encryptArmor && (encryptEncoding == "" || encryptEncoding == utils.EncodingRaw) {
+			opts.Parallelism = parallelism(encryptParallel)
+			encryptStream := encryptFileStream
+			if encryptResume {
+				encryptStream = encryptFileResumable
+			}
+			if err := encryptStream(encryptFile, outputFile, keyBytes, opts); err != nil {
+				fmt.Fprintf(os.Stderr, "Error encrypting file: %v\n", err)
+				os.Exit(1)
+			}
+			reportOutput(outputFile, "File encrypted and saved to: %s\n", outputFile)
+			return
+		}
+
+		if encryptResume {
+			fmt.Fprintln(os.Stderr, "Error: --resume needs a streamed file (aes-256-gcm or --passphrase, without --armor, --pad-to or a text --encoding)")
+			os.Exit(1)
+		}
+
 		// Encrypt file
 		utils.DebugLogf("Reading file for encryption: %s", encryptFile)
 		data, err := utils.ReadFile(encryptFile)
 		if err != nil {
-			fmt.Printf("Error reading file: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
 			os.Exit(1)
 		}
 
 		utils.DebugLogf("File read successfully, size: %d bytes", len(data))
 		utils.DebugLog("Starting file encryption")
-		result, err = provider.Encrypt(data, keyBytes)
+		if isFPE {
+			result, err = transformLines(data, keyBytes, provider.Encrypt)
+		} else {
+			result, err = encrypt(data, keyBytes)
+		}
 		if err != nil {
-			fmt.Printf("Error encrypting file: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error encrypting file: %v\n", err)
 			os.Exit(1)
 		}
 		utils.DebugLogf("File encrypted successfully, result size: %d bytes", len(result))
-
-		outputFile := encryptOutput
-		if outputFile == "" {
-			outputFile = encryptFile + ".encrypted"
+		if encryptArmor {
+			result = crypto.Armor(result, armorHeaders)
+		} else if encryptEncoding != "" && encryptEncoding != utils.EncodingRaw {
+			result = encodeCiphertext(result, encryptEncoding)
 		}
 
 		err = utils.WriteFile(outputFile, result)
 		if err != nil {
-			fmt.Printf("Error writing encrypted file: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error writing encrypted file: %v\n", err)
 			os.Exit(1)
 		}
-		fmt.Printf("File encrypted and saved to: %s\n", outputFile)
+		reportOutput(outputFile, "File encrypted and saved to: %s\n", outputFile)
+	}
+}
+
+// streamOptions returns the streaming equivalent of an aes-256-gcm, passphrase or
+// multi-recipient provider; other providers and padding need the whole plaintext
+func streamOptions(provider crypto.CryptoProvider) (*crypto.StreamOptions, bool) {
+	var opts *crypto.StreamOptions
+	switch p := provider.(type) {
+	case *crypto.AESGCMProvider:
+		opts = &crypto.StreamOptions{EnvelopeOptions: p.EnvelopeOptions}
+	case *crypto.PassphraseProvider:
+		if p.Params == nil {
+			return nil, false
+		}
+		opts = &crypto.StreamOptions{KDF: p.Params, EnvelopeOptions: p.EnvelopeOptions}
+	case *crypto.MultiRecipientProvider:
+		opts = &crypto.StreamOptions{Recipients: p.Recipients, EnvelopeOptions: p.EnvelopeOptions}
+	default:
+		return nil, false
+	}
+	if opts.Padding.Kind != crypto.PaddingNone {
+		return nil, false
+	}
+	return opts, true
+}
+
+// encryptFileStream encrypts inputFile into outputFile with crypto.NewEncryptWriter.
+// The output only replaces outputFile once it is complete.
+func encryptFileStream(inputFile, outputFile string, key []byte, opts *crypto.StreamOptions) error {
+	in, err := utils.OpenFile(inputFile)
+	if err != nil {
+		return err
 	}
-}
\ No newline at end of file
+	defer in.Close()
+
+	// Standard input has no size to show progress against
+	total := int64(-1)
+	if inputFile != utils.Stdio {
+		info, err := os.Stat(inputFile)
+		if err != nil {
+			return fmt.Errorf("failed to read file %s: %w", inputFile, err)
+		}
+		total = info.Size()
+	}
+	bar := newProgress(encryptProgress, "encrypt", progressName(inputFile), total)
+	defer bar.finish()
+	if bar != nil {
+		opts.Progress = bar.update
+	}
+
+	out, err := utils.CreateFileAtomic(outputFile)
+	if err != nil {
+		return err
+	}
+	w, err := crypto.NewEncryptWriter(out, key, opts)
+	if err != nil {
+		out.Abort()
+		return err
+	}
+
+	n, err := io.Copy(w, in)
+	if err != nil {
+		crypto.AbortEncryptWriter(w)
+		out.Abort()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		out.Abort()
+		return err
+	}
+	utils.DebugLogf("Streamed %d bytes into %s", n, outputFile)
+	return out.Commit(0644)
+}
+
+// parallelism turns --parallel into a worker count, 0 meaning one per CPU
+func parallelism(n int) int {
+	if n < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --parallel must not be negative")
+		os.Exit(1)
+	}
+	if n == 0 {
+		return runtime.NumCPU()
+	}
+	return n
+}
+
+// encodeCiphertext encodes ciphertext as one line of text in a validated encoding
+func encodeCiphertext(data []byte, encoding string) []byte {
+	encoded, err := utils.Encode(data, encoding)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return []byte(encoded + "\n")
+}
+
+// parseExpiry turns --expires-in or --not-after into an absolute time in the future.
+// Durations accept a "d" suffix for days on top of time.ParseDuration units.
+func parseExpiry(expiresIn, notAfter string) (time.Time, error) {
+	if expiresIn != "" && notAfter != "" {
+		return time.Time{}, fmt.Errorf("cannot specify both --expires-in and --not-after")
+	}
+
+	var t time.Time
+	if expiresIn != "" {
+		var d time.Duration
+		var err error
+		if days, ok := strings.CutSuffix(expiresIn, "d"); ok {
+			var n int
+			n, err = strconv.Atoi(days)
+			d = time.Duration(n) * 24 * time.Hour
+		} else {
+			d, err = time.ParseDuration(expiresIn)
+		}
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid --expires-in value %q", expiresIn)
+		}
+		t = time.Now().Add(d)
+	} else {
+		var err error
+		if t, err = time.Parse(time.RFC3339, notAfter); err != nil {
+			if t, err = time.Parse("2006-01-02", notAfter); err != nil {
+				return time.Time{}, fmt.Errorf("invalid --not-after value %q, expected RFC 3339 or YYYY-MM-DD", notAfter)
+			}
+		}
+	}
+
+	if !t.After(time.Now()) {
+		return time.Time{}, fmt.Errorf("expiry time %s is not in the future", t.UTC().Format(time.RFC3339))
+	}
+	return t, nil
+}
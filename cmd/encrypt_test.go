@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"thanhlv-encryption-decryption/pkg/crypto"
+)
+
+// --parallel only changes how chunks are sealed, not what decrypts from them
+func TestEncryptFileStreamParallel(t *testing.T) {
+	dir := t.TempDir()
+	key := []byte("parallel command test key")
+	content := make([]byte, 100*1024+123)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	inputFile := filepath.Join(dir, "input.bin")
+	if err := os.WriteFile(inputFile, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range []int{1, 2, 4, 8} {
+		outputFile := filepath.Join(dir, "output.enc")
+		if err := encryptFileStream(inputFile, outputFile, key, &crypto.StreamOptions{ChunkSize: 4096, Parallelism: n}); err != nil {
+			t.Fatalf("--parallel %d: %v", n, err)
+		}
+		data, err := os.ReadFile(outputFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, readers := range []int{1, 4} {
+			r, err := crypto.NewDecryptReader(bytes.NewReader(data), key, &crypto.OpenOptions{Parallelism: readers})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("--parallel %d, %d readers: %v", n, readers, err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("--parallel %d, %d readers: decrypted content differs from the serial input", n, readers)
+			}
+		}
+	}
+}
+
+// A failed read stops the sealing goroutines and leaves no output behind
+func TestEncryptFileStreamReadError(t *testing.T) {
+	dir := t.TempDir()
+	outputFile := filepath.Join(dir, "output.enc")
+	before := runtime.NumGoroutine()
+	// A directory opens but cannot be read, so the copy fails after the header
+	if err := encryptFileStream(dir, outputFile, []byte("key"), &crypto.StreamOptions{Parallelism: 4}); err == nil {
+		t.Fatal("encrypting a directory succeeded")
+	}
+	if _, err := os.Stat(outputFile); !os.IsNotExist(err) {
+		t.Errorf("output left behind: %v", err)
+	}
+	for deadline := time.Now().Add(2 * time.Second); runtime.NumGoroutine() > before; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines still running, want %d", runtime.NumGoroutine(), before)
+		}
+	}
+}
+
+func TestParseExpiry(t *testing.T) {
+	now := time.Now()
+	for _, tt := range []struct {
+		expiresIn, notAfter string
+		want                time.Duration
+		ok                  bool
+	}{
+		{"90m", "", 90 * time.Minute, true},
+		{"7d", "", 7 * 24 * time.Hour, true},
+		{"", now.Add(48 * time.Hour).UTC().Format(time.RFC3339), 48 * time.Hour, true},
+		{"", "2099-01-01", time.Until(time.Date(2099, 1, 1, 0, 0, 0, 0, time.UTC)), true},
+		{"24h", "2099-01-01", 0, false},
+		{"-1h", "", 0, false},
+		{"0d", "", 0, false},
+		{"1w", "", 0, false},
+		{"xd", "", 0, false},
+		{"", "2000-01-01", 0, false},
+		{"", "tomorrow", 0, false},
+	} {
+		got, err := parseExpiry(tt.expiresIn, tt.notAfter)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseExpiry(%q, %q) error = %v", tt.expiresIn, tt.notAfter, err)
+			continue
+		}
+		if d := got.Sub(now.Add(tt.want)); tt.ok && (d < -time.Minute || d > time.Minute) {
+			t.Errorf("parseExpiry(%q, %q) = %v, %v off", tt.expiresIn, tt.notAfter, got, d)
+		}
+	}
+}
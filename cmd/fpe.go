@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// transformLines applies a format-preserving transform to every non-empty line of data,
+// keeping line endings, so files holding one identifier per line keep their layout
+func transformLines(data []byte, key []byte, transform func(data []byte, key []byte) ([]byte, error)) ([]byte, error) {
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		content := bytes.TrimSuffix(line, []byte("\r"))
+		if len(content) == 0 {
+			continue
+		}
+
+		result, err := transform(content, key)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		lines[i] = append(result, line[len(content):]...)
+	}
+	return bytes.Join(lines, []byte("\n")), nil
+}
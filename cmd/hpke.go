@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"thanhlv-encryption-decryption/pkg/crypto"
+)
+
+// buildHPKEOptions turns the --sender-key, --psk and --psk-id flags into HPKE options.
+// The sender key is a private key when encrypting and a public key when decrypting.
+func buildHPKEOptions(senderKey, psk, pskID string, encrypting bool) (*crypto.HPKEOptions, error) {
+	if senderKey == "" && psk == "" && pskID == "" {
+		return nil, nil
+	}
+
+	if (psk == "") != (pskID == "") {
+		return nil, fmt.Errorf("--psk and --psk-id must be specified together")
+	}
+
+	opts := &crypto.HPKEOptions{}
+	if psk != "" {
+		pskBytes, err := base64.StdEncoding.DecodeString(psk)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding base64 psk: %w", err)
+		}
+		opts.PSK = pskBytes
+		opts.PSKID = []byte(pskID)
+	}
+
+	if senderKey != "" {
+		keyBytes, err := base64.StdEncoding.DecodeString(senderKey)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding base64 sender key: %w", err)
+		}
+		if encrypting {
+			opts.SenderPrivateKey = keyBytes
+		} else {
+			opts.SenderPublicKey = keyBytes
+		}
+	}
+
+	return opts, nil
+}
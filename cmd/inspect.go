@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"thanhlv-encryption-decryption/pkg/crypto"
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+var inspectCmd = &cobra.Command{
+	Use:   "inspect",
+	Short: "Show ciphertext metadata without decrypting",
+	Long: `Show what can be read from a ciphertext without the key: format version, algorithm,
+KDF settings, key ids, recipients and sizes. Bare ciphertexts from older versions are
+matched against the size rules of each legacy format.`,
+	Run: runInspect,
+}
+
+var (
+	inspectText string
+	inspectFile string
+	inspectJSON bool
+)
+
+func init() {
+	inspectCmd.Flags().StringVarP(&inspectText, "text", "t", "", "Base64 encoded ciphertext to inspect")
+	inspectCmd.Flags().StringVarP(&inspectFile, "file", "f", "", "Encrypted file to inspect (- for standard input)")
+	inspectCmd.Flags().BoolVar(&inspectJSON, "json", false, "Print JSON instead of text")
+}
+
+func runInspect(cmd *cobra.Command, args []string) {
+	if inspectText == "" && inspectFile == "" {
+		if !stdinIsPiped() {
+			fmt.Fprintln(os.Stderr, "Error: Either --text or --file must be specified, or data piped to standard input")
+			os.Exit(1)
+		}
+		inspectFile = utils.Stdio
+	}
+
+	if inspectText != "" && inspectFile != "" {
+		fmt.Fprintln(os.Stderr, "Error: Cannot specify both --text and --file")
+		os.Exit(1)
+	}
+
+	var info *crypto.CiphertextInfo
+	var data []byte
+	var err error
+	if inspectText != "" && crypto.IsArmored([]byte(inspectText)) {
+		data, err = dearmor([]byte(inspectText))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else if inspectText != "" {
+		data, err = utils.Decode(inspectText, utils.EncodingAuto)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error decoding encrypted text: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		info, err = inspectFileHeader(inspectFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if info == nil {
+		info = crypto.InspectCiphertext(data)
+	}
+
+	if inspectJSON {
+		out, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(out))
+	} else {
+		printCiphertextInfo(info)
+	}
+	// A header that is there but cannot be read is damaged, which scripts need to see
+	if info.Error != "" {
+		os.Exit(1)
+	}
+}
+
+// inspectFileHeader inspects a file or standard input. Binary ciphertext is
+// inspected from its header and size alone, so large files are not loaded; only
+// armored or text-encoded output, which must be decoded first, is read whole.
+func inspectFileHeader(file string) (*crypto.CiphertextInfo, error) {
+	f, err := utils.OpenFile(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	size := int64(-1)
+	if file != utils.Stdio {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		size = info.Size()
+	}
+
+	r := bufio.NewReader(f)
+	peek, err := r.Peek(512)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !crypto.IsArmored(peek) && !isASCIIText(peek) {
+		return crypto.InspectCiphertextReader(r, size)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if crypto.IsArmored(data) {
+		if data, err = dearmor(data); err != nil {
+			return nil, err
+		}
+	} else if !crypto.IsEnvelope(data) {
+		if decoded, _, err := utils.DecodeAuto(string(data)); err == nil && crypto.IsEnvelope(decoded) {
+			data = decoded
+		}
+	}
+	return crypto.InspectCiphertext(data), nil
+}
+
+// isASCIIText reports whether data could be text-encoded output: printable ASCII
+// and whitespace only
+func isASCIIText(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	for _, b := range data {
+		if (b < 0x20 || b > 0x7e) && b != '\n' && b != '\r' && b != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+func printCiphertextInfo(info *crypto.CiphertextInfo) {
+	if info.Format == "legacy" {
+		fmt.Println("Format: legacy (no envelope header)")
+		fmt.Printf("Size: %d bytes\n", info.TotalSize)
+		if len(info.Candidates) == 0 {
+			fmt.Println("No legacy format matches this size; the data may be truncated or not encrypted")
+			return
+		}
+		fmt.Println("Possible formats (decrypt with --legacy -a <algorithm>):")
+		for _, candidate := range info.Candidates {
+			fmt.Printf("  - %s\n", candidate)
+		}
+		return
+	}
+
+	fmt.Printf("Format: envelope version %d\n", info.Version)
+	if info.Error != "" {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", info.Error)
+		fmt.Printf("Size: %d bytes\n", info.TotalSize)
+		return
+	}
+
+	fmt.Printf("Algorithm: %s\n", info.Algorithm)
+	if info.KeyID != "" {
+		fmt.Printf("Key ID: %s\n", info.KeyID)
+	}
+	if len(info.Flags) > 0 {
+		fmt.Printf("Flags: %s\n", strings.Join(info.Flags, ", "))
+	}
+	if info.KDF != nil {
+		fmt.Printf("KDF: %s\n", info.KDF.Algorithm)
+		fmt.Printf("  Salt: %d bytes\n", info.KDF.SaltSize)
+		switch info.KDF.Algorithm {
+		case "argon2id":
+			fmt.Printf("  Time: %d, Memory: %d KiB, Parallelism: %d\n", info.KDF.Iterations, info.KDF.MemoryKiB, info.KDF.Parallelism)
+		case "scrypt":
+			fmt.Printf("  N: %d, r: %d, p: %d\n", info.KDF.ScryptN, info.KDF.ScryptR, info.KDF.Parallelism)
+		default:
+			fmt.Printf("  Iterations: %d\n", info.KDF.Iterations)
+		}
+	}
+	if len(info.Recipients) > 0 {
+		fmt.Printf("Recipients: %d\n", len(info.Recipients))
+		for _, recipient := range info.Recipients {
+			fmt.Printf("  - %s %s\n", recipient.Type, recipient.KeyID)
+		}
+	}
+	if info.ChunkSize > 0 {
+		fmt.Printf("Streamed: %d byte chunks\n", info.ChunkSize)
+	}
+	if info.Compression != "" {
+		fmt.Printf("Compression: %s\n", info.Compression)
+	}
+	if info.Padding != "" {
+		fmt.Printf("Padding: %s\n", info.Padding)
+	}
+	if info.NotAfter != nil {
+		status := "valid"
+		if info.Expired {
+			status = "expired"
+		}
+		fmt.Printf("Not after: %s (%s)\n", info.NotAfter.Format(time.RFC3339), status)
+	}
+	if info.NonceSize > 0 {
+		fmt.Printf("Nonce: %d bytes\n", info.NonceSize)
+	}
+	fmt.Printf("Size: %d bytes (header %d, body %d)\n", info.TotalSize, info.HeaderSize, info.BodySize)
+}
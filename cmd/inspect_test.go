@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"thanhlv-encryption-decryption/pkg/crypto"
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+func TestInspectFileHeader(t *testing.T) {
+	key := []byte("inspect command test key")
+	var buf bytes.Buffer
+	w, err := crypto.NewEncryptWriter(&buf, key, &crypto.StreamOptions{ChunkSize: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(bytes.Repeat([]byte("inspect "), 10000))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	stream := buf.Bytes()
+
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"stream.enc":  stream,
+		"stream.asc":  crypto.Armor(stream, nil),
+		"stream.b64":  []byte(base64.StdEncoding.EncodeToString(stream) + "\n"),
+		"damaged.enc": stream[:20],
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"stream.enc", "stream.asc", "stream.b64"} {
+		info, err := inspectFileHeader(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if info.Format != "envelope" || info.ChunkSize != 4096 || info.TotalSize != len(stream) || info.Error != "" {
+			t.Errorf("%s: info = %+v", name, info)
+		}
+	}
+
+	info, err := inspectFileHeader(filepath.Join(dir, "damaged.enc"))
+	if err != nil || info.Error == "" {
+		t.Errorf("damaged header: info = %+v, %v", info, err)
+	}
+
+	withStdio(t, stream)
+	info, err = inspectFileHeader(utils.Stdio)
+	if err != nil || info.ChunkSize != 4096 || info.TotalSize != len(stream) {
+		t.Errorf("standard input: info = %+v, %v", info, err)
+	}
+
+	if _, err := inspectFileHeader(filepath.Join(dir, "missing.enc")); err == nil {
+		t.Error("a missing file was inspected")
+	}
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"thanhlv-encryption-decryption/pkg/crypto"
+)
+
+var (
+	encryptKDF            string
+	encryptKDFIterations  uint32
+	encryptKDFMemory      uint32
+	encryptKDFParallelism uint32
+	encryptScryptN        uint32
+)
+
+// kdfFlags are the cost flags that only apply to --passphrase mode
+var kdfFlags = []string{"kdf", "kdf-iterations", "kdf-memory", "kdf-parallelism", "scrypt-n"}
+
+func init() {
+	encryptCmd.Flags().StringVar(&encryptKDF, "kdf", "argon2id", "Passphrase key derivation function (argon2id, scrypt, pbkdf2)")
+	encryptCmd.Flags().Uint32Var(&encryptKDFIterations, "kdf-iterations", 0, "PBKDF2 iterations or Argon2id passes (default 600000 / 3)")
+	encryptCmd.Flags().Uint32Var(&encryptKDFMemory, "kdf-memory", 0, "Argon2id memory in KiB (default 65536)")
+	encryptCmd.Flags().Uint32Var(&encryptKDFParallelism, "kdf-parallelism", 0, "Argon2id lanes or scrypt p (default 4 / 1)")
+	encryptCmd.Flags().Uint32Var(&encryptScryptN, "scrypt-n", 0, "scrypt CPU/memory cost N, a power of two (default 32768)")
+}
+
+// newPassphraseProvider builds a PassphraseProvider from the --kdf flags
+func newPassphraseProvider() (*crypto.PassphraseProvider, error) {
+	algorithm, err := crypto.ParseKDFAlgorithm(encryptKDF)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := crypto.NewKDFParams(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	switch algorithm {
+	case crypto.KDFPBKDF2SHA256:
+		if encryptKDFMemory != 0 || encryptKDFParallelism != 0 || encryptScryptN != 0 {
+			return nil, fmt.Errorf("pbkdf2 only supports --kdf-iterations")
+		}
+	case crypto.KDFScrypt:
+		if encryptKDFIterations != 0 || encryptKDFMemory != 0 {
+			return nil, fmt.Errorf("scrypt only supports --scrypt-n and --kdf-parallelism")
+		}
+	case crypto.KDFArgon2id:
+		if encryptScryptN != 0 {
+			return nil, fmt.Errorf("--scrypt-n is only supported with --kdf scrypt")
+		}
+	}
+
+	if encryptKDFIterations != 0 {
+		params.Iterations = encryptKDFIterations
+	}
+	if encryptKDFMemory != 0 {
+		params.MemoryKiB = encryptKDFMemory
+	}
+	if encryptKDFParallelism != 0 {
+		params.Parallelism = encryptKDFParallelism
+	}
+	if encryptScryptN != 0 {
+		params.ScryptN = encryptScryptN
+	}
+
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	return &crypto.PassphraseProvider{Params: params}, nil
+}
+
+// kdfFlagsChanged reports whether any --kdf cost flag was set
+func kdfFlagsChanged(cmd *cobra.Command) bool {
+	for _, name := range kdfFlags {
+		if cmd.Flags().Changed(name) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,9 +1,9 @@
 package cmd
 
 import (
-	"encoding/base64"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"thanhlv-encryption-decryption/pkg/crypto"
@@ -22,71 +22,188 @@ var (
 	keygenPrivateFile string
 	keygenPublicFile  string
 	keygenBase64      bool
+	keygenPrompt      bool
+	keygenPassEnv     string
+	keygenKeyEncoding string
 )
 
 func init() {
-	keygenCmd.Flags().StringVarP(&keygenAlgorithm, "algorithm", "a", "aes-256-cbc", "Key generation algorithm (aes-256-cbc, rsa)")
-	keygenCmd.Flags().StringVarP(&keygenPrivateFile, "private", "p", "", "Private key output file (RSA only)")
-	keygenCmd.Flags().StringVarP(&keygenPublicFile, "public", "u", "", "Public key output file (RSA only)")
+	keygenCmd.Flags().StringVarP(&keygenAlgorithm, "algorithm", "a", "aes-256-cbc", "Key generation algorithm (aes-256-cbc, aes-256-gcm, rsa, hpke[-x25519|-p256], x25519, ecies, ff1, ff3-1)")
+	keygenCmd.Flags().StringVarP(&keygenPrivateFile, "private", "p", "", "Private key output file (key pairs only)")
+	keygenCmd.Flags().StringVarP(&keygenPublicFile, "public", "u", "", "Public key output file (key pairs only)")
 	keygenCmd.Flags().BoolVarP(&keygenBase64, "base64", "b", false, "Output key in base64 format")
+	keygenCmd.Flags().StringVar(&keygenKeyEncoding, "key-encoding", "", "Printed key encoding (base64, base64url, hex, base32); overrides --base64")
+	keygenCmd.Flags().BoolVar(&keygenPrompt, "prompt", false, "Encrypt the private key with a passphrase read from the terminal (key pairs only)")
+	keygenCmd.Flags().StringVar(&keygenPassEnv, "passphrase-env", "", "Encrypt the private key with the passphrase in this environment variable (key pairs only)")
 }
 
 func runKeygen(cmd *cobra.Command, args []string) {
-	switch keygenAlgorithm {
-	case "aes-256-cbc":
+	protect := keygenPrompt || keygenPassEnv != ""
+	if protect && (strings.HasPrefix(keygenAlgorithm, "aes-256-") || keygenAlgorithm == crypto.FPEModeFF1 || keygenAlgorithm == crypto.FPEModeFF31) {
+		fmt.Fprintln(os.Stderr, "Error: --prompt and --passphrase-env are only supported for key pairs")
+		os.Exit(1)
+	}
+
+	// Symmetric keys are printed in hex unless --base64 or --key-encoding says otherwise
+	keyEncoding := utils.EncodingHex
+	if keygenBase64 {
+		keyEncoding = utils.EncodingBase64
+	}
+	if keygenKeyEncoding != "" {
+		if err := utils.ValidateEncoding(keygenKeyEncoding, false); err != nil || keygenKeyEncoding == utils.EncodingRaw {
+			fmt.Fprintln(os.Stderr, "Error: --key-encoding must be base64, base64url, hex or base32")
+			os.Exit(1)
+		}
+		keyEncoding = keygenKeyEncoding
+	}
+
+	switch {
+	case keygenAlgorithm == "aes-256-cbc" || keygenAlgorithm == "aes-256-gcm":
 		provider := &crypto.AESProvider{}
 		key, err := provider.GenerateKey()
 		if err != nil {
-			fmt.Printf("Error generating AES key: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error generating AES key: %v\n", err)
 			os.Exit(1)
 		}
 
-		if keygenBase64 {
-			fmt.Printf("Generated AES-256-CBC key (base64): %s\n", base64.StdEncoding.EncodeToString(key))
-		} else {
-			fmt.Printf("Generated AES-256-CBC key (hex): %x\n", key)
+		label := strings.ToUpper(keygenAlgorithm)
+		fmt.Printf("Generated %s key (%s): %s\n", label, keyEncoding, mustEncode(key, keyEncoding))
+
+	case keygenAlgorithm == crypto.FPEModeFF1 || keygenAlgorithm == crypto.FPEModeFF31:
+		provider := &crypto.FPEProvider{Mode: keygenAlgorithm}
+		key, err := provider.GenerateKey()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating %s key: %v\n", keygenAlgorithm, err)
+			os.Exit(1)
 		}
 
-	case "rsa":
+		fmt.Printf("Generated %s AES-256 key (%s): %s\n", keygenAlgorithm, keyEncoding, mustEncode(key, keyEncoding))
+
+	case keygenAlgorithm == "rsa":
 		privateKey, publicKey, err := crypto.GenerateRSAKeyPair()
 		if err != nil {
-			fmt.Printf("Error generating RSA keys: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error generating RSA keys: %v\n", err)
 			os.Exit(1)
 		}
 
-		privateFile := keygenPrivateFile
-		if privateFile == "" {
-			privateFile = "private_key_rsa.pem"
+		writeKeyPair("RSA", privateKey, publicKey, "private_key_rsa.pem", "public_key_rsa.pem")
+
+	case keygenAlgorithm == "x25519" || keygenAlgorithm == "ecies":
+		// Recipient keys for multi-recipient encryption; ecies keys are P-256
+		suite := crypto.HPKESuite{KEM: crypto.KEMX25519HKDFSHA256, KDF: crypto.KDFHKDFSHA256, AEAD: crypto.AEADAES128GCM}
+		if keygenAlgorithm == "ecies" {
+			suite.KEM = crypto.KEMP256HKDFSHA256
 		}
 
-		publicFile := keygenPublicFile
-		if publicFile == "" {
-			publicFile = "public_key_rsa.pem"
+		privateKey, publicKey, err := crypto.GenerateHPKEKeyPair(suite)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating %s keys: %v\n", keygenAlgorithm, err)
+			os.Exit(1)
 		}
 
-		err = utils.WriteFile(privateFile, privateKey)
+		writeKeyPair(strings.ToUpper(keygenAlgorithm), privateKey, publicKey,
+			"private_key_"+keygenAlgorithm+".pem", "public_key_"+keygenAlgorithm+".pem")
+
+	case strings.HasPrefix(keygenAlgorithm, "hpke"):
+		suite, err := crypto.ParseHPKESuite(keygenAlgorithm)
 		if err != nil {
-			fmt.Printf("Error writing private key: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
 
-		err = utils.WriteFile(publicFile, publicKey)
+		privateKey, publicKey, err := crypto.GenerateHPKEKeyPair(suite)
 		if err != nil {
-			fmt.Printf("Error writing public key: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error generating HPKE keys: %v\n", err)
 			os.Exit(1)
 		}
 
-		fmt.Printf("RSA key pair generated:\n")
-		fmt.Printf("Private key: %s\n", privateFile)
-		fmt.Printf("Public key: %s\n", publicFile)
+		writeKeyPair("HPKE", privateKey, publicKey, "private_key_hpke.pem", "public_key_hpke.pem")
+
+	default:
+		fmt.Fprintf(os.Stderr, "Unsupported algorithm: %s\n", keygenAlgorithm)
+		os.Exit(1)
+	}
+}
+
+// writeKeyPair writes a PEM key pair to the --private/--public files (or the given defaults).
+// With --prompt or --passphrase-env the private key is written passphrase-encrypted;
+// "decrypt --prompt" recovers the PEM.
+func writeKeyPair(label string, privateKey, publicKey []byte, defaultPrivateFile, defaultPublicFile string) {
+	privateFile := keygenPrivateFile
+	if privateFile == "" {
+		privateFile = defaultPrivateFile
+	}
+
+	publicFile := keygenPublicFile
+	if publicFile == "" {
+		publicFile = defaultPublicFile
+	}
 
-		if keygenBase64 {
-			fmt.Printf("\nPrivate key (base64): %s\n", base64.StdEncoding.EncodeToString(privateKey))
-			fmt.Printf("Public key (base64): %s\n", base64.StdEncoding.EncodeToString(publicKey))
+	protected := keygenPrompt || keygenPassEnv != ""
+	if protected {
+		var passphrase []byte
+		var err error
+		// An environment passphrase wins, so --prompt can stay in scripts without a terminal
+		if keygenPassEnv != "" {
+			passphrase, err = readPassphrase("", keygenPassEnv)
+		} else {
+			passphrase, err = promptSecret("Private key passphrase", true)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := checkPassphrase(passphrase, false); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
 		}
 
-	default:
-		fmt.Printf("Unsupported algorithm: %s\n", keygenAlgorithm)
+		privateKey, err = (&crypto.PassphraseProvider{}).Encrypt(privateKey, passphrase)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encrypting private key: %v\n", err)
+			os.Exit(1)
+		}
+		if keygenPrivateFile == "" {
+			privateFile += ".encrypted"
+		}
+	}
+
+	err := utils.WriteFile(privateFile, privateKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing private key: %v\n", err)
 		os.Exit(1)
 	}
-}
\ No newline at end of file
+
+	err = utils.WriteFile(publicFile, publicKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing public key: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s key pair generated:\n", label)
+	if protected {
+		fmt.Fprintf(os.Stderr, "Private key (passphrase encrypted): %s\n", privateFile)
+	} else {
+		fmt.Fprintf(os.Stderr, "Private key: %s\n", privateFile)
+	}
+	fmt.Fprintf(os.Stderr, "Public key: %s\n", publicFile)
+
+	if keygenBase64 || keygenKeyEncoding != "" {
+		encoding := keygenKeyEncoding
+		if encoding == "" {
+			encoding = utils.EncodingBase64
+		}
+		fmt.Printf("\nPrivate key (%s): %s\n", encoding, mustEncode(privateKey, encoding))
+		fmt.Printf("Public key (%s): %s\n", encoding, mustEncode(publicKey, encoding))
+	}
+}
+
+// mustEncode encodes a key in an encoding already checked by runKeygen
+func mustEncode(key []byte, encoding string) string {
+	encoded, err := utils.Encode(key, encoding)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return encoded
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+// readKey resolves the --key/--key-env pair used by the commands and decodes the
+// key with the --key-encoding of the command
+func readKey(key, keyEnv, encoding string) ([]byte, error) {
+	if err := utils.ValidateEncoding(encoding, true); err != nil {
+		return nil, fmt.Errorf("--key-encoding: %w", err)
+	}
+	if key == "" && keyEnv == "" {
+		return nil, fmt.Errorf("either --key or --key-env must be specified")
+	}
+
+	if key != "" && keyEnv != "" {
+		return nil, fmt.Errorf("cannot specify both --key and --key-env")
+	}
+
+	keyValue := key
+	if keyEnv != "" {
+		keyValue = os.Getenv(keyEnv)
+		if keyValue == "" {
+			return nil, fmt.Errorf("environment variable '%s' is not set or empty", keyEnv)
+		}
+		utils.DebugLogf("Using key from environment variable: %s", keyEnv)
+	}
+
+	keyBytes, err := utils.Decode(keyValue, encoding)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding key: %w", err)
+	}
+	return keyBytes, nil
+}
+
+// readPassphrase resolves the --passphrase/--passphrase-env pair. The passphrase is
+// used as typed, not base64 decoded.
+func readPassphrase(passphrase, passphraseEnv string) ([]byte, error) {
+	if passphrase != "" && passphraseEnv != "" {
+		return nil, fmt.Errorf("cannot specify both --passphrase and --passphrase-env")
+	}
+
+	if passphraseEnv != "" {
+		passphrase = os.Getenv(passphraseEnv)
+		if passphrase == "" {
+			return nil, fmt.Errorf("environment variable '%s' is not set or empty", passphraseEnv)
+		}
+		utils.DebugLogf("Using passphrase from environment variable: %s", passphraseEnv)
+	}
+	return []byte(passphrase), nil
+}
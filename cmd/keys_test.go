@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"thanhlv-encryption-decryption/pkg/crypto"
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+// hexLookingKey is valid base64 and valid hex, decoding to different bytes
+const hexLookingKey = "deadbeefdeadbeef"
+
+func TestKeyEncodingDefaultsToBase64(t *testing.T) {
+	want, err := base64.StdEncoding.DecodeString(hexLookingKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auto, _ := utils.Decode(hexLookingKey, utils.EncodingAuto); bytes.Equal(auto, want) {
+		t.Fatalf("%s should be detected as hex", hexLookingKey)
+	}
+
+	for _, cmd := range []string{"encrypt", "decrypt"} {
+		flags := encryptCmd.Flags()
+		if cmd == "decrypt" {
+			flags = decryptCmd.Flags()
+		}
+		encoding := flags.Lookup("key-encoding").DefValue
+		got, err := utils.Decode(hexLookingKey, encoding)
+		if err != nil {
+			t.Fatalf("%s: %v", cmd, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s --key-encoding defaults to %s, which decodes %s to %x, want %x", cmd, encoding, hexLookingKey, got, want)
+		}
+	}
+
+	t.Setenv("TEST_HEX_LOOKING_KEY", hexLookingKey)
+	got, err := readKey("", "TEST_HEX_LOOKING_KEY", utils.EncodingBase64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("readKey decoded %s to %x, want %x", hexLookingKey, got, want)
+	}
+}
+
+// A CBC ciphertext written before --key-encoding existed, with a key that also
+// parses as hex, still decrypts with the default key encoding
+func TestKeyEncodingDecryptsBaselineCiphertext(t *testing.T) {
+	baselineKey, _ := base64.StdEncoding.DecodeString(hexLookingKey)
+	plaintext := []byte("written by an older release")
+	ciphertext, err := (&crypto.AESProvider{}).Encrypt(plaintext, baselineKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := utils.Decode(hexLookingKey, decryptCmd.Flags().Lookup("key-encoding").DefValue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := (&crypto.AESProvider{}).Decrypt(ciphertext, key)
+	if err != nil {
+		t.Fatalf("decrypt with the default key encoding: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("got %q, want %q", got, plaintext)
+	}
+}
+
+func TestReadKeyEncoding(t *testing.T) {
+	want, _ := hex.DecodeString(hexLookingKey)
+	got, err := readKey(hexLookingKey, "", utils.EncodingHex)
+	if err != nil || !bytes.Equal(got, want) {
+		t.Errorf("readKey with hex = %x, %v, want %x", got, err, want)
+	}
+	if _, err := readKey(hexLookingKey, "", "base58"); err == nil {
+		t.Error("readKey accepted an unknown key encoding")
+	}
+
+	// Every command reading its key with readKey has --key-encoding, defaulting to base64
+	for _, cmd := range []*cobra.Command{deriveCmd, blindIndexCmd, splitCmd, upgradeCmd, logCatCmd, logRepairCmd} {
+		flag := cmd.Flags().Lookup("key-encoding")
+		if flag == nil || flag.DefValue != utils.EncodingBase64 {
+			t.Errorf("%s: --key-encoding = %+v, want a flag defaulting to base64", cmd.CommandPath(), flag)
+		}
+	}
+}
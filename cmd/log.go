@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"thanhlv-encryption-decryption/pkg/crypto"
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+var logCmd = &cobra.Command{
+	Use:   "log",
+	Short: "Read append-only encrypted record logs",
+	Long: `Encrypted logs are written by programs through crypto.LogWriter: each record is
+encrypted and authenticated on its own and chained to the one before it, so removed,
+reordered or changed records are detected.`,
+}
+
+var logCatCmd = &cobra.Command{
+	Use:   "cat [log files...]",
+	Short: "Decrypt and print the records of encrypted logs",
+	Long: `Decrypt the records of each log in order and print them one per line. Reading stops
+with an error at the first record that fails authentication or breaks the chain, and
+at an incomplete last record; the records before it are printed.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runLogCat,
+}
+
+var logRepairCmd = &cobra.Command{
+	Use:   "repair [log files...]",
+	Short: "Remove the incomplete record an interrupted append left at the end of encrypted logs",
+	Long: `Check every record of each log and remove an incomplete last record, left by a
+crash during an append, so that writers can open the log again. Records that fail
+authentication or break the chain are reported and never removed.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runLogRepair,
+}
+
+var (
+	logKey         string
+	logKeyEnv      string
+	logKeyEncoding string
+	logJSON        bool
+	logHead        bool
+)
+
+func init() {
+	logCatCmd.Flags().StringVarP(&logKey, "key", "k", "", "Key of the log (base64 encoded)")
+	logCatCmd.Flags().StringVarP(&logKeyEnv, "key-env", "e", "", "Environment variable name containing the key (base64 encoded)")
+	logCatCmd.Flags().StringVar(&logKeyEncoding, "key-encoding", utils.EncodingBase64, "Encoding of --key and --key-env (base64, base64url, hex, base32, raw, or auto to detect it)")
+	logCatCmd.Flags().BoolVar(&logJSON, "json", false, "Print one JSON object per record with its number")
+	logCatCmd.Flags().BoolVar(&logHead, "head", false, "Print the record count and chain head of each log on stderr, to compare with a saved head")
+	logRepairCmd.Flags().StringVarP(&logKey, "key", "k", "", "Key of the log (base64 encoded)")
+	logRepairCmd.Flags().StringVarP(&logKeyEnv, "key-env", "e", "", "Environment variable name containing the key (base64 encoded)")
+	logRepairCmd.Flags().StringVar(&logKeyEncoding, "key-encoding", utils.EncodingBase64, "Encoding of --key and --key-env (base64, base64url, hex, base32, raw, or auto to detect it)")
+	logCmd.AddCommand(logCatCmd)
+	logCmd.AddCommand(logRepairCmd)
+}
+
+// logRecord is one line of log cat --json
+type logRecord struct {
+	Log    string `json:"log"`
+	Seq    uint64 `json:"seq"`
+	Record string `json:"record"`
+}
+
+func runLogCat(cmd *cobra.Command, args []string) {
+	keyBytes, err := readKey(logKey, logKeyEnv, logKeyEncoding)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	for _, file := range args {
+		if err := catLog(out, file, keyBytes); err != nil {
+			out.Flush()
+			if errors.Is(err, crypto.ErrLogTruncated) {
+				err = fmt.Errorf("%w (an append was interrupted; log repair removes it)", err)
+			}
+			fmt.Fprintf(os.Stderr, "Error reading log %s: %v\n", file, err)
+			os.Exit(1)
+		}
+	}
+}
+
+func catLog(out *bufio.Writer, file string, key []byte) error {
+	in, err := utils.OpenFile(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	r, err := crypto.NewLogReader(in, key)
+	if err != nil {
+		return err
+	}
+	for {
+		seq := r.Count()
+		record, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if logJSON {
+			line, err := json.Marshal(logRecord{Log: file, Seq: seq, Record: string(record)})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "%s\n", line)
+		} else {
+			fmt.Fprintf(out, "%s\n", record)
+		}
+	}
+	utils.DebugLogf("Read %d records from %s", r.Count(), file)
+	if logHead {
+		out.Flush()
+		fmt.Fprintf(os.Stderr, "%s: %d records, head %s\n", file, r.Count(), hex.EncodeToString(r.Head()))
+	}
+	return nil
+}
+
+func runLogRepair(cmd *cobra.Command, args []string) {
+	keyBytes, err := readKey(logKey, logKeyEnv, logKeyEncoding)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, file := range args {
+		dropped, err := crypto.RepairLog(file, keyBytes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error repairing log %s: %v\n", file, err)
+			os.Exit(1)
+		}
+		if dropped > 0 {
+			fmt.Printf("%s: removed %d bytes of an incomplete record\n", file, dropped)
+		} else {
+			fmt.Printf("%s: no incomplete record\n", file)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+	"thanhlv-encryption-decryption/pkg/crypto"
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+var passphraseCmd = &cobra.Command{
+	Use:   "passphrase",
+	Short: "Generate passphrases or check their strength",
+	Long: `Generate diceware-style passphrases from an embedded 2048-word list (11 bits per word),
+or estimate the strength of an existing passphrase with --check. Without a value (or with -),
+--check reads the passphrase from standard input when it is piped, or else prompts for it.`,
+	Args: cobra.NoArgs,
+	Run:  runPassphrase,
+}
+
+var (
+	passphraseWords     int
+	passphraseSeparator string
+	passphraseCheck     string
+	passphraseOutput    string
+)
+
+func init() {
+	passphraseCmd.Flags().IntVarP(&passphraseWords, "words", "w", crypto.DefaultPassphraseWords, "Number of words")
+	passphraseCmd.Flags().StringVar(&passphraseSeparator, "separator", "-", "Separator between words")
+	passphraseCmd.Flags().StringVar(&passphraseCheck, "check", "", "Estimate the strength of a passphrase instead of generating one (no value or - to read it from standard input or a prompt)")
+	passphraseCmd.Flags().Lookup("check").NoOptDefVal = utils.Stdio
+	passphraseCmd.Flags().StringVarP(&passphraseOutput, "output", "o", "", "Output file (optional, - for standard output)")
+}
+
+func runPassphrase(cmd *cobra.Command, args []string) {
+	if passphraseCheck != "" {
+		passphrase, err := readCheckPassphrase(passphraseCheck)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		strength := crypto.EstimatePassphraseStrength(string(passphrase))
+		fmt.Printf("Strength: %s (about %.0f bits)\n", strength.Rating(), strength.Entropy)
+		for _, warning := range strength.Warnings {
+			fmt.Printf("  - %s\n", warning)
+		}
+		return
+	}
+
+	passphrase, err := crypto.GeneratePassphrase(passphraseWords, passphraseSeparator)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating passphrase: %v\n", err)
+		os.Exit(1)
+	}
+
+	if passphraseOutput != "" {
+		err = utils.WriteFile(passphraseOutput, []byte(passphrase))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing to output file: %v\n", err)
+			os.Exit(1)
+		}
+		reportOutput(passphraseOutput, "Passphrase written to: %s\n", passphraseOutput)
+		reportOutput(passphraseOutput, "Entropy: %.0f bits\n", crypto.GeneratedPassphraseEntropy(passphraseWords))
+		return
+	}
+	fmt.Printf("Passphrase: %s\n", passphrase)
+	fmt.Printf("Entropy: %.0f bits\n", crypto.GeneratedPassphraseEntropy(passphraseWords))
+}
+
+// readCheckPassphrase returns the passphrase given to --check, reading it from piped
+// standard input or the terminal for -
+func readCheckPassphrase(value string) ([]byte, error) {
+	if value != utils.Stdio {
+		fmt.Fprintln(os.Stderr, "Warning: a passphrase on the command line is visible in shell history and ps output; use --check without a value to type it")
+		return []byte(value), nil
+	}
+
+	if !stdinIsPiped() {
+		return promptSecret("Passphrase to check", false)
+	}
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase from standard input: %w", err)
+	}
+	passphrase := bytes.TrimSuffix(bytes.TrimSuffix(data, []byte("\n")), []byte("\r"))
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("no passphrase on standard input")
+	}
+	return passphrase, nil
+}
+
+// checkPassphrase warns about a weak passphrase on stderr, or fails when reject is set
+func checkPassphrase(passphrase []byte, reject bool) error {
+	strength := crypto.EstimatePassphraseStrength(string(passphrase))
+	if !strength.Weak() {
+		return nil
+	}
+
+	message := fmt.Sprintf("passphrase is %s (about %.0f bits)", strength.Rating(), strength.Entropy)
+	if len(strength.Warnings) > 0 {
+		message += ": " + strings.Join(strength.Warnings, ", ")
+	}
+	if reject {
+		return fmt.Errorf("%s; generate one with 'thanhlv-ed passphrase'", message)
+	}
+	fmt.Fprintf(os.Stderr, "Warning: %s\n", message)
+	return nil
+}
+
+// isPrintableText reports whether key looks like typed text rather than random bytes
+func isPrintableText(key []byte) bool {
+	if len(key) == 0 || !utf8.Valid(key) {
+		return false
+	}
+	for _, r := range string(key) {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+func TestCheckFlagWithoutValue(t *testing.T) {
+	saved := passphraseCheck
+	t.Cleanup(func() { passphraseCheck = saved })
+
+	if err := passphraseCmd.Flags().Parse([]string{"--check"}); err != nil {
+		t.Fatal(err)
+	}
+	if passphraseCheck != utils.Stdio {
+		t.Errorf("--check without a value = %q, want %q", passphraseCheck, utils.Stdio)
+	}
+}
+
+func TestReadCheckPassphrase(t *testing.T) {
+	for _, input := range []string{"correct horse\n", "correct horse\r\n", "correct horse"} {
+		withStdio(t, []byte(input))
+		got, err := readCheckPassphrase(utils.Stdio)
+		if err != nil || string(got) != "correct horse" {
+			t.Errorf("input %q: read %q, %v", input, got, err)
+		}
+	}
+
+	withStdio(t, []byte("\n"))
+	if _, err := readCheckPassphrase(utils.Stdio); err == nil {
+		t.Error("an empty passphrase was read from standard input")
+	}
+
+	_, stderr := withStdio(t, nil)
+	got, err := readCheckPassphrase("on the command line")
+	if err != nil || string(got) != "on the command line" {
+		t.Errorf("read %q, %v", got, err)
+	}
+	if !strings.Contains(string(stderr()), "shell history") {
+		t.Errorf("no warning about a passphrase on the command line: %q", stderr())
+	}
+}
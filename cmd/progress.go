@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+	"thanhlv-encryption-decryption/pkg/crypto"
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+// Values of --progress
+const (
+	progressAuto = "auto"
+	progressJSON = "json"
+	progressOff  = "off"
+)
+
+const progressBarWidth = 30
+
+func validateProgress(mode string) error {
+	switch mode {
+	case progressAuto, progressJSON, progressOff:
+		return nil
+	}
+	return fmt.Errorf("invalid --progress %q (auto, json, off)", mode)
+}
+
+// progress reports how far an operation has got on stderr, as a bar redrawn in
+// place on a terminal or as JSON lines for --progress json. A nil *progress
+// reports nothing, so callers need not check whether progress is enabled.
+type progress struct {
+	operation string
+	name      string
+	// total is the number of bytes to process, or -1 when unknown (pipes)
+	total int64
+	json  bool
+
+	start time.Time
+	last  time.Time
+	done  int64
+	drawn bool
+}
+
+// progressEvent is one line of --progress json
+type progressEvent struct {
+	Operation      string  `json:"operation"`
+	File           string  `json:"file,omitempty"`
+	Bytes          int64   `json:"bytes"`
+	Total          int64   `json:"total,omitempty"`
+	Percent        float64 `json:"percent,omitempty"`
+	BytesPerSecond int64   `json:"bytes_per_second"`
+	ETASeconds     float64 `json:"eta_seconds,omitempty"`
+	Done           bool    `json:"done,omitempty"`
+}
+
+// newProgress returns the reporter for mode, or nil when there is nothing to show:
+// with --progress off, or with auto when stderr is not a terminal
+func newProgress(mode, operation, name string, total int64) *progress {
+	switch mode {
+	case progressJSON:
+	case progressAuto:
+		if !term.IsTerminal(int(os.Stderr.Fd())) {
+			return nil
+		}
+	default:
+		return nil
+	}
+	now := time.Now()
+	return &progress{operation: operation, name: name, total: total, json: mode == progressJSON, start: now, last: now}
+}
+
+// progressName is the name of a file in progress output
+func progressName(file string) string {
+	if file == utils.Stdio {
+		return "stdin"
+	}
+	return filepath.Base(file)
+}
+
+// reader returns r, counting what is read from it as progress
+func (p *progress) reader(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	return crypto.NewProgressReader(r, p.update)
+}
+
+// update records that done bytes have been processed, redrawing at most ten times
+// a second on a terminal and writing at most one JSON line a second
+func (p *progress) update(done int64) {
+	if p == nil {
+		return
+	}
+	p.done = done
+	interval := 100 * time.Millisecond
+	if p.json {
+		interval = time.Second
+	}
+	if now := time.Now(); now.Sub(p.last) >= interval {
+		p.last = now
+		p.report(false)
+	}
+}
+
+// finish reports the final state and ends the bar's line
+func (p *progress) finish() {
+	if p == nil {
+		return
+	}
+	p.report(true)
+	if !p.json {
+		fmt.Fprintln(os.Stderr)
+		p.drawn = false
+	}
+}
+
+// clear removes the bar so a status line can be printed, it is redrawn on the next update
+func (p *progress) clear() {
+	if p == nil || p.json || !p.drawn {
+		return
+	}
+	fmt.Fprint(os.Stderr, "\r\033[K")
+	p.drawn = false
+}
+
+func (p *progress) report(done bool) {
+	event := progressEvent{Operation: p.operation, File: p.name, Bytes: p.done, Done: done}
+	if elapsed := time.Since(p.start).Seconds(); elapsed > 0 {
+		event.BytesPerSecond = int64(float64(p.done) / elapsed)
+	}
+	if p.total > 0 {
+		event.Total = p.total
+		event.Percent = min(100, float64(p.done)*100/float64(p.total))
+		if event.BytesPerSecond > 0 && p.done < p.total {
+			event.ETASeconds = float64(p.total-p.done) / float64(event.BytesPerSecond)
+		}
+	} else if p.total == 0 {
+		event.Percent = 100
+	}
+
+	if p.json {
+		line, _ := json.Marshal(event)
+		fmt.Fprintf(os.Stderr, "%s\n", line)
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\r%s ", p.operation)
+	if p.name != "" {
+		fmt.Fprintf(&b, "%s ", p.name)
+	}
+	if p.total >= 0 {
+		filled := int(event.Percent) * progressBarWidth / 100
+		bar := strings.Repeat("=", filled)
+		if filled < progressBarWidth {
+			bar += ">" + strings.Repeat(" ", progressBarWidth-filled-1)
+		}
+		fmt.Fprintf(&b, "[%s] %3.0f%%  %s/%s", bar, event.Percent, formatBytes(p.done), formatBytes(p.total))
+	} else {
+		b.WriteString(formatBytes(p.done))
+	}
+	fmt.Fprintf(&b, "  %s/s", formatBytes(event.BytesPerSecond))
+	if event.ETASeconds > 0 {
+		fmt.Fprintf(&b, "  ETA %s", (time.Duration(event.ETASeconds) * time.Second).String())
+	}
+	b.WriteString("\033[K")
+	fmt.Fprint(os.Stderr, b.String())
+	p.drawn = true
+}
+
+// formatBytes prints n with a binary unit, e.g. 1.5 GiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, exp := float64(n)/unit, 0
+	for value >= unit && exp < 4 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGTP"[exp])
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"thanhlv-encryption-decryption/pkg/crypto"
+)
+
+func TestValidateProgress(t *testing.T) {
+	for _, mode := range []string{progressAuto, progressJSON, progressOff} {
+		if err := validateProgress(mode); err != nil {
+			t.Errorf("validateProgress(%q) = %v", mode, err)
+		}
+	}
+	for _, mode := range []string{"", "on", "JSON", "bar"} {
+		if err := validateProgress(mode); err == nil {
+			t.Errorf("validateProgress(%q) succeeded", mode)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for _, tt := range []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{1 << 20, "1.0 MiB"},
+		{5 << 30, "5.0 GiB"},
+		{1 << 50, "1.0 PiB"},
+		{1 << 60, "1024.0 PiB"},
+	} {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+// progressEvents parses the --progress json lines written on stderr
+func progressEvents(t *testing.T, stderr []byte) []progressEvent {
+	t.Helper()
+	var events []progressEvent
+	for _, line := range strings.Split(strings.TrimSpace(string(stderr)), "\n") {
+		var e progressEvent
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("progress line %q: %v", line, err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestProgressJSON(t *testing.T) {
+	_, stderr := withStdio(t, nil)
+	if newProgress(progressOff, "encrypt", "x", 10) != nil || newProgress(progressAuto, "encrypt", "x", 10) != nil {
+		t.Error("progress shown with --progress off, or auto without a terminal")
+	}
+	// A nil reporter does nothing
+	var none *progress
+	none.update(1)
+	none.finish()
+	if len(stderr()) != 0 {
+		t.Fatalf("disabled progress wrote %q", stderr())
+	}
+
+	bar := newProgress(progressJSON, "encrypt", "report.pdf", 2048)
+	bar.update(1024)
+	bar.finish()
+	events := progressEvents(t, stderr())
+	last := events[len(events)-1]
+	want := progressEvent{Operation: "encrypt", File: "report.pdf", Bytes: 1024, Total: 2048, Percent: 50, BytesPerSecond: last.BytesPerSecond, ETASeconds: last.ETASeconds, Done: true}
+	if last != want {
+		t.Errorf("last event = %+v, want %+v", last, want)
+	}
+}
+
+func TestEncryptFileStreamProgressJSON(t *testing.T) {
+	saved := encryptProgress
+	encryptProgress = progressJSON
+	t.Cleanup(func() { encryptProgress = saved })
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.bin")
+	content := bytes.Repeat([]byte("progress "), 5000)
+	if err := os.WriteFile(input, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, stderr := withStdio(t, nil)
+	if err := encryptFileStream(input, filepath.Join(dir, "output.enc"), []byte("progress test key"), &crypto.StreamOptions{ChunkSize: 4096}); err != nil {
+		t.Fatal(err)
+	}
+
+	events := progressEvents(t, stderr())
+	last := events[len(events)-1]
+	if !last.Done || last.Bytes != int64(len(content)) || last.Total != int64(len(content)) || last.Percent != 100 || last.File != "input.bin" {
+		t.Errorf("last event = %+v, want all %d bytes done", last, len(content))
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].Bytes < events[i-1].Bytes {
+			t.Errorf("progress went back from %d to %d", events[i-1].Bytes, events[i].Bytes)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// errNoTTY is returned by promptSecret when no terminal is attached, for example in CI
+var errNoTTY = errors.New("--prompt needs a terminal and none is attached; use --passphrase-env or --key-env instead")
+
+// openPromptTTY opens the terminal promptSecret reads from; tests replace it
+var openPromptTTY = openTTY
+
+// promptSecret reads a secret from the controlling terminal with echo disabled.
+// Reading the terminal directly keeps the secret out of shell history, ps output
+// and redirected stdin. With confirm set the secret is asked for twice.
+func promptSecret(label string, confirm bool) ([]byte, error) {
+	tty, err := openPromptTTY()
+	if err != nil {
+		return nil, errNoTTY
+	}
+	defer tty.Close()
+
+	if !term.IsTerminal(int(tty.in.Fd())) {
+		return nil, errNoTTY
+	}
+
+	secret, err := readHidden(tty, label+": ")
+	if err != nil {
+		return nil, err
+	}
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("empty passphrase")
+	}
+
+	if confirm {
+		again, err := readHidden(tty, "Confirm "+strings.ToLower(label)+": ")
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(secret, again) {
+			return nil, fmt.Errorf("passphrases do not match")
+		}
+	}
+	return secret, nil
+}
+
+func readHidden(tty *ttyFiles, prompt string) ([]byte, error) {
+	fmt.Fprint(tty.out, prompt)
+	secret, err := term.ReadPassword(int(tty.in.Fd()))
+	// The newline typed by the user is not echoed either
+	fmt.Fprintln(tty.out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from terminal: %w", err)
+	}
+	return secret, nil
+}
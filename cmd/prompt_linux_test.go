@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// openTestPTY opens a pseudo-terminal and returns its master and slave ends
+func openTestPTY(t *testing.T) (*os.File, *os.File) {
+	t.Helper()
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("no pseudo-terminal: %v", err)
+	}
+	t.Cleanup(func() { master.Close() })
+	if err := unix.IoctlSetPointerInt(int(master.Fd()), unix.TIOCSPTLCK, 0); err != nil {
+		t.Skipf("cannot unlock pseudo-terminal: %v", err)
+	}
+	n, err := unix.IoctlGetInt(int(master.Fd()), unix.TIOCGPTN)
+	if err != nil {
+		t.Skipf("cannot find pseudo-terminal: %v", err)
+	}
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("cannot open pseudo-terminal: %v", err)
+	}
+	return master, slave
+}
+
+// withPromptTTY makes promptSecret read from open for the rest of the test
+func withPromptTTY(t *testing.T, open func() (*ttyFiles, error)) {
+	t.Helper()
+	saved := openPromptTTY
+	openPromptTTY = open
+	t.Cleanup(func() { openPromptTTY = saved })
+}
+
+// promptWithInput runs promptSecret on a pseudo-terminal that the user types input
+// into, and returns what was shown on the terminal
+func promptWithInput(t *testing.T, input string, confirm bool) ([]byte, string, error) {
+	t.Helper()
+	master, slave := openTestPTY(t)
+	withPromptTTY(t, func() (*ttyFiles, error) { return &ttyFiles{in: slave, out: slave}, nil })
+	// The input is typed ahead, before promptSecret turns echo off, so turn it off
+	// here as a user typing at the prompt would see it
+	termios, err := unix.IoctlGetTermios(int(slave.Fd()), unix.TCGETS)
+	if err != nil {
+		t.Skipf("cannot read terminal settings: %v", err)
+	}
+	termios.Lflag &^= unix.ECHO
+	if err := unix.IoctlSetTermios(int(slave.Fd()), unix.TCSETS, termios); err != nil {
+		t.Skipf("cannot change terminal settings: %v", err)
+	}
+	if _, err := master.WriteString(input); err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := promptSecret("Passphrase", confirm)
+	// Closing the slave end makes the master read everything shown, then fail
+	slave.Close()
+	shown, _ := io.ReadAll(master)
+	return secret, string(shown), err
+}
+
+func TestPromptSecret(t *testing.T) {
+	secret, shown, err := promptWithInput(t, "hunter2\n", false)
+	if err != nil || string(secret) != "hunter2" {
+		t.Fatalf("promptSecret = %q, %v", secret, err)
+	}
+	if !strings.Contains(shown, "Passphrase: ") || strings.Contains(shown, "Confirm") || strings.Contains(shown, "hunter2") {
+		t.Errorf("terminal showed %q", shown)
+	}
+
+	secret, shown, err = promptWithInput(t, "hunter2\nhunter2\n", true)
+	if err != nil || string(secret) != "hunter2" {
+		t.Fatalf("promptSecret with confirmation = %q, %v", secret, err)
+	}
+	if !strings.Contains(shown, "Confirm passphrase: ") {
+		t.Errorf("terminal showed %q", shown)
+	}
+}
+
+func TestPromptSecretRejects(t *testing.T) {
+	if _, _, err := promptWithInput(t, "hunter2\nhunter3\n", true); err == nil || !strings.Contains(err.Error(), "do not match") {
+		t.Errorf("mismatched confirmation: error = %v", err)
+	}
+	if _, _, err := promptWithInput(t, "\n", false); err == nil || !strings.Contains(err.Error(), "empty") {
+		t.Errorf("empty passphrase: error = %v", err)
+	}
+}
+
+func TestPromptSecretNoTerminal(t *testing.T) {
+	withPromptTTY(t, func() (*ttyFiles, error) { return nil, errors.New("no controlling terminal") })
+	if _, err := promptSecret("Passphrase", false); !errors.Is(err, errNoTTY) {
+		t.Errorf("without a terminal: error = %v, want errNoTTY", err)
+	}
+
+	// A file that is not a terminal is refused rather than read in the clear
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.WriteString("hunter2\n")
+	withPromptTTY(t, func() (*ttyFiles, error) { return &ttyFiles{in: r, out: w}, nil })
+	if _, err := promptSecret("Passphrase", false); !errors.Is(err, errNoTTY) {
+		t.Errorf("from a pipe: error = %v, want errNoTTY", err)
+	}
+}
+
+func TestStdinIsPipedTerminal(t *testing.T) {
+	_, slave := openTestPTY(t)
+	saved := os.Stdin
+	os.Stdin = slave
+	t.Cleanup(func() { os.Stdin = saved })
+	if stdinIsPiped() {
+		t.Error("a terminal on standard input is reported as piped")
+	}
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"thanhlv-encryption-decryption/pkg/crypto"
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+// newMultiRecipientProvider parses the --recipient values, each either a PEM file path
+// or a base64 encoded public key
+func newMultiRecipientProvider(values []string) (*crypto.MultiRecipientProvider, error) {
+	provider := &crypto.MultiRecipientProvider{}
+	for i, value := range values {
+		var keyBytes []byte
+		var err error
+		if utils.FileExists(value) {
+			keyBytes, err = utils.ReadFile(value)
+		} else {
+			keyBytes, err = base64.StdEncoding.DecodeString(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("recipient %d: %w", i+1, err)
+		}
+
+		recipient, err := crypto.ParseRecipient(keyBytes)
+		if err != nil {
+			return nil, fmt.Errorf("recipient %d: %w", i+1, err)
+		}
+		utils.DebugLogf("Adding %s recipient %x", recipient.Type, recipient.KeyID)
+		provider.Recipients = append(provider.Recipients, recipient)
+	}
+	return provider, nil
+}
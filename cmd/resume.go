@@ -0,0 +1,350 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"thanhlv-encryption-decryption/pkg/crypto"
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+// With --resume the output is written to OUTPUT.partial, which is synced every few
+// seconds before OUTPUT.checkpoint records how much of it is on disk. A run
+// interrupted for any reason continues from the checkpoint when repeated with
+// --resume, after checking that the input is the same file, unchanged, and that the
+// last chunk on disk matches it. The checkpoint holds no key material. Only the end
+// of the partial output is checked (the last chunk when encrypting, the last
+// resumeCheckSize bytes when decrypting); what came before was synced and is kept.
+
+const (
+	partialSuffix    = ".partial"
+	checkpointSuffix = ".checkpoint"
+	// checkpointInterval is how often the partial output is synced and checkpointed
+	checkpointInterval = 5 * time.Second
+	// resumeCheckSize is how much of the decrypted output is compared on resume
+	resumeCheckSize = 64 << 10
+)
+
+// resumeCheckpoint identifies the input of an interrupted run and says how many
+// bytes of its partial output are on disk
+type resumeCheckpoint struct {
+	Operation     string    `json:"operation"`
+	Source        string    `json:"source"`
+	SourceSize    int64     `json:"source_size"`
+	SourceModTime time.Time `json:"source_mod_time"`
+	Bytes         int64     `json:"bytes"`
+}
+
+func newCheckpoint(operation, source string, info os.FileInfo) (*resumeCheckpoint, error) {
+	abs, err := filepath.Abs(source)
+	if err != nil {
+		return nil, err
+	}
+	return &resumeCheckpoint{Operation: operation, Source: abs, SourceSize: info.Size(), SourceModTime: info.ModTime()}, nil
+}
+
+// loadCheckpoint reads the checkpoint of output, or returns nil if there is none
+func loadCheckpoint(output string) (*resumeCheckpoint, error) {
+	data, err := os.ReadFile(output + checkpointSuffix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cp := &resumeCheckpoint{}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %w", output+checkpointSuffix, err)
+	}
+	return cp, nil
+}
+
+// check makes sure cp was saved by the same operation on the same, unchanged source
+func (cp *resumeCheckpoint) check(operation, source string, info os.FileInfo, output string) error {
+	current, err := newCheckpoint(operation, source, info)
+	if err != nil {
+		return err
+	}
+	if cp.Operation != operation || cp.Source != current.Source {
+		return fmt.Errorf("%s is for the %s of %s; remove it to start over", output+checkpointSuffix, cp.Operation, cp.Source)
+	}
+	if cp.SourceSize != current.SourceSize || !cp.SourceModTime.Equal(current.SourceModTime) {
+		return fmt.Errorf("%s has changed since the checkpoint was saved; remove %s to start over", source, output+checkpointSuffix)
+	}
+	return nil
+}
+
+func (cp *resumeCheckpoint) save(output string) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(output+checkpointSuffix, data, 0600)
+}
+
+// checkpointWriter writes the partial output, checkpointing it every checkpointInterval
+type checkpointWriter struct {
+	f          *os.File
+	output     string
+	checkpoint *resumeCheckpoint
+	written    int64
+	last       time.Time
+}
+
+func newCheckpointWriter(f *os.File, output string, checkpoint *resumeCheckpoint, written int64) *checkpointWriter {
+	return &checkpointWriter{f: f, output: output, checkpoint: checkpoint, written: written, last: time.Now()}
+}
+
+func (c *checkpointWriter) Write(p []byte) (int, error) {
+	n, err := c.f.Write(p)
+	c.written += int64(n)
+	if err == nil && time.Since(c.last) >= checkpointInterval {
+		c.last = time.Now()
+		err = c.save()
+	}
+	return n, err
+}
+
+// save records what has been written once it is on disk
+func (c *checkpointWriter) save() error {
+	if err := c.f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", c.f.Name(), err)
+	}
+	c.checkpoint.Bytes = c.written
+	utils.DebugLogf("Checkpoint: %d bytes of %s", c.written, c.f.Name())
+	return c.checkpoint.save(c.output)
+}
+
+// commit puts the finished partial output in place of output and drops the checkpoint
+func (c *checkpointWriter) commit() error {
+	if err := c.f.Sync(); err != nil {
+		c.f.Close()
+		return fmt.Errorf("failed to sync %s: %w", c.f.Name(), err)
+	}
+	if err := c.f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(c.f.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(c.f.Name(), c.output); err != nil {
+		return fmt.Errorf("failed to replace file %s: %w", c.output, err)
+	}
+	// Runs shorter than checkpointInterval never save one
+	if err := os.Remove(c.output + checkpointSuffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// openPartial opens the partial output of output at offset, or creates it afresh
+func openPartial(output string, offset int64) (*os.File, error) {
+	if offset == 0 {
+		return os.OpenFile(output+partialSuffix, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	}
+	f, err := os.OpenFile(output+partialSuffix, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Truncate(offset); err == nil {
+		_, err = f.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// encryptFileResumable is encryptFileStream for --resume
+func encryptFileResumable(inputFile, outputFile string, key []byte, opts *crypto.StreamOptions) error {
+	if inputFile == utils.Stdio || outputFile == utils.Stdio {
+		return fmt.Errorf("--resume needs an input and an output file, not standard input or output")
+	}
+	if len(opts.Recipients) > 0 || opts.Compression != crypto.CompressionNone {
+		return fmt.Errorf("--resume cannot be used with --recipient or --compress")
+	}
+
+	in, err := os.Open(inputFile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	// The stream holds the metadata frame NewEncryptWriter writes, then the content
+	var frame []byte
+	if opts.FileMetadata != nil {
+		if frame, err = crypto.WrapFileMetadata(opts.FileMetadata, nil); err != nil {
+			return err
+		}
+	}
+	// plaintextAt reads the plaintext, metadata frame then content, from offset on
+	plaintextAt := func(offset int64) io.Reader {
+		if offset < int64(len(frame)) {
+			return io.MultiReader(bytes.NewReader(frame[offset:]), io.NewSectionReader(in, 0, info.Size()))
+		}
+		offset -= int64(len(frame))
+		return io.NewSectionReader(in, offset, info.Size()-offset)
+	}
+
+	cp, err := loadCheckpoint(outputFile)
+	if err != nil {
+		return err
+	}
+	var out *checkpointWriter
+	var w io.WriteCloser
+	var done int64
+	if cp != nil && cp.Bytes > 0 {
+		if err := cp.check("encrypt", inputFile, info, outputFile); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(outputFile+partialSuffix, os.O_RDWR, 0)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = newCheckpointWriter(f, outputFile, cp, 0)
+		var point *crypto.ResumePoint
+		w, point, err = crypto.ResumeEncryptWriter(out, f, cp.Bytes, key, opts)
+		if errors.Is(err, crypto.ErrNothingToResume) {
+			cp = nil
+		} else if err != nil {
+			return fmt.Errorf("cannot resume from %s: %w; remove %s to start over", outputFile+partialSuffix, err, outputFile+checkpointSuffix)
+		} else {
+			lastChunk := make([]byte, len(point.LastChunk))
+			if _, err := io.ReadFull(plaintextAt(point.Plaintext-int64(len(lastChunk))), lastChunk); err != nil || !bytes.Equal(lastChunk, point.LastChunk) {
+				return fmt.Errorf("%s does not match the encrypted part; remove %s to start over", inputFile, outputFile+checkpointSuffix)
+			}
+			if err := f.Truncate(point.Offset); err != nil {
+				return err
+			}
+			if _, err := f.Seek(point.Offset, io.SeekStart); err != nil {
+				return err
+			}
+			out.written, done = point.Offset, point.Plaintext
+			utils.DebugLogf("Resuming encryption of %s at %d bytes", inputFile, done)
+		}
+	}
+	if cp == nil || cp.Bytes == 0 {
+		if cp, err = newCheckpoint("encrypt", inputFile, info); err != nil {
+			return err
+		}
+		f, err := openPartial(outputFile, 0)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = newCheckpointWriter(f, outputFile, cp, 0)
+		if w, err = crypto.NewEncryptWriter(out, key, opts); err != nil {
+			return err
+		}
+		done = int64(len(frame))
+	}
+
+	bar := newProgress(encryptProgress, "encrypt", progressName(inputFile), info.Size()+int64(len(frame))-done)
+	defer bar.finish()
+	if _, err := io.Copy(w, bar.reader(plaintextAt(done))); err != nil {
+		// Sealing a last chunk here would end the partial output early
+		crypto.AbortEncryptWriter(w)
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return out.commit()
+}
+
+// decryptFileResumable is decryptFileStream for --resume. It reads the ciphertext
+// with crypto.NewDecryptReaderAt, so it can start anywhere but does not decompress.
+func decryptFileResumable(key []byte, opts *crypto.OpenOptions) (string, error) {
+	if decryptFile == utils.Stdio {
+		return "", fmt.Errorf("--resume needs an encrypted file, not standard input")
+	}
+	file, err := os.Open(decryptFile)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := crypto.NewDecryptReaderAt(file, info.Size(), key, opts)
+	if err != nil {
+		return "", err
+	}
+	meta := plaintext.FileMetadata()
+	outputFile, err := decryptOutputFile(meta)
+	if err != nil {
+		return "", err
+	}
+	if outputFile == utils.Stdio {
+		return "", fmt.Errorf("--resume needs an output file, not standard output")
+	}
+	size := plaintext.Size()
+
+	cp, err := loadCheckpoint(outputFile)
+	if err != nil {
+		return "", err
+	}
+	var done int64
+	if cp != nil && cp.Bytes > 0 {
+		if err := cp.check("decrypt", decryptFile, info, outputFile); err != nil {
+			return "", err
+		}
+		if cp.Bytes > size {
+			return "", fmt.Errorf("%s is larger than the decrypted file; remove %s to start over", outputFile+partialSuffix, outputFile+checkpointSuffix)
+		}
+		done = cp.Bytes
+	} else if cp, err = newCheckpoint("decrypt", decryptFile, info); err != nil {
+		return "", err
+	}
+
+	f, err := openPartial(outputFile, done)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if done > 0 {
+		// What is on disk must be what the ciphertext decrypts to; ReadAt authenticates it
+		n := min(done, resumeCheckSize)
+		have, want := make([]byte, n), make([]byte, n)
+		if _, err := f.ReadAt(have, done-n); err != nil {
+			return "", err
+		}
+		if _, err := plaintext.ReadAt(want, done-n); err != nil {
+			return "", err
+		}
+		if !bytes.Equal(have, want) {
+			return "", fmt.Errorf("%s does not match %s; remove %s to start over", outputFile+partialSuffix, decryptFile, outputFile+checkpointSuffix)
+		}
+		utils.DebugLogf("Resuming decryption of %s at %d bytes", decryptFile, done)
+	}
+
+	out := newCheckpointWriter(f, outputFile, cp, done)
+	bar := newProgress(decryptProgress, "decrypt", progressName(decryptFile), size-done)
+	defer bar.finish()
+	if _, err := io.Copy(out, bar.reader(io.NewSectionReader(plaintext, done, size-done))); err != nil {
+		return "", err
+	}
+	if err := out.commit(); err != nil {
+		return "", err
+	}
+
+	if meta != nil && !decryptNoRestore {
+		if err := restoreFileMetadata(outputFile, meta); err != nil {
+			return "", err
+		}
+	}
+	return outputFile, nil
+}
@@ -0,0 +1,332 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"thanhlv-encryption-decryption/pkg/crypto"
+)
+
+const resumeTestChunkSize = 4096
+
+var resumeTestKey = []byte("resume test key")
+
+func resumeTestFiles(t *testing.T) (string, []byte) {
+	t.Helper()
+	dir := t.TempDir()
+	content := make([]byte, 10*resumeTestChunkSize+123)
+	for i := range content {
+		content[i] = byte(i*13 + i>>10)
+	}
+	inputFile := filepath.Join(dir, "input.bin")
+	if err := os.WriteFile(inputFile, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return inputFile, content
+}
+
+// interruptAt leaves output as a run of operation on source would after saving a
+// checkpoint at n bytes: the partial output holds written bytes of full, possibly
+// more than the checkpoint, and the output itself does not exist yet
+func interruptAt(t *testing.T, operation, source, output string, full []byte, n, written int) {
+	t.Helper()
+	info, err := os.Stat(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp, err := newCheckpoint(operation, source, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp.Bytes = int64(n)
+	if err := cp.save(output); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(output+partialSuffix, full[:written], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(output); err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+}
+
+func checkResumeFinished(t *testing.T, output string) {
+	t.Helper()
+	for _, suffix := range []string{partialSuffix, checkpointSuffix} {
+		if _, err := os.Stat(output + suffix); !os.IsNotExist(err) {
+			t.Errorf("%s left behind", output+suffix)
+		}
+	}
+}
+
+func checkResumeError(t *testing.T, err error, output string) {
+	t.Helper()
+	if err == nil {
+		t.Fatal("resume succeeded")
+	}
+	if !strings.Contains(err.Error(), output+checkpointSuffix) || !strings.Contains(err.Error(), "to start over") {
+		t.Errorf("error %q does not say to remove the checkpoint", err)
+	}
+}
+
+func resumeStreamOptions() *crypto.StreamOptions {
+	return &crypto.StreamOptions{ChunkSize: resumeTestChunkSize}
+}
+
+func decryptForTest(t *testing.T, file string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := crypto.NewDecryptReader(bytes.NewReader(data), resumeTestKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plaintext
+}
+
+func TestEncryptResume(t *testing.T) {
+	inputFile, content := resumeTestFiles(t)
+	output := inputFile + ".encrypted"
+	if err := encryptFileResumable(inputFile, output, resumeTestKey, resumeStreamOptions()); err != nil {
+		t.Fatal(err)
+	}
+	checkResumeFinished(t, output)
+	full, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed := resumeTestChunkSize + 16
+	headerSize := len(full) - 10*sealed - (123 + 16)
+
+	for _, tc := range []struct {
+		name       string
+		n, written int
+	}{
+		{"header only", headerSize, headerSize},
+		{"first chunk", headerSize + sealed, headerSize + sealed},
+		{"mid chunk", headerSize + 3*sealed + 100, headerSize + 3*sealed + 100},
+		{"written past the checkpoint", headerSize + 3*sealed, headerSize + 5*sealed + 7},
+		{"all full chunks", headerSize + 10*sealed, headerSize + 10*sealed},
+		{"only the last chunk missing", len(full) - 1, len(full) - 1},
+	} {
+		interruptAt(t, "encrypt", inputFile, output, full, tc.n, tc.written)
+		for _, parallel := range []int{1, 4} {
+			if parallel > 1 {
+				interruptAt(t, "encrypt", inputFile, output, full, tc.n, tc.written)
+			}
+			opts := resumeStreamOptions()
+			opts.Parallelism = parallel
+			if err := encryptFileResumable(inputFile, output, resumeTestKey, opts); err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+			checkResumeFinished(t, output)
+			got, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// With no full chunk on disk the run starts over with a new salt
+			if tc.n >= headerSize+sealed && !bytes.Equal(got, full) {
+				t.Errorf("%s, parallel %d: resumed output differs from an uninterrupted run", tc.name, parallel)
+			}
+			if !bytes.Equal(decryptForTest(t, output), content) {
+				t.Errorf("%s, parallel %d: resumed output does not decrypt to the input", tc.name, parallel)
+			}
+		}
+	}
+}
+
+func TestEncryptResumeSourceChanged(t *testing.T) {
+	inputFile, content := resumeTestFiles(t)
+	output := inputFile + ".encrypted"
+	if err := encryptFileResumable(inputFile, output, resumeTestKey, resumeStreamOptions()); err != nil {
+		t.Fatal(err)
+	}
+	full, _ := os.ReadFile(output)
+	n := len(full) / 2
+
+	// Size
+	interruptAt(t, "encrypt", inputFile, output, full, n, n)
+	if err := os.WriteFile(inputFile, append(content, 'x'), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checkResumeError(t, encryptFileResumable(inputFile, output, resumeTestKey, resumeStreamOptions()), output)
+
+	// Modification time
+	if err := os.WriteFile(inputFile, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	interruptAt(t, "encrypt", inputFile, output, full, n, n)
+	if err := os.Chtimes(inputFile, time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	checkResumeError(t, encryptFileResumable(inputFile, output, resumeTestKey, resumeStreamOptions()), output)
+
+	// Content of the last chunk before the checkpoint changed in place, with the
+	// size and time put back; that chunk is compared with the input
+	interruptAt(t, "encrypt", inputFile, output, full, n, n)
+	info, _ := os.Stat(inputFile)
+	changed := append([]byte{}, content...)
+	changed[4*resumeTestChunkSize+1] ^= 1
+	if err := os.WriteFile(inputFile, changed, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(inputFile, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	checkResumeError(t, encryptFileResumable(inputFile, output, resumeTestKey, resumeStreamOptions()), output)
+
+	// A checkpoint of another operation
+	interruptAt(t, "decrypt", inputFile, output, full, n, n)
+	checkResumeError(t, encryptFileResumable(inputFile, output, resumeTestKey, resumeStreamOptions()), output)
+}
+
+func TestEncryptResumeCorruptedPartial(t *testing.T) {
+	inputFile, _ := resumeTestFiles(t)
+	output := inputFile + ".encrypted"
+	if err := encryptFileResumable(inputFile, output, resumeTestKey, resumeStreamOptions()); err != nil {
+		t.Fatal(err)
+	}
+	full, _ := os.ReadFile(output)
+	sealed := resumeTestChunkSize + 16
+	headerSize := len(full) - 10*sealed - (123 + 16)
+	n := headerSize + 4*sealed
+
+	// The last full chunk before the checkpoint
+	interruptAt(t, "encrypt", inputFile, output, full, n, n)
+	partial, _ := os.ReadFile(output + partialSuffix)
+	partial[n-20] ^= 1
+	os.WriteFile(output+partialSuffix, partial, 0600)
+	checkResumeError(t, encryptFileResumable(inputFile, output, resumeTestKey, resumeStreamOptions()), output)
+
+	// The header
+	interruptAt(t, "encrypt", inputFile, output, full, n, n)
+	partial, _ = os.ReadFile(output + partialSuffix)
+	partial[headerSize-1] ^= 1
+	os.WriteFile(output+partialSuffix, partial, 0600)
+	checkResumeError(t, encryptFileResumable(inputFile, output, resumeTestKey, resumeStreamOptions()), output)
+
+	// Shorter than the checkpoint says
+	interruptAt(t, "encrypt", inputFile, output, full, n, n-sealed-10)
+	checkResumeError(t, encryptFileResumable(inputFile, output, resumeTestKey, resumeStreamOptions()), output)
+
+	// Another key
+	interruptAt(t, "encrypt", inputFile, output, full, n, n)
+	checkResumeError(t, encryptFileResumable(inputFile, output, []byte("another key"), resumeStreamOptions()), output)
+}
+
+// setDecryptFlags points the decrypt command at file and output for one test
+func setDecryptFlags(t *testing.T, file, output string) {
+	t.Helper()
+	oldFile, oldOutput, oldNoRestore := decryptFile, decryptOutput, decryptNoRestore
+	decryptFile, decryptOutput, decryptNoRestore = file, output, true
+	t.Cleanup(func() { decryptFile, decryptOutput, decryptNoRestore = oldFile, oldOutput, oldNoRestore })
+}
+
+func TestDecryptResume(t *testing.T) {
+	inputFile, content := resumeTestFiles(t)
+	encrypted := inputFile + ".encrypted"
+	if err := encryptFileStream(inputFile, encrypted, resumeTestKey, resumeStreamOptions()); err != nil {
+		t.Fatal(err)
+	}
+	output := inputFile + ".decrypted"
+	setDecryptFlags(t, encrypted, output)
+
+	for _, tc := range []struct {
+		name       string
+		n, written int
+	}{
+		{"one byte", 1, 1},
+		{"chunk boundary", 3 * resumeTestChunkSize, 3 * resumeTestChunkSize},
+		{"mid chunk", 5*resumeTestChunkSize + 17, 5*resumeTestChunkSize + 17},
+		{"written past the checkpoint", 2 * resumeTestChunkSize, 4*resumeTestChunkSize + 5},
+		{"all but one byte", len(content) - 1, len(content) - 1},
+		{"everything", len(content), len(content)},
+	} {
+		interruptAt(t, "decrypt", encrypted, output, content, tc.n, tc.written)
+		if _, err := decryptFileResumable(resumeTestKey, &crypto.OpenOptions{}); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		checkResumeFinished(t, output)
+		got, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Errorf("%s: resumed output differs from the original", tc.name)
+		}
+	}
+}
+
+func TestDecryptResumeSourceChanged(t *testing.T) {
+	inputFile, content := resumeTestFiles(t)
+	encrypted := inputFile + ".encrypted"
+	if err := encryptFileStream(inputFile, encrypted, resumeTestKey, resumeStreamOptions()); err != nil {
+		t.Fatal(err)
+	}
+	output := inputFile + ".decrypted"
+	setDecryptFlags(t, encrypted, output)
+	n := 4 * resumeTestChunkSize
+
+	// Modification time
+	interruptAt(t, "decrypt", encrypted, output, content, n, n)
+	if err := os.Chtimes(encrypted, time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	_, err := decryptFileResumable(resumeTestKey, &crypto.OpenOptions{})
+	checkResumeError(t, err, output)
+
+	// Encrypted again: same plaintext, new salt and size of a different file
+	if err := encryptFileStream(inputFile, encrypted, resumeTestKey, &crypto.StreamOptions{ChunkSize: 2 * resumeTestChunkSize}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = decryptFileResumable(resumeTestKey, &crypto.OpenOptions{})
+	checkResumeError(t, err, output)
+}
+
+func TestDecryptResumeCorruptedPartial(t *testing.T) {
+	inputFile, content := resumeTestFiles(t)
+	encrypted := inputFile + ".encrypted"
+	if err := encryptFileStream(inputFile, encrypted, resumeTestKey, resumeStreamOptions()); err != nil {
+		t.Fatal(err)
+	}
+	output := inputFile + ".decrypted"
+	setDecryptFlags(t, encrypted, output)
+	n := 4*resumeTestChunkSize + 99
+
+	for _, tc := range []struct {
+		name    string
+		corrupt func([]byte) []byte
+	}{
+		{"changed byte", func(b []byte) []byte { b[n-1] ^= 1; return b }},
+		{"shorter than the checkpoint", func(b []byte) []byte { return b[:n-10] }},
+		{"other content", func(b []byte) []byte { return bytes.Repeat([]byte{'x'}, len(b)) }},
+	} {
+		interruptAt(t, "decrypt", encrypted, output, content, n, n)
+		partial, _ := os.ReadFile(output + partialSuffix)
+		os.WriteFile(output+partialSuffix, tc.corrupt(partial), 0600)
+		_, err := decryptFileResumable(resumeTestKey, &crypto.OpenOptions{})
+		checkResumeError(t, err, output)
+		if _, err := os.Stat(output); !os.IsNotExist(err) {
+			t.Errorf("%s: output was written", tc.name)
+		}
+	}
+
+	// A checkpoint past the end of the plaintext
+	interruptAt(t, "decrypt", encrypted, output, content, n, n)
+	cp, _ := loadCheckpoint(output)
+	cp.Bytes = int64(len(content)) + 1
+	cp.save(output)
+	_, err := decryptFileResumable(resumeTestKey, &crypto.OpenOptions{})
+	checkResumeError(t, err, output)
+}
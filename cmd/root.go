@@ -20,7 +20,7 @@ like AES-256-CBC and RSA. Supports both text and file encryption/decryption.`,
 
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
@@ -31,6 +31,14 @@ func init() {
 	rootCmd.AddCommand(encryptCmd)
 	rootCmd.AddCommand(decryptCmd)
 	rootCmd.AddCommand(keygenCmd)
+	rootCmd.AddCommand(blindIndexCmd)
+	rootCmd.AddCommand(splitCmd)
+	rootCmd.AddCommand(combineCmd)
+	rootCmd.AddCommand(deriveCmd)
+	rootCmd.AddCommand(passphraseCmd)
+	rootCmd.AddCommand(inspectCmd)
+	rootCmd.AddCommand(upgradeCmd)
+	rootCmd.AddCommand(logCmd)
 }
 
 func IsDebugEnabled() bool {
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"thanhlv-encryption-decryption/pkg/crypto"
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+var splitCmd = &cobra.Command{
+	Use:   "split",
+	Short: "Split a key into Shamir secret shares",
+	Long: `Split a key or other small secret into shares over GF(256) so that any
+--threshold of the --shares shares recover it and fewer reveal nothing.`,
+	Run: runSplit,
+}
+
+var combineCmd = &cobra.Command{
+	Use:   "combine [share...]",
+	Short: "Recover a key from Shamir secret shares",
+	Long: `Recover a key from shares created by split. Shares can be given as arguments,
+with --share or in a file with one share per line, in base64 or word list form.`,
+	Run: runCombine,
+}
+
+var (
+	splitKey         string
+	splitKeyEnv      string
+	splitKeyEncoding string
+	splitText        string
+	splitShares      int
+	splitThreshold   int
+	splitFormat      string
+	splitOutput      string
+
+	combineShares []string
+	combineFile   string
+	combineOutput string
+	combineText   bool
+)
+
+func init() {
+	splitCmd.Flags().StringVarP(&splitKey, "key", "k", "", "Key to split (base64 encoded)")
+	splitCmd.Flags().StringVarP(&splitKeyEnv, "key-env", "e", "", "Environment variable name containing the key to split (base64 encoded)")
+	splitCmd.Flags().StringVar(&splitKeyEncoding, "key-encoding", utils.EncodingBase64, "Encoding of --key and --key-env (base64, base64url, hex, base32, raw, or auto to detect it)")
+	splitCmd.Flags().StringVarP(&splitText, "text", "t", "", "Text secret to split")
+	splitCmd.Flags().IntVarP(&splitShares, "shares", "n", 5, "Number of shares to create")
+	splitCmd.Flags().IntVar(&splitThreshold, "threshold", 3, "Number of shares needed to recover the secret")
+	splitCmd.Flags().StringVar(&splitFormat, "format", "base64", "Share format (base64, words)")
+	splitCmd.Flags().StringVarP(&splitOutput, "output", "o", "", "Output file, one share per line (optional, - for standard output)")
+
+	combineCmd.Flags().StringArrayVarP(&combineShares, "share", "s", nil, "Share to combine (repeatable)")
+	combineCmd.Flags().StringVarP(&combineFile, "file", "f", "", "File with one share per line (- for standard input)")
+	combineCmd.Flags().StringVarP(&combineOutput, "output", "o", "", "Output file for the recovered secret (optional, - for standard output)")
+	combineCmd.Flags().BoolVar(&combineText, "text", false, "Print the recovered secret as text instead of base64")
+}
+
+func runSplit(cmd *cobra.Command, args []string) {
+	if splitFormat != "base64" && splitFormat != "words" {
+		fmt.Fprintf(os.Stderr, "Error: Unsupported share format: %s\n", splitFormat)
+		os.Exit(1)
+	}
+
+	var secret []byte
+	if splitText != "" {
+		if splitKey != "" || splitKeyEnv != "" {
+			fmt.Fprintln(os.Stderr, "Error: Cannot specify both --text and --key/--key-env")
+			os.Exit(1)
+		}
+		secret = []byte(splitText)
+	} else {
+		keyBytes, err := readKey(splitKey, splitKeyEnv, splitKeyEncoding)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		secret = keyBytes
+	}
+
+	shares, err := crypto.SplitSecret(secret, splitShares, splitThreshold)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error splitting secret: %v\n", err)
+		os.Exit(1)
+	}
+
+	lines := make([]string, len(shares))
+	for i, share := range shares {
+		if splitFormat == "words" {
+			lines[i] = share.Words()
+		} else {
+			lines[i] = share.String()
+		}
+	}
+
+	if splitOutput != "" {
+		err = utils.WriteFile(splitOutput, []byte(strings.Join(lines, "\n")+"\n"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing to output file: %v\n", err)
+			os.Exit(1)
+		}
+		reportOutput(splitOutput, "%d shares (threshold %d) written to: %s\n", len(shares), splitThreshold, splitOutput)
+		return
+	}
+
+	fmt.Printf("Split into %d shares, any %d recover the secret:\n", len(shares), splitThreshold)
+	for i, line := range lines {
+		fmt.Printf("Share %d: %s\n", i+1, line)
+	}
+}
+
+func runCombine(cmd *cobra.Command, args []string) {
+	inputs := append(append([]string{}, args...), combineShares...)
+	if combineFile != "" {
+		data, err := utils.ReadFile(combineFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading shares file: %v\n", err)
+			os.Exit(1)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if strings.TrimSpace(line) != "" {
+				inputs = append(inputs, line)
+			}
+		}
+	}
+
+	if len(inputs) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: No shares given")
+		os.Exit(1)
+	}
+
+	shares := make([]*crypto.Share, len(inputs))
+	for i, input := range inputs {
+		share, err := crypto.ParseShare(input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing share %d: %v\n", i+1, err)
+			os.Exit(1)
+		}
+		shares[i] = share
+	}
+
+	secret, err := crypto.CombineShares(shares)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error combining shares: %v\n", err)
+		os.Exit(1)
+	}
+
+	if combineOutput != "" {
+		err = utils.WriteFile(combineOutput, secret)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing to output file: %v\n", err)
+			os.Exit(1)
+		}
+		reportOutput(combineOutput, "Recovered secret written to: %s\n", combineOutput)
+	} else if combineText {
+		fmt.Printf("Recovered secret: %s\n", string(secret))
+	} else {
+		fmt.Printf("Recovered secret (base64): %s\n", base64.StdEncoding.EncodeToString(secret))
+	}
+}
@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+// stdinIsPiped reports whether standard input is a pipe or file rather than a
+// terminal, so a command given no input can read it
+func stdinIsPiped() bool {
+	return !term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// reportOutput prints a status line about output on stderr. Nothing is printed
+// when output is standard output, which then carries only the data.
+func reportOutput(output string, format string, args ...interface{}) {
+	if output == utils.Stdio {
+		return
+	}
+	fmt.Fprintf(os.Stderr, format, args...)
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"thanhlv-encryption-decryption/pkg/crypto"
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+// withStdio replaces standard input with input and standard output and error with
+// files for the rest of the test, and returns functions reading what was written
+func withStdio(t *testing.T, input []byte) (stdout, stderr func() []byte) {
+	t.Helper()
+	dir := t.TempDir()
+	open := func(name string) *os.File {
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f.Close() })
+		return f
+	}
+	in, out, errOut := open("stdin"), open("stdout"), open("stderr")
+	if _, err := in.Write(input); err != nil {
+		t.Fatal(err)
+	}
+	in.Seek(0, 0)
+
+	oldIn, oldOut, oldErr := os.Stdin, os.Stdout, os.Stderr
+	os.Stdin, os.Stdout, os.Stderr = in, out, errOut
+	t.Cleanup(func() { os.Stdin, os.Stdout, os.Stderr = oldIn, oldOut, oldErr })
+
+	read := func(name string) func() []byte {
+		return func() []byte {
+			data, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return data
+		}
+	}
+	return read("stdout"), read("stderr")
+}
+
+func TestEncryptDecryptPipe(t *testing.T) {
+	key := []byte("stdio command test key")
+	content := bytes.Repeat([]byte("piped through stdin\n"), 500)
+
+	stdout, stderr := withStdio(t, content)
+	if err := encryptFileStream(utils.Stdio, utils.Stdio, key, &crypto.StreamOptions{ChunkSize: 1024}); err != nil {
+		t.Fatal(err)
+	}
+	encrypted := stdout()
+	if !crypto.IsEnvelope(encrypted) {
+		t.Fatalf("standard output holds %d bytes that are not an envelope", len(encrypted))
+	}
+	if len(stderr()) != 0 {
+		t.Errorf("encrypting to standard output wrote %q on stderr", stderr())
+	}
+
+	stdout, stderr = withStdio(t, encrypted)
+	setDecryptFlags(t, utils.Stdio, "")
+	output, err := decryptFileStream(os.Stdin, key, &crypto.OpenOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != utils.Stdio || !bytes.Equal(stdout(), content) {
+		t.Errorf("decrypted to %q: %d bytes, want %d on standard output", output, len(stdout()), len(content))
+	}
+	if len(stderr()) != 0 {
+		t.Errorf("decrypting to standard output wrote %q on stderr", stderr())
+	}
+}
+
+func TestDecryptPipeToFile(t *testing.T) {
+	key := []byte("stdio command test key")
+	var encrypted bytes.Buffer
+	w, err := crypto.NewEncryptWriter(&encrypted, key, &crypto.StreamOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("to a file"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, _ := withStdio(t, encrypted.Bytes())
+	outputFile := filepath.Join(t.TempDir(), "plain.txt")
+	setDecryptFlags(t, utils.Stdio, outputFile)
+	if output, err := decryptFileStream(os.Stdin, key, &crypto.OpenOptions{}); err != nil || output != outputFile {
+		t.Fatalf("decryptFileStream = %q, %v", output, err)
+	}
+	if data, _ := os.ReadFile(outputFile); string(data) != "to a file" {
+		t.Errorf("output file holds %q", data)
+	}
+	if len(stdout()) != 0 {
+		t.Errorf("--output still wrote %q on standard output", stdout())
+	}
+}
+
+func TestDecryptOutputFile(t *testing.T) {
+	meta := &crypto.FileMetadata{Name: "report.pdf"}
+	for _, tt := range []struct {
+		file, output string
+		meta         *crypto.FileMetadata
+		want         string
+	}{
+		{utils.Stdio, "", meta, utils.Stdio},
+		{utils.Stdio, "out.txt", nil, "out.txt"},
+		{filepath.Join("dir", "x.encrypted"), "", meta, filepath.Join("dir", "report.pdf")},
+		{filepath.Join("dir", "x.encrypted"), "", nil, filepath.Join("dir", "x")},
+		{filepath.Join("dir", "x.bin"), "", nil, filepath.Join("dir", "x.bin.decrypted")},
+		{filepath.Join("dir", "x.bin"), utils.Stdio, meta, utils.Stdio},
+	} {
+		setDecryptFlags(t, tt.file, tt.output)
+		if got, err := decryptOutputFile(tt.meta); err != nil || got != tt.want {
+			t.Errorf("file %q, --output %q: decryptOutputFile = %q, %v, want %q", tt.file, tt.output, got, err, tt.want)
+		}
+	}
+}
+
+func TestReportOutput(t *testing.T) {
+	_, stderr := withStdio(t, nil)
+	reportOutput(utils.Stdio, "written to %s\n", utils.Stdio)
+	if len(stderr()) != 0 {
+		t.Errorf("status for standard output printed %q", stderr())
+	}
+	reportOutput("out.txt", "written to %s\n", "out.txt")
+	if string(stderr()) != "written to out.txt\n" {
+		t.Errorf("status printed %q", stderr())
+	}
+}
+
+func TestStdinIsPiped(t *testing.T) {
+	withStdio(t, nil)
+	if !stdinIsPiped() {
+		t.Error("a file on standard input is not reported as piped")
+	}
+}
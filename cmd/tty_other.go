@@ -0,0 +1,23 @@
+//go:build !windows
+
+package cmd
+
+import "os"
+
+// ttyFiles holds the terminal input and output, which are the same file on Unix
+type ttyFiles struct {
+	in, out *os.File
+}
+
+// openTTY opens the controlling terminal, even when stdin and stdout are redirected
+func openTTY() (*ttyFiles, error) {
+	f, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &ttyFiles{in: f, out: f}, nil
+}
+
+func (t *ttyFiles) Close() error {
+	return t.in.Close()
+}
@@ -0,0 +1,29 @@
+//go:build windows
+
+package cmd
+
+import "os"
+
+// ttyFiles holds the console input and output buffers
+type ttyFiles struct {
+	in, out *os.File
+}
+
+// openTTY opens the console, even when stdin and stdout are redirected
+func openTTY() (*ttyFiles, error) {
+	in, err := os.OpenFile("CONIN$", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	out, err := os.OpenFile("CONOUT$", os.O_WRONLY, 0)
+	if err != nil {
+		in.Close()
+		return nil, err
+	}
+	return &ttyFiles{in: in, out: out}, nil
+}
+
+func (t *ttyFiles) Close() error {
+	t.out.Close()
+	return t.in.Close()
+}
@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"thanhlv-encryption-decryption/pkg/crypto"
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade [files or directories...]",
+	Short: "Re-encrypt legacy aes-256-cbc files in the authenticated envelope format",
+	Long: `Decrypt bare aes-256-cbc files written by older versions and re-encrypt them as
+aes-256-gcm envelopes under the same key. Each file is replaced atomically; the original
+is kept next to it with the --backup-suffix unless --remove-originals is given. Files that
+already have an envelope header are skipped, so the command can be re-run safely.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runUpgrade,
+}
+
+var (
+	upgradeKey             string
+	upgradeKeyEnv          string
+	upgradeKeyEncoding     string
+	upgradeRecursive       bool
+	upgradeRemoveOriginals bool
+	upgradeBackupSuffix    string
+	upgradeDryRun          bool
+	upgradeVerify          bool
+	upgradeInclude         string
+	upgradeProgress        string
+)
+
+func init() {
+	upgradeCmd.Flags().StringVarP(&upgradeKey, "key", "k", "", "Key of the legacy files (base64 encoded)")
+	upgradeCmd.Flags().StringVarP(&upgradeKeyEnv, "key-env", "e", "", "Environment variable name containing the key (base64 encoded)")
+	upgradeCmd.Flags().StringVar(&upgradeKeyEncoding, "key-encoding", utils.EncodingBase64, "Encoding of --key and --key-env (base64, base64url, hex, base32, raw, or auto to detect it)")
+	upgradeCmd.Flags().BoolVarP(&upgradeRecursive, "recursive", "r", false, "Upgrade all files in the given directories and their subdirectories")
+	upgradeCmd.Flags().BoolVar(&upgradeRemoveOriginals, "remove-originals", false, "Do not keep a backup of the legacy files (needs --verify)")
+	upgradeCmd.Flags().StringVar(&upgradeBackupSuffix, "backup-suffix", ".legacy", "Suffix of the backup kept for each legacy file")
+	upgradeCmd.Flags().StringVar(&upgradeInclude, "include", "", "Only upgrade files whose base name matches this pattern (e.g. \"*.encrypted\")")
+	upgradeCmd.Flags().StringVar(&upgradeProgress, "progress", progressAuto, "Show progress over all files on stderr (auto: a bar when stderr is a terminal, json, off)")
+	upgradeCmd.Flags().BoolVar(&upgradeDryRun, "dry-run", false, "Check that each file decrypts with the key without writing anything")
+	upgradeCmd.Flags().BoolVar(&upgradeVerify, "verify", false, "Decrypt every file before upgrading any, and upgrade nothing if one fails")
+}
+
+// errUpgradeSkipped marks files that are already in the envelope format
+var errUpgradeSkipped = errors.New("already in the envelope format")
+
+func runUpgrade(cmd *cobra.Command, args []string) {
+	keyBytes, err := readKey(upgradeKey, upgradeKeyEnv, upgradeKeyEncoding)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// A wrong key passes the padding check of about one legacy file in 256, so the
+	// originals are only dropped when the key has been checked against every file
+	if upgradeRemoveOriginals && !upgradeVerify {
+		fmt.Fprintln(os.Stderr, "Error: --remove-originals needs --verify")
+		os.Exit(1)
+	}
+	if !upgradeRemoveOriginals && upgradeBackupSuffix == "" {
+		fmt.Fprintln(os.Stderr, "Error: --backup-suffix cannot be empty; use --remove-originals to drop the originals")
+		os.Exit(1)
+	}
+
+	if err := validateProgress(upgradeProgress); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if _, err := filepath.Match(upgradeInclude, ""); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --include pattern: %v\n", err)
+		os.Exit(1)
+	}
+
+	files, err := collectUpgradeFiles(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	upgraded, skipped, failed := upgradeFiles(files, keyBytes)
+	fmt.Printf("Upgraded: %d, skipped: %d, failed: %d\n", upgraded, skipped, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// upgradeFiles upgrades files one by one, printing a line for each, and returns the
+// counts. With --verify nothing is written unless every file decrypts first.
+func upgradeFiles(files []string, key []byte) (upgraded, skipped, failed int) {
+	if upgradeVerify {
+		if errs := verifyUpgradeKey(files, key); errs != nil {
+			for i, file := range files {
+				switch {
+				case errs[i] == nil:
+					fmt.Printf("FAILED  %s: not upgraded, other files do not decrypt with this key\n", file)
+				case errors.Is(errs[i], errUpgradeSkipped):
+					skipped++
+					fmt.Printf("skipped %s: %v\n", file, errs[i])
+					continue
+				default:
+					fmt.Printf("FAILED  %s: %v\n", file, errs[i])
+				}
+				failed++
+			}
+			return 0, skipped, failed
+		}
+	}
+
+	// Progress counts the bytes of the files done so far
+	var total, done int64
+	sizes := make([]int64, len(files))
+	for i, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+	bar := newProgress(upgradeProgress, "upgrade", "", total)
+	defer bar.finish()
+
+	for i, file := range files {
+		err := upgradeFile(file, key)
+		done += sizes[i]
+		bar.clear()
+		switch {
+		case errors.Is(err, errUpgradeSkipped):
+			skipped++
+			fmt.Printf("skipped %s: %v\n", file, err)
+		case err != nil:
+			failed++
+			fmt.Printf("FAILED  %s: %v\n", file, err)
+		default:
+			upgraded++
+			if upgradeDryRun {
+				fmt.Printf("ok      %s (dry run)\n", file)
+			} else {
+				fmt.Printf("ok      %s\n", file)
+			}
+		}
+		bar.update(done)
+	}
+	return upgraded, skipped, failed
+}
+
+// verifyUpgradeKey decrypts every legacy file with key and returns the error of
+// each file, or nil if all of them decrypt or are already upgraded. The legacy
+// format is not authenticated, so a wrong key is only caught by the padding check,
+// which it passes for about one file in 256 but very rarely for all of them.
+func verifyUpgradeKey(files []string, key []byte) []error {
+	errs := make([]error, len(files))
+	ok := true
+	for i, file := range files {
+		data, err := utils.ReadFile(file)
+		if err == nil && crypto.IsEnvelope(data) {
+			err = errUpgradeSkipped
+		} else if err == nil {
+			_, err = (&crypto.AESProvider{}).Decrypt(data, key)
+		}
+		errs[i] = err
+		if err != nil && !errors.Is(err, errUpgradeSkipped) {
+			ok = false
+		}
+	}
+	if ok {
+		return nil
+	}
+	return errs
+}
+
+// collectUpgradeFiles expands the arguments into regular files, walking directories
+// with --recursive and leaving out backups from earlier runs and names not matching --include
+func collectUpgradeFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		if !upgradeRecursive {
+			return nil, fmt.Errorf("%s is a directory; use --recursive", arg)
+		}
+
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			if upgradeBackupSuffix != "" && strings.HasSuffix(path, upgradeBackupSuffix) {
+				utils.DebugLogf("Skipping backup file: %s", path)
+				return nil
+			}
+			if upgradeInclude != "" {
+				if ok, _ := filepath.Match(upgradeInclude, d.Name()); !ok {
+					return nil
+				}
+			}
+			files = append(files, path)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk %s: %w", arg, err)
+		}
+	}
+	return files, nil
+}
+
+func upgradeFile(file string, key []byte) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	data, err := utils.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	upgraded, err := crypto.UpgradeLegacy(data, key)
+	if errors.Is(err, crypto.ErrAlreadyUpgraded) {
+		return errUpgradeSkipped
+	}
+	if err != nil {
+		return err
+	}
+	if upgradeDryRun {
+		return nil
+	}
+
+	if !upgradeRemoveOriginals {
+		backup := file + upgradeBackupSuffix
+		if utils.FileExists(backup) {
+			return fmt.Errorf("backup %s already exists", backup)
+		}
+		if err := linkOrCopy(file, backup, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to keep original: %w", err)
+		}
+	}
+	return utils.WriteFileAtomic(file, upgraded, info.Mode().Perm())
+}
+
+// linkOrCopy hard links src to dst, copying where links are not supported
+func linkOrCopy(src, dst string, perm os.FileMode) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
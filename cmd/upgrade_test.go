@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"thanhlv-encryption-decryption/pkg/crypto"
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+var upgradeTestKey = []byte("upgrade command test key")
+
+// setUpgradeFlags sets the upgrade flags for the rest of the test
+func setUpgradeFlags(t *testing.T, recursive, removeOriginals, dryRun bool, include string) {
+	t.Helper()
+	oldRecursive, oldRemove, oldDryRun, oldInclude, oldSuffix, oldVerify, oldProgress := upgradeRecursive, upgradeRemoveOriginals, upgradeDryRun, upgradeInclude, upgradeBackupSuffix, upgradeVerify, upgradeProgress
+	upgradeRecursive, upgradeRemoveOriginals, upgradeDryRun, upgradeInclude, upgradeBackupSuffix, upgradeVerify, upgradeProgress = recursive, removeOriginals, dryRun, include, ".legacy", false, progressOff
+	t.Cleanup(func() {
+		upgradeRecursive, upgradeRemoveOriginals, upgradeDryRun, upgradeInclude, upgradeBackupSuffix, upgradeVerify, upgradeProgress = oldRecursive, oldRemove, oldDryRun, oldInclude, oldSuffix, oldVerify, oldProgress
+	})
+}
+
+// writeLegacyFile writes content encrypted in the legacy aes-256-cbc format
+func writeLegacyFile(t *testing.T, path string, content []byte) []byte {
+	t.Helper()
+	legacy, err := (&crypto.AESProvider{}).Encrypt(content, upgradeTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, legacy, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return legacy
+}
+
+func TestUpgradeFile(t *testing.T) {
+	setUpgradeFlags(t, false, false, false, "")
+	file := filepath.Join(t.TempDir(), "report.encrypted")
+	legacy := writeLegacyFile(t, file, []byte("legacy content"))
+
+	if err := upgradeFile(file, upgradeTestKey); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := crypto.OpenEnvelope(data, upgradeTestKey, nil); err != nil || string(got) != "legacy content" {
+		t.Errorf("upgraded file decrypts to %q, %v", got, err)
+	}
+	if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("upgraded file mode = %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+	if backup, err := os.ReadFile(file + ".legacy"); err != nil || !bytes.Equal(backup, legacy) {
+		t.Errorf("backup = %d bytes, %v, want the original", len(backup), err)
+	}
+
+	// Already upgraded
+	if err := upgradeFile(file, upgradeTestKey); !errors.Is(err, errUpgradeSkipped) {
+		t.Errorf("second upgrade: error = %v, want errUpgradeSkipped", err)
+	}
+}
+
+func TestUpgradeFileKeepsBackup(t *testing.T) {
+	setUpgradeFlags(t, false, false, false, "")
+	file := filepath.Join(t.TempDir(), "report.encrypted")
+	legacy := writeLegacyFile(t, file, []byte("legacy content"))
+	if err := os.WriteFile(file+".legacy", []byte("older backup"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// An existing backup is never overwritten, and the file is left alone
+	if err := upgradeFile(file, upgradeTestKey); err == nil {
+		t.Error("upgrade over an existing backup succeeded")
+	}
+	if data, _ := os.ReadFile(file); !bytes.Equal(data, legacy) {
+		t.Error("file changed although its backup could not be kept")
+	}
+	if data, _ := os.ReadFile(file + ".legacy"); string(data) != "older backup" {
+		t.Error("existing backup was overwritten")
+	}
+}
+
+func TestUpgradeFileDryRunAndRemoveOriginals(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "report.encrypted")
+	legacy := writeLegacyFile(t, file, []byte("legacy content"))
+
+	setUpgradeFlags(t, false, false, true, "")
+	if err := upgradeFile(file, upgradeTestKey); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(file); !bytes.Equal(data, legacy) || utils.FileExists(file+".legacy") {
+		t.Error("dry run wrote something")
+	}
+	// A file that does not decrypt is reported in a dry run too
+	bad := filepath.Join(dir, "bad.encrypted")
+	if err := os.WriteFile(bad, legacy[:len(legacy)-1], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := upgradeFile(bad, upgradeTestKey); err == nil {
+		t.Error("dry run of a damaged file succeeded")
+	}
+
+	setUpgradeFlags(t, false, true, false, "")
+	if err := upgradeFile(file, upgradeTestKey); err != nil {
+		t.Fatal(err)
+	}
+	if utils.FileExists(file + ".legacy") {
+		t.Error("--remove-originals kept a backup")
+	}
+	data, _ := os.ReadFile(file)
+	if got, err := crypto.OpenEnvelope(data, upgradeTestKey, nil); err != nil || string(got) != "legacy content" {
+		t.Errorf("upgraded file decrypts to %q, %v", got, err)
+	}
+}
+
+func TestCollectUpgradeFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.encrypted", "a.encrypted.legacy", "notes.txt", "sub/b.encrypted", "sub/deeper/c.encrypted"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	setUpgradeFlags(t, false, false, false, "")
+	if _, err := collectUpgradeFiles([]string{dir}); err == nil {
+		t.Error("a directory without --recursive was accepted")
+	}
+	if files, err := collectUpgradeFiles([]string{filepath.Join(dir, "notes.txt")}); err != nil || len(files) != 1 {
+		t.Errorf("single file = %v, %v", files, err)
+	}
+	if _, err := collectUpgradeFiles([]string{filepath.Join(dir, "missing")}); err == nil {
+		t.Error("a missing file was accepted")
+	}
+
+	for _, tt := range []struct {
+		include string
+		want    []string
+	}{
+		{"", []string{"a.encrypted", "notes.txt", "sub/b.encrypted", "sub/deeper/c.encrypted"}},
+		{"*.encrypted", []string{"a.encrypted", "sub/b.encrypted", "sub/deeper/c.encrypted"}},
+	} {
+		setUpgradeFlags(t, true, false, false, tt.include)
+		files, err := collectUpgradeFiles([]string{dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, f := range files {
+			rel, _ := filepath.Rel(dir, f)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		sort.Strings(got)
+		if len(got) != len(tt.want) {
+			t.Errorf("--include %q: files = %v, want %v", tt.include, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("--include %q: files = %v, want %v", tt.include, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+// writeWrongKeyLegacyFile writes a legacy file that also passes the padding check
+// with wrongKey, as about one in 256 do
+func writeWrongKeyLegacyFile(t *testing.T, path string, wrongKey []byte) []byte {
+	t.Helper()
+	for i := 0; i < 10000; i++ {
+		legacy, err := (&crypto.AESProvider{}).Encrypt([]byte(fmt.Sprintf("legacy content %d", i)), upgradeTestKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := (&crypto.AESProvider{}).Decrypt(legacy, wrongKey); err == nil {
+			if err := os.WriteFile(path, legacy, 0600); err != nil {
+				t.Fatal(err)
+			}
+			return legacy
+		}
+	}
+	t.Fatal("no ciphertext passed the padding check with the wrong key")
+	return nil
+}
+
+func TestUpgradeVerifyWrongKey(t *testing.T) {
+	wrongKey := []byte("not the upgrade key")
+	dir := t.TempDir()
+	lucky := filepath.Join(dir, "lucky.encrypted")
+	luckyData := writeWrongKeyLegacyFile(t, lucky, wrongKey)
+	files := []string{lucky, filepath.Join(dir, "a.encrypted"), filepath.Join(dir, "b.encrypted")}
+	for _, file := range files[1:] {
+		writeLegacyFile(t, file, []byte("legacy content"))
+	}
+
+	setUpgradeFlags(t, false, true, false, "")
+	upgradeVerify = true
+	stdout, _ := withStdio(t, nil)
+	upgraded, skipped, failed := upgradeFiles(files, wrongKey)
+	if upgraded != 0 || skipped != 0 || failed != len(files) {
+		t.Errorf("wrong key: upgraded %d, skipped %d, failed %d", upgraded, skipped, failed)
+	}
+	if out := string(stdout()); strings.Contains(out, "ok ") {
+		t.Errorf("wrong key reported an upgrade:\n%s", out)
+	}
+	if data, _ := os.ReadFile(lucky); !bytes.Equal(data, luckyData) {
+		t.Error("a file that decrypted with the wrong key was rewritten")
+	}
+
+	// The right key upgrades everything, and a re-run skips what is done
+	if upgraded, _, failed := upgradeFiles(files[1:], upgradeTestKey); upgraded != 2 || failed != 0 {
+		t.Errorf("right key: upgraded %d, failed %d", upgraded, failed)
+	}
+	if upgraded, skipped, failed := upgradeFiles(files, upgradeTestKey); upgraded != 1 || skipped != 2 || failed != 0 {
+		t.Errorf("re-run: upgraded %d, skipped %d, failed %d", upgraded, skipped, failed)
+	}
+	for _, file := range files {
+		data, _ := os.ReadFile(file)
+		if _, err := crypto.OpenEnvelope(data, upgradeTestKey, nil); err != nil {
+			t.Errorf("%s: %v", file, err)
+		}
+	}
+}
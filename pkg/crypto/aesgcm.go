@@ -0,0 +1,93 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+// aesGCMKeyInfo is the HKDF info that turns a key of any length into the AES-256 key
+var aesGCMKeyInfo = []byte("thanhlv-ed aes-256-gcm")
+
+// AESGCMProvider implements CryptoProvider with AES-256-GCM in a self-describing
+// envelope. Unlike AESProvider the ciphertext is authenticated, header included.
+// The key may be any length; HKDF-SHA256 derives the AES key from it.
+type AESGCMProvider struct {
+	EnvelopeOptions
+}
+
+func (a *AESGCMProvider) Encrypt(data []byte, key []byte) ([]byte, error) {
+	utils.DebugLogf("AESGCMProvider.Encrypt: encrypting %d bytes of data", len(data))
+	aesKey, err := DeriveKey(key, nil, aesGCMKeyInfo, fileKeySize)
+	if err != nil {
+		return nil, err
+	}
+	keyID, err := symmetricKeyID(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := &envelopeHeader{Algorithm: EnvelopeAES256GCM, KeyID: keyID, Nonce: make([]byte, 12)}
+	if _, err := rand.Read(header.Nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	if data, err = a.apply(header, data); err != nil {
+		return nil, err
+	}
+
+	headerBytes, err := header.marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := sealEnvelopeBody(aesKey, header.Nonce, data, headerBytes)
+	if err != nil {
+		return nil, err
+	}
+	return append(headerBytes, body...), nil
+}
+
+func (a *AESGCMProvider) Decrypt(data []byte, key []byte) ([]byte, error) {
+	utils.DebugLogf("AESGCMProvider.Decrypt: decrypting %d bytes of data", len(data))
+	header, headerBytes, body, err := parseEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	if header.Algorithm != EnvelopeAES256GCM {
+		return nil, fmt.Errorf("data is a %s envelope, not aes-256-gcm", header.Algorithm)
+	}
+	if err := checkNotAfter(header); err != nil {
+		return nil, err
+	}
+	plaintext, err := openAESGCMEnvelope(header, headerBytes, body, key, DefaultMaxDecompressedSize)
+	if err != nil {
+		return nil, err
+	}
+	_, content, err := splitFileMetadata(header, plaintext)
+	return content, err
+}
+
+func (a *AESGCMProvider) GenerateKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return key, nil
+}
+
+func openAESGCMEnvelope(header *envelopeHeader, headerBytes, body, key []byte, maxSize int64) ([]byte, error) {
+	aesKey, err := aesGCMBodyKey(header, key)
+	if err != nil {
+		return nil, err
+	}
+	return openEnvelopePayload(header, aesKey, body, headerBytes, maxSize)
+}
+
+// aesGCMBodyKey checks the key against the header's key id and derives the body key
+func aesGCMBodyKey(header *envelopeHeader, key []byte) ([]byte, error) {
+	if err := checkSymmetricKeyID(header, key); err != nil {
+		return nil, err
+	}
+	return DeriveKey(key, nil, aesGCMKeyInfo, fileKeySize)
+}
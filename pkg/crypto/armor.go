@@ -0,0 +1,148 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+const (
+	armorBegin     = "-----BEGIN THANHLV ENCRYPTED MESSAGE-----"
+	armorEnd       = "-----END THANHLV ENCRYPTED MESSAGE-----"
+	armorLineWidth = 64
+	crc24Init      = 0xb704ce
+	crc24Poly      = 0x1864cfb
+)
+
+// ArmorHeader is a "Key: Value" line between the BEGIN line and the data
+type ArmorHeader struct {
+	Key   string
+	Value string
+}
+
+// ParseArmorHeader parses a "Key: Value" string
+func ParseArmorHeader(s string) (ArmorHeader, error) {
+	key, value, ok := strings.Cut(s, ":")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" || strings.ContainsAny(key, " \t\r\n") || strings.ContainsAny(value, "\r\n") {
+		return ArmorHeader{}, fmt.Errorf("invalid armor header %q, expected \"Key: Value\"", s)
+	}
+	return ArmorHeader{Key: key, Value: strings.TrimSpace(value)}, nil
+}
+
+// Armor encodes data as a PEM-like text block in the OpenPGP style: BEGIN line,
+// optional headers and a blank line, base64 wrapped at 64 columns, a CRC-24
+// checksum line starting with "=" and the END line
+func Armor(data []byte, headers []ArmorHeader) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(armorBegin + "\n")
+	for _, h := range headers {
+		fmt.Fprintf(&buf, "%s: %s\n", h.Key, h.Value)
+	}
+	if len(headers) > 0 {
+		buf.WriteString("\n")
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > armorLineWidth {
+		buf.WriteString(encoded[:armorLineWidth] + "\n")
+		encoded = encoded[armorLineWidth:]
+	}
+	if encoded != "" {
+		buf.WriteString(encoded + "\n")
+	}
+
+	crc := crc24(data)
+	buf.WriteString("=" + base64.StdEncoding.EncodeToString([]byte{byte(crc >> 16), byte(crc >> 8), byte(crc)}) + "\n")
+	buf.WriteString(armorEnd + "\n")
+	return buf.Bytes()
+}
+
+// IsArmored reports whether data starts with the armor BEGIN line, ignoring leading whitespace
+func IsArmored(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte(armorBegin))
+}
+
+// Dearmor decodes an armored block. Text before the BEGIN line and after the END
+// line is ignored, as are CRLF line endings and indentation added by mail clients.
+func Dearmor(data []byte) ([]byte, []ArmorHeader, error) {
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	start := -1
+	for i, line := range lines {
+		if strings.TrimSpace(line) == armorBegin {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return nil, nil, fmt.Errorf("armor BEGIN line not found")
+	}
+
+	var headers []ArmorHeader
+	var body strings.Builder
+	var checksum string
+	inHeaders, ended := true, false
+	for _, line := range lines[start+1:] {
+		line = strings.TrimSpace(line)
+		if line == armorEnd {
+			ended = true
+			break
+		}
+		if inHeaders {
+			if line == "" {
+				inHeaders = false
+				continue
+			}
+			if strings.Contains(line, ":") {
+				h, err := ParseArmorHeader(line)
+				if err != nil {
+					return nil, nil, err
+				}
+				headers = append(headers, h)
+				continue
+			}
+			// No headers: the data starts right after the BEGIN line
+			inHeaders = false
+		}
+		if strings.HasPrefix(line, "=") && len(line) == 5 {
+			checksum = line[1:]
+			continue
+		}
+		body.WriteString(line)
+	}
+	if !ended {
+		return nil, nil, fmt.Errorf("armor END line not found")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(body.String())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode armored data: %w", err)
+	}
+	if checksum != "" {
+		sum, err := base64.StdEncoding.DecodeString(checksum)
+		if err != nil || len(sum) != 3 {
+			return nil, nil, fmt.Errorf("invalid armor checksum line")
+		}
+		crc := crc24(decoded)
+		if sum[0] != byte(crc>>16) || sum[1] != byte(crc>>8) || sum[2] != byte(crc) {
+			return nil, nil, fmt.Errorf("armor checksum mismatch; the message was damaged in transit")
+		}
+	}
+	return decoded, headers, nil
+}
+
+// crc24 is the OpenPGP armor checksum (RFC 4880, section 6.1)
+func crc24(data []byte) uint32 {
+	crc := uint32(crc24Init)
+	for _, b := range data {
+		crc ^= uint32(b) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= crc24Poly
+			}
+		}
+	}
+	return crc & 0xffffff
+}
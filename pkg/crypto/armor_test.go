@@ -0,0 +1,137 @@
+package crypto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCRC24(t *testing.T) {
+	// Check values of CRC-24/OPENPGP
+	if got := crc24(nil); got != crc24Init {
+		t.Errorf("crc24(empty) = %06x, want %06x", got, crc24Init)
+	}
+	if got := crc24([]byte("123456789")); got != 0x21cf02 {
+		t.Errorf("crc24(123456789) = %06x, want 21cf02", got)
+	}
+}
+
+func TestArmorRoundTrip(t *testing.T) {
+	headers := []ArmorHeader{{"Comment", "quarterly report"}, {"Version", "1"}}
+	for _, n := range []int{0, 1, 47, 48, 49, 1000} {
+		data := parallelTestData(n)
+		for _, h := range [][]ArmorHeader{nil, headers} {
+			armored := Armor(data, h)
+			if !IsArmored(armored) {
+				t.Errorf("%d bytes: IsArmored = false", n)
+			}
+			for _, line := range strings.Split(string(armored), "\n") {
+				if len(line) > armorLineWidth && line != armorBegin && line != armorEnd {
+					t.Errorf("%d bytes: line %q is longer than %d", n, line, armorLineWidth)
+				}
+			}
+
+			got, gotHeaders, err := Dearmor(armored)
+			if err != nil {
+				t.Fatalf("%d bytes: %v", n, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("%d bytes: Dearmor returned %d different bytes", n, len(got))
+			}
+			if len(gotHeaders) != len(h) {
+				t.Errorf("%d bytes: headers = %v, want %v", n, gotHeaders, h)
+				continue
+			}
+			for i := range h {
+				if gotHeaders[i] != h[i] {
+					t.Errorf("%d bytes: header %d = %v, want %v", n, i, gotHeaders[i], h[i])
+				}
+			}
+		}
+	}
+}
+
+func TestDearmorMailClients(t *testing.T) {
+	data := []byte("forwarded by mail")
+	armored := string(Armor(data, []ArmorHeader{{"Comment", "fwd"}}))
+
+	for name, text := range map[string]string{
+		"crlf":         strings.ReplaceAll(armored, "\n", "\r\n"),
+		"indented":     "  " + strings.ReplaceAll(strings.TrimSuffix(armored, "\n"), "\n", "\n  ") + "\n",
+		"quoted reply": "Here it is:\n\n" + armored + "\nThanks\n",
+	} {
+		got, _, err := Dearmor([]byte(text))
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s: Dearmor = %q, %v", name, got, err)
+		}
+	}
+
+	// The checksum line is optional
+	var noChecksum []string
+	for _, line := range strings.Split(armored, "\n") {
+		if !strings.HasPrefix(line, "=") {
+			noChecksum = append(noChecksum, line)
+		}
+	}
+	if got, _, err := Dearmor([]byte(strings.Join(noChecksum, "\n"))); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("without a checksum: Dearmor = %q, %v", got, err)
+	}
+}
+
+func TestDearmorDamaged(t *testing.T) {
+	armored := string(Armor([]byte("damaged in transit, twice over"), nil))
+	lines := strings.Split(armored, "\n")
+	body := lines[1]
+
+	// Swap two different characters of the body so the base64 still decodes
+	swapped := []byte(body)
+	for i := 1; i < len(swapped); i++ {
+		if swapped[i] != swapped[0] {
+			swapped[0], swapped[i] = swapped[i], swapped[0]
+			break
+		}
+	}
+
+	for name, tt := range map[string]struct {
+		text string
+		want string
+	}{
+		"no begin line":   {strings.Replace(armored, armorBegin, "-----BEGIN PGP MESSAGE-----", 1), "BEGIN line not found"},
+		"no end line":     {strings.Replace(armored, armorEnd, "", 1), "END line not found"},
+		"truncated":       {strings.Join(lines[:2], "\n"), "END line not found"},
+		"changed data":    {strings.Replace(armored, body, string(swapped), 1), "checksum mismatch"},
+		"bad base64":      {strings.Replace(armored, body, "!"+body[1:], 1), "decode"},
+		"bad checksum":    {strings.Replace(armored, lines[2], "=!!!!", 1), "checksum line"},
+		"bad header line": {strings.Replace(armored, armorBegin+"\n", armorBegin+"\nBad Key: value\n\n", 1), "invalid armor header"},
+	} {
+		_, _, err := Dearmor([]byte(tt.text))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want one about %q", name, err, tt.want)
+		}
+	}
+	if IsArmored([]byte("TLED binary envelope")) {
+		t.Error("IsArmored accepted binary data")
+	}
+}
+
+func TestParseArmorHeader(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want ArmorHeader
+		ok   bool
+	}{
+		{"Comment: hello", ArmorHeader{"Comment", "hello"}, true},
+		{"  Key :  spaced value ", ArmorHeader{"Key", "spaced value"}, true},
+		{"Key:", ArmorHeader{"Key", ""}, true},
+		{"Key: a: b", ArmorHeader{"Key", "a: b"}, true},
+		{"no separator", ArmorHeader{}, false},
+		{": value", ArmorHeader{}, false},
+		{"Two words: value", ArmorHeader{}, false},
+		{"Key: line\nbreak", ArmorHeader{}, false},
+	} {
+		got, err := ParseArmorHeader(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseArmorHeader(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
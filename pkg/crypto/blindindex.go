@@ -0,0 +1,84 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+// DefaultBlindIndexBits is the default blind index size. Short indexes collide on
+// purpose so that an index alone does not identify a single row.
+const DefaultBlindIndexBits = 32
+
+// MinBlindIndexKeySize is the minimum accepted index key length in bytes
+const MinBlindIndexKeySize = 16
+
+// BlindIndexOptions controls how values are normalized and how long the index is
+type BlindIndexOptions struct {
+	// Bits is the index length in bits, between 1 and 256 (0 means DefaultBlindIndexBits)
+	Bits int
+	// CaseFold makes the index case-insensitive
+	CaseFold bool
+	// Trim removes leading and trailing white space
+	Trim bool
+}
+
+// BlindIndex derives a truncated HMAC-SHA256 index of value under a dedicated index key.
+// Equal values (after normalization) give equal indexes, so an encrypted column can be
+// queried for equality by storing the index next to the ciphertext. The index key must
+// not be the key used to encrypt the column.
+func BlindIndex(indexKey []byte, value []byte, opts BlindIndexOptions) ([]byte, error) {
+	bits := opts.Bits
+	if bits == 0 {
+		bits = DefaultBlindIndexBits
+	}
+	if bits < 1 || bits > sha256.Size*8 {
+		return nil, fmt.Errorf("blind index size must be between 1 and %d bits", sha256.Size*8)
+	}
+	if len(indexKey) < MinBlindIndexKeySize {
+		return nil, fmt.Errorf("index key must be at least %d bytes", MinBlindIndexKeySize)
+	}
+
+	normalized := NormalizeBlindIndexValue(string(value), opts)
+	utils.DebugLogf("BlindIndex: computing %d-bit index over %d normalized bytes", bits, len(normalized))
+
+	mac := hmac.New(sha256.New, indexKey)
+	mac.Write([]byte(normalized))
+	sum := mac.Sum(nil)
+
+	// Keep the leading bits and clear the unused low bits of the last byte
+	index := sum[:(bits+7)/8]
+	if rem := bits % 8; rem != 0 {
+		index[len(index)-1] &= byte(0xff << (8 - rem))
+	}
+	return index, nil
+}
+
+// NormalizeBlindIndexValue applies the normalization selected in opts
+func NormalizeBlindIndexValue(value string, opts BlindIndexOptions) string {
+	if opts.Trim {
+		value = strings.TrimSpace(value)
+	}
+	if opts.CaseFold {
+		value = foldCase(value)
+	}
+	return value
+}
+
+// foldCase maps every rune to the smallest rune of its simple case folding orbit,
+// so two strings fold to the same value exactly when strings.EqualFold reports true
+func foldCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		folded := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if f < folded {
+				folded = f
+			}
+		}
+		return folded
+	}, s)
+}
@@ -0,0 +1,94 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"testing"
+)
+
+var blindIndexTestKey = []byte("0123456789abcdef blind index key")
+
+func TestBlindIndexIsTruncatedHMAC(t *testing.T) {
+	mac := hmac.New(sha256.New, blindIndexTestKey)
+	mac.Write([]byte("alice@example.com"))
+	sum := mac.Sum(nil)
+
+	for _, tt := range []struct {
+		bits int
+		want []byte
+	}{
+		{0, sum[:4]},
+		{32, sum[:4]},
+		{256, sum},
+		{8, sum[:1]},
+		{1, []byte{sum[0] & 0x80}},
+		{12, []byte{sum[0], sum[1] & 0xf0}},
+		{255, append(append([]byte{}, sum[:31]...), sum[31]&0xfe)},
+	} {
+		got, err := BlindIndex(blindIndexTestKey, []byte("alice@example.com"), BlindIndexOptions{Bits: tt.bits})
+		if err != nil {
+			t.Fatalf("BlindIndex(%d bits): %v", tt.bits, err)
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("BlindIndex(%d bits) = %x, want %x", tt.bits, got, tt.want)
+		}
+	}
+}
+
+func TestBlindIndexNormalization(t *testing.T) {
+	index := func(value string, opts BlindIndexOptions) []byte {
+		t.Helper()
+		got, err := BlindIndex(blindIndexTestKey, []byte(value), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	for _, tt := range []struct {
+		a, b  string
+		opts  BlindIndexOptions
+		equal bool
+	}{
+		{"Alice@Example.com", "alice@example.com", BlindIndexOptions{}, false},
+		{"Alice@Example.com", "alice@example.com", BlindIndexOptions{CaseFold: true}, true},
+		{" alice ", "alice", BlindIndexOptions{}, false},
+		{" alice\t\n", "alice", BlindIndexOptions{Trim: true}, true},
+		{"  ALICE ", "alice", BlindIndexOptions{Trim: true, CaseFold: true}, true},
+		{"a lice", "alice", BlindIndexOptions{Trim: true, CaseFold: true}, false},
+		// Folding follows strings.EqualFold beyond ASCII
+		{"STRASSE", "strasse", BlindIndexOptions{CaseFold: true}, true},
+		{"ΣΊΣΥΦΟΣ", "σίσυφος", BlindIndexOptions{CaseFold: true}, true},
+		{"k", "\u212a", BlindIndexOptions{CaseFold: true}, true},
+		{"bob", "alice", BlindIndexOptions{CaseFold: true}, false},
+	} {
+		got := bytes.Equal(index(tt.a, tt.opts), index(tt.b, tt.opts))
+		if got != tt.equal {
+			t.Errorf("%+v: index(%q) == index(%q) is %v, want %v", tt.opts, tt.a, tt.b, got, tt.equal)
+		}
+	}
+
+	// Another key gives another index
+	other, err := BlindIndex([]byte("another blind index key"), []byte("alice"), BlindIndexOptions{Bits: 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(other, index("alice", BlindIndexOptions{Bits: 256})) {
+		t.Error("two keys gave the same index")
+	}
+}
+
+func TestBlindIndexErrors(t *testing.T) {
+	for _, bits := range []int{-1, 257} {
+		if _, err := BlindIndex(blindIndexTestKey, []byte("alice"), BlindIndexOptions{Bits: bits}); err == nil {
+			t.Errorf("BlindIndex(%d bits) succeeded", bits)
+		}
+	}
+	if _, err := BlindIndex(make([]byte, MinBlindIndexKeySize-1), []byte("alice"), BlindIndexOptions{}); err == nil {
+		t.Error("BlindIndex with a short key succeeded")
+	}
+	if _, err := BlindIndex(make([]byte, MinBlindIndexKeySize), nil, BlindIndexOptions{}); err != nil {
+		t.Errorf("BlindIndex of an empty value: %v", err)
+	}
+}
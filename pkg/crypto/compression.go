@@ -0,0 +1,126 @@
+package crypto
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CompressionAlgorithm selects how the plaintext is compressed before encryption.
+// Compressing attacker-influenced data next to secrets leaks the secrets through
+// the ciphertext length (CRIME, BREACH); only compress data that is not mixed so.
+type CompressionAlgorithm uint8
+
+const (
+	CompressionNone    CompressionAlgorithm = 0
+	CompressionGzip    CompressionAlgorithm = 1
+	CompressionDeflate CompressionAlgorithm = 2
+)
+
+// DefaultMaxDecompressedSize bounds decompression, so a small crafted ciphertext
+// cannot expand into gigabytes of memory
+const DefaultMaxDecompressedSize = 1 << 30
+
+// ErrDecompressionLimit is returned when decompressed data would exceed the limit
+var ErrDecompressionLimit = errors.New("decompressed data exceeds the size limit")
+
+// ParseCompressionAlgorithm parses gzip and deflate
+func ParseCompressionAlgorithm(name string) (CompressionAlgorithm, error) {
+	switch strings.ToLower(name) {
+	case "gzip":
+		return CompressionGzip, nil
+	case "deflate":
+		return CompressionDeflate, nil
+	default:
+		return CompressionNone, fmt.Errorf("unsupported compression: %s (use gzip or deflate)", name)
+	}
+}
+
+func (c CompressionAlgorithm) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionDeflate:
+		return "deflate"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(c))
+	}
+}
+
+// newWriter returns a compressing writer into w at level (1-9, 0 for the default)
+func (c CompressionAlgorithm) newWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+	var cw io.WriteCloser
+	var err error
+	switch c {
+	case CompressionGzip:
+		cw, err = gzip.NewWriterLevel(w, level)
+	case CompressionDeflate:
+		cw, err = flate.NewWriter(w, level)
+	default:
+		return nil, fmt.Errorf("unsupported compression %s", c)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid compression level %d", level)
+	}
+	return cw, nil
+}
+
+// newReader returns a decompressing reader of r
+func (c CompressionAlgorithm) newReader(r io.Reader) (io.ReadCloser, error) {
+	switch c {
+	case CompressionGzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress: %w", err)
+		}
+		return zr, nil
+	case CompressionDeflate:
+		return flate.NewReader(r), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %s", c)
+	}
+}
+
+// compress compresses data at level (1-9, 0 for the default)
+func (c CompressionAlgorithm) compress(data []byte, level int) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := c.newWriter(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress expands data, failing with ErrDecompressionLimit past limit bytes
+func (c CompressionAlgorithm) decompress(data []byte, limit int64) ([]byte, error) {
+	r, err := c.newReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	out, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+	if int64(len(out)) > limit {
+		return nil, fmt.Errorf("%w of %d bytes", ErrDecompressionLimit, limit)
+	}
+	return out, nil
+}
@@ -0,0 +1,119 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("compressible text, "), 500)
+	for _, c := range []CompressionAlgorithm{CompressionGzip, CompressionDeflate} {
+		for _, level := range []int{0, 1, 9} {
+			compressed, err := c.compress(data, level)
+			if err != nil {
+				t.Fatalf("%s level %d: %v", c, level, err)
+			}
+			if len(compressed) >= len(data)/10 {
+				t.Errorf("%s level %d: %d bytes compressed to %d", c, level, len(data), len(compressed))
+			}
+			got, err := c.decompress(compressed, DefaultMaxDecompressedSize)
+			if err != nil || !bytes.Equal(got, data) {
+				t.Errorf("%s level %d: decompress = %d bytes, %v", c, level, len(got), err)
+			}
+		}
+		if _, err := c.compress(data, 10); err == nil {
+			t.Errorf("%s: level 10 accepted", c)
+		}
+		if _, err := c.decompress([]byte("not compressed at all"), DefaultMaxDecompressedSize); err == nil {
+			t.Errorf("%s: garbage decompressed", c)
+		}
+	}
+	if _, err := CompressionNone.compress(data, 0); err == nil {
+		t.Error("compress without an algorithm succeeded")
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	data := make([]byte, 1000)
+	for _, c := range []CompressionAlgorithm{CompressionGzip, CompressionDeflate} {
+		compressed, err := c.compress(data, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := c.decompress(compressed, 1000); err != nil || len(got) != 1000 {
+			t.Errorf("%s: at the limit: %d bytes, %v", c, len(got), err)
+		}
+		if _, err := c.decompress(compressed, 999); !errors.Is(err, ErrDecompressionLimit) {
+			t.Errorf("%s: past the limit: error = %v, want ErrDecompressionLimit", c, err)
+		}
+	}
+}
+
+func TestCompressionBomb(t *testing.T) {
+	// 16 MiB of zeros compress to a few kilobytes
+	const size = 16 << 20
+	bomb := make([]byte, size)
+	provider := &AESGCMProvider{EnvelopeOptions: EnvelopeOptions{Compression: CompressionDeflate, CompressionLevel: 9}}
+	data, err := SealEnvelope(provider, bomb, parallelTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > size/100 {
+		t.Fatalf("%d bytes sealed into %d", size, len(data))
+	}
+
+	if _, err := OpenEnvelope(data, parallelTestKey, &OpenOptions{MaxDecompressedSize: 1 << 20}); !errors.Is(err, ErrDecompressionLimit) {
+		t.Errorf("OpenEnvelope error = %v, want ErrDecompressionLimit", err)
+	}
+	if got, err := OpenEnvelope(data, parallelTestKey, &OpenOptions{MaxDecompressedSize: size}); err != nil || len(got) != size {
+		t.Errorf("at the limit: OpenEnvelope = %d bytes, %v", len(got), err)
+	}
+
+	stream := encryptStreamForTest(t, bomb, &StreamOptions{EnvelopeOptions: EnvelopeOptions{Compression: CompressionGzip}})
+	for _, tt := range []struct {
+		limit int64
+		ok    bool
+	}{
+		{size, true},
+		{size - 1, false},
+		{1 << 20, false},
+	} {
+		for _, parallelism := range []int{1, 4} {
+			r, err := NewDecryptReader(bytes.NewReader(stream), parallelTestKey, &OpenOptions{MaxDecompressedSize: tt.limit, Parallelism: parallelism})
+			if err != nil {
+				t.Fatal(err)
+			}
+			n, err := io.Copy(io.Discard, r)
+			if tt.ok && (err != nil || n != size) {
+				t.Errorf("stream, limit %d: read %d bytes, %v", tt.limit, n, err)
+			}
+			if !tt.ok && (!errors.Is(err, ErrDecompressionLimit) || n > tt.limit) {
+				t.Errorf("stream, limit %d: read %d bytes, error = %v, want ErrDecompressionLimit", tt.limit, n, err)
+			}
+			if c, ok := r.(io.Closer); ok {
+				c.Close()
+			}
+		}
+	}
+}
+
+func TestParseCompressionAlgorithm(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want CompressionAlgorithm
+		ok   bool
+	}{
+		{"gzip", CompressionGzip, true},
+		{"Deflate", CompressionDeflate, true},
+		{"none", CompressionNone, false},
+		{"zstd", CompressionNone, false},
+		{"", CompressionNone, false},
+	} {
+		got, err := ParseCompressionAlgorithm(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseCompressionAlgorithm(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
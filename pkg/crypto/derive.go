@@ -0,0 +1,41 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+// DeriveKey derives a length-byte key from master with HKDF-SHA256 (RFC 5869).
+// Different info values give independent keys from the same master key; salt is
+// optional and may be nil.
+func DeriveKey(master, salt, info []byte, length int) ([]byte, error) {
+	return deriveHKDF(sha256.New, master, salt, info, length)
+}
+
+// DeriveKeySHA512 is DeriveKey with HKDF-SHA512
+func DeriveKeySHA512(master, salt, info []byte, length int) ([]byte, error) {
+	return deriveHKDF(sha512.New, master, salt, info, length)
+}
+
+func deriveHKDF(newHash func() hash.Hash, master, salt, info []byte, length int) ([]byte, error) {
+	utils.DebugLogf("DeriveKey: deriving %d bytes with info %q", length, info)
+	if len(master) == 0 {
+		return nil, fmt.Errorf("master key must not be empty")
+	}
+	// RFC 5869 limits the output to 255 hash blocks
+	if maxLength := 255 * newHash().Size(); length < 1 || length > maxLength {
+		return nil, fmt.Errorf("derived key length must be between 1 and %d bytes", maxLength)
+	}
+
+	key := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.New(newHash, master, salt, info), key); err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	return key, nil
+}
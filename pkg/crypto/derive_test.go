@@ -0,0 +1,96 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// RFC 5869 appendix A, test cases 1 and 3
+func TestDeriveKeyRFC5869(t *testing.T) {
+	ikm := bytes.Repeat([]byte{0x0b}, 22)
+	for _, tt := range []struct {
+		name       string
+		salt, info string
+		okm        string
+	}{
+		{"case 1", "000102030405060708090a0b0c", "f0f1f2f3f4f5f6f7f8f9", "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865"},
+		{"case 3", "", "", "8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d9d201395faa4b61a96c8"},
+	} {
+		want := mustHex(t, tt.okm)
+		got, err := DeriveKey(ikm, mustHex(t, tt.salt), mustHex(t, tt.info), len(want))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: DeriveKey = %x, want %x", tt.name, got, want)
+		}
+	}
+}
+
+func TestDeriveKeySeparation(t *testing.T) {
+	master := []byte("master key material")
+	derive := func(f func(master, salt, info []byte, length int) ([]byte, error), salt, info string, length int) []byte {
+		t.Helper()
+		key, err := f(master, []byte(salt), []byte(info), length)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	a := derive(DeriveKey, "", "encryption", 32)
+	if !bytes.Equal(a, derive(DeriveKey, "", "encryption", 32)) {
+		t.Error("DeriveKey is not deterministic")
+	}
+	for name, other := range map[string][]byte{
+		"another info":   derive(DeriveKey, "", "authentication", 32),
+		"another salt":   derive(DeriveKey, "salt", "encryption", 32),
+		"sha512":         derive(DeriveKeySHA512, "", "encryption", 32),
+		"sha512 prefix":  derive(DeriveKeySHA512, "", "encryption", 64)[:32],
+		"another master": func() []byte { k, _ := DeriveKey([]byte("other master"), nil, []byte("encryption"), 32); return k }(),
+	} {
+		if bytes.Equal(a, other) {
+			t.Errorf("%s gave the same key", name)
+		}
+	}
+	// A shorter key is a prefix of a longer one with the same inputs
+	if long := derive(DeriveKey, "", "encryption", 100); !bytes.Equal(long[:32], a) {
+		t.Error("DeriveKey(32) is not a prefix of DeriveKey(100)")
+	}
+}
+
+func TestDeriveKeyLimits(t *testing.T) {
+	master := []byte("master")
+	for _, tt := range []struct {
+		f      func(master, salt, info []byte, length int) ([]byte, error)
+		name   string
+		length int
+		ok     bool
+	}{
+		{DeriveKey, "sha256", 1, true},
+		{DeriveKey, "sha256", 255 * 32, true},
+		{DeriveKey, "sha256", 255*32 + 1, false},
+		{DeriveKey, "sha256", 0, false},
+		{DeriveKey, "sha256", -1, false},
+		{DeriveKeySHA512, "sha512", 255 * 64, true},
+		{DeriveKeySHA512, "sha512", 255*64 + 1, false},
+	} {
+		key, err := tt.f(master, nil, nil, tt.length)
+		if (err == nil) != tt.ok || (tt.ok && len(key) != tt.length) {
+			t.Errorf("%s length %d: got %d bytes, %v", tt.name, tt.length, len(key), err)
+		}
+	}
+	if _, err := DeriveKey(nil, nil, nil, 32); err == nil {
+		t.Error("DeriveKey with an empty master key succeeded")
+	}
+}
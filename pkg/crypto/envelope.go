@@ -0,0 +1,661 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+// Envelope layout:
+//
+//	magic "TLED" | version (1) | header length (4, big endian) | header fields | body
+//
+// Header fields are tag (1) | length (2, big endian) | value. For aes-256-gcm,
+// passphrase and multi-recipient envelopes the whole header, magic included, is
+// authenticated as additional data of the body AEAD. Envelopes around the legacy
+// aes-256-cbc, rsa and hpke outputs only label the body: a tampered header makes
+// decryption fail but is not detected as such. With a chunk size field the body is
+// a sequence of chunks (see stream.go) instead of a single AEAD ciphertext.
+
+var envelopeMagic = []byte("TLED")
+
+const envelopeVersion = 1
+
+// envelopePrefixSize is magic, version and header length
+const envelopePrefixSize = 4 + 1 + 4
+
+// maxEnvelopeHeaderSize bounds the header so a corrupted length cannot trigger a huge allocation
+const maxEnvelopeHeaderSize = 1 << 20
+
+const (
+	headerTagRecipient byte = 0x01
+	headerTagNonce     byte = 0x02
+	headerTagKDF       byte = 0x03
+	headerTagAlgorithm byte = 0x04
+	headerTagKeyID     byte = 0x05
+	headerTagFlags     byte = 0x06
+	headerTagNotAfter  byte = 0x07
+	headerTagPadding   byte = 0x08
+	headerTagCompress  byte = 0x09
+	headerTagChunkSize byte = 0x0a
+)
+
+// EnvelopeAlgorithm identifies how an envelope body is encrypted
+type EnvelopeAlgorithm uint8
+
+const (
+	EnvelopeAES256GCM      EnvelopeAlgorithm = 1
+	EnvelopeAES256CBC      EnvelopeAlgorithm = 2
+	EnvelopeRSA            EnvelopeAlgorithm = 3
+	EnvelopeHPKE           EnvelopeAlgorithm = 4
+	EnvelopeMultiRecipient EnvelopeAlgorithm = 5
+	EnvelopePassphrase     EnvelopeAlgorithm = 6
+)
+
+// Envelope flags record options the reader must supply again, and how the
+// plaintext is framed
+const (
+	EnvelopeFlagHPKEPSK  uint32 = 1 << 0
+	EnvelopeFlagHPKEAuth uint32 = 1 << 1
+	// EnvelopeFlagFileMetadata marks a plaintext that starts with file metadata
+	// (see filemeta.go). Only envelopes with an authenticated header carry it.
+	EnvelopeFlagFileMetadata uint32 = 1 << 2
+
+	knownEnvelopeFlags = EnvelopeFlagHPKEPSK | EnvelopeFlagHPKEAuth | EnvelopeFlagFileMetadata
+)
+
+// keyIDSize is the length of the key fingerprint stored in the header
+const keyIDSize = 8
+
+// ErrKeyMismatch is returned when the key's fingerprint differs from the one in the header
+var ErrKeyMismatch = errors.New("key does not match the key this data was encrypted with")
+
+func (a EnvelopeAlgorithm) String() string {
+	switch a {
+	case EnvelopeAES256GCM:
+		return "aes-256-gcm"
+	case EnvelopeAES256CBC:
+		return "aes-256-cbc"
+	case EnvelopeRSA:
+		return "rsa"
+	case EnvelopeHPKE:
+		return "hpke"
+	case EnvelopeMultiRecipient:
+		return "multi-recipient"
+	case EnvelopePassphrase:
+		return "passphrase"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(a))
+	}
+}
+
+type envelopeHeader struct {
+	Algorithm EnvelopeAlgorithm
+	// HPKESuite is set for EnvelopeHPKE
+	HPKESuite HPKESuite
+	// KeyID fingerprints the key for single-key algorithms, so a wrong key fails early
+	KeyID      []byte
+	Flags      uint32
+	Recipients []recipientStanza
+	Nonce      []byte
+	// KDF is set when the body key is derived from a passphrase
+	KDF *KDFParams
+	// NotAfter is the expiry time, zero if the data does not expire
+	NotAfter time.Time
+	// Padding is set when the plaintext was padded to hide its length
+	Padding PaddingScheme
+	// Compression is set when the plaintext was compressed before padding and encryption
+	Compression CompressionAlgorithm
+	// ChunkSize is set when the body is chunked for streaming, with Nonce as the stream salt
+	ChunkSize uint32
+}
+
+// EnvelopeOptions are recorded in the header of the envelopes whose header is
+// authenticated, so they cannot be changed without breaking decryption:
+// aes-256-gcm, passphrase and multi-recipient
+type EnvelopeOptions struct {
+	// NotAfter, if set, is the expiry time
+	NotAfter time.Time
+	// Padding, if set, pads the plaintext to hide its length
+	Padding PaddingScheme
+	// Compression, if set, compresses the plaintext at CompressionLevel (1-9, 0 for the default)
+	Compression      CompressionAlgorithm
+	CompressionLevel int
+	// FileMetadata, if set, is stored in front of the plaintext, so it is encrypted
+	// with it, and flagged in the header
+	FileMetadata *FileMetadata
+}
+
+// SupportsEnvelopeOptions reports whether provider writes envelopes whose header
+// is authenticated, and so takes EnvelopeOptions
+func SupportsEnvelopeOptions(provider CryptoProvider) bool {
+	switch provider.(type) {
+	case *AESGCMProvider, *PassphraseProvider, *MultiRecipientProvider:
+		return true
+	}
+	return false
+}
+
+// SetEnvelopeOptions sets the options of an aes-256-gcm, passphrase or multi-recipient provider
+func SetEnvelopeOptions(provider CryptoProvider, opts EnvelopeOptions) error {
+	switch p := provider.(type) {
+	case *AESGCMProvider:
+		p.EnvelopeOptions = opts
+	case *PassphraseProvider:
+		p.EnvelopeOptions = opts
+	case *MultiRecipientProvider:
+		p.EnvelopeOptions = opts
+	default:
+		return fmt.Errorf("expiry, padding, compression and file metadata are only supported with aes-256-gcm, passphrase and multi-recipient encryption")
+	}
+	return nil
+}
+
+// apply records the options in header, then adds the file metadata, compresses
+// and pads data as requested
+func (o EnvelopeOptions) apply(header *envelopeHeader, data []byte) ([]byte, error) {
+	header.NotAfter = o.NotAfter
+	if o.FileMetadata != nil {
+		framed, err := WrapFileMetadata(o.FileMetadata, data)
+		if err != nil {
+			return nil, err
+		}
+		header.Flags |= EnvelopeFlagFileMetadata
+		data = framed
+	}
+	if o.Compression != CompressionNone {
+		compressed, err := o.Compression.compress(data, o.CompressionLevel)
+		if err != nil {
+			return nil, err
+		}
+		utils.DebugLogf("Compressed %d bytes to %d with %s", len(data), len(compressed), o.Compression)
+		header.Compression = o.Compression
+		data = compressed
+	}
+	if o.Padding.Kind == PaddingNone {
+		return data, nil
+	}
+	header.Padding = o.Padding
+	return o.Padding.pad(data)
+}
+
+// IsEnvelope reports whether data starts with the envelope magic bytes
+func IsEnvelope(data []byte) bool {
+	return len(data) >= envelopePrefixSize && bytes.Equal(data[:len(envelopeMagic)], envelopeMagic)
+}
+
+func (h *envelopeHeader) marshal() ([]byte, error) {
+	var fields []byte
+	appendField := func(tag byte, value []byte) error {
+		if len(value) > 0xffff {
+			return fmt.Errorf("header field 0x%02x is too large", tag)
+		}
+		fields = append(fields, tag)
+		fields = binary.BigEndian.AppendUint16(fields, uint16(len(value)))
+		fields = append(fields, value...)
+		return nil
+	}
+
+	if h.Algorithm != 0 {
+		algorithm := []byte{byte(h.Algorithm)}
+		if h.Algorithm == EnvelopeHPKE {
+			algorithm = binary.BigEndian.AppendUint16(algorithm, uint16(h.HPKESuite.KEM))
+			algorithm = binary.BigEndian.AppendUint16(algorithm, uint16(h.HPKESuite.KDF))
+			algorithm = binary.BigEndian.AppendUint16(algorithm, uint16(h.HPKESuite.AEAD))
+		}
+		if err := appendField(headerTagAlgorithm, algorithm); err != nil {
+			return nil, err
+		}
+	}
+	if len(h.KeyID) > 0 {
+		if err := appendField(headerTagKeyID, h.KeyID); err != nil {
+			return nil, err
+		}
+	}
+	if h.Flags != 0 {
+		if err := appendField(headerTagFlags, binary.BigEndian.AppendUint32(nil, h.Flags)); err != nil {
+			return nil, err
+		}
+	}
+	if h.Compression != CompressionNone {
+		if err := appendField(headerTagCompress, []byte{byte(h.Compression)}); err != nil {
+			return nil, err
+		}
+	}
+	if h.Padding.Kind != PaddingNone {
+		if err := appendField(headerTagPadding, h.Padding.marshal()); err != nil {
+			return nil, err
+		}
+	}
+	if h.ChunkSize != 0 {
+		if err := appendField(headerTagChunkSize, binary.BigEndian.AppendUint32(nil, h.ChunkSize)); err != nil {
+			return nil, err
+		}
+	}
+	if !h.NotAfter.IsZero() {
+		if err := appendField(headerTagNotAfter, binary.BigEndian.AppendUint64(nil, uint64(h.NotAfter.Unix()))); err != nil {
+			return nil, err
+		}
+	}
+	for _, stanza := range h.Recipients {
+		if err := appendField(headerTagRecipient, stanza.marshal()); err != nil {
+			return nil, err
+		}
+	}
+	if h.KDF != nil {
+		if err := appendField(headerTagKDF, h.KDF.marshal()); err != nil {
+			return nil, err
+		}
+	}
+	if len(h.Nonce) > 0 {
+		if err := appendField(headerTagNonce, h.Nonce); err != nil {
+			return nil, err
+		}
+	}
+
+	out := append([]byte{}, envelopeMagic...)
+	out = append(out, envelopeVersion)
+	out = binary.BigEndian.AppendUint32(out, uint32(len(fields)))
+	return append(out, fields...), nil
+}
+
+// parseEnvelope splits an envelope into its header, the raw header bytes (the AEAD
+// additional data) and the body
+func parseEnvelope(data []byte) (*envelopeHeader, []byte, []byte, error) {
+	if !IsEnvelope(data) {
+		return nil, nil, nil, fmt.Errorf("data is not an encrypted envelope")
+	}
+	if version := data[len(envelopeMagic)]; version != envelopeVersion {
+		return nil, nil, nil, fmt.Errorf("unsupported envelope version %d", version)
+	}
+
+	headerLen := binary.BigEndian.Uint32(data[len(envelopeMagic)+1:])
+	if headerLen > maxEnvelopeHeaderSize || int(headerLen) > len(data)-envelopePrefixSize {
+		return nil, nil, nil, fmt.Errorf("envelope header is truncated")
+	}
+	headerEnd := envelopePrefixSize + int(headerLen)
+	fields := data[envelopePrefixSize:headerEnd]
+
+	header := &envelopeHeader{}
+	for len(fields) > 0 {
+		if len(fields) < 3 {
+			return nil, nil, nil, fmt.Errorf("envelope header is truncated")
+		}
+		tag := fields[0]
+		length := int(binary.BigEndian.Uint16(fields[1:3]))
+		if len(fields) < 3+length {
+			return nil, nil, nil, fmt.Errorf("envelope header is truncated")
+		}
+		value := fields[3 : 3+length]
+		fields = fields[3+length:]
+
+		switch tag {
+		case headerTagRecipient:
+			stanza, err := parseRecipientStanza(value)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			header.Recipients = append(header.Recipients, stanza)
+		case headerTagNonce:
+			header.Nonce = value
+		case headerTagKDF:
+			params, err := parseKDFParams(value)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			header.KDF = params
+		case headerTagAlgorithm:
+			if len(value) == 0 {
+				return nil, nil, nil, fmt.Errorf("envelope algorithm field is empty")
+			}
+			header.Algorithm = EnvelopeAlgorithm(value[0])
+			if header.Algorithm == EnvelopeHPKE {
+				if len(value) != 7 {
+					return nil, nil, nil, fmt.Errorf("invalid HPKE suite in envelope header")
+				}
+				header.HPKESuite = HPKESuite{
+					KEM:  HPKEKEM(binary.BigEndian.Uint16(value[1:])),
+					KDF:  HPKEKDF(binary.BigEndian.Uint16(value[3:])),
+					AEAD: HPKEAEAD(binary.BigEndian.Uint16(value[5:])),
+				}
+			}
+		case headerTagKeyID:
+			header.KeyID = value
+		case headerTagFlags:
+			if len(value) != 4 {
+				return nil, nil, nil, fmt.Errorf("invalid envelope flags field")
+			}
+			header.Flags = binary.BigEndian.Uint32(value)
+		case headerTagNotAfter:
+			if len(value) != 8 {
+				return nil, nil, nil, fmt.Errorf("invalid envelope expiry field")
+			}
+			header.NotAfter = time.Unix(int64(binary.BigEndian.Uint64(value)), 0)
+		case headerTagCompress:
+			if len(value) != 1 || (CompressionAlgorithm(value[0]) != CompressionGzip && CompressionAlgorithm(value[0]) != CompressionDeflate) {
+				return nil, nil, nil, fmt.Errorf("unsupported envelope compression field")
+			}
+			header.Compression = CompressionAlgorithm(value[0])
+		case headerTagPadding:
+			padding, err := parsePaddingScheme(value)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			header.Padding = padding
+		case headerTagChunkSize:
+			if len(value) != 4 {
+				return nil, nil, nil, fmt.Errorf("invalid envelope chunk size field")
+			}
+			header.ChunkSize = binary.BigEndian.Uint32(value)
+			if header.ChunkSize < minStreamChunkSize || header.ChunkSize > maxStreamChunkSize {
+				return nil, nil, nil, fmt.Errorf("unsupported envelope chunk size %d", header.ChunkSize)
+			}
+		default:
+			return nil, nil, nil, fmt.Errorf("unknown envelope header field 0x%02x", tag)
+		}
+	}
+
+	if header.Flags&^knownEnvelopeFlags != 0 {
+		return nil, nil, nil, fmt.Errorf("unsupported envelope flags 0x%08x", header.Flags)
+	}
+
+	// Passphrase and multi-recipient envelopes written before the algorithm field existed
+	if header.Algorithm == 0 {
+		switch {
+		case header.KDF != nil:
+			header.Algorithm = EnvelopePassphrase
+		case len(header.Recipients) > 0:
+			header.Algorithm = EnvelopeMultiRecipient
+		default:
+			return nil, nil, nil, fmt.Errorf("envelope header does not name an algorithm")
+		}
+	}
+
+	// The flag decides how the plaintext is read, so it must be authenticated
+	if header.Flags&EnvelopeFlagFileMetadata != 0 && !header.authenticated() {
+		return nil, nil, nil, fmt.Errorf("%s envelopes cannot carry file metadata", header.Algorithm)
+	}
+
+	return header, data[:headerEnd], data[headerEnd:], nil
+}
+
+// authenticated reports whether the body AEAD authenticates the header
+func (h *envelopeHeader) authenticated() bool {
+	switch h.Algorithm {
+	case EnvelopeAES256GCM, EnvelopePassphrase, EnvelopeMultiRecipient:
+		return true
+	}
+	return false
+}
+
+// splitFileMetadata splits the plaintext of an envelope into its file metadata and
+// content if the header flags metadata; otherwise it is all content
+func splitFileMetadata(header *envelopeHeader, plaintext []byte) (*FileMetadata, []byte, error) {
+	if header.Flags&EnvelopeFlagFileMetadata == 0 {
+		return nil, plaintext, nil
+	}
+	return UnwrapFileMetadata(plaintext)
+}
+
+// SealEnvelope encrypts data with provider and wraps the result in an envelope that
+// names the algorithm and fingerprints the key, so OpenEnvelope needs no algorithm
+// choice and rejects a wrong key before decrypting. Format-preserving providers
+// cannot be wrapped, as that would break the format.
+func SealEnvelope(provider CryptoProvider, data, key []byte) ([]byte, error) {
+	header := &envelopeHeader{}
+	switch p := provider.(type) {
+	case *AESGCMProvider, *PassphraseProvider, *MultiRecipientProvider:
+		// These write envelopes themselves
+		return provider.Encrypt(data, key)
+	case *AESProvider:
+		keyID, err := symmetricKeyID(key)
+		if err != nil {
+			return nil, err
+		}
+		header.Algorithm = EnvelopeAES256CBC
+		header.KeyID = keyID
+	case *RSAProvider:
+		header.Algorithm = EnvelopeRSA
+		header.KeyID = publicKeyID(key)
+	case *HPKEProvider:
+		header.Algorithm = EnvelopeHPKE
+		header.HPKESuite = p.Suite
+		header.KeyID = publicKeyID(key)
+		if p.Options != nil && len(p.Options.PSK) > 0 {
+			header.Flags |= EnvelopeFlagHPKEPSK
+		}
+		if p.Options != nil && len(p.Options.SenderPrivateKey) > 0 {
+			header.Flags |= EnvelopeFlagHPKEAuth
+		}
+	default:
+		return nil, fmt.Errorf("%T ciphertexts cannot be wrapped in an envelope", provider)
+	}
+
+	body, err := provider.Encrypt(data, key)
+	if err != nil {
+		return nil, err
+	}
+
+	headerBytes, err := header.marshal()
+	if err != nil {
+		return nil, err
+	}
+	return append(headerBytes, body...), nil
+}
+
+// OpenOptions are the optional inputs of OpenEnvelope
+type OpenOptions struct {
+	// HPKE supplies the PSK or sender key of HPKE envelopes
+	HPKE *HPKEOptions
+	// IgnoreExpiry decrypts data past its not-after time, for recovery
+	IgnoreExpiry bool
+	// MaxDecompressedSize bounds compressed payloads; 0 means DefaultMaxDecompressedSize
+	MaxDecompressedSize int64
+	// Parallelism is the number of goroutines NewDecryptReader opens chunks on,
+	// 0 or 1 for the caller's
+	Parallelism int
+	// Progress, if set, is called by NewDecryptReader with the number of ciphertext
+	// bytes read so far
+	Progress ProgressFunc
+}
+
+// OpenEnvelope decrypts any envelope, picking the algorithm from its header. key is
+// the symmetric key, private key or passphrase; opts may be nil. Expired data fails
+// with ErrExpired unless opts.IgnoreExpiry is set. Stored file metadata is dropped;
+// OpenFileEnvelope returns it.
+func OpenEnvelope(data []byte, key []byte, opts *OpenOptions) ([]byte, error) {
+	_, content, err := OpenFileEnvelope(data, key, opts)
+	return content, err
+}
+
+// OpenFileEnvelope is OpenEnvelope that also returns the file metadata stored with
+// the content, or nil if there is none
+func OpenFileEnvelope(data []byte, key []byte, opts *OpenOptions) (*FileMetadata, []byte, error) {
+	header, plaintext, err := openEnvelope(data, key, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return splitFileMetadata(header, plaintext)
+}
+
+// openEnvelope decrypts an envelope and returns its header and plaintext, file
+// metadata included
+func openEnvelope(data []byte, key []byte, opts *OpenOptions) (*envelopeHeader, []byte, error) {
+	header, headerBytes, body, err := parseEnvelope(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	plaintext, err := openParsedEnvelope(header, headerBytes, body, key, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, plaintext, nil
+}
+
+// openParsedEnvelope decrypts the body of an envelope whose header has been parsed
+func openParsedEnvelope(header *envelopeHeader, headerBytes, body, key []byte, opts *OpenOptions) ([]byte, error) {
+	utils.DebugLogf("OpenEnvelope: %s envelope, key id %x, flags 0x%x", header.Algorithm, header.KeyID, header.Flags)
+
+	if opts == nil {
+		opts = &OpenOptions{}
+	}
+	if !opts.IgnoreExpiry {
+		if err := checkNotAfter(header); err != nil {
+			return nil, err
+		}
+	}
+	hpkeOptions := opts.HPKE
+	maxSize := opts.MaxDecompressedSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxDecompressedSize
+	}
+
+	switch header.Algorithm {
+	case EnvelopeAES256GCM:
+		return openAESGCMEnvelope(header, headerBytes, body, key, maxSize)
+	case EnvelopePassphrase:
+		return openPassphraseEnvelope(header, headerBytes, body, key, maxSize)
+	case EnvelopeMultiRecipient:
+		return openRecipientEnvelope(header, headerBytes, body, key, maxSize)
+	case EnvelopeAES256CBC:
+		if err := checkSymmetricKeyID(header, key); err != nil {
+			return nil, err
+		}
+		return (&AESProvider{}).Decrypt(body, key)
+	case EnvelopeRSA:
+		if err := checkPrivateKeyID(header, key); err != nil {
+			return nil, err
+		}
+		return (&RSAProvider{}).Decrypt(body, key)
+	case EnvelopeHPKE:
+		if err := checkPrivateKeyID(header, key); err != nil {
+			return nil, err
+		}
+		if header.Flags&EnvelopeFlagHPKEPSK != 0 && (hpkeOptions == nil || len(hpkeOptions.PSK) == 0) {
+			return nil, fmt.Errorf("data was encrypted in HPKE psk mode; the psk and psk id are required")
+		}
+		if header.Flags&EnvelopeFlagHPKEAuth != 0 && (hpkeOptions == nil || len(hpkeOptions.SenderPublicKey) == 0) {
+			return nil, fmt.Errorf("data was encrypted in HPKE auth mode; the sender public key is required")
+		}
+		return (&HPKEProvider{Suite: header.HPKESuite, Options: hpkeOptions}).Decrypt(body, key)
+	default:
+		return nil, fmt.Errorf("unsupported envelope algorithm %s", header.Algorithm)
+	}
+}
+
+// symmetricKeyID fingerprints a symmetric key with HKDF, so the id reveals nothing
+// about the key that the ciphertext does not
+func symmetricKeyID(key []byte) ([]byte, error) {
+	return DeriveKey(key, nil, []byte("thanhlv-ed key id"), keyIDSize)
+}
+
+// publicKeyID returns the recipient key id of a public key, or nil when the key
+// cannot be parsed here; the provider then reports the key error
+func publicKeyID(key []byte) []byte {
+	recipient, err := ParseRecipient(key)
+	if err != nil {
+		utils.DebugLogf("publicKeyID: no key id for this key: %v", err)
+		return nil
+	}
+	return recipient.KeyID
+}
+
+func checkSymmetricKeyID(header *envelopeHeader, key []byte) error {
+	if len(header.KeyID) == 0 {
+		return nil
+	}
+	keyID, err := symmetricKeyID(key)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(keyID, header.KeyID) {
+		return ErrKeyMismatch
+	}
+	return nil
+}
+
+func checkPrivateKeyID(header *envelopeHeader, key []byte) error {
+	if len(header.KeyID) == 0 {
+		return nil
+	}
+	identities, err := parseIdentities(key)
+	if err != nil {
+		// Leave unusual key encodings to the provider
+		return nil
+	}
+	for _, id := range identities {
+		if bytes.Equal(id.KeyID, header.KeyID) {
+			return nil
+		}
+	}
+	return ErrKeyMismatch
+}
+
+// sealEnvelopeBody encrypts the body with AES-256-GCM, authenticating the header
+func sealEnvelopeBody(key, nonce, plaintext, header []byte) ([]byte, error) {
+	aead, err := newEnvelopeAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size %d", len(nonce))
+	}
+	return aead.Seal(nil, nonce, plaintext, header), nil
+}
+
+// openEnvelopePayload is openEnvelopeBody followed by removing the padding and
+// compression the header names; maxSize bounds the decompressed size. Chunked
+// bodies are decrypted chunk by chunk.
+func openEnvelopePayload(h *envelopeHeader, key, ciphertext, header []byte, maxSize int64) ([]byte, error) {
+	if h.ChunkSize != 0 {
+		return openStreamPayload(h, key, ciphertext, header, maxSize)
+	}
+	plaintext, err := openEnvelopeBody(key, h.Nonce, ciphertext, header)
+	if err != nil {
+		return nil, err
+	}
+	return finishEnvelopePayload(h, plaintext, maxSize)
+}
+
+// finishEnvelopePayload removes the padding and compression of a decrypted body
+func finishEnvelopePayload(h *envelopeHeader, plaintext []byte, maxSize int64) ([]byte, error) {
+	var err error
+	if h.Padding.Kind != PaddingNone {
+		if plaintext, err = unpad(plaintext); err != nil {
+			return nil, err
+		}
+	}
+	if h.Compression != CompressionNone {
+		return h.Compression.decompress(plaintext, maxSize)
+	}
+	return plaintext, nil
+}
+
+func openEnvelopeBody(key, nonce, ciphertext, header []byte) ([]byte, error) {
+	aead, err := newEnvelopeAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size %d", len(nonce))
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt envelope body: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newEnvelopeAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
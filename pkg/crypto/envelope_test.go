@@ -0,0 +1,230 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type envelopeTestCase struct {
+	name          string
+	provider      CryptoProvider
+	sealKey       []byte
+	openKey       []byte
+	otherKey      []byte
+	authenticated bool
+}
+
+func envelopeTestCases(t *testing.T) []envelopeTestCase {
+	t.Helper()
+	rsaPrivate, rsaPublic, err := GenerateRSAKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRSA, _, err := GenerateRSAKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hpkePrivate, hpkePublic, err := GenerateHPKEKeyPair(DefaultHPKESuite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherHPKE, _, err := GenerateHPKEKeyPair(DefaultHPKESuite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, err := ParseRecipient(hpkePublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return []envelopeTestCase{
+		{"aes-256-gcm", &AESGCMProvider{}, parallelTestKey, parallelTestKey, []byte("another key"), true},
+		{"aes-256-cbc", &AESProvider{}, parallelTestKey, parallelTestKey, []byte("another key"), false},
+		{"rsa", &RSAProvider{}, rsaPublic, rsaPrivate, otherRSA, false},
+		{"hpke", &HPKEProvider{Suite: DefaultHPKESuite}, hpkePublic, hpkePrivate, otherHPKE, false},
+		{"passphrase", &PassphraseProvider{Params: cheapKDFParams(KDFPBKDF2SHA256)}, []byte("open sesame"), []byte("open sesame"), []byte("close sesame"), true},
+		{"multi-recipient", &MultiRecipientProvider{Recipients: []*Recipient{recipient}}, nil, hpkePrivate, otherHPKE, true},
+	}
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	plaintext := []byte("sealed in an envelope")
+	for _, tt := range envelopeTestCases(t) {
+		data, err := SealEnvelope(tt.provider, plaintext, tt.sealKey)
+		if err != nil {
+			t.Fatalf("%s: SealEnvelope: %v", tt.name, err)
+		}
+		if !IsEnvelope(data) {
+			t.Errorf("%s: IsEnvelope = false", tt.name)
+		}
+		header, _, _, err := parseEnvelope(data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if header.Algorithm.String() != tt.name || header.authenticated() != tt.authenticated {
+			t.Errorf("%s: header names %s, authenticated %v", tt.name, header.Algorithm, header.authenticated())
+		}
+
+		got, err := OpenEnvelope(data, tt.openKey, nil)
+		if err != nil || !bytes.Equal(got, plaintext) {
+			t.Errorf("%s: OpenEnvelope = %q, %v", tt.name, got, err)
+		}
+		if _, err := OpenEnvelope(data, tt.otherKey, nil); err == nil {
+			t.Errorf("%s: opened with another key", tt.name)
+		}
+	}
+}
+
+func TestEnvelopeKeyMismatch(t *testing.T) {
+	// Single-key envelopes fingerprint the key, so a wrong one fails before decrypting
+	for _, tt := range envelopeTestCases(t) {
+		if tt.name == "passphrase" || tt.name == "multi-recipient" {
+			continue
+		}
+		data, err := SealEnvelope(tt.provider, []byte("x"), tt.sealKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := OpenEnvelope(data, tt.otherKey, nil); !errors.Is(err, ErrKeyMismatch) {
+			t.Errorf("%s: error = %v, want ErrKeyMismatch", tt.name, err)
+		}
+	}
+}
+
+func TestEnvelopeAuthenticatedHeader(t *testing.T) {
+	for _, tt := range envelopeTestCases(t) {
+		if !tt.authenticated {
+			continue
+		}
+		data, err := SealEnvelope(tt.provider, []byte("x"), tt.sealKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, headerBytes, _, err := parseEnvelope(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The last header byte is part of the nonce, which parses whatever its value
+		tampered := append([]byte{}, data...)
+		tampered[len(headerBytes)-1] ^= 1
+		if _, err := OpenEnvelope(tampered, tt.openKey, nil); err == nil {
+			t.Errorf("%s: changed header was accepted", tt.name)
+		}
+		tampered = append([]byte{}, data...)
+		tampered[len(tampered)-1] ^= 1
+		if _, err := OpenEnvelope(tampered, tt.openKey, nil); err == nil {
+			t.Errorf("%s: changed body was accepted", tt.name)
+		}
+	}
+}
+
+func TestEnvelopeHeaderRoundTrip(t *testing.T) {
+	header := &envelopeHeader{
+		Algorithm:   EnvelopeHPKE,
+		HPKESuite:   HPKESuite{KEM: KEMP256HKDFSHA256, KDF: KDFHKDFSHA256, AEAD: AEADChaCha20Poly1305},
+		KeyID:       []byte("12345678"),
+		Flags:       EnvelopeFlagHPKEPSK | EnvelopeFlagHPKEAuth,
+		Nonce:       []byte("nonce bytes!"),
+		NotAfter:    time.Unix(2000000000, 0),
+		Compression: CompressionDeflate,
+		ChunkSize:   minStreamChunkSize,
+	}
+	data, err := header.marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, headerBytes, body, err := parseEnvelope(append(data, "body"...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Algorithm != header.Algorithm || got.HPKESuite != header.HPKESuite || !bytes.Equal(got.KeyID, header.KeyID) ||
+		got.Flags != header.Flags || !bytes.Equal(got.Nonce, header.Nonce) || !got.NotAfter.Equal(header.NotAfter) ||
+		got.Compression != header.Compression || got.ChunkSize != header.ChunkSize {
+		t.Errorf("parsed %+v, want %+v", got, header)
+	}
+	if !bytes.Equal(headerBytes, data) || string(body) != "body" {
+		t.Errorf("split into %d header bytes and body %q", len(headerBytes), body)
+	}
+}
+
+func TestParseEnvelopeErrors(t *testing.T) {
+	envelope := func(fields ...[]byte) []byte {
+		var body []byte
+		for _, f := range fields {
+			body = append(body, f...)
+		}
+		out := append([]byte{}, envelopeMagic...)
+		out = append(out, envelopeVersion)
+		out = binary.BigEndian.AppendUint32(out, uint32(len(body)))
+		return append(out, body...)
+	}
+	field := func(tag byte, value ...byte) []byte {
+		return append(binary.BigEndian.AppendUint16([]byte{tag}, uint16(len(value))), value...)
+	}
+	gcm := field(headerTagAlgorithm, byte(EnvelopeAES256GCM))
+
+	badVersion := envelope(gcm)
+	badVersion[len(envelopeMagic)] = envelopeVersion + 1
+	hugeHeader := envelope(gcm)
+	binary.BigEndian.PutUint32(hugeHeader[len(envelopeMagic)+1:], maxEnvelopeHeaderSize+1)
+
+	for name, tt := range map[string]struct {
+		data []byte
+		want string
+	}{
+		"not an envelope":          {[]byte("plain old ciphertext"), "not an encrypted envelope"},
+		"too short":                {envelopeMagic, "not an encrypted envelope"},
+		"version":                  {badVersion, "version"},
+		"header past the end":      {envelope(gcm)[:envelopePrefixSize+2], "truncated"},
+		"huge header":              {hugeHeader, "truncated"},
+		"field cut":                {envelope(gcm, []byte{headerTagNonce, 0}), "truncated"},
+		"field value cut":          {envelope(gcm, []byte{headerTagNonce, 0, 12, 1, 2}), "truncated"},
+		"unknown field":            {envelope(gcm, field(0x7f, 1)), "unknown envelope header field"},
+		"unknown flag":             {envelope(gcm, field(headerTagFlags, 0, 0, 1, 0)), "flags"},
+		"no algorithm":             {envelope(field(headerTagNonce, 1, 2, 3)), "does not name an algorithm"},
+		"empty algorithm":          {envelope(field(headerTagAlgorithm)), "empty"},
+		"short hpke suite":         {envelope(field(headerTagAlgorithm, byte(EnvelopeHPKE), 0, 0x20)), "HPKE suite"},
+		"bad compression":          {envelope(gcm, field(headerTagCompress, 9)), "compression"},
+		"chunk size too small":     {envelope(gcm, field(headerTagChunkSize, 0, 0, 0, 1)), "chunk size"},
+		"bad expiry":               {envelope(gcm, field(headerTagNotAfter, 1)), "expiry"},
+		"unauthenticated metadata": {envelope(field(headerTagAlgorithm, byte(EnvelopeAES256CBC)), field(headerTagFlags, 0, 0, 0, byte(EnvelopeFlagFileMetadata))), "file metadata"},
+	} {
+		_, _, _, err := parseEnvelope(tt.data)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want one about %q", name, err, tt.want)
+		}
+	}
+
+	// Older passphrase and multi-recipient envelopes have no algorithm field
+	kdf := cheapKDFParams(KDFScrypt)
+	header, _, _, err := parseEnvelope(envelope(field(headerTagKDF, kdf.marshal()...)))
+	if err != nil || header.Algorithm != EnvelopePassphrase {
+		t.Errorf("envelope with KDF parameters only: %v, %v", header, err)
+	}
+}
+
+func TestSealEnvelopeHPKEModes(t *testing.T) {
+	private, public, err := GenerateHPKEKeyPair(DefaultHPKESuite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	psk := &HPKEOptions{PSK: []byte("a pre-shared key of 32 bytes!!!!"), PSKID: []byte("psk id")}
+	data, err := SealEnvelope(&HPKEProvider{Suite: DefaultHPKESuite, Options: psk}, []byte("psk mode"), public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenEnvelope(data, private, nil); err == nil || !strings.Contains(err.Error(), "psk") {
+		t.Errorf("psk mode without the psk: error = %v", err)
+	}
+	if got, err := OpenEnvelope(data, private, &OpenOptions{HPKE: psk}); err != nil || string(got) != "psk mode" {
+		t.Errorf("psk mode = %q, %v", got, err)
+	}
+
+	if _, err := SealEnvelope(&FPEProvider{}, []byte("1234567890"), parallelTestKey); err == nil {
+		t.Error("format-preserving ciphertext was wrapped in an envelope")
+	}
+}
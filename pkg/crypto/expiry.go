@@ -0,0 +1,18 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrExpired is returned when decrypting data past its not-after time
+var ErrExpired = errors.New("data has expired")
+
+// checkNotAfter fails with ErrExpired once the header's not-after time has passed
+func checkNotAfter(header *envelopeHeader) error {
+	if !header.NotAfter.IsZero() && time.Now().After(header.NotAfter) {
+		return fmt.Errorf("%w: not valid after %s", ErrExpired, header.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
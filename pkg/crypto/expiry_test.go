@@ -0,0 +1,79 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestEnvelopeExpiry(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	for _, tt := range envelopeTestCases(t) {
+		if !SupportsEnvelopeOptions(tt.provider) {
+			if err := SetEnvelopeOptions(tt.provider, EnvelopeOptions{NotAfter: future}); err == nil {
+				t.Errorf("%s: expiry accepted for an unauthenticated header", tt.name)
+			}
+			continue
+		}
+
+		if err := SetEnvelopeOptions(tt.provider, EnvelopeOptions{NotAfter: future}); err != nil {
+			t.Fatal(err)
+		}
+		data, err := SealEnvelope(tt.provider, []byte("still valid"), tt.sealKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := OpenEnvelope(data, tt.openKey, nil); err != nil || string(got) != "still valid" {
+			t.Errorf("%s: before expiry: OpenEnvelope = %q, %v", tt.name, got, err)
+		}
+
+		if err := SetEnvelopeOptions(tt.provider, EnvelopeOptions{NotAfter: past}); err != nil {
+			t.Fatal(err)
+		}
+		data, err = SealEnvelope(tt.provider, []byte("expired"), tt.sealKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := OpenEnvelope(data, tt.openKey, nil); !errors.Is(err, ErrExpired) {
+			t.Errorf("%s: OpenEnvelope error = %v, want ErrExpired", tt.name, err)
+		}
+		if _, err := tt.provider.Decrypt(data, tt.openKey); !errors.Is(err, ErrExpired) {
+			t.Errorf("%s: Decrypt error = %v, want ErrExpired", tt.name, err)
+		}
+		if got, err := OpenEnvelope(data, tt.openKey, &OpenOptions{IgnoreExpiry: true}); err != nil || string(got) != "expired" {
+			t.Errorf("%s: IgnoreExpiry: OpenEnvelope = %q, %v", tt.name, got, err)
+		}
+
+		// Moving the expiry forward breaks the authenticated header
+		extended := bytes.Replace(data,
+			binary.BigEndian.AppendUint64(nil, uint64(past.Unix())),
+			binary.BigEndian.AppendUint64(nil, uint64(future.Unix())), 1)
+		if bytes.Equal(extended, data) {
+			t.Fatalf("%s: not-after time not found in the header", tt.name)
+		}
+		if _, err := OpenEnvelope(extended, tt.openKey, nil); err == nil || errors.Is(err, ErrExpired) {
+			t.Errorf("%s: extended expiry: error = %v, want an authentication failure", tt.name, err)
+		}
+	}
+}
+
+func TestStreamExpiry(t *testing.T) {
+	data := encryptStreamForTest(t, parallelTestData(3000), &StreamOptions{
+		ChunkSize:       streamTestChunkSize,
+		EnvelopeOptions: EnvelopeOptions{NotAfter: time.Now().Add(-time.Second)},
+	})
+	if _, err := NewDecryptReader(bytes.NewReader(data), parallelTestKey, nil); !errors.Is(err, ErrExpired) {
+		t.Errorf("NewDecryptReader error = %v, want ErrExpired", err)
+	}
+	r, err := NewDecryptReader(bytes.NewReader(data), parallelTestKey, &OpenOptions{IgnoreExpiry: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, parallelTestData(3000)) {
+		t.Errorf("IgnoreExpiry: read %d bytes, %v", len(got), err)
+	}
+}
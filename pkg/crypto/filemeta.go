@@ -0,0 +1,205 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// File metadata layout, prepended to the plaintext before encryption so it is
+// encrypted and authenticated with the content:
+//
+//	magic "TLFM" | version (1) | metadata length (2, big endian) | fields | content
+//
+// Fields are tag (1) | length (2, big endian) | value, like envelope header fields.
+// Unknown fields are skipped so later versions can add more. Whether a plaintext
+// starts with metadata is recorded by EnvelopeFlagFileMetadata in the authenticated
+// header, never guessed from the plaintext, which may start with anything.
+
+var fileMetadataMagic = []byte("TLFM")
+
+var errNoFileMetadata = errors.New("data flagged with file metadata does not start with it")
+
+const fileMetadataVersion = 1
+
+const (
+	fileMetaTagName    byte = 0x01
+	fileMetaTagMode    byte = 0x02
+	fileMetaTagModTime byte = 0x03
+)
+
+// FileMetadata is the original name, permission bits and modification time of an encrypted file
+type FileMetadata struct {
+	// Name is the base name of the file, without any directory
+	Name    string
+	Mode    os.FileMode
+	ModTime time.Time
+}
+
+// NewFileMetadata records the base name, permission bits and modification time of info
+func NewFileMetadata(info os.FileInfo) *FileMetadata {
+	return &FileMetadata{Name: info.Name(), Mode: info.Mode().Perm(), ModTime: info.ModTime()}
+}
+
+// WrapFileMetadata prepends meta to content
+func WrapFileMetadata(meta *FileMetadata, content []byte) ([]byte, error) {
+	if len(meta.Name) > 0xffff {
+		return nil, fmt.Errorf("file name is too long")
+	}
+
+	var fields []byte
+	fields = append(fields, fileMetaTagName)
+	fields = binary.BigEndian.AppendUint16(fields, uint16(len(meta.Name)))
+	fields = append(fields, meta.Name...)
+	fields = append(fields, fileMetaTagMode, 0, 4)
+	fields = binary.BigEndian.AppendUint32(fields, uint32(meta.Mode.Perm()))
+	fields = append(fields, fileMetaTagModTime, 0, 8)
+	fields = binary.BigEndian.AppendUint64(fields, uint64(meta.ModTime.UnixNano()))
+	if len(fields) > 0xffff {
+		return nil, fmt.Errorf("file metadata is too large")
+	}
+
+	out := make([]byte, 0, len(fileMetadataMagic)+3+len(fields)+len(content))
+	out = append(out, fileMetadataMagic...)
+	out = append(out, fileMetadataVersion)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(fields)))
+	out = append(out, fields...)
+	return append(out, content...), nil
+}
+
+// UnwrapFileMetadata splits decrypted data that starts with metadata, as the
+// plaintext of an envelope flagged with EnvelopeFlagFileMetadata does, into the
+// metadata and the content
+func UnwrapFileMetadata(data []byte) (*FileMetadata, []byte, error) {
+	if !bytes.HasPrefix(data, fileMetadataMagic) {
+		return nil, nil, errNoFileMetadata
+	}
+	rest := data[len(fileMetadataMagic):]
+	if len(rest) < 3 {
+		return nil, nil, fmt.Errorf("file metadata is truncated")
+	}
+	if rest[0] != fileMetadataVersion {
+		return nil, nil, fmt.Errorf("unsupported file metadata version %d", rest[0])
+	}
+	size := int(binary.BigEndian.Uint16(rest[1:]))
+	rest = rest[3:]
+	if len(rest) < size {
+		return nil, nil, fmt.Errorf("file metadata is truncated")
+	}
+	fields, content := rest[:size], rest[size:]
+
+	meta := &FileMetadata{}
+	for len(fields) > 0 {
+		if len(fields) < 3 {
+			return nil, nil, fmt.Errorf("file metadata is truncated")
+		}
+		tag, length := fields[0], int(binary.BigEndian.Uint16(fields[1:]))
+		if len(fields) < 3+length {
+			return nil, nil, fmt.Errorf("file metadata is truncated")
+		}
+		value := fields[3 : 3+length]
+		fields = fields[3+length:]
+
+		switch tag {
+		case fileMetaTagName:
+			meta.Name = string(value)
+		case fileMetaTagMode:
+			if length != 4 {
+				return nil, nil, fmt.Errorf("invalid file mode field")
+			}
+			meta.Mode = os.FileMode(binary.BigEndian.Uint32(value)).Perm()
+		case fileMetaTagModTime:
+			if length != 8 {
+				return nil, nil, fmt.Errorf("invalid modification time field")
+			}
+			meta.ModTime = time.Unix(0, int64(binary.BigEndian.Uint64(value)))
+		}
+	}
+	return meta, content, nil
+}
+
+// ReadFileMetadata is UnwrapFileMetadata for a stream: it reads the metadata from
+// the start of r and returns a reader of the content that follows
+func ReadFileMetadata(r io.Reader) (*FileMetadata, io.Reader, error) {
+	prefixSize := len(fileMetadataMagic) + 3
+	br := bufio.NewReaderSize(r, prefixSize+0xffff)
+	prefix, err := br.Peek(prefixSize)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	if !bytes.HasPrefix(prefix, fileMetadataMagic) {
+		return nil, nil, errNoFileMetadata
+	}
+	if len(prefix) < prefixSize {
+		return nil, nil, fmt.Errorf("file metadata is truncated")
+	}
+
+	frameSize := prefixSize + int(binary.BigEndian.Uint16(prefix[len(fileMetadataMagic)+1:]))
+	frame, err := br.Peek(frameSize)
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("file metadata is truncated")
+	} else if err != nil {
+		return nil, nil, err
+	}
+	meta, _, err := UnwrapFileMetadata(frame)
+	if err != nil {
+		return nil, nil, err
+	}
+	br.Discard(frameSize)
+	return meta, br, nil
+}
+
+// SafeName returns the stored name if it is a plain file name. Names with path
+// separators, "." or "..", drive letters or control characters are rejected, so a
+// crafted file cannot make decrypt write outside the output directory.
+func (m *FileMetadata) SafeName() (string, error) {
+	name := m.Name
+	switch {
+	case name == "":
+		return "", fmt.Errorf("no file name stored")
+	case name == "." || name == "..":
+		return "", fmt.Errorf("stored file name %q is not a file name", name)
+	case strings.ContainsAny(name, `/\:`):
+		return "", fmt.Errorf("stored file name %q contains a path separator", name)
+	case strings.IndexFunc(name, func(r rune) bool { return r < 0x20 || r == 0x7f }) >= 0:
+		return "", fmt.Errorf("stored file name %q contains control characters", name)
+	}
+	return name, nil
+}
+
+// ReadFileMetadataAt reads the metadata at the start of the size bytes of decrypted
+// data in r and returns it with the offset at which the content starts
+func ReadFileMetadataAt(r io.ReaderAt, size int64) (*FileMetadata, int64, error) {
+	prefixSize := len(fileMetadataMagic) + 3
+	prefix := make([]byte, prefixSize)
+	n, err := r.ReadAt(prefix, 0)
+	if err != nil && err != io.EOF {
+		return nil, 0, err
+	}
+	if !bytes.HasPrefix(prefix[:n], fileMetadataMagic) {
+		return nil, 0, errNoFileMetadata
+	}
+	if n < prefixSize {
+		return nil, 0, fmt.Errorf("file metadata is truncated")
+	}
+
+	frameSize := int64(prefixSize) + int64(binary.BigEndian.Uint16(prefix[len(fileMetadataMagic)+1:]))
+	if frameSize > size {
+		return nil, 0, fmt.Errorf("file metadata is truncated")
+	}
+	frame := make([]byte, frameSize)
+	if _, err := r.ReadAt(frame, 0); err != nil && err != io.EOF {
+		return nil, 0, err
+	}
+	meta, _, err := UnwrapFileMetadata(frame)
+	if err != nil {
+		return nil, 0, err
+	}
+	return meta, frameSize, nil
+}
@@ -0,0 +1,182 @@
+package crypto
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+var testFileMetadata = &FileMetadata{Name: "report.pdf", Mode: 0640, ModTime: time.Unix(1577923200, 0)}
+
+func TestFileMetadataRoundTrip(t *testing.T) {
+	key := []byte("file metadata test key")
+	content := []byte("file content")
+	provider := &AESGCMProvider{EnvelopeOptions: EnvelopeOptions{FileMetadata: testFileMetadata}}
+	data, err := SealEnvelope(provider, content, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, got, err := OpenFileEnvelope(data, key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta == nil || meta.Name != testFileMetadata.Name || meta.Mode != testFileMetadata.Mode || !meta.ModTime.Equal(testFileMetadata.ModTime) {
+		t.Errorf("metadata = %+v, want %+v", meta, testFileMetadata)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("content = %q, want %q", got, content)
+	}
+
+	// OpenEnvelope and the provider drop the metadata
+	if got, err := OpenEnvelope(data, key, nil); err != nil || !bytes.Equal(got, content) {
+		t.Errorf("OpenEnvelope = %q, %v", got, err)
+	}
+	if got, err := provider.Decrypt(data, key); err != nil || !bytes.Equal(got, content) {
+		t.Errorf("Decrypt = %q, %v", got, err)
+	}
+}
+
+// Without the header flag the plaintext is content, even when it looks like a frame
+func TestFileMetadataLookalikeContent(t *testing.T) {
+	key := []byte("file metadata test key")
+	framed, err := WrapFileMetadata(testFileMetadata, []byte("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range [][]byte{[]byte("TLFMhello world"), framed, []byte("TLFM")} {
+		data, err := SealEnvelope(&AESGCMProvider{}, content, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		meta, got, err := OpenFileEnvelope(data, key, nil)
+		if err != nil {
+			t.Fatalf("%q: %v", content, err)
+		}
+		if meta != nil || !bytes.Equal(got, content) {
+			t.Errorf("%q: got metadata %+v and content %q", content, meta, got)
+		}
+
+		var buf bytes.Buffer
+		w, err := NewEncryptWriter(&buf, key, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(content)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		meta, r, err := NewFileDecryptReader(bytes.NewReader(buf.Bytes()), key, nil)
+		if err != nil {
+			t.Fatalf("%q: %v", content, err)
+		}
+		got, err = io.ReadAll(r)
+		if err != nil || meta != nil || !bytes.Equal(got, content) {
+			t.Errorf("%q: stream got metadata %+v and content %q, %v", content, meta, got, err)
+		}
+	}
+}
+
+func TestFileMetadataStream(t *testing.T) {
+	key := []byte("file metadata test key")
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	var buf bytes.Buffer
+	w, err := NewEncryptWriter(&buf, key, &StreamOptions{ChunkSize: 1024, EnvelopeOptions: EnvelopeOptions{FileMetadata: testFileMetadata}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(content)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	meta, r, err := NewFileDecryptReader(bytes.NewReader(buf.Bytes()), key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta == nil || meta.Name != testFileMetadata.Name || !bytes.Equal(got, content) {
+		t.Errorf("got metadata %+v and %d bytes of content", meta, len(got))
+	}
+
+	s, err := NewDecryptReaderAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()), key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.FileMetadata() == nil || s.Size() != int64(len(content)) {
+		t.Fatalf("SeekableReader has metadata %+v and size %d", s.FileMetadata(), s.Size())
+	}
+	part := make([]byte, 100)
+	if _, err := s.ReadAt(part, 1000); err != nil || !bytes.Equal(part, content[1000:1100]) {
+		t.Errorf("ReadAt(1000) = %q, %v", part, err)
+	}
+}
+
+// The flag decides how the plaintext is read, so envelopes that do not
+// authenticate their header must not carry it
+func TestFileMetadataFlagNeedsAuthenticatedHeader(t *testing.T) {
+	key := []byte("file metadata test key")
+	data, err := SealEnvelope(&AESProvider{}, []byte("content"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, _, body, err := parseEnvelope(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header.Flags |= EnvelopeFlagFileMetadata
+	headerBytes, err := header.marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenEnvelope(append(headerBytes, body...), key, nil); err == nil {
+		t.Error("aes-256-cbc envelope with the file metadata flag was accepted")
+	}
+
+	if SupportsEnvelopeOptions(&AESProvider{}) || SupportsEnvelopeOptions(&HPKEProvider{}) {
+		t.Error("SupportsEnvelopeOptions accepts a provider without an authenticated header")
+	}
+}
+
+// Clearing the flag of an authenticated envelope fails instead of exposing the frame
+func TestFileMetadataFlagIsAuthenticated(t *testing.T) {
+	key := []byte("file metadata test key")
+	data, err := SealEnvelope(&AESGCMProvider{EnvelopeOptions: EnvelopeOptions{FileMetadata: testFileMetadata}}, []byte("content"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, _, body, err := parseEnvelope(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header.Flags &^= EnvelopeFlagFileMetadata
+	headerBytes, err := header.marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenEnvelope(append(headerBytes, body...), key, nil); err == nil {
+		t.Error("envelope with the file metadata flag removed was accepted")
+	}
+}
+
+func TestFileMetadataSafeName(t *testing.T) {
+	for name, ok := range map[string]bool{
+		"report.pdf": true,
+		"":           false,
+		".":          false,
+		"..":         false,
+		"../x":       false,
+		`a\b`:        false,
+		"c:x":        false,
+		"a\nb":       false,
+	} {
+		_, err := (&FileMetadata{Name: name}).SafeName()
+		if (err == nil) != ok {
+			t.Errorf("SafeName(%q) error = %v, want ok %v", name, err, ok)
+		}
+	}
+}
@@ -0,0 +1,465 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+// Format-preserving encryption modes from NIST SP 800-38G (Rev. 1)
+const (
+	FPEModeFF1  = "ff1"
+	FPEModeFF31 = "ff3-1"
+)
+
+// DefaultFPEAlphabet is used when no alphabet is configured
+const DefaultFPEAlphabet = "0123456789"
+
+// FF31TweakSize is the FF3-1 tweak length in bytes (56 bits)
+const FF31TweakSize = 7
+
+// FF1MaxTweakSize bounds the FF1 tweak; SP 800-38G leaves maxTlen to the implementation
+const FF1MaxTweakSize = 256
+
+// fpeMinDomain is the minimum domain size radix^minlen required by SP 800-38G
+const fpeMinDomain = 1000000
+
+// FPEProvider implements CryptoProvider with FF1 or FF3-1. Data is text made of
+// characters from Alphabet and the ciphertext has the same length and alphabet.
+// The key is a raw AES-128, AES-192 or AES-256 key.
+type FPEProvider struct {
+	Mode     string
+	Alphabet string
+	Tweak    []byte
+}
+
+func (f *FPEProvider) Encrypt(data []byte, key []byte) ([]byte, error) {
+	utils.DebugLogf("FPEProvider.Encrypt: mode=%s, input length: %d", f.Mode, len(data))
+	return f.transform(data, key, true)
+}
+
+func (f *FPEProvider) Decrypt(data []byte, key []byte) ([]byte, error) {
+	utils.DebugLogf("FPEProvider.Decrypt: mode=%s, input length: %d", f.Mode, len(data))
+	return f.transform(data, key, false)
+}
+
+func (f *FPEProvider) GenerateKey() ([]byte, error) {
+	key := make([]byte, 32) // AES-256
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return key, nil
+}
+
+func (f *FPEProvider) transform(data []byte, key []byte, encrypt bool) ([]byte, error) {
+	alphabet := f.Alphabet
+	if alphabet == "" {
+		alphabet = DefaultFPEAlphabet
+	}
+	symbols, err := parseAlphabet(alphabet)
+	if err != nil {
+		return nil, err
+	}
+
+	numerals, err := toNumerals(string(data), symbols)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []uint16
+	switch f.Mode {
+	case FPEModeFF1:
+		ff1, err := NewFF1(key, len(symbols), f.Tweak)
+		if err != nil {
+			return nil, err
+		}
+		if encrypt {
+			result, err = ff1.Encrypt(numerals)
+		} else {
+			result, err = ff1.Decrypt(numerals)
+		}
+		if err != nil {
+			return nil, err
+		}
+	case FPEModeFF31:
+		ff3, err := NewFF31(key, len(symbols), f.Tweak)
+		if err != nil {
+			return nil, err
+		}
+		if encrypt {
+			result, err = ff3.Encrypt(numerals)
+		} else {
+			result, err = ff3.Decrypt(numerals)
+		}
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported format-preserving mode: %s", f.Mode)
+	}
+
+	return []byte(fromNumerals(result, symbols)), nil
+}
+
+func parseAlphabet(alphabet string) ([]rune, error) {
+	symbols := []rune(alphabet)
+	if len(symbols) < 2 || len(symbols) > 1<<16 {
+		return nil, fmt.Errorf("alphabet must have between 2 and 65536 characters")
+	}
+	seen := make(map[rune]bool, len(symbols))
+	for _, r := range symbols {
+		if seen[r] {
+			return nil, fmt.Errorf("alphabet contains duplicate character %q", r)
+		}
+		seen[r] = true
+	}
+	return symbols, nil
+}
+
+func toNumerals(text string, symbols []rune) ([]uint16, error) {
+	index := make(map[rune]uint16, len(symbols))
+	for i, r := range symbols {
+		index[r] = uint16(i)
+	}
+
+	numerals := make([]uint16, 0, len(text))
+	for _, r := range text {
+		n, ok := index[r]
+		if !ok {
+			return nil, fmt.Errorf("character %q is not in the alphabet", r)
+		}
+		numerals = append(numerals, n)
+	}
+	return numerals, nil
+}
+
+func fromNumerals(numerals []uint16, symbols []rune) string {
+	out := make([]rune, len(numerals))
+	for i, n := range numerals {
+		out[i] = symbols[n]
+	}
+	return string(out)
+}
+
+// FF1 is the FF1 format-preserving cipher over numeral strings in the given radix
+type FF1 struct {
+	block cipher.Block
+	radix int
+	tweak []byte
+}
+
+// NewFF1 creates an FF1 cipher with an AES key, a radix in [2, 65536] and a tweak
+// of at most FF1MaxTweakSize bytes
+func NewFF1(key []byte, radix int, tweak []byte) (*FF1, error) {
+	if radix < 2 || radix > 1<<16 {
+		return nil, fmt.Errorf("radix must be between 2 and 65536")
+	}
+	if len(tweak) > FF1MaxTweakSize {
+		return nil, fmt.Errorf("FF1 tweak must be at most %d bytes, got %d", FF1MaxTweakSize, len(tweak))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return &FF1{block: block, radix: radix, tweak: tweak}, nil
+}
+
+// Encrypt runs FF1.Encrypt (SP 800-38G, Algorithm 7)
+func (f *FF1) Encrypt(x []uint16) ([]uint16, error) {
+	return f.crypt(x, true)
+}
+
+// Decrypt runs FF1.Decrypt (SP 800-38G, Algorithm 8)
+func (f *FF1) Decrypt(x []uint16) ([]uint16, error) {
+	return f.crypt(x, false)
+}
+
+func (f *FF1) crypt(x []uint16, encrypt bool) ([]uint16, error) {
+	n := len(x)
+	if err := checkFPELength(f.radix, n, math.MaxInt32); err != nil {
+		return nil, err
+	}
+	if err := checkNumerals(x, f.radix); err != nil {
+		return nil, err
+	}
+
+	t := len(f.tweak)
+	u := n / 2
+	v := n - u
+	a := append([]uint16{}, x[:u]...)
+	b := append([]uint16{}, x[u:]...)
+
+	radix := big.NewInt(int64(f.radix))
+	// b = ceil(ceil(v * log2(radix)) / 8)
+	byteLen := (new(big.Int).Sub(new(big.Int).Exp(radix, big.NewInt(int64(v)), nil), big.NewInt(1)).BitLen() + 7) / 8
+	d := 4*((byteLen+3)/4) + 4
+
+	p := []byte{1, 2, 1,
+		byte(f.radix >> 16), byte(f.radix >> 8), byte(f.radix),
+		10, byte(u),
+		byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n),
+		byte(t >> 24), byte(t >> 16), byte(t >> 8), byte(t),
+	}
+
+	padLen := (16 - (t+byteLen+1)%16) % 16
+	q := make([]byte, t+padLen+1+byteLen)
+	copy(q, f.tweak)
+
+	modU := new(big.Int).Exp(radix, big.NewInt(int64(u)), nil)
+	modV := new(big.Int).Exp(radix, big.NewInt(int64(v)), nil)
+
+	for step := 0; step < 10; step++ {
+		i := step
+		if !encrypt {
+			i = 9 - step
+		}
+
+		// The round function input is B when encrypting and A when decrypting
+		src := b
+		if !encrypt {
+			src = a
+		}
+		q[t+padLen] = byte(i)
+		numBytes := numRadix(src, radix).Bytes()
+		for j := t + padLen + 1; j < len(q); j++ {
+			q[j] = 0
+		}
+		copy(q[len(q)-len(numBytes):], numBytes)
+
+		r := f.prf(append(append([]byte{}, p...), q...))
+		s := f.expand(r, d)
+		y := new(big.Int).SetBytes(s)
+
+		m, mod := u, modU
+		if i%2 == 1 {
+			m, mod = v, modV
+		}
+
+		c := new(big.Int)
+		if encrypt {
+			c.Add(numRadix(a, radix), y)
+		} else {
+			c.Sub(numRadix(b, radix), y)
+		}
+		c.Mod(c, mod)
+		cs := strRadix(c, radix, m)
+
+		if encrypt {
+			a, b = b, cs
+		} else {
+			b, a = a, cs
+		}
+	}
+
+	return append(a, b...), nil
+}
+
+// prf is the CBC-MAC of data under the FF1 key with a zero IV
+func (f *FF1) prf(data []byte) []byte {
+	y := make([]byte, aes.BlockSize)
+	for i := 0; i < len(data); i += aes.BlockSize {
+		for j := 0; j < aes.BlockSize; j++ {
+			y[j] ^= data[i+j]
+		}
+		f.block.Encrypt(y, y)
+	}
+	return y
+}
+
+// expand returns the first d bytes of R || CIPH(R xor [1]) || CIPH(R xor [2]) || ...
+func (f *FF1) expand(r []byte, d int) []byte {
+	s := append([]byte{}, r...)
+	for j := 1; len(s) < d; j++ {
+		block := append([]byte{}, r...)
+		for k := 0; k < 8; k++ {
+			block[aes.BlockSize-1-k] ^= byte(uint64(j) >> (8 * k))
+		}
+		f.block.Encrypt(block, block)
+		s = append(s, block...)
+	}
+	return s[:d]
+}
+
+// FF31 is the FF3-1 format-preserving cipher over numeral strings in the given radix
+type FF31 struct {
+	block  cipher.Block
+	radix  int
+	tweakL []byte
+	tweakR []byte
+}
+
+// NewFF31 creates an FF3-1 cipher with an AES key, a radix in [2, 65536] and a 56-bit tweak
+func NewFF31(key []byte, radix int, tweak []byte) (*FF31, error) {
+	if radix < 2 || radix > 1<<16 {
+		return nil, fmt.Errorf("radix must be between 2 and 65536")
+	}
+	if len(tweak) != FF31TweakSize {
+		return nil, fmt.Errorf("FF3-1 tweak must be exactly %d bytes, got %d", FF31TweakSize, len(tweak))
+	}
+
+	// FF3-1 uses the byte-reversed key
+	reversedKey := make([]byte, len(key))
+	for i := range key {
+		reversedKey[i] = key[len(key)-1-i]
+	}
+	block, err := aes.NewCipher(reversedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	// T_L = T[0..27] || 0^4, T_R = T[32..55] || T[28..31] || 0^4
+	tweakL := []byte{tweak[0], tweak[1], tweak[2], tweak[3] & 0xf0}
+	tweakR := []byte{tweak[4], tweak[5], tweak[6], tweak[3] << 4}
+
+	return &FF31{block: block, radix: radix, tweakL: tweakL, tweakR: tweakR}, nil
+}
+
+// Encrypt runs FF3-1.Encrypt (SP 800-38G Rev. 1, Algorithm 9)
+func (f *FF31) Encrypt(x []uint16) ([]uint16, error) {
+	return f.crypt(x, true)
+}
+
+// Decrypt runs FF3-1.Decrypt (SP 800-38G Rev. 1, Algorithm 10)
+func (f *FF31) Decrypt(x []uint16) ([]uint16, error) {
+	return f.crypt(x, false)
+}
+
+func (f *FF31) crypt(x []uint16, encrypt bool) ([]uint16, error) {
+	n := len(x)
+	radix := big.NewInt(int64(f.radix))
+
+	// maxlen = 2 * floor(log_radix(2^96))
+	limit := new(big.Int).Lsh(big.NewInt(1), 96)
+	maxHalf := 0
+	for power := new(big.Int).Set(radix); power.Cmp(limit) <= 0; power.Mul(power, radix) {
+		maxHalf++
+	}
+	if err := checkFPELength(f.radix, n, 2*maxHalf); err != nil {
+		return nil, err
+	}
+	if err := checkNumerals(x, f.radix); err != nil {
+		return nil, err
+	}
+
+	u := (n + 1) / 2
+	v := n - u
+	a := append([]uint16{}, x[:u]...)
+	b := append([]uint16{}, x[u:]...)
+
+	modU := new(big.Int).Exp(radix, big.NewInt(int64(u)), nil)
+	modV := new(big.Int).Exp(radix, big.NewInt(int64(v)), nil)
+
+	for step := 0; step < 8; step++ {
+		i := step
+		if !encrypt {
+			i = 7 - step
+		}
+
+		m, mod, w := u, modU, f.tweakR
+		if i%2 == 1 {
+			m, mod, w = v, modV, f.tweakL
+		}
+
+		src := b
+		if !encrypt {
+			src = a
+		}
+
+		p := make([]byte, aes.BlockSize)
+		copy(p, w)
+		p[3] ^= byte(i)
+		numBytes := numRadix(reverseNumerals(src), radix).Bytes()
+		copy(p[aes.BlockSize-len(numBytes):], numBytes)
+
+		reverseBytes(p)
+		f.block.Encrypt(p, p)
+		reverseBytes(p)
+		y := new(big.Int).SetBytes(p)
+
+		c := new(big.Int)
+		if encrypt {
+			c.Add(numRadix(reverseNumerals(a), radix), y)
+		} else {
+			c.Sub(numRadix(reverseNumerals(b), radix), y)
+		}
+		c.Mod(c, mod)
+		cs := reverseNumerals(strRadix(c, radix, m))
+
+		if encrypt {
+			a, b = b, cs
+		} else {
+			b, a = a, cs
+		}
+	}
+
+	return append(a, b...), nil
+}
+
+func checkFPELength(radix, n, maxLen int) error {
+	// radix^minlen >= 1,000,000 with minlen >= 2
+	minLen := 2
+	domain := new(big.Int).Exp(big.NewInt(int64(radix)), big.NewInt(int64(minLen)), nil)
+	for domain.Cmp(big.NewInt(fpeMinDomain)) < 0 {
+		minLen++
+		domain.Mul(domain, big.NewInt(int64(radix)))
+	}
+	if n < minLen {
+		return fmt.Errorf("input must be at least %d characters for radix %d", minLen, radix)
+	}
+	if n > maxLen {
+		return fmt.Errorf("input must be at most %d characters for radix %d", maxLen, radix)
+	}
+	return nil
+}
+
+func checkNumerals(x []uint16, radix int) error {
+	for _, d := range x {
+		if int(d) >= radix {
+			return errors.New("numeral out of range for radix")
+		}
+	}
+	return nil
+}
+
+// numRadix interprets x as a big-endian number in the given radix
+func numRadix(x []uint16, radix *big.Int) *big.Int {
+	result := new(big.Int)
+	digit := new(big.Int)
+	for _, d := range x {
+		result.Mul(result, radix)
+		result.Add(result, digit.SetUint64(uint64(d)))
+	}
+	return result
+}
+
+// strRadix returns the m-digit big-endian representation of x in the given radix
+func strRadix(x *big.Int, radix *big.Int, m int) []uint16 {
+	out := make([]uint16, m)
+	value := new(big.Int).Set(x)
+	digit := new(big.Int)
+	for i := m - 1; i >= 0; i-- {
+		value.DivMod(value, radix, digit)
+		out[i] = uint16(digit.Uint64())
+	}
+	return out
+}
+
+func reverseNumerals(x []uint16) []uint16 {
+	out := make([]uint16, len(x))
+	for i := range x {
+		out[i] = x[len(x)-1-i]
+	}
+	return out
+}
+
+func reverseBytes(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
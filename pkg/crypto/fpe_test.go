@@ -0,0 +1,150 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+const fpeTestAlphabet36 = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+type fpeTestVector struct {
+	name       string
+	alphabet   string
+	key        string
+	tweak      string
+	plaintext  string
+	ciphertext string
+}
+
+// NIST SP 800-38G FF1 samples 1 to 9
+var ff1TestVectors = []fpeTestVector{
+	{"sample 1", DefaultFPEAlphabet, "2b7e151628aed2a6abf7158809cf4f3c", "", "0123456789", "2433477484"},
+	{"sample 2", DefaultFPEAlphabet, "2b7e151628aed2a6abf7158809cf4f3c", "39383736353433323130", "0123456789", "6124200773"},
+	{"sample 3", fpeTestAlphabet36, "2b7e151628aed2a6abf7158809cf4f3c", "3737373770717273373737", "0123456789abcdefghi", "a9tv40mll9kdu509eum"},
+	{"sample 4", DefaultFPEAlphabet, "2b7e151628aed2a6abf7158809cf4f3cef4359d8d580aa4f", "", "0123456789", "2830668132"},
+	{"sample 5", DefaultFPEAlphabet, "2b7e151628aed2a6abf7158809cf4f3cef4359d8d580aa4f", "39383736353433323130", "0123456789", "2496655549"},
+	{"sample 6", fpeTestAlphabet36, "2b7e151628aed2a6abf7158809cf4f3cef4359d8d580aa4f", "3737373770717273373737", "0123456789abcdefghi", "xbj3kv35jrawxv32ysr"},
+	{"sample 7", DefaultFPEAlphabet, "2b7e151628aed2a6abf7158809cf4f3cef4359d8d580aa4f7f036d6f04fc6a94", "", "0123456789", "6657667009"},
+	{"sample 8", DefaultFPEAlphabet, "2b7e151628aed2a6abf7158809cf4f3cef4359d8d580aa4f7f036d6f04fc6a94", "39383736353433323130", "0123456789", "1001623463"},
+	{"sample 9", fpeTestAlphabet36, "2b7e151628aed2a6abf7158809cf4f3cef4359d8d580aa4f7f036d6f04fc6a94", "3737373770717273373737", "0123456789abcdefghi", "xs8a0azh2avyalyzuwd"},
+}
+
+// NIST ACVP FF3-1 vectors with 56-bit tweaks
+var ff31TestVectors = []fpeTestVector{
+	{"radix 10", DefaultFPEAlphabet, "2de79d232df5585d68ce47882ae256d6", "cbd09280979564", "3992520240", "8901801106"},
+	{"radix 10 max length", DefaultFPEAlphabet, "01c63017111438f7fc8e24eb16c71ab5", "c4e822dcd09f27", "60761757463116869318437658042297305934914824457484538562", "35637144092473838892796702739628394376915177448290847293"},
+	{"radix 26", "abcdefghijklmnopqrstuvwxyz", "718385e6542534604419e83ce387a437", "b6f35084fa90e1", "wfmwlrorcd", "ywowehycyd"},
+	{"radix 26 long", "abcdefghijklmnopqrstuvwxyz", "db602dff22ed7e84c8d8c865a941a238", "ebefd63bcc2083", "kkuomenbzqvggfbteqdyanwpmhzdmoicekiihkrm", "belcfahcwwytwrckieymthabgjjfkxtxauipmjja"},
+}
+
+func testFPEVectors(t *testing.T, mode string, vectors []fpeTestVector) {
+	for _, v := range vectors {
+		t.Run(v.name, func(t *testing.T) {
+			key, _ := hex.DecodeString(v.key)
+			tweak, _ := hex.DecodeString(v.tweak)
+			provider := &FPEProvider{Mode: mode, Alphabet: v.alphabet, Tweak: tweak}
+
+			ciphertext, err := provider.Encrypt([]byte(v.plaintext), key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(ciphertext) != v.ciphertext {
+				t.Errorf("Encrypt = %s, want %s", ciphertext, v.ciphertext)
+			}
+			plaintext, err := provider.Decrypt([]byte(v.ciphertext), key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(plaintext) != v.plaintext {
+				t.Errorf("Decrypt = %s, want %s", plaintext, v.plaintext)
+			}
+		})
+	}
+}
+
+func TestFF1Vectors(t *testing.T) {
+	testFPEVectors(t, FPEModeFF1, ff1TestVectors)
+}
+
+func TestFF31Vectors(t *testing.T) {
+	testFPEVectors(t, FPEModeFF31, ff31TestVectors)
+}
+
+func TestFPERoundTripPreservesFormat(t *testing.T) {
+	key := make([]byte, 32)
+	for _, mode := range []string{FPEModeFF1, FPEModeFF31} {
+		for _, alphabet := range []string{"01", DefaultFPEAlphabet, fpeTestAlphabet36, "αβγδεζηθικλμνξοπρστυφχψω"} {
+			symbols := []rune(alphabet)
+			for _, n := range []int{20, 21, 33} {
+				var sb strings.Builder
+				for i := 0; i < n; i++ {
+					sb.WriteRune(symbols[(i*7+3)%len(symbols)])
+				}
+				plaintext := sb.String()
+				provider := &FPEProvider{Mode: mode, Alphabet: alphabet, Tweak: []byte("tweak!!")}
+
+				ciphertext, err := provider.Encrypt([]byte(plaintext), key)
+				if err != nil {
+					t.Fatalf("%s %q length %d: %v", mode, alphabet, n, err)
+				}
+				if len([]rune(string(ciphertext))) != n {
+					t.Errorf("%s %q: ciphertext %q has length %d, want %d", mode, alphabet, ciphertext, len([]rune(string(ciphertext))), n)
+				}
+				for _, r := range string(ciphertext) {
+					if !strings.ContainsRune(alphabet, r) {
+						t.Errorf("%s %q: ciphertext %q contains %q", mode, alphabet, ciphertext, r)
+					}
+				}
+				if string(ciphertext) == plaintext {
+					t.Errorf("%s %q: ciphertext equals plaintext", mode, alphabet)
+				}
+				got, err := provider.Decrypt(ciphertext, key)
+				if err != nil || string(got) != plaintext {
+					t.Errorf("%s %q: Decrypt = %q, %v, want %q", mode, alphabet, got, err, plaintext)
+				}
+			}
+		}
+	}
+}
+
+func TestFPEErrors(t *testing.T) {
+	key := make([]byte, 16)
+	tweak7 := make([]byte, FF31TweakSize)
+	for _, tc := range []struct {
+		name     string
+		provider *FPEProvider
+		input    string
+		key      []byte
+		want     string
+	}{
+		// radix 10 needs 6 digits for a domain of at least 10^6
+		{"ff1 domain too small", &FPEProvider{Mode: FPEModeFF1}, "12345", key, "at least 6"},
+		{"ff3-1 domain too small", &FPEProvider{Mode: FPEModeFF31, Tweak: tweak7}, "12345", key, "at least 6"},
+		{"binary domain too small", &FPEProvider{Mode: FPEModeFF1, Alphabet: "01"}, "0101010101010101010", key, "at least 20"},
+		{"ff3-1 too long", &FPEProvider{Mode: FPEModeFF31, Tweak: tweak7}, strings.Repeat("1", 57), key, "at most 56"},
+		{"ff3-1 short tweak", &FPEProvider{Mode: FPEModeFF31, Tweak: tweak7[:6]}, "123456", key, "tweak must be exactly 7 bytes"},
+		{"ff3-1 64-bit tweak", &FPEProvider{Mode: FPEModeFF31, Tweak: make([]byte, 8)}, "123456", key, "tweak must be exactly 7 bytes"},
+		{"ff1 long tweak", &FPEProvider{Mode: FPEModeFF1, Tweak: make([]byte, FF1MaxTweakSize+1)}, "123456", key, "tweak must be at most 256 bytes"},
+		{"character outside alphabet", &FPEProvider{Mode: FPEModeFF1}, "12345a", key, "not in the alphabet"},
+		{"duplicate alphabet character", &FPEProvider{Mode: FPEModeFF1, Alphabet: "0123456780"}, "123456", key, "duplicate character"},
+		{"one character alphabet", &FPEProvider{Mode: FPEModeFF1, Alphabet: "0"}, "000000", key, "alphabet must have"},
+		{"bad key size", &FPEProvider{Mode: FPEModeFF1}, "123456", key[:15], "failed to create cipher"},
+		{"unknown mode", &FPEProvider{Mode: "ff3"}, "123456", key, "unsupported format-preserving mode"},
+	} {
+		_, err := tc.provider.Encrypt([]byte(tc.input), tc.key)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: error = %v, want %q", tc.name, err, tc.want)
+		}
+	}
+
+	if _, err := NewFF1(key, 1, nil); err == nil {
+		t.Error("NewFF1 accepted radix 1")
+	}
+	if _, err := NewFF1(key, 10, make([]byte, FF1MaxTweakSize)); err != nil {
+		t.Errorf("NewFF1 rejected a %d-byte tweak: %v", FF1MaxTweakSize, err)
+	}
+	if _, err := NewFF31(key, 1<<16+1, tweak7); err == nil {
+		t.Error("NewFF31 accepted radix 65537")
+	}
+}
@@ -0,0 +1,483 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+// HPKE (RFC 9180) identifiers
+type HPKEKEM uint16
+type HPKEKDF uint16
+type HPKEAEAD uint16
+type HPKEMode uint8
+
+const (
+	KEMP256HKDFSHA256   HPKEKEM = 0x0010
+	KEMX25519HKDFSHA256 HPKEKEM = 0x0020
+
+	KDFHKDFSHA256 HPKEKDF = 0x0001
+
+	AEADAES128GCM        HPKEAEAD = 0x0001
+	AEADAES256GCM        HPKEAEAD = 0x0002
+	AEADChaCha20Poly1305 HPKEAEAD = 0x0003
+
+	HPKEModeBase    HPKEMode = 0x00
+	HPKEModePSK     HPKEMode = 0x01
+	HPKEModeAuth    HPKEMode = 0x02
+	HPKEModeAuthPSK HPKEMode = 0x03
+)
+
+const hpkeVersionLabel = "HPKE-v1"
+
+// MinHPKEPSKSize is the shortest pre-shared key accepted; RFC 9180, section 5.1.2 asks
+// for at least 32 bytes of entropy, as the PSK is the only secret against an outsider
+const MinHPKEPSKSize = 32
+
+// HPKESuite selects the KEM, KDF and AEAD used by an HPKE context
+type HPKESuite struct {
+	KEM  HPKEKEM
+	KDF  HPKEKDF
+	AEAD HPKEAEAD
+}
+
+// HPKEOptions carries the optional inputs that select the PSK and auth modes.
+// The sender sets SenderPrivateKey, the recipient sets SenderPublicKey.
+type HPKEOptions struct {
+	PSK              []byte
+	PSKID            []byte
+	SenderPrivateKey []byte
+	SenderPublicKey  []byte
+}
+
+// HPKEContext is an encryption context established by SetupSender or SetupRecipient
+type HPKEContext struct {
+	suite          HPKESuite
+	aead           cipher.AEAD
+	baseNonce      []byte
+	seq            uint64
+	exporterSecret []byte
+}
+
+func (s HPKESuite) curve() (ecdh.Curve, error) {
+	switch s.KEM {
+	case KEMX25519HKDFSHA256:
+		return ecdh.X25519(), nil
+	case KEMP256HKDFSHA256:
+		return ecdh.P256(), nil
+	default:
+		return nil, fmt.Errorf("unsupported HPKE KEM: 0x%04x", uint16(s.KEM))
+	}
+}
+
+func (s HPKESuite) validate() error {
+	if _, err := s.curve(); err != nil {
+		return err
+	}
+	if s.KDF != KDFHKDFSHA256 {
+		return fmt.Errorf("unsupported HPKE KDF: 0x%04x", uint16(s.KDF))
+	}
+	if _, err := s.aeadKeySize(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s HPKESuite) aeadKeySize() (int, error) {
+	switch s.AEAD {
+	case AEADAES128GCM:
+		return 16, nil
+	case AEADAES256GCM, AEADChaCha20Poly1305:
+		return 32, nil
+	default:
+		return 0, fmt.Errorf("unsupported HPKE AEAD: 0x%04x", uint16(s.AEAD))
+	}
+}
+
+func (s HPKESuite) newAEAD(key []byte) (cipher.AEAD, error) {
+	switch s.AEAD {
+	case AEADAES128GCM, AEADAES256GCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cipher: %w", err)
+		}
+		return cipher.NewGCM(block)
+	case AEADChaCha20Poly1305:
+		return chacha20poly1305.New(key)
+	default:
+		return nil, fmt.Errorf("unsupported HPKE AEAD: 0x%04x", uint16(s.AEAD))
+	}
+}
+
+func (s HPKESuite) kemSuiteID() []byte {
+	return binary.BigEndian.AppendUint16([]byte("KEM"), uint16(s.KEM))
+}
+
+func (s HPKESuite) hpkeSuiteID() []byte {
+	id := []byte("HPKE")
+	id = binary.BigEndian.AppendUint16(id, uint16(s.KEM))
+	id = binary.BigEndian.AppendUint16(id, uint16(s.KDF))
+	return binary.BigEndian.AppendUint16(id, uint16(s.AEAD))
+}
+
+func labeledExtract(suiteID []byte, salt []byte, label string, ikm []byte) []byte {
+	labeled := make([]byte, 0, len(hpkeVersionLabel)+len(suiteID)+len(label)+len(ikm))
+	labeled = append(labeled, hpkeVersionLabel...)
+	labeled = append(labeled, suiteID...)
+	labeled = append(labeled, label...)
+	labeled = append(labeled, ikm...)
+	return hkdf.Extract(sha256.New, labeled, salt)
+}
+
+func labeledExpand(suiteID []byte, prk []byte, label string, info []byte, length int) ([]byte, error) {
+	labeled := binary.BigEndian.AppendUint16(nil, uint16(length))
+	labeled = append(labeled, hpkeVersionLabel...)
+	labeled = append(labeled, suiteID...)
+	labeled = append(labeled, label...)
+	labeled = append(labeled, info...)
+
+	out := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, prk, labeled), out); err != nil {
+		return nil, fmt.Errorf("failed to expand key material: %w", err)
+	}
+	return out, nil
+}
+
+// DeriveKeyPair deterministically derives a KEM key pair from ikm (RFC 9180, section 7.1.3)
+func (s HPKESuite) DeriveKeyPair(ikm []byte) (*ecdh.PrivateKey, error) {
+	curve, err := s.curve()
+	if err != nil {
+		return nil, err
+	}
+
+	suiteID := s.kemSuiteID()
+	dkpPRK := labeledExtract(suiteID, nil, "dkp_prk", ikm)
+
+	if s.KEM == KEMX25519HKDFSHA256 {
+		sk, err := labeledExpand(suiteID, dkpPRK, "sk", nil, 32)
+		if err != nil {
+			return nil, err
+		}
+		return curve.NewPrivateKey(sk)
+	}
+
+	for counter := 0; counter < 256; counter++ {
+		candidate, err := labeledExpand(suiteID, dkpPRK, "candidate", []byte{byte(counter)}, 32)
+		if err != nil {
+			return nil, err
+		}
+		// NewPrivateKey rejects zero and out of range scalars
+		if key, err := curve.NewPrivateKey(candidate); err == nil {
+			return key, nil
+		}
+	}
+	return nil, errors.New("failed to derive HPKE key pair")
+}
+
+// GenerateKeyPair generates a random KEM key pair for the suite
+func (s HPKESuite) GenerateKeyPair() (*ecdh.PrivateKey, error) {
+	curve, err := s.curve()
+	if err != nil {
+		return nil, err
+	}
+	return curve.GenerateKey(rand.Reader)
+}
+
+func (s HPKESuite) extractAndExpand(dh []byte, kemContext []byte) ([]byte, error) {
+	suiteID := s.kemSuiteID()
+	eaePRK := labeledExtract(suiteID, nil, "eae_prk", dh)
+	return labeledExpand(suiteID, eaePRK, "shared_secret", kemContext, 32)
+}
+
+func (s HPKESuite) encap(pkR *ecdh.PublicKey, skS *ecdh.PrivateKey, skE *ecdh.PrivateKey) ([]byte, []byte, error) {
+	dh, err := skE.ECDH(pkR)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to compute shared secret: %w", err)
+	}
+
+	enc := skE.PublicKey().Bytes()
+	kemContext := append(append([]byte{}, enc...), pkR.Bytes()...)
+
+	if skS != nil {
+		dhS, err := skS.ECDH(pkR)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to compute shared secret: %w", err)
+		}
+		dh = append(dh, dhS...)
+		kemContext = append(kemContext, skS.PublicKey().Bytes()...)
+	}
+
+	sharedSecret, err := s.extractAndExpand(dh, kemContext)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sharedSecret, enc, nil
+}
+
+func (s HPKESuite) decap(enc []byte, skR *ecdh.PrivateKey, pkS *ecdh.PublicKey) ([]byte, error) {
+	curve, err := s.curve()
+	if err != nil {
+		return nil, err
+	}
+
+	pkE, err := curve.NewPublicKey(enc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encapsulated key: %w", err)
+	}
+
+	dh, err := skR.ECDH(pkE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute shared secret: %w", err)
+	}
+
+	kemContext := append(append([]byte{}, enc...), skR.PublicKey().Bytes()...)
+
+	if pkS != nil {
+		dhS, err := skR.ECDH(pkS)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute shared secret: %w", err)
+		}
+		dh = append(dh, dhS...)
+		kemContext = append(kemContext, pkS.Bytes()...)
+	}
+
+	return s.extractAndExpand(dh, kemContext)
+}
+
+func (s HPKESuite) keySchedule(mode HPKEMode, sharedSecret, info, psk, pskID []byte) (*HPKEContext, error) {
+	key, baseNonce, exporterSecret, err := s.keyScheduleSecrets(mode, sharedSecret, info, psk, pskID)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := s.newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HPKEContext{
+		suite:          s,
+		aead:           aead,
+		baseNonce:      baseNonce,
+		exporterSecret: exporterSecret,
+	}, nil
+}
+
+// keyScheduleSecrets derives the AEAD key, base nonce and exporter secret (RFC 9180, section 5.1)
+func (s HPKESuite) keyScheduleSecrets(mode HPKEMode, sharedSecret, info, psk, pskID []byte) ([]byte, []byte, []byte, error) {
+	hasPSK := len(psk) > 0
+	if hasPSK != (len(pskID) > 0) {
+		return nil, nil, nil, errors.New("inconsistent PSK inputs: psk and psk_id must be given together")
+	}
+	if hasPSK != (mode == HPKEModePSK || mode == HPKEModeAuthPSK) {
+		return nil, nil, nil, errors.New("PSK inputs do not match the HPKE mode")
+	}
+	if hasPSK && len(psk) < MinHPKEPSKSize {
+		return nil, nil, nil, fmt.Errorf("psk is %d bytes, must be at least %d", len(psk), MinHPKEPSKSize)
+	}
+
+	suiteID := s.hpkeSuiteID()
+	pskIDHash := labeledExtract(suiteID, nil, "psk_id_hash", pskID)
+	infoHash := labeledExtract(suiteID, nil, "info_hash", info)
+	keyScheduleContext := append([]byte{byte(mode)}, pskIDHash...)
+	keyScheduleContext = append(keyScheduleContext, infoHash...)
+
+	secret := labeledExtract(suiteID, sharedSecret, "secret", psk)
+
+	keySize, err := s.aeadKeySize()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	key, err := labeledExpand(suiteID, secret, "key", keyScheduleContext, keySize)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	baseNonce, err := labeledExpand(suiteID, secret, "base_nonce", keyScheduleContext, 12)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	exporterSecret, err := labeledExpand(suiteID, secret, "exp", keyScheduleContext, 32)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return key, baseNonce, exporterSecret, nil
+}
+
+func (o *HPKEOptions) mode() HPKEMode {
+	if o == nil {
+		return HPKEModeBase
+	}
+	mode := HPKEModeBase
+	if len(o.PSK) > 0 || len(o.PSKID) > 0 {
+		mode |= HPKEModePSK
+	}
+	if len(o.SenderPrivateKey) > 0 || len(o.SenderPublicKey) > 0 {
+		mode |= HPKEModeAuth
+	}
+	return mode
+}
+
+func (o *HPKEOptions) psk() ([]byte, []byte) {
+	if o == nil {
+		return nil, nil
+	}
+	return o.PSK, o.PSKID
+}
+
+// SetupSender establishes a sender context for the recipient public key pkR.
+// The mode (base, psk, auth or auth_psk) is selected by the options.
+func (s HPKESuite) SetupSender(pkR []byte, info []byte, opts *HPKEOptions) ([]byte, *HPKEContext, error) {
+	skE, err := s.GenerateKeyPair()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	return s.setupSenderWithEphemeral(pkR, info, opts, skE)
+}
+
+func (s HPKESuite) setupSenderWithEphemeral(pkR []byte, info []byte, opts *HPKEOptions, skE *ecdh.PrivateKey) ([]byte, *HPKEContext, error) {
+	if err := s.validate(); err != nil {
+		return nil, nil, err
+	}
+	curve, _ := s.curve()
+
+	mode := opts.mode()
+	utils.DebugLogf("HPKE SetupSender: kem=0x%04x aead=0x%04x mode=%d", uint16(s.KEM), uint16(s.AEAD), mode)
+
+	recipientKey, err := curve.NewPublicKey(pkR)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid recipient public key: %w", err)
+	}
+
+	var senderKey *ecdh.PrivateKey
+	if mode&HPKEModeAuth != 0 {
+		if len(opts.SenderPrivateKey) == 0 {
+			return nil, nil, errors.New("auth mode requires the sender private key")
+		}
+		senderKey, err = curve.NewPrivateKey(opts.SenderPrivateKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid sender private key: %w", err)
+		}
+	}
+
+	sharedSecret, enc, err := s.encap(recipientKey, senderKey, skE)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	psk, pskID := opts.psk()
+	ctx, err := s.keySchedule(mode, sharedSecret, info, psk, pskID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return enc, ctx, nil
+}
+
+// SetupRecipient establishes a recipient context from the encapsulated key enc
+func (s HPKESuite) SetupRecipient(enc []byte, skR []byte, info []byte, opts *HPKEOptions) (*HPKEContext, error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	curve, _ := s.curve()
+
+	mode := opts.mode()
+	utils.DebugLogf("HPKE SetupRecipient: kem=0x%04x aead=0x%04x mode=%d", uint16(s.KEM), uint16(s.AEAD), mode)
+
+	recipientKey, err := curve.NewPrivateKey(skR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient private key: %w", err)
+	}
+
+	var senderKey *ecdh.PublicKey
+	if mode&HPKEModeAuth != 0 {
+		if len(opts.SenderPublicKey) == 0 {
+			return nil, errors.New("auth mode requires the sender public key")
+		}
+		senderKey, err = curve.NewPublicKey(opts.SenderPublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sender public key: %w", err)
+		}
+	}
+
+	sharedSecret, err := s.decap(enc, recipientKey, senderKey)
+	if err != nil {
+		return nil, err
+	}
+
+	psk, pskID := opts.psk()
+	return s.keySchedule(mode, sharedSecret, info, psk, pskID)
+}
+
+func (c *HPKEContext) nextNonce() ([]byte, error) {
+	if c.seq == ^uint64(0) {
+		return nil, errors.New("HPKE message limit reached")
+	}
+	nonce := make([]byte, len(c.baseNonce))
+	copy(nonce, c.baseNonce)
+	var seq [8]byte
+	binary.BigEndian.PutUint64(seq[:], c.seq)
+	for i := range seq {
+		nonce[len(nonce)-8+i] ^= seq[i]
+	}
+	return nonce, nil
+}
+
+// Seal encrypts and authenticates plaintext with the next sequence number
+func (c *HPKEContext) Seal(aad, plaintext []byte) ([]byte, error) {
+	nonce, err := c.nextNonce()
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := c.aead.Seal(nil, nonce, plaintext, aad)
+	c.seq++
+	return ciphertext, nil
+}
+
+// Open decrypts and verifies ciphertext with the next sequence number
+func (c *HPKEContext) Open(aad, ciphertext []byte) ([]byte, error) {
+	nonce, err := c.nextNonce()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open HPKE ciphertext: %w", err)
+	}
+	c.seq++
+	return plaintext, nil
+}
+
+// Export derives a secret of the given length from the context (RFC 9180, section 5.3)
+func (c *HPKEContext) Export(exporterContext []byte, length int) ([]byte, error) {
+	return labeledExpand(c.suite.hpkeSuiteID(), c.exporterSecret, "sec", exporterContext, length)
+}
+
+// HPKESeal is the single-shot sender API: it returns the encapsulated key and the ciphertext
+func HPKESeal(suite HPKESuite, pkR, info, aad, plaintext []byte, opts *HPKEOptions) ([]byte, []byte, error) {
+	enc, ctx, err := suite.SetupSender(pkR, info, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	ciphertext, err := ctx.Seal(aad, plaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+	return enc, ciphertext, nil
+}
+
+// HPKEOpen is the single-shot recipient API
+func HPKEOpen(suite HPKESuite, enc, skR, info, aad, ciphertext []byte, opts *HPKEOptions) ([]byte, error) {
+	ctx, err := suite.SetupRecipient(enc, skR, info, opts)
+	if err != nil {
+		return nil, err
+	}
+	return ctx.Open(aad, ciphertext)
+}
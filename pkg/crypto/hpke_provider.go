@@ -0,0 +1,268 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+// HPKEProvider implements CryptoProvider with single-shot HPKE.
+// The ciphertext is the encapsulated key followed by the AEAD output.
+type HPKEProvider struct {
+	Suite   HPKESuite
+	Info    []byte
+	Options *HPKEOptions
+}
+
+// DefaultHPKESuite is DHKEM(X25519, HKDF-SHA256), HKDF-SHA256, AES-128-GCM
+var DefaultHPKESuite = HPKESuite{KEM: KEMX25519HKDFSHA256, KDF: KDFHKDFSHA256, AEAD: AEADAES128GCM}
+
+// ParseHPKESuite parses algorithm names of the form hpke[-<kem>[-<aead>]],
+// e.g. "hpke", "hpke-p256" or "hpke-x25519-chacha20poly1305"
+func ParseHPKESuite(algorithm string) (HPKESuite, error) {
+	parts := strings.Split(strings.ToLower(algorithm), "-")
+	if parts[0] != "hpke" || len(parts) > 3 {
+		return HPKESuite{}, fmt.Errorf("invalid HPKE algorithm: %s", algorithm)
+	}
+
+	suite := DefaultHPKESuite
+	if len(parts) > 1 {
+		switch parts[1] {
+		case "x25519":
+			suite.KEM = KEMX25519HKDFSHA256
+		case "p256":
+			suite.KEM = KEMP256HKDFSHA256
+		default:
+			return HPKESuite{}, fmt.Errorf("unsupported HPKE KEM: %s", parts[1])
+		}
+	}
+	if len(parts) > 2 {
+		switch parts[2] {
+		case "aes128gcm":
+			suite.AEAD = AEADAES128GCM
+		case "aes256gcm":
+			suite.AEAD = AEADAES256GCM
+		case "chacha20poly1305":
+			suite.AEAD = AEADChaCha20Poly1305
+		default:
+			return HPKESuite{}, fmt.Errorf("unsupported HPKE AEAD: %s", parts[2])
+		}
+	}
+	return suite, nil
+}
+
+// Name returns the suite in the hpke-<kem>-<aead> form accepted by ParseHPKESuite
+func (s HPKESuite) Name() string {
+	kem := fmt.Sprintf("kem0x%04x", uint16(s.KEM))
+	switch s.KEM {
+	case KEMX25519HKDFSHA256:
+		kem = "x25519"
+	case KEMP256HKDFSHA256:
+		kem = "p256"
+	}
+
+	aead := fmt.Sprintf("aead0x%04x", uint16(s.AEAD))
+	switch s.AEAD {
+	case AEADAES128GCM:
+		aead = "aes128gcm"
+	case AEADAES256GCM:
+		aead = "aes256gcm"
+	case AEADChaCha20Poly1305:
+		aead = "chacha20poly1305"
+	}
+	return "hpke-" + kem + "-" + aead
+}
+
+func (h *HPKEProvider) Encrypt(data []byte, key []byte) ([]byte, error) {
+	utils.DebugLogf("HPKEProvider.Encrypt: encrypting %d bytes of data", len(data))
+	curve, err := h.Suite.curve()
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := ParseECDHPublicKey(key, curve)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := h.rawOptions(curve)
+	if err != nil {
+		return nil, err
+	}
+
+	enc, ciphertext, err := HPKESeal(h.Suite, publicKey.Bytes(), h.Info, nil, data, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(enc, ciphertext...), nil
+}
+
+func (h *HPKEProvider) Decrypt(data []byte, key []byte) ([]byte, error) {
+	utils.DebugLogf("HPKEProvider.Decrypt: decrypting %d bytes of data", len(data))
+	curve, err := h.Suite.curve()
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := ParseECDHPrivateKey(key, curve)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := h.rawOptions(curve)
+	if err != nil {
+		return nil, err
+	}
+
+	encSize := len(privateKey.PublicKey().Bytes())
+	if len(data) < encSize {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	return HPKEOpen(h.Suite, data[:encSize], privateKey.Bytes(), h.Info, nil, data[encSize:], opts)
+}
+
+// rawOptions converts PEM encoded sender keys in the options to their raw form
+func (h *HPKEProvider) rawOptions(curve ecdh.Curve) (*HPKEOptions, error) {
+	if h.Options == nil {
+		return nil, nil
+	}
+
+	opts := *h.Options
+	if len(opts.SenderPrivateKey) > 0 {
+		senderKey, err := ParseECDHPrivateKey(opts.SenderPrivateKey, curve)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sender key: %w", err)
+		}
+		opts.SenderPrivateKey = senderKey.Bytes()
+	}
+	if len(opts.SenderPublicKey) > 0 {
+		senderKey, err := ParseECDHPublicKey(opts.SenderPublicKey, curve)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sender key: %w", err)
+		}
+		opts.SenderPublicKey = senderKey.Bytes()
+	}
+	return &opts, nil
+}
+
+func (h *HPKEProvider) GenerateKey() ([]byte, error) {
+	utils.DebugLog("HPKEProvider.GenerateKey: generating new HPKE key pair")
+	privateKeyPEM, _, err := GenerateHPKEKeyPair(h.Suite)
+	return privateKeyPEM, err
+}
+
+// GenerateHPKEKeyPair generates a KEM key pair for the suite and returns the
+// private key (PKCS#8) and public key (PKIX) in PEM format
+func GenerateHPKEKeyPair(suite HPKESuite) ([]byte, []byte, error) {
+	utils.DebugLog("GenerateHPKEKeyPair: generating HPKE key pair")
+	privateKey, err := suite.GenerateKeyPair()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate HPKE key: %w", err)
+	}
+	return marshalECDHKeyPair(privateKey)
+}
+
+func marshalECDHKeyPair(privateKey *ecdh.PrivateKey) ([]byte, []byte, error) {
+	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal private key: %w", err)
+	}
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: privateKeyBytes,
+	})
+
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(privateKey.PublicKey())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicKeyBytes,
+	})
+
+	return privateKeyPEM, publicKeyPEM, nil
+}
+
+// ParseECDHPublicKey accepts a PKIX PEM public key or a raw serialized public key for curve
+func ParseECDHPublicKey(key []byte, curve ecdh.Curve) (*ecdh.PublicKey, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		publicKey, err := curve.NewPublicKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		return publicKey, nil
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	var publicKey *ecdh.PublicKey
+	switch k := pub.(type) {
+	case *ecdh.PublicKey:
+		publicKey = k
+	case *ecdsa.PublicKey:
+		publicKey, err = k.ECDH()
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert public key: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("key is not an ECDH public key")
+	}
+
+	if publicKey.Curve() != curve {
+		return nil, fmt.Errorf("public key does not match the selected curve")
+	}
+	return publicKey, nil
+}
+
+// ParseECDHPrivateKey accepts a PKCS#8 PEM private key or a raw serialized private key for curve
+func ParseECDHPrivateKey(key []byte, curve ecdh.Curve) (*ecdh.PrivateKey, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		privateKey, err := curve.NewPrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		return privateKey, nil
+	}
+
+	var parsedKey interface{}
+	var err error
+	if block.Type == "EC PRIVATE KEY" {
+		parsedKey, err = x509.ParseECPrivateKey(block.Bytes)
+	} else {
+		parsedKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	var privateKey *ecdh.PrivateKey
+	switch k := parsedKey.(type) {
+	case *ecdh.PrivateKey:
+		privateKey = k
+	case *ecdsa.PrivateKey:
+		privateKey, err = k.ECDH()
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert private key: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("key is not an ECDH private key")
+	}
+
+	if privateKey.Curve() != curve {
+		return nil, fmt.Errorf("private key does not match the selected curve")
+	}
+	return privateKey, nil
+}
@@ -0,0 +1,594 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"encoding/hex"
+	"testing"
+)
+
+type hpkeTestEncryption struct {
+	seq         uint64
+	aad, pt, ct string
+}
+
+type hpkeTestExport struct {
+	context string
+	length  int
+	value   string
+}
+
+// hpkeTestVector is a test vector from RFC 9180, Appendix A. Byte strings are hex.
+type hpkeTestVector struct {
+	name                           string
+	suite                          HPKESuite
+	mode                           HPKEMode
+	info, ikmR, ikmE, skRm, skEm   string
+	pkRm, pkEm, ikmS, skSm, pkSm   string
+	psk, pskID, enc, sharedSecret  string
+	key, baseNonce, exporterSecret string
+	encryptions                    []hpkeTestEncryption
+	exports                        []hpkeTestExport
+}
+
+var hpkeTestVectors = []hpkeTestVector{
+	{
+		name:           "A.1, base",
+		suite:          HPKESuite{KEM: KEMX25519HKDFSHA256, KDF: KDFHKDFSHA256, AEAD: AEADAES128GCM},
+		mode:           HPKEModeBase,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmR:           "6db9df30aa07dd42ee5e8181afdb977e538f5e1fec8a06223f33f7013e525037",
+		ikmE:           "7268600d403fce431561aef583ee1613527cff655c1343f29812e66706df3234",
+		skRm:           "4612c550263fc8ad58375df3f557aac531d26850903e55a9f23f21d8534e8ac8",
+		skEm:           "52c4a758a802cd8b936eceea314432798d5baf2d7e9235dc084ab1b9cfa2f736",
+		pkRm:           "3948cfe0ad1ddb695d780e59077195da6c56506b027329794ab02bca80815c4d",
+		pkEm:           "37fda3567bdbd628e88668c3c8d7e97d1d1253b6d4ea6d44c150f741f1bf4431",
+		enc:            "37fda3567bdbd628e88668c3c8d7e97d1d1253b6d4ea6d44c150f741f1bf4431",
+		sharedSecret:   "fe0e18c9f024ce43799ae393c7e8fe8fce9d218875e8227b0187c04e7d2ea1fc",
+		key:            "4531685d41d65f03dc48f6b8302c05b0",
+		baseNonce:      "56d890e5accaaf011cff4b7d",
+		exporterSecret: "45ff1c2e220db587171952c0592d5f5ebe103f1561a2614e38f2ffd47e99e3f8",
+		encryptions: []hpkeTestEncryption{
+			{seq: 0, aad: "436f756e742d30", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "f938558b5d72f1a23810b4be2ab4f84331acc02fc97babc53a52ae8218a355a96d8770ac83d07bea87e13c512a"},
+			{seq: 1, aad: "436f756e742d31", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "af2d7e9ac9ae7e270f46ba1f975be53c09f8d875bdc8535458c2494e8a6eab251c03d0c22a56b8ca42c2063b84"},
+			{seq: 2, aad: "436f756e742d32", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "498dfcabd92e8acedc281e85af1cb4e3e31c7dc394a1ca20e173cb72516491588d96a19ad4a683518973dcc180"},
+			{seq: 4, aad: "436f756e742d34", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "583bd32bc67a5994bb8ceaca813d369bca7b2a42408cddef5e22f880b631215a09fc0012bc69fccaa251c0246d"},
+			{seq: 255, aad: "436f756e742d323535", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "7175db9717964058640a3a11fb9007941a5d1757fda1a6935c805c21af32505bf106deefec4a49ac38d71c9e0a"},
+			{seq: 256, aad: "436f756e742d323536", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "957f9800542b0b8891badb026d79cc54597cb2d225b54c00c5238c25d05c30e3fbeda97d2e0e1aba483a2df9f2"},
+		},
+		exports: []hpkeTestExport{
+			{context: "", length: 32, value: "3853fe2b4035195a573ffc53856e77058e15d9ea064de3e59f4961d0095250ee"},
+			{context: "00", length: 32, value: "2e8f0b54673c7029649d4eb9d5e33bf1872cf76d623ff164ac185da9e88c21a5"},
+			{context: "54657374436f6e74657874", length: 32, value: "e9e43065102c3836401bed8c3c3c75ae46be1639869391d62c61f1ec7af54931"},
+		},
+	},
+	{
+		name:           "A.1, psk",
+		suite:          HPKESuite{KEM: KEMX25519HKDFSHA256, KDF: KDFHKDFSHA256, AEAD: AEADAES128GCM},
+		mode:           HPKEModePSK,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmR:           "d4a09d09f575fef425905d2ab396c1449141463f698f8efdb7accfaff8995098",
+		ikmE:           "78628c354e46f3e169bd231be7b2ff1c77aa302460a26dbfa15515684c00130b",
+		skRm:           "c5eb01eb457fe6c6f57577c5413b931550a162c71a03ac8d196babbd4e5ce0fd",
+		skEm:           "463426a9ffb42bb17dbe6044b9abd1d4e4d95f9041cef0e99d7824eef2b6f588",
+		pkRm:           "9fed7e8c17387560e92cc6462a68049657246a09bfa8ade7aefe589672016366",
+		pkEm:           "0ad0950d9fb9588e59690b74f1237ecdf1d775cd60be2eca57af5a4b0471c91b",
+		psk:            "0247fd33b913760fa1fa51e1892d9f307fbe65eb171e8132c2af18555a738b82",
+		pskID:          "456e6e796e20447572696e206172616e204d6f726961",
+		enc:            "0ad0950d9fb9588e59690b74f1237ecdf1d775cd60be2eca57af5a4b0471c91b",
+		sharedSecret:   "727699f009ffe3c076315019c69648366b69171439bd7dd0807743bde76986cd",
+		key:            "15026dba546e3ae05836fc7de5a7bb26",
+		baseNonce:      "9518635eba129d5ce0914555",
+		exporterSecret: "3d76025dbbedc49448ec3f9080a1abab6b06e91c0b11ad23c912f043a0ee7655",
+		encryptions: []hpkeTestEncryption{
+			{seq: 0, aad: "436f756e742d30", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "e52c6fed7f758d0cf7145689f21bc1be6ec9ea097fef4e959440012f4feb73fb611b946199e681f4cfc34db8ea"},
+			{seq: 1, aad: "436f756e742d31", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "49f3b19b28a9ea9f43e8c71204c00d4a490ee7f61387b6719db765e948123b45b61633ef059ba22cd62437c8ba"},
+			{seq: 2, aad: "436f756e742d32", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "257ca6a08473dc851fde45afd598cc83e326ddd0abe1ef23baa3baa4dd8cde99fce2c1e8ce687b0b47ead1adc9"},
+			{seq: 4, aad: "436f756e742d34", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "a71d73a2cd8128fcccbd328b9684d70096e073b59b40b55e6419c9c68ae21069c847e2a70f5d8fb821ce3dfb1c"},
+			{seq: 255, aad: "436f756e742d323535", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "55f84b030b7f7197f7d7d552365b6b932df5ec1abacd30241cb4bc4ccea27bd2b518766adfa0fb1b71170e9392"},
+			{seq: 256, aad: "436f756e742d323536", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "c5bf246d4a790a12dcc9eed5eae525081e6fb541d5849e9ce8abd92a3bc1551776bea16b4a518f23e237c14b59"},
+		},
+		exports: []hpkeTestExport{
+			{context: "", length: 32, value: "dff17af354c8b41673567db6259fd6029967b4e1aad13023c2ae5df8f4f43bf6"},
+			{context: "00", length: 32, value: "6a847261d8207fe596befb52928463881ab493da345b10e1dcc645e3b94e2d95"},
+			{context: "54657374436f6e74657874", length: 32, value: "8aff52b45a1be3a734bc7a41e20b4e055ad4c4d22104b0c20285a7c4302401cd"},
+		},
+	},
+	{
+		name:           "A.1, auth",
+		suite:          HPKESuite{KEM: KEMX25519HKDFSHA256, KDF: KDFHKDFSHA256, AEAD: AEADAES128GCM},
+		mode:           HPKEModeAuth,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmR:           "f1d4a30a4cef8d6d4e3b016e6fd3799ea057db4f345472ed302a67ce1c20cdec",
+		ikmE:           "6e6d8f200ea2fb20c30b003a8b4f433d2f4ed4c2658d5bc8ce2fef718059c9f7",
+		skRm:           "fdea67cf831f1ca98d8e27b1f6abeb5b7745e9d35348b80fa407ff6958f9137e",
+		skEm:           "ff4442ef24fbc3c1ff86375b0be1e77e88a0de1e79b30896d73411c5ff4c3518",
+		pkRm:           "1632d5c2f71c2b38d0a8fcc359355200caa8b1ffdf28618080466c909cb69b2e",
+		pkEm:           "23fb952571a14a25e3d678140cd0e5eb47a0961bb18afcf85896e5453c312e76",
+		ikmS:           "94b020ce91d73fca4649006c7e7329a67b40c55e9e93cc907d282bbbff386f58",
+		skSm:           "dc4a146313cce60a278a5323d321f051c5707e9c45ba21a3479fecdf76fc69dd",
+		pkSm:           "8b0c70873dc5aecb7f9ee4e62406a397b350e57012be45cf53b7105ae731790b",
+		enc:            "23fb952571a14a25e3d678140cd0e5eb47a0961bb18afcf85896e5453c312e76",
+		sharedSecret:   "2d6db4cf719dc7293fcbf3fa64690708e44e2bebc81f84608677958c0d4448a7",
+		key:            "b062cb2c4dd4bca0ad7c7a12bbc341e6",
+		baseNonce:      "a1bc314c1942ade7051ffed0",
+		exporterSecret: "ee1a093e6e1c393c162ea98fdf20560c75909653550540a2700511b65c88c6f1",
+		encryptions: []hpkeTestEncryption{
+			{seq: 0, aad: "436f756e742d30", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "5fd92cc9d46dbf8943e72a07e42f363ed5f721212cd90bcfd072bfd9f44e06b80fd17824947496e21b680c141b"},
+			{seq: 1, aad: "436f756e742d31", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "d3736bb256c19bfa93d79e8f80b7971262cb7c887e35c26370cfed62254369a1b52e3d505b79dd699f002bc8ed"},
+			{seq: 2, aad: "436f756e742d32", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "122175cfd5678e04894e4ff8789e85dd381df48dcaf970d52057df2c9acc3b121313a2bfeaa986050f82d93645"},
+			{seq: 4, aad: "436f756e742d34", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "dae12318660cf963c7bcbef0f39d64de3bf178cf9e585e756654043cc5059873bc8af190b72afc43d1e0135ada"},
+			{seq: 255, aad: "436f756e742d323535", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "55d53d85fe4d9e1e97903101eab0b4865ef20cef28765a47f840ff99625b7d69dee927df1defa66a036fc58ff2"},
+			{seq: 256, aad: "436f756e742d323536", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "42fa248a0e67ccca688f2b1d13ba4ba84755acf764bd797c8f7ba3b9b1dc3330326f8d172fef6003c79ec72319"},
+		},
+		exports: []hpkeTestExport{
+			{context: "", length: 32, value: "28c70088017d70c896a8420f04702c5a321d9cbf0279fba899b59e51bac72c85"},
+			{context: "00", length: 32, value: "25dfc004b0892be1888c3914977aa9c9bbaf2c7471708a49e1195af48a6f29ce"},
+			{context: "54657374436f6e74657874", length: 32, value: "5a0131813abc9a522cad678eb6bafaabc43389934adb8097d23c5ff68059eb64"},
+		},
+	},
+	{
+		name:           "A.1, auth_psk",
+		suite:          HPKESuite{KEM: KEMX25519HKDFSHA256, KDF: KDFHKDFSHA256, AEAD: AEADAES128GCM},
+		mode:           HPKEModeAuthPSK,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmR:           "4b16221f3b269a88e207270b5e1de28cb01f847841b344b8314d6a622fe5ee90",
+		ikmE:           "4303619085a20ebcf18edd22782952b8a7161e1dbae6e46e143a52a96127cf84",
+		skRm:           "cb29a95649dc5656c2d054c1aa0d3df0493155e9d5da6d7e344ed8b6a64a9423",
+		skEm:           "14de82a5897b613616a00c39b87429df35bc2b426bcfd73febcb45e903490768",
+		pkRm:           "1d11a3cd247ae48e901939659bd4d79b6b959e1f3e7d66663fbc9412dd4e0976",
+		pkEm:           "820818d3c23993492cc5623ab437a48a0a7ca3e9639c140fe1e33811eb844b7c",
+		ikmS:           "62f77dcf5df0dd7eac54eac9f654f426d4161ec850cc65c54f8b65d2e0b4e345",
+		skSm:           "fc1c87d2f3832adb178b431fce2ac77c7ca2fd680f3406c77b5ecdf818b119f4",
+		pkSm:           "2bfb2eb18fcad1af0e4f99142a1c474ae74e21b9425fc5c589382c69b50cc57e",
+		psk:            "0247fd33b913760fa1fa51e1892d9f307fbe65eb171e8132c2af18555a738b82",
+		pskID:          "456e6e796e20447572696e206172616e204d6f726961",
+		enc:            "820818d3c23993492cc5623ab437a48a0a7ca3e9639c140fe1e33811eb844b7c",
+		sharedSecret:   "f9d0e870aba28d04709b2680cb8185466c6a6ff1d6e9d1091d5bf5e10ce3a577",
+		key:            "1364ead92c47aa7becfa95203037b19a",
+		baseNonce:      "99d8b5c54669807e9fc70df1",
+		exporterSecret: "f048d55eacbf60f9c6154bd4021774d1075ebf963c6adc71fa846f183ab2dde6",
+		encryptions: []hpkeTestEncryption{
+			{seq: 0, aad: "436f756e742d30", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "a84c64df1e11d8fd11450039d4fe64ff0c8a99fca0bd72c2d4c3e0400bc14a40f27e45e141a24001697737533e"},
+			{seq: 1, aad: "436f756e742d31", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "4d19303b848f424fc3c3beca249b2c6de0a34083b8e909b6aa4c3688505c05ffe0c8f57a0a4c5ab9da127435d9"},
+			{seq: 2, aad: "436f756e742d32", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "0c085a365fbfa63409943b00a3127abce6e45991bc653f182a80120868fc507e9e4d5e37bcc384fc8f14153b24"},
+			{seq: 4, aad: "436f756e742d34", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "000a3cd3a3523bf7d9796830b1cd987e841a8bae6561ebb6791a3f0e34e89a4fb539faeee3428b8bbc082d2c1a"},
+			{seq: 255, aad: "436f756e742d323535", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "576d39dd2d4cc77d1a14a51d5c5f9d5e77586c3d8d2ab33bdec6379e28ce5c502f0b1cbd09047cf9eb9269bb52"},
+			{seq: 256, aad: "436f756e742d323536", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "13239bab72e25e9fd5bb09695d23c90a24595158b99127505c8a9ff9f127e0d657f71af59d67d4f4971da028f9"},
+		},
+		exports: []hpkeTestExport{
+			{context: "", length: 32, value: "08f7e20644bb9b8af54ad66d2067457c5f9fcb2a23d9f6cb4445c0797b330067"},
+			{context: "00", length: 32, value: "52e51ff7d436557ced5265ff8b94ce69cf7583f49cdb374e6aad801fc063b010"},
+			{context: "54657374436f6e74657874", length: 32, value: "a30c20370c026bbea4dca51cb63761695132d342bae33a6a11527d3e7679436d"},
+		},
+	},
+	{
+		name:           "A.2, base",
+		suite:          HPKESuite{KEM: KEMX25519HKDFSHA256, KDF: KDFHKDFSHA256, AEAD: AEADChaCha20Poly1305},
+		mode:           HPKEModeBase,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmR:           "1ac01f181fdf9f352797655161c58b75c656a6cc2716dcb66372da835542e1df",
+		ikmE:           "909a9b35d3dc4713a5e72a4da274b55d3d3821a37e5d099e74a647db583a904b",
+		skRm:           "8057991eef8f1f1af18f4a9491d16a1ce333f695d4db8e38da75975c4478e0fb",
+		skEm:           "f4ec9b33b792c372c1d2c2063507b684ef925b8c75a42dbcbf57d63ccd381600",
+		pkRm:           "4310ee97d88cc1f088a5576c77ab0cf5c3ac797f3d95139c6c84b5429c59662a",
+		pkEm:           "1afa08d3dec047a643885163f1180476fa7ddb54c6a8029ea33f95796bf2ac4a",
+		enc:            "1afa08d3dec047a643885163f1180476fa7ddb54c6a8029ea33f95796bf2ac4a",
+		sharedSecret:   "0bbe78490412b4bbea4812666f7916932b828bba79942424abb65244930d69a7",
+		key:            "ad2744de8e17f4ebba575b3f5f5a8fa1f69c2a07f6e7500bc60ca6e3e3ec1c91",
+		baseNonce:      "5c4d98150661b848853b547f",
+		exporterSecret: "a3b010d4994890e2c6968a36f64470d3c824c8f5029942feb11e7a74b2921922",
+		encryptions: []hpkeTestEncryption{
+			{seq: 0, aad: "436f756e742d30", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "1c5250d8034ec2b784ba2cfd69dbdb8af406cfe3ff938e131f0def8c8b60b4db21993c62ce81883d2dd1b51a28"},
+			{seq: 1, aad: "436f756e742d31", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "6b53c051e4199c518de79594e1c4ab18b96f081549d45ce015be002090bb119e85285337cc95ba5f59992dc98c"},
+			{seq: 2, aad: "436f756e742d32", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "71146bd6795ccc9c49ce25dda112a48f202ad220559502cef1f34271e0cb4b02b4f10ecac6f48c32f878fae86b"},
+			{seq: 4, aad: "436f756e742d34", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "63357a2aa291f5a4e5f27db6baa2af8cf77427c7c1a909e0b37214dd47db122bb153495ff0b02e9e54a50dbe16"},
+			{seq: 255, aad: "436f756e742d323535", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "18ab939d63ddec9f6ac2b60d61d36a7375d2070c9b683861110757062c52b8880a5f6b3936da9cd6c23ef2a95c"},
+			{seq: 256, aad: "436f756e742d323536", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "7a4a13e9ef23978e2c520fd4d2e757514ae160cd0cd05e556ef692370ca53076214c0c40d4c728d6ed9e727a5b"},
+		},
+		exports: []hpkeTestExport{
+			{context: "", length: 32, value: "4bbd6243b8bb54cec311fac9df81841b6fd61f56538a775e7c80a9f40160606e"},
+			{context: "00", length: 32, value: "8c1df14732580e5501b00f82b10a1647b40713191b7c1240ac80e2b68808ba69"},
+			{context: "54657374436f6e74657874", length: 32, value: "5acb09211139c43b3090489a9da433e8a30ee7188ba8b0a9a1ccf0c229283e53"},
+		},
+	},
+	{
+		name:           "A.2, psk",
+		suite:          HPKESuite{KEM: KEMX25519HKDFSHA256, KDF: KDFHKDFSHA256, AEAD: AEADChaCha20Poly1305},
+		mode:           HPKEModePSK,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmR:           "26b923eade72941c8a85b09986cdfa3f1296852261adedc52d58d2930269812b",
+		ikmE:           "35706a0b09fb26fb45c39c2f5079c709c7cf98e43afa973f14d88ece7e29c2e3",
+		skRm:           "77d114e0212be51cb1d76fa99dd41cfd4d0166b08caa09074430a6c59ef17879",
+		skEm:           "0c35fdf49df7aa01cd330049332c40411ebba36e0c718ebc3edf5845795f6321",
+		pkRm:           "13640af826b722fc04feaa4de2f28fbd5ecc03623b317834e7ff4120dbe73062",
+		pkEm:           "2261299c3f40a9afc133b969a97f05e95be2c514e54f3de26cbe5644ac735b04",
+		psk:            "0247fd33b913760fa1fa51e1892d9f307fbe65eb171e8132c2af18555a738b82",
+		pskID:          "456e6e796e20447572696e206172616e204d6f726961",
+		enc:            "2261299c3f40a9afc133b969a97f05e95be2c514e54f3de26cbe5644ac735b04",
+		sharedSecret:   "4be079c5e77779d0215b3f689595d59e3e9b0455d55662d1f3666ec606e50ea7",
+		key:            "600d2fdb0313a7e5c86a9ce9221cd95bed069862421744cfb4ab9d7203a9c019",
+		baseNonce:      "112e0465562045b7368653e7",
+		exporterSecret: "73b506dc8b6b4269027f80b0362def5cbb57ee50eed0c2873dac9181f453c5ac",
+		encryptions: []hpkeTestEncryption{
+			{seq: 0, aad: "436f756e742d30", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "4a177f9c0d6f15cfdf533fb65bf84aecdc6ab16b8b85b4cf65a370e07fc1d78d28fb073214525276f4a89608ff"},
+			{seq: 1, aad: "436f756e742d31", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "5c3cabae2f0b3e124d8d864c116fd8f20f3f56fda988c3573b40b09997fd6c769e77c8eda6cda4f947f5b704a8"},
+			{seq: 2, aad: "436f756e742d32", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "14958900b44bdae9cbe5a528bf933c5c990dbb8e282e6e495adf8205d19da9eb270e3a6f1e0613ab7e757962a4"},
+			{seq: 4, aad: "436f756e742d34", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "c2a7bc09ddb853cf2effb6e8d058e346f7fe0fb3476528c80db6b698415c5f8c50b68a9a355609e96d2117f8d3"},
+			{seq: 255, aad: "436f756e742d323535", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "2414d0788e4bc39a59a26d7bd5d78e111c317d44c37bd5a4c2a1235f2ddc2085c487d406490e75210c958724a7"},
+			{seq: 256, aad: "436f756e742d323536", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "c567ae1c3f0f75abe1dd9e4532b422600ed4a6e5b9484dafb1e43ab9f5fd662b28c00e2e81d3cde955dae7e218"},
+		},
+		exports: []hpkeTestExport{
+			{context: "", length: 32, value: "813c1bfc516c99076ae0f466671f0ba5ff244a41699f7b2417e4c59d46d39f40"},
+			{context: "00", length: 32, value: "2745cf3d5bb65c333658732954ee7af49eb895ce77f8022873a62a13c94cb4e1"},
+			{context: "54657374436f6e74657874", length: 32, value: "ad40e3ae14f21c99bfdebc20ae14ab86f4ca2dc9a4799d200f43a25f99fa78ae"},
+		},
+	},
+	{
+		name:           "A.2, auth",
+		suite:          HPKESuite{KEM: KEMX25519HKDFSHA256, KDF: KDFHKDFSHA256, AEAD: AEADChaCha20Poly1305},
+		mode:           HPKEModeAuth,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmR:           "64835d5ee64aa7aad57c6f2e4f758f7696617f8829e70bc9ac7a5ef95d1c756c",
+		ikmE:           "938d3daa5a8904540bc24f48ae90eed3f4f7f11839560597b55e7c9598c996c0",
+		skRm:           "3ca22a6d1cda1bb9480949ec5329d3bf0b080ca4c45879c95eddb55c70b80b82",
+		skEm:           "c94619e1af28971c8fa7957192b7e62a71ca2dcdde0a7cc4a8a9e741d600ab13",
+		pkRm:           "1a478716d63cb2e16786ee93004486dc151e988b34b475043d3e0175bdb01c44",
+		pkEm:           "f7674cc8cd7baa5872d1f33dbaffe3314239f6197ddf5ded1746760bfc847e0e",
+		ikmS:           "9d8f94537d5a3ddef71234c0baedfad4ca6861634d0b94c3007fed557ad17df6",
+		skSm:           "2def0cb58ffcf83d1062dd085c8aceca7f4c0c3fd05912d847b61f3e54121f05",
+		pkSm:           "f0f4f9e96c54aeed3f323de8534fffd7e0577e4ce269896716bcb95643c8712b",
+		enc:            "f7674cc8cd7baa5872d1f33dbaffe3314239f6197ddf5ded1746760bfc847e0e",
+		sharedSecret:   "d2d67828c8bc9fa661cf15a31b3ebf1febe0cafef7abfaaca580aaf6d471e3eb",
+		key:            "b071fd1136680600eb447a845a967d35e9db20749cdf9ce098bcc4deef4b1356",
+		baseNonce:      "d20577dff16d7cea2c4bf780",
+		exporterSecret: "be2d93b82071318cdb88510037cf504344151f2f9b9da8ab48974d40a2251dd7",
+		encryptions: []hpkeTestEncryption{
+			{seq: 0, aad: "436f756e742d30", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "ab1a13c9d4f01a87ec3440dbd756e2677bd2ecf9df0ce7ed73869b98e00c09be111cb9fdf077347aeb88e61bdf"},
+			{seq: 1, aad: "436f756e742d31", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "3265c7807ffff7fdace21659a2c6ccffee52a26d270c76468ed74202a65478bfaedfff9c2b7634e24f10b71016"},
+			{seq: 2, aad: "436f756e742d32", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "3aadee86ad2a05081ea860033a9d09dbccb4acac2ded0891da40f51d4df19925f7a767b076a5cbc9355c8fd35e"},
+			{seq: 4, aad: "436f756e742d34", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "502ecccd5c2be3506a081809cc58b43b94f77cbe37b8b31712d9e21c9e61aa6946a8e922f54eae630f88eb8033"},
+			{seq: 255, aad: "436f756e742d323535", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "652e597ba20f3d9241cda61f33937298b1169e6adf72974bbe454297502eb4be132e1c5064702fc165c2ddbde8"},
+			{seq: 256, aad: "436f756e742d323536", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "3be14e8b3bbd1028cf2b7d0a691dbbeff71321e7dec92d3c2cfb30a0994ab246af76168480285a60037b4ba13a"},
+		},
+		exports: []hpkeTestExport{
+			{context: "", length: 32, value: "070cffafd89b67b7f0eeb800235303a223e6ff9d1e774dce8eac585c8688c872"},
+			{context: "00", length: 32, value: "2852e728568d40ddb0edde284d36a4359c56558bb2fb8837cd3d92e46a3a14a8"},
+			{context: "54657374436f6e74657874", length: 32, value: "1df39dc5dd60edcbf5f9ae804e15ada66e885b28ed7929116f768369a3f950ee"},
+		},
+	},
+	{
+		name:           "A.2, auth_psk",
+		suite:          HPKESuite{KEM: KEMX25519HKDFSHA256, KDF: KDFHKDFSHA256, AEAD: AEADChaCha20Poly1305},
+		mode:           HPKEModeAuthPSK,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmR:           "f3304ddcf15848488271f12b75ecaf72301faabf6ad283654a14c398832eb184",
+		ikmE:           "49d6eac8c6c558c953a0a252929a818745bb08cd3d29e15f9f5db5eb2e7d4b84",
+		skRm:           "7b36a42822e75bf3362dfabbe474b3016236408becb83b859a6909e22803cb0c",
+		skEm:           "5e6dd73e82b856339572b7245d3cbb073a7561c0bee52873490e305cbb710410",
+		pkRm:           "a5099431c35c491ec62ca91df1525d6349cb8aa170c51f9581f8627be6334851",
+		pkEm:           "656a2e00dc9990fd189e6e473459392df556e9a2758754a09db3f51179a3fc02",
+		ikmS:           "20ade1d5203de1aadfb261c4700b6432e260d0d317be6ebbb8d7fffb1f86ad9d",
+		skSm:           "90761c5b0a7ef0985ed66687ad708b921d9803d51637c8d1cb72d03ed0f64418",
+		pkSm:           "3ac5bd4dd66ff9f2740bef0d6ccb66daa77bff7849d7895182b07fb74d087c45",
+		psk:            "0247fd33b913760fa1fa51e1892d9f307fbe65eb171e8132c2af18555a738b82",
+		pskID:          "456e6e796e20447572696e206172616e204d6f726961",
+		enc:            "656a2e00dc9990fd189e6e473459392df556e9a2758754a09db3f51179a3fc02",
+		sharedSecret:   "86a6c0ed17714f11d2951747e660857a5fd7616c933ef03207808b7a7123fe67",
+		key:            "49c7e6d7d2d257aded2a746fe6a9bf12d4de8007c4862b1fdffe8c35fb65054c",
+		baseNonce:      "abac79931e8c1bcb8a23960a",
+		exporterSecret: "7c6cc1bb98993cd93e2599322247a58fd41fdecd3db895fb4c5fd8d6bbe606b5",
+		encryptions: []hpkeTestEncryption{
+			{seq: 0, aad: "436f756e742d30", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "9aa52e29274fc6172e38a4461361d2342585d3aeec67fb3b721ecd63f059577c7fe886be0ede01456ebc67d597"},
+			{seq: 1, aad: "436f756e742d31", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "59460bacdbe7a920ef2806a74937d5a691d6d5062d7daafcad7db7e4d8c649adffe575c1889c5c2e3a49af8e3e"},
+			{seq: 2, aad: "436f756e742d32", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "5688ff6a03ba26ae936044a5c800f286fb5d1eccdd2a0f268f6ff9773b51169318d1a1466bb36263415071db00"},
+			{seq: 4, aad: "436f756e742d34", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "d936b7a01f5c7dc4c3dc04e322cc694684ee18dd71719196874e5235aed3cfb06cadcd3bc7da0877488d7c551d"},
+			{seq: 255, aad: "436f756e742d323535", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "4d4c462f7b9b637eaf1f4e15e325b7bc629c0af6e3073422c86064cc3c98cff87300f054fd56dd57dc34358beb"},
+			{seq: 256, aad: "436f756e742d323536", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "9b7f84224922d2a9edd7b2c2057f3bcf3a547f17570575e626202e593bfdd99e9878a1af9e41ded58c7fb77d2f"},
+		},
+		exports: []hpkeTestExport{
+			{context: "", length: 32, value: "c23ebd4e7a0ad06a5dddf779f65004ce9481069ce0f0e6dd51a04539ddcbd5cd"},
+			{context: "00", length: 32, value: "ed7ff5ca40a3d84561067ebc8e01702bc36cf1eb99d42a92004642b9dfaadd37"},
+			{context: "54657374436f6e74657874", length: 32, value: "d3bae066aa8da27d527d85c040f7dd6ccb60221c902ee36a82f70bcd62a60ee4"},
+		},
+	},
+	{
+		name:           "A.3, base",
+		suite:          HPKESuite{KEM: KEMP256HKDFSHA256, KDF: KDFHKDFSHA256, AEAD: AEADAES128GCM},
+		mode:           HPKEModeBase,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmR:           "668b37171f1072f3cf12ea8a236a45df23fc13b82af3609ad1e354f6ef817550",
+		ikmE:           "4270e54ffd08d79d5928020af4686d8f6b7d35dbe470265f1f5aa22816ce860e",
+		skRm:           "f3ce7fdae57e1a310d87f1ebbde6f328be0a99cdbcadf4d6589cf29de4b8ffd2",
+		skEm:           "4995788ef4b9d6132b249ce59a77281493eb39af373d236a1fe415cb0c2d7beb",
+		pkRm:           "04fe8c19ce0905191ebc298a9245792531f26f0cece2460639e8bc39cb7f706a826a779b4cf969b8a0e539c7f62fb3d30ad6aa8f80e30f1d128aafd68a2ce72ea0",
+		pkEm:           "04a92719c6195d5085104f469a8b9814d5838ff72b60501e2c4466e5e67b325ac98536d7b61a1af4b78e5b7f951c0900be863c403ce65c9bfcb9382657222d18c4",
+		enc:            "04a92719c6195d5085104f469a8b9814d5838ff72b60501e2c4466e5e67b325ac98536d7b61a1af4b78e5b7f951c0900be863c403ce65c9bfcb9382657222d18c4",
+		sharedSecret:   "c0d26aeab536609a572b07695d933b589dcf363ff9d93c93adea537aeabb8cb8",
+		key:            "868c066ef58aae6dc589b6cfdd18f97e",
+		baseNonce:      "4e0bc5018beba4bf004cca59",
+		exporterSecret: "14ad94af484a7ad3ef40e9f3be99ecc6fa9036df9d4920548424df127ee0d99f",
+		encryptions: []hpkeTestEncryption{
+			{seq: 0, aad: "436f756e742d30", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "5ad590bb8baa577f8619db35a36311226a896e7342a6d836d8b7bcd2f20b6c7f9076ac232e3ab2523f39513434"},
+			{seq: 1, aad: "436f756e742d31", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "fa6f037b47fc21826b610172ca9637e82d6e5801eb31cbd3748271affd4ecb06646e0329cbdf3c3cd655b28e82"},
+			{seq: 2, aad: "436f756e742d32", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "895cabfac50ce6c6eb02ffe6c048bf53b7f7be9a91fc559402cbc5b8dcaeb52b2ccc93e466c28fb55fed7a7fec"},
+			{seq: 4, aad: "436f756e742d34", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "8787491ee8df99bc99a246c4b3216d3d57ab5076e18fa27133f520703bc70ec999dd36ce042e44f0c3169a6a8f"},
+			{seq: 255, aad: "436f756e742d323535", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "2ad71c85bf3f45c6eca301426289854b31448bcf8a8ccb1deef3ebd87f60848aa53c538c30a4dac71d619ee2cd"},
+			{seq: 256, aad: "436f756e742d323536", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "10f179686aa2caec1758c8e554513f16472bd0a11e2a907dde0b212cbe87d74f367f8ffe5e41cd3e9962a6afb2"},
+		},
+		exports: []hpkeTestExport{
+			{context: "", length: 32, value: "5e9bc3d236e1911d95e65b576a8a86d478fb827e8bdfe77b741b289890490d4d"},
+			{context: "00", length: 32, value: "6cff87658931bda83dc857e6353efe4987a201b849658d9b047aab4cf216e796"},
+			{context: "54657374436f6e74657874", length: 32, value: "d8f1ea7942adbba7412c6d431c62d01371ea476b823eb697e1f6e6cae1dab85a"},
+		},
+	},
+	{
+		name:           "A.3, psk",
+		suite:          HPKESuite{KEM: KEMP256HKDFSHA256, KDF: KDFHKDFSHA256, AEAD: AEADAES128GCM},
+		mode:           HPKEModePSK,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmR:           "d42ef874c1913d9568c9405407c805baddaffd0898a00f1e84e154fa787b2429",
+		ikmE:           "2afa611d8b1a7b321c761b483b6a053579afa4f767450d3ad0f84a39fda587a6",
+		skRm:           "438d8bcef33b89e0e9ae5eb0957c353c25a94584b0dd59c991372a75b43cb661",
+		skEm:           "57427244f6cc016cddf1c19c8973b4060aa13579b4c067fd5d93a5d74e32a90f",
+		pkRm:           "040d97419ae99f13007a93996648b2674e5260a8ebd2b822e84899cd52d87446ea394ca76223b76639eccdf00e1967db10ade37db4e7db476261fcc8df97c5ffd1",
+		pkEm:           "04305d35563527bce037773d79a13deabed0e8e7cde61eecee403496959e89e4d0ca701726696d1485137ccb5341b3c1c7aaee90a4a02449725e744b1193b53b5f",
+		psk:            "0247fd33b913760fa1fa51e1892d9f307fbe65eb171e8132c2af18555a738b82",
+		pskID:          "456e6e796e20447572696e206172616e204d6f726961",
+		enc:            "04305d35563527bce037773d79a13deabed0e8e7cde61eecee403496959e89e4d0ca701726696d1485137ccb5341b3c1c7aaee90a4a02449725e744b1193b53b5f",
+		sharedSecret:   "2e783ad86a1beae03b5749e0f3f5e9bb19cb7eb382f2fb2dd64c99f15ae0661b",
+		key:            "55d9eb9d26911d4c514a990fa8d57048",
+		baseNonce:      "b595dc6b2d7e2ed23af529b1",
+		exporterSecret: "895a723a1eab809804973a53c0ee18ece29b25a7555a4808277ad2651d66d705",
+		encryptions: []hpkeTestEncryption{
+			{seq: 0, aad: "436f756e742d30", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "90c4deb5b75318530194e4bb62f890b019b1397bbf9d0d6eb918890e1fb2be1ac2603193b60a49c2126b75d0eb"},
+			{seq: 1, aad: "436f756e742d31", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "9e223384a3620f4a75b5a52f546b7262d8826dea18db5a365feb8b997180b22d72dc1287f7089a1073a7102c27"},
+			{seq: 2, aad: "436f756e742d32", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "adf9f6000773035023be7d415e13f84c1cb32a24339a32eb81df02be9ddc6abc880dd81cceb7c1d0c7781465b2"},
+			{seq: 4, aad: "436f756e742d34", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "1f4cc9b7013d65511b1f69c050b7bd8bbd5a5c16ece82b238fec4f30ba2400e7ca8ee482ac5253cffb5c3dc577"},
+			{seq: 255, aad: "436f756e742d323535", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "cdc541253111ed7a424eea5134dc14fc5e8293ab3b537668b8656789628e45894e5bb873c968e3b7cdcbb654a4"},
+			{seq: 256, aad: "436f756e742d323536", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "faf985208858b1253b97b60aecd28bc18737b58d1242370e7703ec33b73a4c31a1afee300e349adef9015bbbfd"},
+		},
+		exports: []hpkeTestExport{
+			{context: "", length: 32, value: "a115a59bf4dd8dc49332d6a0093af8efca1bcbfd3627d850173f5c4a55d0c185"},
+			{context: "00", length: 32, value: "4517eaede0669b16aac7c92d5762dd459c301fa10e02237cd5aeb9be969430c4"},
+			{context: "54657374436f6e74657874", length: 32, value: "164e02144d44b607a7722e58b0f4156e67c0c2874d74cf71da6ca48a4cbdc5e0"},
+		},
+	},
+	{
+		name:           "A.3, auth",
+		suite:          HPKESuite{KEM: KEMP256HKDFSHA256, KDF: KDFHKDFSHA256, AEAD: AEADAES128GCM},
+		mode:           HPKEModeAuth,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmR:           "7bc93bde8890d1fb55220e7f3b0c107ae7e6eda35ca4040bb6651284bf0747ee",
+		ikmE:           "798d82a8d9ea19dbc7f2c6dfa54e8a6706f7cdc119db0813dacf8440ab37c857",
+		skRm:           "d929ab4be2e59f6954d6bedd93e638f02d4046cef21115b00cdda2acb2a4440e",
+		skEm:           "6b8de0873aed0c1b2d09b8c7ed54cbf24fdf1dfc7a47fa501f918810642d7b91",
+		pkRm:           "04423e363e1cd54ce7b7573110ac121399acbc9ed815fae03b72ffbd4c18b01836835c5a09513f28fc971b7266cfde2e96afe84bb0f266920e82c4f53b36e1a78d",
+		pkEm:           "042224f3ea800f7ec55c03f29fc9865f6ee27004f818fcbdc6dc68932c1e52e15b79e264a98f2c535ef06745f3d308624414153b22c7332bc1e691cb4af4d53454",
+		ikmS:           "874baa0dcf93595a24a45a7f042e0d22d368747daaa7e19f80a802af19204ba8",
+		skSm:           "1120ac99fb1fccc1e8230502d245719d1b217fe20505c7648795139d177f0de9",
+		pkSm:           "04a817a0902bf28e036d66add5d544cc3a0457eab150f104285df1e293b5c10eef8651213e43d9cd9086c80b309df22cf37609f58c1127f7607e85f210b2804f73",
+		enc:            "042224f3ea800f7ec55c03f29fc9865f6ee27004f818fcbdc6dc68932c1e52e15b79e264a98f2c535ef06745f3d308624414153b22c7332bc1e691cb4af4d53454",
+		sharedSecret:   "d4aea336439aadf68f9348880aa358086f1480e7c167b6ef15453ba69b94b44f",
+		key:            "19aa8472b3fdc530392b0e54ca17c0f5",
+		baseNonce:      "b390052d26b67a5b8a8fcaa4",
+		exporterSecret: "f152759972660eb0e1db880835abd5de1c39c8e9cd269f6f082ed80e28acb164",
+		encryptions: []hpkeTestEncryption{
+			{seq: 0, aad: "436f756e742d30", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "82ffc8c44760db691a07c5627e5fc2c08e7a86979ee79b494a17cc3405446ac2bdb8f265db4a099ed3289ffe19"},
+			{seq: 1, aad: "436f756e742d31", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "b0a705a54532c7b4f5907de51c13dffe1e08d55ee9ba59686114b05945494d96725b239468f1229e3966aa1250"},
+			{seq: 2, aad: "436f756e742d32", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "8dc805680e3271a801790833ed74473710157645584f06d1b53ad439078d880b23e25256663178271c80ee8b7c"},
+			{seq: 4, aad: "436f756e742d34", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "04c8f7aae1584b61aa5816382cb0b834a5d744f420e6dffb5ddcec633a21b8b3472820930c1ea9258b035937a2"},
+			{seq: 255, aad: "436f756e742d323535", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "4a319462eaedee37248b4d985f64f4f863d31913fe9e30b6e13136053b69fe5d70853c84c60a84bb5495d5a678"},
+			{seq: 256, aad: "436f756e742d323536", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "28e874512f8940fafc7d06135e7589f6b4198bc0f3a1c64702e72c9e6abaf9f05cb0d2f11b03a517898815c934"},
+		},
+		exports: []hpkeTestExport{
+			{context: "", length: 32, value: "837e49c3ff629250c8d80d3c3fb957725ed481e59e2feb57afd9fe9a8c7c4497"},
+			{context: "00", length: 32, value: "594213f9018d614b82007a7021c3135bda7b380da4acd9ab27165c508640dbda"},
+			{context: "54657374436f6e74657874", length: 32, value: "14fe634f95ca0d86e15247cca7de7ba9b73c9b9deb6437e1c832daf7291b79d5"},
+		},
+	},
+	{
+		name:           "A.3, auth_psk",
+		suite:          HPKESuite{KEM: KEMP256HKDFSHA256, KDF: KDFHKDFSHA256, AEAD: AEADAES128GCM},
+		mode:           HPKEModeAuthPSK,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmR:           "abcc2da5b3fa81d8aabd91f7f800a8ccf60ec37b1b585a5d1d1ac77f258b6cca",
+		ikmE:           "3c1fceb477ec954c8d58ef3249e4bb4c38241b5925b95f7486e4d9f1d0d35fbb",
+		skRm:           "bdf4e2e587afdf0930644a0c45053889ebcadeca662d7c755a353d5b4e2a8394",
+		skEm:           "36f771e411cf9cf72f0701ef2b991ce9743645b472e835fe234fb4d6eb2ff5a0",
+		pkRm:           "04d824d7e897897c172ac8a9e862e4bd820133b8d090a9b188b8233a64dfbc5f725aa0aa52c8462ab7c9188f1c4872f0c99087a867e8a773a13df48a627058e1b3",
+		pkEm:           "046a1de3fc26a3d43f4e4ba97dbe24f7e99181136129c48fbe872d4743e2b131357ed4f29a7b317dc22509c7b00991ae990bf65f8b236700c82ab7c11a84511401",
+		ikmS:           "6262031f040a9db853edd6f91d2272596eabbc78a2ed2bd643f770ecd0f19b82",
+		skSm:           "b0ed8721db6185435898650f7a677affce925aba7975a582653c4cb13c72d240",
+		pkSm:           "049f158c750e55d8d5ad13ede66cf6e79801634b7acadcad72044eac2ae1d0480069133d6488bf73863fa988c4ba8bde1c2e948b761274802b4d8012af4f13af9e",
+		psk:            "0247fd33b913760fa1fa51e1892d9f307fbe65eb171e8132c2af18555a738b82",
+		pskID:          "456e6e796e20447572696e206172616e204d6f726961",
+		enc:            "046a1de3fc26a3d43f4e4ba97dbe24f7e99181136129c48fbe872d4743e2b131357ed4f29a7b317dc22509c7b00991ae990bf65f8b236700c82ab7c11a84511401",
+		sharedSecret:   "d4c27698391db126f1612d9e91a767f10b9b19aa17e1695549203f0df7d9aebe",
+		key:            "4d567121d67fae1227d90e11585988fb",
+		baseNonce:      "67c9d05330ca21e5116ecda6",
+		exporterSecret: "3f479020ae186788e4dfd4a42a21d24f3faabb224dd4f91c2b2e5e9524ca27b2",
+		encryptions: []hpkeTestEncryption{
+			{seq: 0, aad: "436f756e742d30", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "b9f36d58d9eb101629a3e5a7b63d2ee4af42b3644209ab37e0a272d44365407db8e655c72e4fa46f4ff81b9246"},
+			{seq: 1, aad: "436f756e742d31", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "51788c4e5d56276771032749d015d3eea651af0c7bb8e3da669effffed299ea1f641df621af65579c10fc09736"},
+			{seq: 2, aad: "436f756e742d32", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "3b5a2be002e7b29927f06442947e1cf709b9f8508b03823127387223d712703471c266efc355f1bc2036f3027c"},
+			{seq: 4, aad: "436f756e742d34", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "8ddbf1242fe5c7d61e1675496f3bfdb4d90205b3dfbc1b12aab41395d71a82118e095c484103107cf4face5123"},
+			{seq: 255, aad: "436f756e742d323535", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "6de25ceadeaec572fbaa25eda2558b73c383fe55106abaec24d518ef6724a7ce698f83ecdc53e640fe214d2f42"},
+			{seq: 256, aad: "436f756e742d323536", pt: "4265617574792069732074727574682c20747275746820626561757479", ct: "f380e19d291e12c5e378b51feb5cd50f6d00df6cb2af8393794c4df342126c2e29633fe7e8ce49587531affd4d"},
+		},
+		exports: []hpkeTestExport{
+			{context: "", length: 32, value: "595ce0eff405d4b3bb1d08308d70a4e77226ce11766e0a94c4fdb5d90025c978"},
+			{context: "00", length: 32, value: "110472ee0ae328f57ef7332a9886a1992d2c45b9b8d5abc9424ff68630f7d38d"},
+			{context: "54657374436f6e74657874", length: 32, value: "18ee4d001a9d83a4c67e76f88dd747766576cac438723bad0700a910a4d717e6"},
+		},
+	},
+}
+
+func hpkeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestHPKEVectors(t *testing.T) {
+	for _, v := range hpkeTestVectors {
+		t.Run(v.name, func(t *testing.T) {
+			s := v.suite
+
+			skR, err := s.DeriveKeyPair(hpkeHex(t, v.ikmR))
+			if err != nil {
+				t.Fatal(err)
+			}
+			skE, err := s.DeriveKeyPair(hpkeHex(t, v.ikmE))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(skR.Bytes(), hpkeHex(t, v.skRm)) || !bytes.Equal(skR.PublicKey().Bytes(), hpkeHex(t, v.pkRm)) {
+				t.Errorf("DeriveKeyPair(ikmR) = %x", skR.Bytes())
+			}
+			if !bytes.Equal(skE.Bytes(), hpkeHex(t, v.skEm)) || !bytes.Equal(skE.PublicKey().Bytes(), hpkeHex(t, v.pkEm)) {
+				t.Errorf("DeriveKeyPair(ikmE) = %x", skE.Bytes())
+			}
+
+			senderOpts := &HPKEOptions{PSK: hpkeHex(t, v.psk), PSKID: hpkeHex(t, v.pskID)}
+			recipientOpts := &HPKEOptions{PSK: hpkeHex(t, v.psk), PSKID: hpkeHex(t, v.pskID)}
+			if v.ikmS != "" {
+				skS, err := s.DeriveKeyPair(hpkeHex(t, v.ikmS))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(skS.Bytes(), hpkeHex(t, v.skSm)) || !bytes.Equal(skS.PublicKey().Bytes(), hpkeHex(t, v.pkSm)) {
+					t.Errorf("DeriveKeyPair(ikmS) = %x", skS.Bytes())
+				}
+				senderOpts.SenderPrivateKey = hpkeHex(t, v.skSm)
+				recipientOpts.SenderPublicKey = hpkeHex(t, v.pkSm)
+			}
+			if mode := senderOpts.mode(); mode != v.mode {
+				t.Fatalf("options select mode %d, want %d", mode, v.mode)
+			}
+
+			key, baseNonce, exporterSecret, err := s.keyScheduleSecrets(v.mode, hpkeHex(t, v.sharedSecret), hpkeHex(t, v.info), senderOpts.PSK, senderOpts.PSKID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(key, hpkeHex(t, v.key)) {
+				t.Errorf("key = %x, want %s", key, v.key)
+			}
+			if !bytes.Equal(baseNonce, hpkeHex(t, v.baseNonce)) {
+				t.Errorf("base nonce = %x, want %s", baseNonce, v.baseNonce)
+			}
+			if !bytes.Equal(exporterSecret, hpkeHex(t, v.exporterSecret)) {
+				t.Errorf("exporter secret = %x, want %s", exporterSecret, v.exporterSecret)
+			}
+
+			enc, sender, err := s.setupSenderWithEphemeral(hpkeHex(t, v.pkRm), hpkeHex(t, v.info), senderOpts, skE)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(enc, hpkeHex(t, v.enc)) {
+				t.Errorf("enc = %x, want %s", enc, v.enc)
+			}
+			var pkS *ecdh.PublicKey
+			if v.ikmS != "" {
+				curve, _ := s.curve()
+				if pkS, err = curve.NewPublicKey(hpkeHex(t, v.pkSm)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			sharedSecret, err := s.decap(enc, skR, pkS)
+			if err != nil || !bytes.Equal(sharedSecret, hpkeHex(t, v.sharedSecret)) {
+				t.Errorf("decap = %x, %v, want %s", sharedSecret, err, v.sharedSecret)
+			}
+			recipient, err := s.SetupRecipient(enc, hpkeHex(t, v.skRm), hpkeHex(t, v.info), recipientOpts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, e := range v.encryptions {
+				sender.seq, recipient.seq = e.seq, e.seq
+				ct, err := sender.Seal(hpkeHex(t, e.aad), hpkeHex(t, e.pt))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(ct, hpkeHex(t, e.ct)) {
+					t.Errorf("seq %d: ciphertext = %x, want %s", e.seq, ct, e.ct)
+				}
+				pt, err := recipient.Open(hpkeHex(t, e.aad), hpkeHex(t, e.ct))
+				if err != nil || !bytes.Equal(pt, hpkeHex(t, e.pt)) {
+					t.Errorf("seq %d: Open = %x, %v", e.seq, pt, err)
+				}
+			}
+
+			for _, e := range v.exports {
+				for _, ctx := range []*HPKEContext{sender, recipient} {
+					got, err := ctx.Export(hpkeHex(t, e.context), e.length)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !bytes.Equal(got, hpkeHex(t, e.value)) {
+						t.Errorf("Export(%q) = %x, want %s", e.context, got, e.value)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHPKEOpenRejectsWrongInputs(t *testing.T) {
+	suite := HPKESuite{KEM: KEMX25519HKDFSHA256, KDF: KDFHKDFSHA256, AEAD: AEADAES128GCM}
+	skR, err := suite.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &HPKEOptions{PSK: bytes.Repeat([]byte{1}, 32), PSKID: []byte("id")}
+	enc, ct, err := HPKESeal(suite, skR.PublicKey().Bytes(), []byte("info"), []byte("aad"), []byte("message"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pt, err := HPKEOpen(suite, enc, skR.Bytes(), []byte("info"), []byte("aad"), ct, opts); err != nil || string(pt) != "message" {
+		t.Fatalf("HPKEOpen = %q, %v", pt, err)
+	}
+
+	for name, open := range map[string]func() ([]byte, error){
+		"info": func() ([]byte, error) {
+			return HPKEOpen(suite, enc, skR.Bytes(), []byte("other"), []byte("aad"), ct, opts)
+		},
+		"aad": func() ([]byte, error) {
+			return HPKEOpen(suite, enc, skR.Bytes(), []byte("info"), []byte("other"), ct, opts)
+		},
+		"psk": func() ([]byte, error) {
+			return HPKEOpen(suite, enc, skR.Bytes(), []byte("info"), []byte("aad"), ct, &HPKEOptions{PSK: bytes.Repeat([]byte{2}, 32), PSKID: []byte("id")})
+		},
+		"no psk": func() ([]byte, error) {
+			return HPKEOpen(suite, enc, skR.Bytes(), []byte("info"), []byte("aad"), ct, nil)
+		},
+	} {
+		if _, err := open(); err == nil {
+			t.Errorf("HPKEOpen with the wrong %s succeeded", name)
+		}
+	}
+}
+
+func TestHPKEShortPSK(t *testing.T) {
+	suite := HPKESuite{KEM: KEMX25519HKDFSHA256, KDF: KDFHKDFSHA256, AEAD: AEADAES128GCM}
+	skR, err := suite.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	short := &HPKEOptions{PSK: bytes.Repeat([]byte{1}, MinHPKEPSKSize-1), PSKID: []byte("id")}
+	if _, _, err := HPKESeal(suite, skR.PublicKey().Bytes(), nil, nil, []byte("message"), short); err == nil {
+		t.Error("HPKESeal accepted a 31-byte psk")
+	}
+
+	opts := &HPKEOptions{PSK: bytes.Repeat([]byte{1}, MinHPKEPSKSize), PSKID: []byte("id")}
+	enc, ct, err := HPKESeal(suite, skR.PublicKey().Bytes(), nil, nil, []byte("message"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := HPKEOpen(suite, enc, skR.Bytes(), nil, nil, ct, short); err == nil {
+		t.Error("HPKEOpen accepted a 31-byte psk")
+	}
+}
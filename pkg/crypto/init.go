@@ -8,11 +8,21 @@ import (
 
 func NewCryptoProvider(algorithm string) (CryptoProvider, error) {
 	utils.DebugLogf("NewCryptoProvider: initializing provider for algorithm: %s", algorithm)
-	switch strings.ToLower(algorithm) {
-	case "aes-256-cbc":
+	switch name := strings.ToLower(algorithm); {
+	case name == "aes-256-gcm":
+		return &AESGCMProvider{}, nil
+	case name == "aes-256-cbc":
 		return &AESProvider{}, nil
-	case "rsa":
+	case name == "rsa":
 		return &RSAProvider{}, nil
+	case name == FPEModeFF1 || name == FPEModeFF31:
+		return &FPEProvider{Mode: name, Alphabet: DefaultFPEAlphabet}, nil
+	case strings.HasPrefix(name, "hpke"):
+		suite, err := ParseHPKESuite(name)
+		if err != nil {
+			return nil, err
+		}
+		return &HPKEProvider{Suite: suite}, nil
 	default:
 		return nil, fmt.Errorf("unsupported algorithm: %s", algorithm)
 	}
@@ -0,0 +1,184 @@
+package crypto
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+)
+
+// CiphertextInfo describes a ciphertext as far as it can be read without the key
+type CiphertextInfo struct {
+	// Format is "envelope" or "legacy" (bare output without an envelope header)
+	Format      string          `json:"format"`
+	Version     int             `json:"version,omitempty"`
+	Algorithm   string          `json:"algorithm,omitempty"`
+	KeyID       string          `json:"key_id,omitempty"`
+	Flags       []string        `json:"flags,omitempty"`
+	KDF         *KDFInfo        `json:"kdf,omitempty"`
+	Recipients  []RecipientInfo `json:"recipients,omitempty"`
+	NonceSize   int             `json:"nonce_size,omitempty"`
+	NotAfter    *time.Time      `json:"not_after,omitempty"`
+	Padding     string          `json:"padding,omitempty"`
+	Compression string          `json:"compression,omitempty"`
+	ChunkSize   int             `json:"chunk_size,omitempty"`
+	Expired     bool            `json:"expired,omitempty"`
+	HeaderSize  int             `json:"header_size,omitempty"`
+	BodySize    int             `json:"body_size"`
+	TotalSize   int             `json:"total_size"`
+	// Candidates lists the legacy formats whose size rules match a bare ciphertext
+	Candidates []string `json:"candidates,omitempty"`
+	// Error is set when an envelope header is present but cannot be parsed
+	Error string `json:"error,omitempty"`
+}
+
+// KDFInfo is the passphrase KDF part of CiphertextInfo
+type KDFInfo struct {
+	Algorithm   string `json:"algorithm"`
+	SaltSize    int    `json:"salt_size"`
+	Iterations  uint32 `json:"iterations,omitempty"`
+	MemoryKiB   uint32 `json:"memory_kib,omitempty"`
+	Parallelism uint32 `json:"parallelism,omitempty"`
+	ScryptN     uint32 `json:"scrypt_n,omitempty"`
+	ScryptR     uint32 `json:"scrypt_r,omitempty"`
+}
+
+// RecipientInfo is one recipient of a multi-recipient envelope
+type RecipientInfo struct {
+	Type  string `json:"type"`
+	KeyID string `json:"key_id"`
+}
+
+// InspectCiphertext reports the format, algorithm, key ids and sizes of data
+// without decrypting it
+func InspectCiphertext(data []byte) *CiphertextInfo {
+	return inspectCiphertext(data, int64(len(data)))
+}
+
+// InspectCiphertextReader is InspectCiphertext for a ciphertext of size bytes read
+// from r. Only the envelope header is read, so files of any size are inspected in
+// constant memory. With a size of -1 the rest of r is read and counted.
+func InspectCiphertextReader(r io.Reader, size int64) (*CiphertextInfo, error) {
+	data := make([]byte, envelopePrefixSize)
+	n, err := io.ReadFull(r, data)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("failed to read ciphertext: %w", err)
+	}
+	data = data[:n]
+	if IsEnvelope(data) {
+		// A header longer than allowed is reported by parseEnvelope
+		if headerLen := binary.BigEndian.Uint32(data[len(envelopeMagic)+1:]); headerLen <= maxEnvelopeHeaderSize {
+			header := make([]byte, headerLen)
+			n, err := io.ReadFull(r, header)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return nil, fmt.Errorf("failed to read envelope header: %w", err)
+			}
+			data = append(data, header[:n]...)
+		}
+	}
+	if size < 0 {
+		rest, err := io.Copy(io.Discard, r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ciphertext: %w", err)
+		}
+		size = int64(len(data)) + rest
+	}
+	return inspectCiphertext(data, size), nil
+}
+
+// inspectCiphertext reports on a ciphertext of size bytes that starts with data,
+// which holds at least its envelope header if it has one
+func inspectCiphertext(data []byte, size int64) *CiphertextInfo {
+	info := &CiphertextInfo{TotalSize: int(size), BodySize: int(size)}
+	if !IsEnvelope(data) {
+		info.Format = "legacy"
+		info.Candidates = legacyCandidates(int(size))
+		return info
+	}
+
+	info.Format = "envelope"
+	info.Version = int(data[len(envelopeMagic)])
+	header, headerBytes, _, err := parseEnvelope(data)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+
+	info.Algorithm = header.Algorithm.String()
+	if header.Algorithm == EnvelopeHPKE {
+		info.Algorithm = header.HPKESuite.Name()
+	}
+	info.KeyID = hex.EncodeToString(header.KeyID)
+	info.Flags = envelopeFlagNames(header.Flags)
+	info.NonceSize = len(header.Nonce)
+	if header.Compression != CompressionNone {
+		info.Compression = header.Compression.String()
+	}
+	info.ChunkSize = int(header.ChunkSize)
+	if header.Padding.Kind != PaddingNone {
+		info.Padding = header.Padding.String()
+	}
+	if !header.NotAfter.IsZero() {
+		notAfter := header.NotAfter.UTC()
+		info.NotAfter = &notAfter
+		info.Expired = checkNotAfter(header) != nil
+	}
+	info.HeaderSize = len(headerBytes)
+	info.BodySize = int(size) - len(headerBytes)
+
+	if header.KDF != nil {
+		info.KDF = &KDFInfo{
+			Algorithm:   header.KDF.Algorithm.String(),
+			SaltSize:    len(header.KDF.Salt),
+			Iterations:  header.KDF.Iterations,
+			MemoryKiB:   header.KDF.MemoryKiB,
+			Parallelism: header.KDF.Parallelism,
+			ScryptN:     header.KDF.ScryptN,
+			ScryptR:     header.KDF.ScryptR,
+		}
+	}
+	for _, stanza := range header.Recipients {
+		info.Recipients = append(info.Recipients, RecipientInfo{Type: stanza.Type.String(), KeyID: hex.EncodeToString(stanza.KeyID)})
+	}
+	return info
+}
+
+func envelopeFlagNames(flags uint32) []string {
+	var names []string
+	if flags&EnvelopeFlagHPKEPSK != 0 {
+		names = append(names, "hpke-psk")
+	}
+	if flags&EnvelopeFlagHPKEAuth != 0 {
+		names = append(names, "hpke-auth")
+	}
+	if flags&EnvelopeFlagFileMetadata != 0 {
+		names = append(names, "file-metadata")
+	}
+	return names
+}
+
+// legacyCandidates lists the bare ciphertext formats that a size of n bytes fits.
+// Bare output carries no label, so this narrows the choice but cannot decide it.
+func legacyCandidates(n int) []string {
+	var candidates []string
+	// AESProvider: 16-byte IV and PKCS#7 padded blocks, at least one
+	if n >= 32 && n%16 == 0 {
+		blocks := n/16 - 1
+		candidates = append(candidates, fmt.Sprintf("aes-256-cbc (IV + %d block(s), %d-%d bytes of plaintext)", blocks, blocks*16-16, blocks*16-1))
+	}
+	// RSAProvider: one OAEP block per chunk
+	for _, bits := range []int{2048, 3072, 4096} {
+		if size := bits / 8; n >= size && n%size == 0 {
+			candidates = append(candidates, fmt.Sprintf("rsa (%d-bit key, %d OAEP block(s))", bits, n/size))
+		}
+	}
+	// HPKEProvider: encapsulated key and AEAD output with a 16-byte tag
+	if n >= 32+16 {
+		candidates = append(candidates, fmt.Sprintf("hpke-x25519 (%d bytes of plaintext)", n-32-16))
+	}
+	if n >= 65+16 {
+		candidates = append(candidates, fmt.Sprintf("hpke-p256 (%d bytes of plaintext)", n-65-16))
+	}
+	return candidates
+}
@@ -0,0 +1,208 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestInspectAESGCM(t *testing.T) {
+	notAfter := time.Now().Add(time.Hour).Truncate(time.Second)
+	provider := &AESGCMProvider{EnvelopeOptions: EnvelopeOptions{
+		NotAfter:     notAfter,
+		Padding:      PaddingScheme{Kind: PaddingPadme},
+		Compression:  CompressionGzip,
+		FileMetadata: testFileMetadata,
+	}}
+	data, err := SealEnvelope(provider, []byte("inspect me"), parallelTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID, err := symmetricKeyID(parallelTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := InspectCiphertext(data)
+	if info.Format != "envelope" || info.Version != envelopeVersion || info.Algorithm != "aes-256-gcm" || info.Error != "" {
+		t.Errorf("info = %+v", info)
+	}
+	if info.KeyID != hex.EncodeToString(keyID) {
+		t.Errorf("KeyID = %s, want %x", info.KeyID, keyID)
+	}
+	if info.NonceSize != 12 || info.Padding != "padme" || info.Compression != "gzip" || info.ChunkSize != 0 {
+		t.Errorf("nonce %d, padding %q, compression %q, chunk size %d", info.NonceSize, info.Padding, info.Compression, info.ChunkSize)
+	}
+	if info.NotAfter == nil || !info.NotAfter.Equal(notAfter) || info.Expired {
+		t.Errorf("NotAfter = %v, expired %v, want %v", info.NotAfter, info.Expired, notAfter)
+	}
+	if len(info.Flags) != 1 || info.Flags[0] != "file-metadata" {
+		t.Errorf("Flags = %v", info.Flags)
+	}
+	if info.HeaderSize+info.BodySize != len(data) || info.TotalSize != len(data) {
+		t.Errorf("header %d + body %d bytes, total %d, want %d", info.HeaderSize, info.BodySize, info.TotalSize, len(data))
+	}
+
+	// Nothing of the plaintext or the file name shows
+	out, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "inspect me") || strings.Contains(string(out), testFileMetadata.Name) {
+		t.Errorf("inspect output %s shows the content", out)
+	}
+}
+
+func TestInspectExpired(t *testing.T) {
+	data, err := SealEnvelope(&AESGCMProvider{EnvelopeOptions: EnvelopeOptions{NotAfter: time.Now().Add(-time.Minute)}}, []byte("x"), parallelTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := InspectCiphertext(data); !info.Expired || info.NotAfter == nil {
+		t.Errorf("expired envelope: info = %+v", info)
+	}
+}
+
+func TestInspectPassphraseAndRecipients(t *testing.T) {
+	params := cheapKDFParams(KDFArgon2id)
+	data, err := EncryptWithPassphrase([]byte("x"), []byte("open sesame"), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := InspectCiphertext(data)
+	if info.Algorithm != "passphrase" || info.KDF == nil {
+		t.Fatalf("passphrase envelope: info = %+v", info)
+	}
+	want := KDFInfo{Algorithm: "argon2id", SaltSize: len(kdfTestSalt), Iterations: params.Iterations, MemoryKiB: params.MemoryKiB, Parallelism: params.Parallelism}
+	if *info.KDF != want {
+		t.Errorf("KDF = %+v, want %+v", *info.KDF, want)
+	}
+
+	keys := recipientTestKeys(t)
+	var recipients []*Recipient
+	for _, k := range keys[:3] {
+		r, err := ParseRecipient(k.public)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recipients = append(recipients, r)
+	}
+	data, err = EncryptForRecipients([]byte("x"), recipients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info = InspectCiphertext(data)
+	if info.Algorithm != "multi-recipient" || len(info.Recipients) != len(recipients) {
+		t.Fatalf("multi-recipient envelope: info = %+v", info)
+	}
+	for i, r := range recipients {
+		if info.Recipients[i] != (RecipientInfo{Type: r.Type.String(), KeyID: hex.EncodeToString(r.KeyID)}) {
+			t.Errorf("recipient %d = %+v, want %s %x", i, info.Recipients[i], r.Type, r.KeyID)
+		}
+	}
+}
+
+func TestInspectHPKEAndStream(t *testing.T) {
+	suite := HPKESuite{KEM: KEMP256HKDFSHA256, KDF: KDFHKDFSHA256, AEAD: AEADChaCha20Poly1305}
+	_, public, err := GenerateHPKEKeyPair(suite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := SealEnvelope(&HPKEProvider{Suite: suite, Options: &HPKEOptions{PSK: []byte("a pre-shared key of 32 bytes!!!!"), PSKID: []byte("id")}}, []byte("x"), public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := InspectCiphertext(data)
+	if info.Algorithm != suite.Name() || len(info.Flags) != 1 || info.Flags[0] != "hpke-psk" || info.KeyID == "" {
+		t.Errorf("hpke envelope: info = %+v", info)
+	}
+
+	stream := encryptStreamForTest(t, parallelTestData(3000), &StreamOptions{ChunkSize: streamTestChunkSize})
+	if info := InspectCiphertext(stream); info.ChunkSize != streamTestChunkSize || info.Algorithm != "aes-256-gcm" {
+		t.Errorf("stream: info = %+v", info)
+	}
+}
+
+func TestInspectLegacyAndDamaged(t *testing.T) {
+	legacy, err := (&AESProvider{}).Encrypt([]byte("twenty bytes of text"), parallelTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := InspectCiphertext(legacy)
+	if info.Format != "legacy" || info.TotalSize != len(legacy) || info.Algorithm != "" {
+		t.Errorf("legacy ciphertext: info = %+v", info)
+	}
+	if len(info.Candidates) == 0 || !strings.HasPrefix(info.Candidates[0], "aes-256-cbc (IV + 2 block(s), 16-31 bytes") {
+		t.Errorf("legacy candidates = %q", info.Candidates)
+	}
+
+	for _, tt := range []struct {
+		size int
+		want []string
+	}{
+		{10, nil},
+		{48, []string{"aes-256-cbc", "hpke-x25519"}},
+		{256, []string{"aes-256-cbc", "rsa (2048-bit key, 1 OAEP", "hpke-x25519", "hpke-p256"}},
+		{81, []string{"hpke-x25519", "hpke-p256"}},
+	} {
+		got := legacyCandidates(tt.size)
+		if len(got) != len(tt.want) {
+			t.Errorf("legacyCandidates(%d) = %q", tt.size, got)
+			continue
+		}
+		for i := range got {
+			if !strings.HasPrefix(got[i], tt.want[i]) {
+				t.Errorf("legacyCandidates(%d)[%d] = %q, want %s...", tt.size, i, got[i], tt.want[i])
+			}
+		}
+	}
+
+	// A damaged header is reported, not guessed at
+	data, err := SealEnvelope(&AESGCMProvider{}, []byte("x"), parallelTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info = InspectCiphertext(data[:envelopePrefixSize+5])
+	if info.Format != "envelope" || info.Error == "" || info.Algorithm != "" {
+		t.Errorf("damaged envelope: info = %+v", info)
+	}
+}
+
+func TestInspectCiphertextReader(t *testing.T) {
+	stream := encryptStreamForTest(t, parallelTestData(5000), &StreamOptions{ChunkSize: streamTestChunkSize})
+	legacy, err := (&AESProvider{}).Encrypt([]byte("twenty bytes of text"), parallelTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	damaged := append([]byte{}, stream[:envelopePrefixSize+3]...)
+
+	for name, data := range map[string][]byte{"stream": stream, "legacy": legacy, "damaged": damaged, "short": []byte("TLE")} {
+		want, _ := json.Marshal(InspectCiphertext(data))
+		for _, size := range []int64{int64(len(data)), -1} {
+			info, err := InspectCiphertextReader(bytes.NewReader(data), size)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if got, _ := json.Marshal(info); string(got) != string(want) {
+				t.Errorf("%s, size %d: info = %s, want %s", name, size, got, want)
+			}
+		}
+	}
+
+	// Only the header is read when the size is known
+	_, headerBytes, _, err := parseEnvelope(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := io.MultiReader(bytes.NewReader(headerBytes), iotest.ErrReader(errors.New("body read")))
+	info, err := InspectCiphertextReader(r, int64(len(stream)))
+	if err != nil || info.Error != "" || info.BodySize != len(stream)-len(headerBytes) {
+		t.Errorf("header only: info = %+v, %v", info, err)
+	}
+}
@@ -0,0 +1,193 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+// KDFAlgorithm identifies a password-based key derivation function
+type KDFAlgorithm uint8
+
+const (
+	KDFPBKDF2SHA256 KDFAlgorithm = 1
+	KDFScrypt       KDFAlgorithm = 2
+	KDFArgon2id     KDFAlgorithm = 3
+)
+
+// Default cost parameters, following the OWASP password storage recommendations
+// and RFC 9106 for Argon2id
+const (
+	DefaultPBKDF2Iterations  = 600000
+	DefaultScryptN           = 1 << 15
+	DefaultScryptR           = 8
+	DefaultScryptP           = 1
+	DefaultArgon2Time        = 3
+	DefaultArgon2MemoryKiB   = 64 * 1024
+	DefaultArgon2Parallelism = 4
+	kdfSaltSize              = 16
+	maxPBKDF2Iterations      = 100000000
+	maxScryptMemoryBytes     = 4 << 30
+	maxArgon2MemoryKiB       = 4 << 20
+	maxArgon2Time            = 1000
+	maxKDFParallelism        = 255
+)
+
+func (k KDFAlgorithm) String() string {
+	switch k {
+	case KDFPBKDF2SHA256:
+		return "pbkdf2-sha256"
+	case KDFScrypt:
+		return "scrypt"
+	case KDFArgon2id:
+		return "argon2id"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(k))
+	}
+}
+
+// ParseKDFAlgorithm parses pbkdf2 (or pbkdf2-sha256), scrypt and argon2id
+func ParseKDFAlgorithm(name string) (KDFAlgorithm, error) {
+	switch strings.ToLower(name) {
+	case "pbkdf2", "pbkdf2-sha256":
+		return KDFPBKDF2SHA256, nil
+	case "scrypt":
+		return KDFScrypt, nil
+	case "argon2id":
+		return KDFArgon2id, nil
+	default:
+		return 0, fmt.Errorf("unsupported KDF: %s", name)
+	}
+}
+
+// KDFParams holds the KDF choice, salt and cost parameters stored with a ciphertext
+type KDFParams struct {
+	Algorithm KDFAlgorithm
+	Salt      []byte
+	// Iterations is the PBKDF2 iteration count or the Argon2id time cost
+	Iterations uint32
+	// MemoryKiB is the Argon2id memory cost
+	MemoryKiB uint32
+	// Parallelism is the Argon2id lane count or the scrypt p parameter
+	Parallelism uint32
+	// ScryptN and ScryptR are the scrypt CPU/memory cost and block size
+	ScryptN uint32
+	ScryptR uint32
+}
+
+// NewKDFParams returns the default parameters for algorithm with a fresh random salt
+func NewKDFParams(algorithm KDFAlgorithm) (*KDFParams, error) {
+	params := &KDFParams{Algorithm: algorithm, Salt: make([]byte, kdfSaltSize)}
+	switch algorithm {
+	case KDFPBKDF2SHA256:
+		params.Iterations = DefaultPBKDF2Iterations
+	case KDFScrypt:
+		params.ScryptN = DefaultScryptN
+		params.ScryptR = DefaultScryptR
+		params.Parallelism = DefaultScryptP
+	case KDFArgon2id:
+		params.Iterations = DefaultArgon2Time
+		params.MemoryKiB = DefaultArgon2MemoryKiB
+		params.Parallelism = DefaultArgon2Parallelism
+	default:
+		return nil, fmt.Errorf("unsupported KDF: %s", algorithm)
+	}
+
+	if _, err := rand.Read(params.Salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	return params, nil
+}
+
+// Validate checks the parameters against sane bounds, so a crafted ciphertext
+// cannot make decryption allocate unbounded memory or run for hours
+func (p *KDFParams) Validate() error {
+	if len(p.Salt) < 8 {
+		return fmt.Errorf("KDF salt must be at least 8 bytes")
+	}
+	switch p.Algorithm {
+	case KDFPBKDF2SHA256:
+		if p.Iterations < 1 || p.Iterations > maxPBKDF2Iterations {
+			return fmt.Errorf("PBKDF2 iterations must be between 1 and %d", maxPBKDF2Iterations)
+		}
+	case KDFScrypt:
+		if p.ScryptN < 2 || p.ScryptN&(p.ScryptN-1) != 0 {
+			return fmt.Errorf("scrypt N must be a power of two greater than 1")
+		}
+		if p.ScryptR < 1 || p.Parallelism < 1 || p.Parallelism > maxKDFParallelism {
+			return fmt.Errorf("invalid scrypt r or p parameter")
+		}
+		if uint64(128)*uint64(p.ScryptN)*uint64(p.ScryptR) > maxScryptMemoryBytes {
+			return fmt.Errorf("scrypt parameters need more than %d bytes of memory", maxScryptMemoryBytes)
+		}
+	case KDFArgon2id:
+		if p.Iterations < 1 || p.Iterations > maxArgon2Time {
+			return fmt.Errorf("Argon2id time cost must be between 1 and %d", maxArgon2Time)
+		}
+		if p.Parallelism < 1 || p.Parallelism > maxKDFParallelism {
+			return fmt.Errorf("Argon2id parallelism must be between 1 and %d", maxKDFParallelism)
+		}
+		if p.MemoryKiB < 8*p.Parallelism || p.MemoryKiB > maxArgon2MemoryKiB {
+			return fmt.Errorf("Argon2id memory must be between %d and %d KiB", 8*p.Parallelism, maxArgon2MemoryKiB)
+		}
+	default:
+		return fmt.Errorf("unsupported KDF: %s", p.Algorithm)
+	}
+	return nil
+}
+
+// DeriveKey derives a key of the given length from passphrase
+func (p *KDFParams) DeriveKey(passphrase []byte, length int) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	utils.DebugLogf("KDF: deriving %d-byte key with %s", length, p.Algorithm)
+
+	switch p.Algorithm {
+	case KDFPBKDF2SHA256:
+		return pbkdf2.Key(passphrase, p.Salt, int(p.Iterations), length, sha256.New), nil
+	case KDFScrypt:
+		key, err := scrypt.Key(passphrase, p.Salt, int(p.ScryptN), int(p.ScryptR), int(p.Parallelism), length)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive key: %w", err)
+		}
+		return key, nil
+	case KDFArgon2id:
+		return argon2.IDKey(passphrase, p.Salt, p.Iterations, p.MemoryKiB, uint8(p.Parallelism), uint32(length)), nil
+	default:
+		return nil, fmt.Errorf("unsupported KDF: %s", p.Algorithm)
+	}
+}
+
+// marshal encodes the parameters as algorithm (1) | five uint32 cost fields | salt
+func (p *KDFParams) marshal() []byte {
+	out := []byte{byte(p.Algorithm)}
+	out = binary.BigEndian.AppendUint32(out, p.Iterations)
+	out = binary.BigEndian.AppendUint32(out, p.MemoryKiB)
+	out = binary.BigEndian.AppendUint32(out, p.Parallelism)
+	out = binary.BigEndian.AppendUint32(out, p.ScryptN)
+	out = binary.BigEndian.AppendUint32(out, p.ScryptR)
+	return append(out, p.Salt...)
+}
+
+func parseKDFParams(value []byte) (*KDFParams, error) {
+	if len(value) < 1+5*4 {
+		return nil, fmt.Errorf("KDF parameters are truncated")
+	}
+	return &KDFParams{
+		Algorithm:   KDFAlgorithm(value[0]),
+		Iterations:  binary.BigEndian.Uint32(value[1:]),
+		MemoryKiB:   binary.BigEndian.Uint32(value[5:]),
+		Parallelism: binary.BigEndian.Uint32(value[9:]),
+		ScryptN:     binary.BigEndian.Uint32(value[13:]),
+		ScryptR:     binary.BigEndian.Uint32(value[17:]),
+		Salt:        append([]byte{}, value[21:]...),
+	}, nil
+}
@@ -0,0 +1,225 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+var kdfTestSalt = []byte("sixteen byte slt")
+
+// cheapKDFParams returns fast parameters for algorithm, with every cost field
+// different so that swapped fields show up
+func cheapKDFParams(algorithm KDFAlgorithm) *KDFParams {
+	params := &KDFParams{Algorithm: algorithm, Salt: append([]byte{}, kdfTestSalt...)}
+	switch algorithm {
+	case KDFPBKDF2SHA256:
+		params.Iterations = 1000
+	case KDFScrypt:
+		params.ScryptN = 1 << 10
+		params.ScryptR = 4
+		params.Parallelism = 2
+	case KDFArgon2id:
+		params.Iterations = 2
+		params.MemoryKiB = 256
+		params.Parallelism = 3
+	}
+	return params
+}
+
+func TestKDFDeriveKey(t *testing.T) {
+	passphrase := []byte("correct horse battery staple")
+	scryptKey, err := scrypt.Key(passphrase, kdfTestSalt, 1<<10, 4, 2, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		algorithm KDFAlgorithm
+		want      []byte
+	}{
+		{KDFPBKDF2SHA256, pbkdf2.Key(passphrase, kdfTestSalt, 1000, 32, sha256.New)},
+		{KDFScrypt, scryptKey},
+		{KDFArgon2id, argon2.IDKey(passphrase, kdfTestSalt, 2, 256, 3, 32)},
+	} {
+		params := cheapKDFParams(tt.algorithm)
+		got, err := params.DeriveKey(passphrase, 32)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.algorithm, err)
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: DeriveKey = %x, want %x", tt.algorithm, got, tt.want)
+		}
+
+		params.Salt[0] ^= 1
+		if other, _ := params.DeriveKey(passphrase, 32); bytes.Equal(other, got) {
+			t.Errorf("%s: another salt gave the same key", tt.algorithm)
+		}
+	}
+}
+
+func TestKDFDefaults(t *testing.T) {
+	for _, algorithm := range []KDFAlgorithm{KDFPBKDF2SHA256, KDFScrypt, KDFArgon2id} {
+		a, err := NewKDFParams(algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := a.Validate(); err != nil {
+			t.Errorf("%s: default parameters are invalid: %v", algorithm, err)
+		}
+		b, err := NewKDFParams(algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(a.Salt) != kdfSaltSize || bytes.Equal(a.Salt, b.Salt) {
+			t.Errorf("%s: salts %x and %x", algorithm, a.Salt, b.Salt)
+		}
+	}
+	if _, err := NewKDFParams(KDFAlgorithm(9)); err == nil {
+		t.Error("NewKDFParams of an unknown algorithm succeeded")
+	}
+}
+
+func TestKDFValidate(t *testing.T) {
+	for name, change := range map[string]func(*KDFParams){
+		"short salt":             func(p *KDFParams) { p.Salt = p.Salt[:7] },
+		"unknown algorithm":      func(p *KDFParams) { p.Algorithm = 0 },
+		"zero PBKDF2 iterations": func(p *KDFParams) { p.Algorithm, p.Iterations = KDFPBKDF2SHA256, 0 },
+		"huge PBKDF2 iterations": func(p *KDFParams) { p.Algorithm, p.Iterations = KDFPBKDF2SHA256, maxPBKDF2Iterations+1 },
+		"scrypt N not a power":   func(p *KDFParams) { *p = *cheapKDFParams(KDFScrypt); p.ScryptN = 1000 },
+		"scrypt N of 1":          func(p *KDFParams) { *p = *cheapKDFParams(KDFScrypt); p.ScryptN = 1 },
+		"scrypt r of 0":          func(p *KDFParams) { *p = *cheapKDFParams(KDFScrypt); p.ScryptR = 0 },
+		"scrypt p of 0":          func(p *KDFParams) { *p = *cheapKDFParams(KDFScrypt); p.Parallelism = 0 },
+		"scrypt memory":          func(p *KDFParams) { *p = *cheapKDFParams(KDFScrypt); p.ScryptN, p.ScryptR = 1<<24, 8 },
+		"argon2 time of 0":       func(p *KDFParams) { p.Iterations = 0 },
+		"argon2 huge time":       func(p *KDFParams) { p.Iterations = maxArgon2Time + 1 },
+		"argon2 no lanes":        func(p *KDFParams) { p.Parallelism = 0 },
+		"argon2 too many lanes":  func(p *KDFParams) { p.Parallelism, p.MemoryKiB = maxKDFParallelism+1, 1<<20 },
+		"argon2 memory per lane": func(p *KDFParams) { p.MemoryKiB = 8*p.Parallelism - 1 },
+		"argon2 huge memory":     func(p *KDFParams) { p.MemoryKiB = maxArgon2MemoryKiB + 1 },
+	} {
+		params := cheapKDFParams(KDFArgon2id)
+		change(params)
+		if err := params.Validate(); err == nil {
+			t.Errorf("%s: Validate succeeded", name)
+		}
+		// DeriveKey checks first, so a crafted header cannot make it run
+		if _, err := params.DeriveKey([]byte("x"), 32); err == nil {
+			t.Errorf("%s: DeriveKey succeeded", name)
+		}
+	}
+}
+
+func TestKDFParamsEncoding(t *testing.T) {
+	for _, algorithm := range []KDFAlgorithm{KDFPBKDF2SHA256, KDFScrypt, KDFArgon2id} {
+		params := cheapKDFParams(algorithm)
+		got, err := parseKDFParams(params.marshal())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Algorithm != params.Algorithm || got.Iterations != params.Iterations || got.MemoryKiB != params.MemoryKiB ||
+			got.Parallelism != params.Parallelism || got.ScryptN != params.ScryptN || got.ScryptR != params.ScryptR || !bytes.Equal(got.Salt, params.Salt) {
+			t.Errorf("%s: parsed %+v, want %+v", algorithm, got, params)
+		}
+	}
+	if _, err := parseKDFParams(make([]byte, 20)); err == nil {
+		t.Error("truncated KDF parameters were accepted")
+	}
+
+	for name, want := range map[string]KDFAlgorithm{"pbkdf2": KDFPBKDF2SHA256, "PBKDF2-SHA256": KDFPBKDF2SHA256, "scrypt": KDFScrypt, "Argon2id": KDFArgon2id} {
+		if got, err := ParseKDFAlgorithm(name); err != nil || got != want {
+			t.Errorf("ParseKDFAlgorithm(%q) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+	if _, err := ParseKDFAlgorithm("bcrypt"); err == nil {
+		t.Error("ParseKDFAlgorithm(bcrypt) succeeded")
+	}
+}
+
+func TestPassphraseRoundTrip(t *testing.T) {
+	plaintext := []byte("passphrase protected")
+	for _, algorithm := range []KDFAlgorithm{KDFPBKDF2SHA256, KDFScrypt, KDFArgon2id} {
+		ciphertext, err := EncryptWithPassphrase(plaintext, []byte("open sesame"), cheapKDFParams(algorithm))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := DecryptWithPassphrase(ciphertext, []byte("open sesame")); err != nil || !bytes.Equal(got, plaintext) {
+			t.Errorf("%s: DecryptWithPassphrase = %q, %v", algorithm, got, err)
+		}
+		if _, err := DecryptWithPassphrase(ciphertext, []byte("open sesame!")); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+			t.Errorf("%s: wrong passphrase: error = %v", algorithm, err)
+		}
+	}
+
+	if _, err := EncryptWithPassphrase(plaintext, nil, cheapKDFParams(KDFArgon2id)); err == nil {
+		t.Error("empty passphrase was accepted")
+	}
+	sealed, err := SealEnvelope(&AESGCMProvider{}, plaintext, parallelTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecryptWithPassphrase(sealed, parallelTestKey); err == nil {
+		t.Error("DecryptWithPassphrase of a key envelope succeeded")
+	}
+}
+
+func TestPassphraseHeaderParams(t *testing.T) {
+	ciphertext, err := EncryptWithPassphrase([]byte("x"), []byte("open sesame"), cheapKDFParams(KDFArgon2id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rewrite := func(change func(*KDFParams)) []byte {
+		header, _, body, err := parseEnvelope(ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		change(header.KDF)
+		headerBytes, err := header.marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append(headerBytes, body...)
+	}
+
+	// Lowered costs derive another key, and the header is authenticated anyway
+	if _, err := DecryptWithPassphrase(rewrite(func(p *KDFParams) { p.Iterations = 1 }), []byte("open sesame")); err == nil {
+		t.Error("lowered time cost was accepted")
+	}
+	// Costs out of bounds are rejected before any work
+	if _, err := DecryptWithPassphrase(rewrite(func(p *KDFParams) { p.MemoryKiB = maxArgon2MemoryKiB * 2 }), []byte("open sesame")); err == nil || !strings.Contains(err.Error(), "memory") {
+		t.Errorf("huge memory cost: error = %v", err)
+	}
+}
+
+func TestPassphraseProviderFreshSalt(t *testing.T) {
+	provider := &PassphraseProvider{Params: cheapKDFParams(KDFScrypt)}
+	a, err := provider.Encrypt([]byte("x"), []byte("open sesame"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := provider.Encrypt([]byte("x"), []byte("open sesame"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerA, _, _, err := parseEnvelope(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerB, _, _, err := parseEnvelope(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(headerA.KDF.Salt, headerB.KDF.Salt) || bytes.Equal(headerA.KDF.Salt, kdfTestSalt) {
+		t.Error("PassphraseProvider reused a salt")
+	}
+	if headerA.KDF.ScryptN != provider.Params.ScryptN || headerA.KDF.Algorithm != KDFScrypt {
+		t.Errorf("header KDF = %+v, want the provider's parameters", headerA.KDF)
+	}
+	if got, err := provider.Decrypt(b, []byte("open sesame")); err != nil || string(got) != "x" {
+		t.Errorf("Decrypt = %q, %v", got, err)
+	}
+}
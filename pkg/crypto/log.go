@@ -0,0 +1,407 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+// Encrypted log layout, an append-only file of records:
+//
+//	header: magic "TLEL" | version (1) | salt (16) | key id (8)
+//	record: length (4, big endian) | nonce (12) | ciphertext and tag | chain MAC (32)
+//
+// The length covers the nonce, ciphertext and tag. Records are sealed with
+// AES-256-GCM under HKDF(key, salt, "thanhlv-ed log") with the record number as
+// additional data, so each one is authenticated on its own. The chain MAC is
+// HMAC-SHA256 under HKDF(key, salt, "thanhlv-ed log mac") of the previous record's
+// chain MAC (the header's for the first record), the record number, the length and
+// the sealed record, so removing, reordering or changing records breaks the chain.
+// Dropping whole records from the end cannot be seen in the file itself; compare
+// Head with a value kept elsewhere for that.
+
+var logMagic = []byte("TLEL")
+
+const (
+	logVersion    = 1
+	logSaltSize   = 16
+	logHeaderSize = 4 + 1 + logSaltSize + keyIDSize
+	logNonceSize  = 12
+	logMACSize    = sha256.Size
+	// MaxLogRecordSize is the largest record LogWriter appends
+	MaxLogRecordSize = 16 << 20
+)
+
+var (
+	logKeyInfo = []byte("thanhlv-ed log")
+	logMACInfo = []byte("thanhlv-ed log mac")
+)
+
+// ErrLogTruncated is returned when an encrypted log ends inside a record, as it
+// does after a crash in the middle of an append
+var ErrLogTruncated = errors.New("encrypted log ends in an incomplete record")
+
+// ErrLogLocked is returned by OpenLogWriter and RepairLog when another LogWriter
+// has the log open
+var ErrLogLocked = errors.New("encrypted log is open by another writer")
+
+// logChain is the state shared by LogWriter and LogReader: the record keys, the
+// number of the next record and the chain MAC so far
+type logChain struct {
+	aead   cipher.AEAD
+	macKey []byte
+	seq    uint64
+	head   []byte
+}
+
+func newLogChain(key, header []byte) (*logChain, error) {
+	salt := header[len(logMagic)+1 : len(logMagic)+1+logSaltSize]
+	encKey, err := DeriveKey(key, salt, logKeyInfo, fileKeySize)
+	if err != nil {
+		return nil, err
+	}
+	macKey, err := DeriveKey(key, salt, logMACInfo, sha256.Size)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(header)
+	return &logChain{aead: aead, macKey: macKey, head: mac.Sum(nil)}, nil
+}
+
+// next returns the chain MAC of record seq with the given length and sealed body
+func (c *logChain) next(length, body []byte) []byte {
+	mac := hmac.New(sha256.New, c.macKey)
+	mac.Write(c.head)
+	mac.Write(binary.BigEndian.AppendUint64(nil, c.seq))
+	mac.Write(length)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// seal frames record as the next record and returns it with its chain MAC; the
+// chain only moves on once the caller has written it
+func (c *logChain) seal(record []byte) ([]byte, []byte, error) {
+	nonce := make([]byte, logNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	body := c.aead.Seal(nonce, nonce, record, binary.BigEndian.AppendUint64(nil, c.seq))
+	length := binary.BigEndian.AppendUint32(nil, uint32(len(body)))
+	head := c.next(length, body)
+
+	frame := make([]byte, 0, len(length)+len(body)+len(head))
+	frame = append(frame, length...)
+	frame = append(frame, body...)
+	return append(frame, head...), head, nil
+}
+
+// open checks the chain MAC of a record and decrypts it
+func (c *logChain) open(length, body, tag []byte) ([]byte, error) {
+	head := c.next(length, body)
+	if !hmac.Equal(head, tag) {
+		return nil, fmt.Errorf("record %d fails the chain MAC: the log was modified, or records were reordered or removed", c.seq)
+	}
+	record, err := c.aead.Open(nil, body[:logNonceSize], body[logNonceSize:], binary.BigEndian.AppendUint64(nil, c.seq))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt record %d: %w", c.seq, err)
+	}
+	c.seq++
+	c.head = head
+	return record, nil
+}
+
+// LogWriter appends encrypted records to a log file. Each Append is written with a
+// single write and synced before it returns, and OpenLogWriter continues an
+// existing log, so records survive process restarts. A LogWriter holds an
+// exclusive lock on its file (flock on Unix, LockFileEx on Windows; none on other
+// systems) so a second writer fails with ErrLogLocked; readers do not lock. Its
+// methods are safe for concurrent use.
+type LogWriter struct {
+	mu    sync.Mutex
+	f     *os.File
+	chain *logChain
+	err   error
+}
+
+// OpenLogWriter opens the log at path for appending, creating it if needed. An
+// existing log is read through to check the key and every record and to pick up
+// the chain. A log that ends in an incomplete record, left by a crash during an
+// append, fails with ErrLogTruncated; RepairLog removes that record.
+func OpenLogWriter(path string, key []byte) (*LogWriter, error) {
+	w, _, err := openLogFile(path, key, false)
+	return w, err
+}
+
+// RepairLog removes the incomplete record a crash during an append left at the
+// end of the log at path and returns the number of bytes removed, 0 if the log
+// ends with a complete record. Records that fail authentication or break the
+// chain are an error and are left in place. A missing log is an error too.
+func RepairLog(path string, key []byte) (int64, error) {
+	w, dropped, err := openLogFile(path, key, true)
+	if err != nil {
+		return 0, err
+	}
+	return dropped, w.Close()
+}
+
+// openLogFile opens and locks the log at path. Only appending creates a missing
+// log; a repair of a mistyped path must not start a new one.
+func openLogFile(path string, key []byte, repair bool) (*LogWriter, int64, error) {
+	flag := os.O_RDWR | os.O_CREATE
+	if repair {
+		flag = os.O_RDWR
+	}
+	f, err := os.OpenFile(path, flag, 0600)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open log %s: %w", path, err)
+	}
+	if err := lockLog(f); err != nil {
+		f.Close()
+		if errors.Is(err, ErrLogLocked) {
+			return nil, 0, err
+		}
+		return nil, 0, fmt.Errorf("failed to lock log %s: %w", path, err)
+	}
+	w, dropped, err := openLogWriter(f, key, repair)
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return w, dropped, nil
+}
+
+// openLogWriter continues the log in f, removing an incomplete last record if
+// repair is set, and returns the number of bytes removed
+func openLogWriter(f *os.File, key []byte, repair bool) (*LogWriter, int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	if info.Size() == 0 {
+		keyID, err := symmetricKeyID(key)
+		if err != nil {
+			return nil, 0, err
+		}
+		header := make([]byte, 0, logHeaderSize)
+		header = append(header, logMagic...)
+		header = append(header, logVersion)
+		salt := make([]byte, logSaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, 0, fmt.Errorf("failed to generate salt: %w", err)
+		}
+		header = append(header, salt...)
+		header = append(header, keyID...)
+		if _, err := f.Write(header); err != nil {
+			return nil, 0, fmt.Errorf("failed to write log header: %w", err)
+		}
+		if err := f.Sync(); err != nil {
+			return nil, 0, fmt.Errorf("failed to sync log: %w", err)
+		}
+		chain, err := newLogChain(key, header)
+		if err != nil {
+			return nil, 0, err
+		}
+		return &LogWriter{f: f, chain: chain}, 0, nil
+	}
+
+	r, err := NewLogReader(f, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	var dropped int64
+	for {
+		_, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, ErrLogTruncated) {
+			dropped = info.Size() - r.offset
+			if !repair {
+				return nil, 0, fmt.Errorf("%w of %d bytes after record %d", err, dropped, r.chain.seq)
+			}
+			utils.DebugLogf("RepairLog: removing %d bytes of an incomplete record", dropped)
+			if err := f.Truncate(r.offset); err != nil {
+				return nil, 0, fmt.Errorf("failed to remove incomplete record: %w", err)
+			}
+			if err := f.Sync(); err != nil {
+				return nil, 0, fmt.Errorf("failed to sync log: %w", err)
+			}
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	if _, err := f.Seek(r.offset, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	utils.DebugLogf("OpenLogWriter: appending after %d records", r.chain.seq)
+	return &LogWriter{f: f, chain: r.chain}, dropped, nil
+}
+
+// Append encrypts record and adds it to the end of the log
+func (w *LogWriter) Append(record []byte) error {
+	if len(record) > MaxLogRecordSize {
+		return fmt.Errorf("log record of %d bytes is larger than %d bytes", len(record), MaxLogRecordSize)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+
+	frame, head, err := w.chain.seal(record)
+	if err != nil {
+		return err
+	}
+	// After a failed write the end of the file is unknown, so the writer stops;
+	// RepairLog removes a partial record
+	if _, err := w.f.Write(frame); err != nil {
+		w.err = fmt.Errorf("failed to append record %d: %w", w.chain.seq, err)
+		return w.err
+	}
+	if err := w.f.Sync(); err != nil {
+		w.err = fmt.Errorf("failed to sync record %d: %w", w.chain.seq, err)
+		return w.err
+	}
+	w.chain.seq++
+	w.chain.head = head
+	return nil
+}
+
+// Count returns the number of records in the log
+func (w *LogWriter) Count() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.chain.seq
+}
+
+// Head returns the chain MAC of the last record. It changes with every Append;
+// keeping it outside the log lets a reader notice records removed from the end.
+func (w *LogWriter) Head() []byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return bytes.Clone(w.chain.head)
+}
+
+// Close closes the log file, releasing its lock
+func (w *LogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Close()
+}
+
+// LogReader reads the records of an encrypted log in order
+type LogReader struct {
+	r     *bufio.Reader
+	chain *logChain
+	// offset is the end of the last complete record
+	offset int64
+	err    error
+}
+
+// NewLogReader reads the log header from r and checks the key against it
+func NewLogReader(r io.Reader, key []byte) (*LogReader, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, logHeaderSize)
+	if _, err := io.ReadFull(br, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("data is not an encrypted log")
+		}
+		return nil, fmt.Errorf("failed to read log header: %w", err)
+	}
+	if !bytes.HasPrefix(header, logMagic) {
+		return nil, fmt.Errorf("data is not an encrypted log")
+	}
+	if version := header[len(logMagic)]; version != logVersion {
+		return nil, fmt.Errorf("unsupported log version %d", version)
+	}
+	keyID, err := symmetricKeyID(key)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(keyID, header[logHeaderSize-keyIDSize:]) {
+		return nil, ErrKeyMismatch
+	}
+	chain, err := newLogChain(key, header)
+	if err != nil {
+		return nil, err
+	}
+	return &LogReader{r: br, chain: chain, offset: logHeaderSize}, nil
+}
+
+// Next returns the next record. It returns io.EOF after the last one, and
+// ErrLogTruncated if the log ends inside a record.
+func (l *LogReader) Next() ([]byte, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	record, size, err := l.next()
+	if err != nil {
+		l.err = err
+		return nil, err
+	}
+	l.offset += size
+	return record, nil
+}
+
+func (l *LogReader) next() ([]byte, int64, error) {
+	length := make([]byte, 4)
+	if _, err := io.ReadFull(l.r, length); err != nil {
+		if err == io.EOF {
+			return nil, 0, io.EOF
+		}
+		if err == io.ErrUnexpectedEOF {
+			return nil, 0, ErrLogTruncated
+		}
+		return nil, 0, fmt.Errorf("failed to read record %d: %w", l.chain.seq, err)
+	}
+	n := int(binary.BigEndian.Uint32(length))
+	if n < logNonceSize+l.chain.aead.Overhead() || n > logNonceSize+MaxLogRecordSize+l.chain.aead.Overhead() {
+		return nil, 0, fmt.Errorf("record %d has an invalid length; the log is corrupted", l.chain.seq)
+	}
+
+	data := make([]byte, n+logMACSize)
+	if _, err := io.ReadFull(l.r, data); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, 0, ErrLogTruncated
+		}
+		return nil, 0, fmt.Errorf("failed to read record %d: %w", l.chain.seq, err)
+	}
+	record, err := l.chain.open(length, data[:n], data[n:])
+	if err != nil {
+		return nil, 0, err
+	}
+	return record, int64(len(length) + len(data)), nil
+}
+
+// Count returns the number of records read so far
+func (l *LogReader) Count() uint64 {
+	return l.chain.seq
+}
+
+// Head returns the chain MAC of the last record read, to compare with LogWriter.Head
+func (l *LogReader) Head() []byte {
+	return bytes.Clone(l.chain.head)
+}
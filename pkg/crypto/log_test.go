@@ -0,0 +1,287 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+var logTestKey = []byte("log test key")
+
+// logTestRecordSize is the size of a record holding 8 bytes, like "record 0"
+const logTestRecordSize = 4 + logNonceSize + 8 + 16 + logMACSize
+
+func writeTestLog(t *testing.T, path string, from, to int) []byte {
+	t.Helper()
+	w, err := OpenLogWriter(path, logTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for i := from; i < to; i++ {
+		if err := w.Append([]byte(fmt.Sprintf("record %d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if w.Count() != uint64(to) {
+		t.Fatalf("Count = %d, want %d", w.Count(), to)
+	}
+	return w.Head()
+}
+
+// readTestLog returns the records of the log at path and the reader's error
+func readTestLog(t *testing.T, path string) ([]string, *LogReader, error) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := NewLogReader(f, logTestKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	var records []string
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			return records, r, nil
+		}
+		if err != nil {
+			return records, r, err
+		}
+		records = append(records, string(record))
+	}
+}
+
+func checkTestLogRecords(t *testing.T, records []string, n int) {
+	t.Helper()
+	if len(records) != n {
+		t.Fatalf("read %d records, want %d", len(records), n)
+	}
+	for i, record := range records {
+		if record != fmt.Sprintf("record %d", i) {
+			t.Errorf("record %d = %q", i, record)
+		}
+	}
+}
+
+func TestLogAppendReopenContinue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	head := writeTestLog(t, path, 0, 3)
+
+	w, err := OpenLogWriter(path, logTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Count() != 3 || !bytes.Equal(w.Head(), head) {
+		t.Errorf("reopened log has %d records and head %x, want 3 and %x", w.Count(), w.Head(), head)
+	}
+	w.Close()
+
+	head = writeTestLog(t, path, 3, 5)
+	records, r, err := readTestLog(t, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestLogRecords(t, records, 5)
+	if r.Count() != 5 || !bytes.Equal(r.Head(), head) {
+		t.Errorf("reader has %d records and head %x, want 5 and %x", r.Count(), r.Head(), head)
+	}
+
+	if _, err := OpenLogWriter(path, []byte("another key")); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("wrong key: error = %v, want ErrKeyMismatch", err)
+	}
+}
+
+func TestLogTornTail(t *testing.T) {
+	for _, cut := range []int{1, 2, 4, 5, logTestRecordSize - 1} {
+		path := filepath.Join(t.TempDir(), "audit.log")
+		writeTestLog(t, path, 0, 3)
+		info, _ := os.Stat(path)
+		// The third record was only partly written
+		torn := info.Size() - logTestRecordSize + int64(cut)
+		if err := os.Truncate(path, torn); err != nil {
+			t.Fatal(err)
+		}
+
+		records, _, err := readTestLog(t, path)
+		if !errors.Is(err, ErrLogTruncated) {
+			t.Errorf("cut %d: reader error = %v, want ErrLogTruncated", cut, err)
+		}
+		checkTestLogRecords(t, records, 2)
+
+		// Nothing is removed without asking
+		if _, err := OpenLogWriter(path, logTestKey); !errors.Is(err, ErrLogTruncated) {
+			t.Errorf("cut %d: OpenLogWriter error = %v, want ErrLogTruncated", cut, err)
+		}
+		if info, _ := os.Stat(path); info.Size() != torn {
+			t.Errorf("cut %d: OpenLogWriter changed the log to %d bytes", cut, info.Size())
+		}
+
+		dropped, err := RepairLog(path, logTestKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dropped != int64(cut) {
+			t.Errorf("cut %d: RepairLog removed %d bytes", cut, dropped)
+		}
+		if dropped, err := RepairLog(path, logTestKey); err != nil || dropped != 0 {
+			t.Errorf("cut %d: second RepairLog = %d, %v", cut, dropped, err)
+		}
+
+		writeTestLog(t, path, 2, 4)
+		records, _, err = readTestLog(t, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkTestLogRecords(t, records, 4)
+	}
+}
+
+func TestLogRepairMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	if _, err := RepairLog(path, logTestKey); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("RepairLog of a missing log: error = %v, want one wrapping os.ErrNotExist", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("RepairLog created %s", path)
+	}
+}
+
+func TestLogTamperedRecord(t *testing.T) {
+	for _, offset := range []int{0, 4, 4 + logNonceSize, logTestRecordSize - 1} {
+		path := filepath.Join(t.TempDir(), "audit.log")
+		writeTestLog(t, path, 0, 3)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[logHeaderSize+logTestRecordSize+offset] ^= 1
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		records, _, err := readTestLog(t, path)
+		if err == nil || errors.Is(err, ErrLogTruncated) {
+			t.Errorf("byte %d of record 1 changed: error = %v", offset, err)
+		}
+		checkTestLogRecords(t, records, 1)
+
+		if _, err := OpenLogWriter(path, logTestKey); err == nil {
+			t.Errorf("byte %d of record 1 changed: OpenLogWriter succeeded", offset)
+		}
+		if _, err := RepairLog(path, logTestKey); err == nil {
+			t.Errorf("byte %d of record 1 changed: RepairLog succeeded", offset)
+		}
+		if info, _ := os.Stat(path); info.Size() != int64(len(data)) {
+			t.Errorf("byte %d of record 1 changed: log cut to %d bytes", offset, info.Size())
+		}
+	}
+}
+
+func TestLogReorderedRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeTestLog(t, path, 0, 3)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := func(i int) []byte {
+		return data[logHeaderSize+i*logTestRecordSize : logHeaderSize+(i+1)*logTestRecordSize]
+	}
+	swapped := append([]byte{}, data[:logHeaderSize]...)
+	swapped = append(append(append(swapped, record(0)...), record(2)...), record(1)...)
+	if err := os.WriteFile(path, swapped, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	records, _, err := readTestLog(t, path)
+	if err == nil {
+		t.Error("reordered records were accepted")
+	}
+	checkTestLogRecords(t, records, 1)
+
+	// Records removed from the middle break the chain too
+	if err := os.WriteFile(path, append(append(append([]byte{}, data[:logHeaderSize]...), record(0)...), record(2)...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := readTestLog(t, path); err == nil {
+		t.Error("log with record 1 removed was accepted")
+	}
+}
+
+// Records removed from the end leave a valid log; only a saved head shows it
+func TestLogHeadAfterTailRemoved(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	head := writeTestLog(t, path, 0, 3)
+	if err := os.Truncate(path, logHeaderSize+2*logTestRecordSize); err != nil {
+		t.Fatal(err)
+	}
+
+	records, r, err := readTestLog(t, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestLogRecords(t, records, 2)
+	if bytes.Equal(r.Head(), head) {
+		t.Error("head is unchanged after the last record was removed")
+	}
+	w, err := OpenLogWriter(path, logTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if bytes.Equal(w.Head(), head) || w.Count() != 2 {
+		t.Errorf("writer has %d records and the saved head", w.Count())
+	}
+}
+
+func TestLogWriterLock(t *testing.T) {
+	switch runtime.GOOS {
+	case "darwin", "dragonfly", "freebsd", "linux", "netbsd", "openbsd", "windows":
+	default:
+		t.Skipf("no log lock on %s", runtime.GOOS)
+	}
+	path := filepath.Join(t.TempDir(), "audit.log")
+	w, err := OpenLogWriter(path, logTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenLogWriter(path, logTestKey); !errors.Is(err, ErrLogLocked) {
+		t.Errorf("second writer: error = %v, want ErrLogLocked", err)
+	}
+	if _, err := RepairLog(path, logTestKey); !errors.Is(err, ErrLogLocked) {
+		t.Errorf("RepairLog on an open log: error = %v, want ErrLogLocked", err)
+	}
+	// Readers do not lock
+	if _, _, err := readTestLog(t, path); err != nil {
+		t.Errorf("reading an open log: %v", err)
+	}
+	w.Close()
+
+	w, err = OpenLogWriter(path, logTestKey)
+	if err != nil {
+		t.Fatalf("after Close: %v", err)
+	}
+	w.Close()
+}
+
+func TestLogRecordTooLarge(t *testing.T) {
+	w, err := OpenLogWriter(filepath.Join(t.TempDir(), "audit.log"), logTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Append(make([]byte, MaxLogRecordSize+1)); err == nil {
+		t.Error("record larger than MaxLogRecordSize was appended")
+	}
+	if w.Count() != 0 {
+		t.Errorf("Count = %d after a rejected record", w.Count())
+	}
+}
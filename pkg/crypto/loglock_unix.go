@@ -0,0 +1,18 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package crypto
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockLog takes an exclusive advisory lock on the log, held until f is closed
+func lockLog(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return ErrLogLocked
+	}
+	return err
+}
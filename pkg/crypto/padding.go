@@ -0,0 +1,129 @@
+package crypto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// PaddingKind selects how the plaintext length is rounded up before encryption
+type PaddingKind uint8
+
+const (
+	PaddingNone PaddingKind = 0
+	// PaddingBucket rounds up to the next power of two
+	PaddingBucket PaddingKind = 1
+	// PaddingPadme rounds up to a Padmé size, which leaks O(log log n) bits at
+	// most 12% overhead (Nikitin et al., "Reducing Metadata Leakage from Encrypted
+	// Files and Communication with PURBs", 2019)
+	PaddingPadme PaddingKind = 2
+	// PaddingMultiple rounds up to a multiple of a fixed size
+	PaddingMultiple PaddingKind = 3
+)
+
+// minPaddedSize keeps tiny messages such as passwords from being told apart
+const minPaddedSize = 64
+
+// maxPaddingMultiple bounds the fixed padding size
+const maxPaddingMultiple = 1 << 30
+
+// PaddingScheme is a padding kind and, for PaddingMultiple, the size to round up to
+type PaddingScheme struct {
+	Kind     PaddingKind
+	Multiple uint32
+}
+
+// ParsePaddingScheme parses bucket, padme or a positive size in bytes
+func ParsePaddingScheme(s string) (PaddingScheme, error) {
+	switch strings.ToLower(s) {
+	case "bucket":
+		return PaddingScheme{Kind: PaddingBucket}, nil
+	case "padme":
+		return PaddingScheme{Kind: PaddingPadme}, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || n < 1 || n > maxPaddingMultiple {
+		return PaddingScheme{}, fmt.Errorf("invalid padding %q, expected bucket, padme or a size between 1 and %d", s, maxPaddingMultiple)
+	}
+	return PaddingScheme{Kind: PaddingMultiple, Multiple: uint32(n)}, nil
+}
+
+func (p PaddingScheme) String() string {
+	switch p.Kind {
+	case PaddingNone:
+		return "none"
+	case PaddingBucket:
+		return "bucket"
+	case PaddingPadme:
+		return "padme"
+	case PaddingMultiple:
+		return fmt.Sprintf("multiple of %d", p.Multiple)
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(p.Kind))
+	}
+}
+
+// paddedSize returns the size n bytes are padded to
+func (p PaddingScheme) paddedSize(n int) (int, error) {
+	if n < minPaddedSize && p.Kind != PaddingMultiple {
+		n = minPaddedSize
+	}
+	switch p.Kind {
+	case PaddingBucket:
+		return 1 << bits.Len(uint(n-1)), nil
+	case PaddingPadme:
+		e := bits.Len(uint(n)) - 1
+		s := bits.Len(uint(e))
+		mask := 1<<(e-s) - 1
+		return (n + mask) &^ mask, nil
+	case PaddingMultiple:
+		m := int(p.Multiple)
+		return (n + m - 1) / m * m, nil
+	default:
+		return 0, fmt.Errorf("unsupported padding %s", p)
+	}
+}
+
+// pad appends a 0x80 marker and zeros up to the padded size (ISO/IEC 7816-4), so
+// unpad needs no stored length
+func (p PaddingScheme) pad(data []byte) ([]byte, error) {
+	size, err := p.paddedSize(len(data) + 1)
+	if err != nil {
+		return nil, err
+	}
+	padded := make([]byte, size)
+	copy(padded, data)
+	padded[len(data)] = 0x80
+	return padded, nil
+}
+
+func unpad(data []byte) ([]byte, error) {
+	i := len(data) - 1
+	for i >= 0 && data[i] == 0 {
+		i--
+	}
+	if i < 0 || data[i] != 0x80 {
+		return nil, fmt.Errorf("invalid length padding")
+	}
+	return data[:i], nil
+}
+
+func (p PaddingScheme) marshal() []byte {
+	return binary.BigEndian.AppendUint32([]byte{byte(p.Kind)}, p.Multiple)
+}
+
+func parsePaddingScheme(value []byte) (PaddingScheme, error) {
+	if len(value) != 5 {
+		return PaddingScheme{}, fmt.Errorf("invalid envelope padding field")
+	}
+	p := PaddingScheme{Kind: PaddingKind(value[0]), Multiple: binary.BigEndian.Uint32(value[1:])}
+	switch {
+	case p.Kind == PaddingBucket || p.Kind == PaddingPadme:
+	case p.Kind == PaddingMultiple && p.Multiple >= 1 && p.Multiple <= maxPaddingMultiple:
+	default:
+		return PaddingScheme{}, fmt.Errorf("unsupported envelope padding %s", p)
+	}
+	return p, nil
+}
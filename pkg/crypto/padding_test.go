@@ -0,0 +1,141 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPaddedSize(t *testing.T) {
+	bucket := PaddingScheme{Kind: PaddingBucket}
+	padme := PaddingScheme{Kind: PaddingPadme}
+	multiple := PaddingScheme{Kind: PaddingMultiple, Multiple: 100}
+	for _, tt := range []struct {
+		scheme PaddingScheme
+		n      int
+		want   int
+	}{
+		{bucket, 1, 64},
+		{bucket, 64, 64},
+		{bucket, 65, 128},
+		{bucket, 1000, 1024},
+		{bucket, 1025, 2048},
+		{padme, 1, 64},
+		{padme, 64, 64},
+		{padme, 100, 104},
+		{padme, 1000, 1024},
+		{padme, 1025, 1088},
+		{padme, 10000, 10240},
+		{multiple, 1, 100},
+		{multiple, 100, 100},
+		{multiple, 101, 200},
+	} {
+		got, err := tt.scheme.paddedSize(tt.n)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: paddedSize(%d) = %d, %v, want %d", tt.scheme, tt.n, got, err, tt.want)
+		}
+	}
+
+	// Padmé never grows a message by more than 12%
+	for n := minPaddedSize; n < 1<<16; n += 7 {
+		got, _ := padme.paddedSize(n)
+		if got < n || float64(got-n) > 0.12*float64(n) {
+			t.Fatalf("padme: paddedSize(%d) = %d", n, got)
+		}
+	}
+	if _, err := (PaddingScheme{}).paddedSize(10); err == nil {
+		t.Error("paddedSize without a padding kind succeeded")
+	}
+}
+
+func TestPadRoundTrip(t *testing.T) {
+	for _, scheme := range []PaddingScheme{{Kind: PaddingBucket}, {Kind: PaddingPadme}, {Kind: PaddingMultiple, Multiple: 1}, {Kind: PaddingMultiple, Multiple: 100}} {
+		for _, n := range []int{0, 1, 62, 63, 64, 99, 100, 1000} {
+			// Trailing zeros and 0x80 bytes in the data must survive
+			data := append(parallelTestData(n), make([]byte, n%3)...)
+			if n%2 == 1 {
+				data = append(data, 0x80)
+			}
+			padded, err := scheme.pad(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := scheme.paddedSize(len(data) + 1)
+			if len(padded) != want {
+				t.Errorf("%s: %d bytes padded to %d, want %d", scheme, len(data), len(padded), want)
+			}
+			got, err := unpad(padded)
+			if err != nil || !bytes.Equal(got, data) {
+				t.Errorf("%s: unpad(pad(%d bytes)) = %d bytes, %v", scheme, len(data), len(got), err)
+			}
+		}
+	}
+
+	for _, bad := range [][]byte{nil, {0, 0, 0}, {1, 2, 3}, {0x80, 1}} {
+		if _, err := unpad(bad); err == nil {
+			t.Errorf("unpad(%x) succeeded", bad)
+		}
+	}
+}
+
+func TestParsePaddingScheme(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want PaddingScheme
+		ok   bool
+	}{
+		{"bucket", PaddingScheme{Kind: PaddingBucket}, true},
+		{"PADME", PaddingScheme{Kind: PaddingPadme}, true},
+		{"4096", PaddingScheme{Kind: PaddingMultiple, Multiple: 4096}, true},
+		{"1", PaddingScheme{Kind: PaddingMultiple, Multiple: 1}, true},
+		{"0", PaddingScheme{}, false},
+		{"-1", PaddingScheme{}, false},
+		{"2147483648", PaddingScheme{}, false},
+		{"4k", PaddingScheme{}, false},
+		{"", PaddingScheme{}, false},
+	} {
+		got, err := ParsePaddingScheme(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParsePaddingScheme(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+
+	// The header field round trips, and unknown or invalid schemes are refused
+	for _, p := range []PaddingScheme{{Kind: PaddingBucket}, {Kind: PaddingPadme}, {Kind: PaddingMultiple, Multiple: 512}} {
+		if got, err := parsePaddingScheme(p.marshal()); err != nil || got != p {
+			t.Errorf("parsePaddingScheme(%s) = %v, %v", p, got, err)
+		}
+	}
+	for _, p := range []PaddingScheme{{Kind: PaddingNone}, {Kind: 9}, {Kind: PaddingMultiple}, {Kind: PaddingMultiple, Multiple: maxPaddingMultiple + 1}} {
+		if _, err := parsePaddingScheme(p.marshal()); err == nil {
+			t.Errorf("parsePaddingScheme(%s) succeeded", p)
+		}
+	}
+	if _, err := parsePaddingScheme([]byte{byte(PaddingBucket)}); err == nil {
+		t.Error("short padding field accepted")
+	}
+}
+
+func TestPaddedEnvelope(t *testing.T) {
+	// Messages in the same bucket give envelopes of the same size
+	provider := &AESGCMProvider{EnvelopeOptions: EnvelopeOptions{Padding: PaddingScheme{Kind: PaddingBucket}}}
+	var sizes []int
+	for _, msg := range []string{"", "yes", "a somewhat longer secret message"} {
+		data, err := SealEnvelope(provider, []byte(msg), parallelTestKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, len(data))
+		if got, err := OpenEnvelope(data, parallelTestKey, nil); err != nil || string(got) != msg {
+			t.Errorf("OpenEnvelope = %q, %v, want %q", got, err, msg)
+		}
+	}
+	if sizes[0] != sizes[1] || sizes[1] != sizes[2] {
+		t.Errorf("padded envelope sizes = %v, want all equal", sizes)
+	}
+
+	// Streams need the total length up front, so they cannot be padded
+	var buf bytes.Buffer
+	if _, err := NewEncryptWriter(&buf, parallelTestKey, &StreamOptions{EnvelopeOptions: provider.EnvelopeOptions}); err == nil {
+		t.Error("padded stream accepted")
+	}
+}
@@ -0,0 +1,238 @@
+package crypto
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Chunks of a stream are independent once their counter and last flag are known,
+// so with Parallelism above 1 they are sealed and opened on a pool of goroutines.
+// A queue keeps them in stream order and a fixed set of chunk buffers bounds the
+// memory used. Nonces only depend on the chunk counter, so the output is the same
+// byte for byte as with a single goroutine.
+
+// chunkJob is one chunk in flight; done is closed once out or err is set
+type chunkJob struct {
+	counter uint64
+	last    bool
+	// in is the plaintext to seal or the ciphertext to open
+	in []byte
+	// data and buf are the reusable ciphertext and plaintext buffers of the reader
+	data []byte
+	buf  []byte
+	out  []byte
+	err  error
+	done chan struct{}
+}
+
+// sealPipeline seals the chunks of a streamWriter and writes them to w in order
+type sealPipeline struct {
+	w    io.Writer
+	aead cipher.AEAD
+	ad   []byte
+
+	work     chan *chunkJob
+	queue    chan *chunkJob
+	free     chan []byte
+	finished chan struct{}
+	stopOnce sync.Once
+
+	mu  sync.Mutex
+	err error
+}
+
+func newSealPipeline(w io.Writer, aead cipher.AEAD, ad []byte, workers, bufSize int) *sealPipeline {
+	p := &sealPipeline{
+		w:        w,
+		aead:     aead,
+		ad:       ad,
+		work:     make(chan *chunkJob, workers),
+		queue:    make(chan *chunkJob, 2*workers),
+		free:     make(chan []byte, 2*workers+2),
+		finished: make(chan struct{}),
+	}
+	for i := 0; i < cap(p.free); i++ {
+		p.free <- make([]byte, 0, bufSize)
+	}
+	for i := 0; i < workers; i++ {
+		go p.seal()
+	}
+	go p.write()
+	return p
+}
+
+// buffer returns an empty chunk buffer, waiting while all of them are in flight
+func (p *sealPipeline) buffer() []byte {
+	return <-p.free
+}
+
+// submit queues a chunk taken from buffer for sealing
+func (p *sealPipeline) submit(buf []byte, counter uint64, last bool) {
+	job := &chunkJob{counter: counter, last: last, in: buf, done: make(chan struct{})}
+	p.queue <- job
+	p.work <- job
+}
+
+// wait lets the queued chunks finish and returns the first write error
+func (p *sealPipeline) wait() error {
+	p.stopOnce.Do(func() {
+		close(p.work)
+		close(p.queue)
+	})
+	<-p.finished
+	return p.failed()
+}
+
+// abort drops the queued chunks unwritten and stops the goroutines
+func (p *sealPipeline) abort() {
+	p.mu.Lock()
+	if p.err == nil {
+		p.err = errWriterAborted
+	}
+	p.mu.Unlock()
+	p.wait()
+}
+
+func (p *sealPipeline) failed() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+func (p *sealPipeline) seal() {
+	for job := range p.work {
+		job.out = p.aead.Seal(job.in[:0], streamNonce(job.counter, job.last), job.in, p.ad)
+		close(job.done)
+	}
+}
+
+// write writes sealed chunks in order; after an error it only recycles them
+func (p *sealPipeline) write() {
+	defer close(p.finished)
+	for job := range p.queue {
+		<-job.done
+		if p.failed() == nil {
+			if _, err := p.w.Write(job.out); err != nil {
+				p.mu.Lock()
+				p.err = fmt.Errorf("failed to write chunk %d: %w", job.counter, err)
+				p.mu.Unlock()
+			}
+		}
+		p.free <- job.out[:0]
+	}
+}
+
+// parallelStreamReader reads chunks ahead of the caller and opens them on workers
+type parallelStreamReader struct {
+	sr       *streamReader
+	work     chan *chunkJob
+	queue    chan *chunkJob
+	free     chan *chunkJob
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	cur   *chunkJob
+	plain []byte
+	err   error
+}
+
+// newParallelStreamReader continues sr, whose first chunk has been opened already
+func newParallelStreamReader(sr *streamReader, workers int) *parallelStreamReader {
+	p := &parallelStreamReader{
+		sr:    sr,
+		work:  make(chan *chunkJob, workers),
+		queue: make(chan *chunkJob, 2*workers),
+		free:  make(chan *chunkJob, 2*workers+2),
+		stop:  make(chan struct{}),
+		plain: sr.plain,
+	}
+	for i := 0; i < cap(p.free); i++ {
+		p.free <- &chunkJob{data: make([]byte, len(sr.chunk)), buf: make([]byte, 0, cap(sr.buf))}
+	}
+	for i := 0; i < workers; i++ {
+		go p.open()
+	}
+	if sr.done {
+		close(p.work)
+		close(p.queue)
+	} else {
+		go p.read(sr.counter)
+	}
+	return p
+}
+
+func (p *parallelStreamReader) Read(b []byte) (int, error) {
+	for len(p.plain) == 0 {
+		if p.err != nil {
+			return 0, p.err
+		}
+		if p.cur != nil {
+			p.free <- p.cur
+			p.cur = nil
+		}
+		job, ok := <-p.queue
+		if !ok {
+			p.err = io.EOF
+			continue
+		}
+		<-job.done
+		if job.err != nil {
+			p.err = job.err
+			p.Close()
+			continue
+		}
+		p.cur = job
+		p.plain = job.out
+	}
+	n := copy(b, p.plain)
+	p.plain = p.plain[n:]
+	return n, nil
+}
+
+// Close stops reading ahead, for callers that stop before the end of the stream
+func (p *parallelStreamReader) Close() error {
+	p.stopOnce.Do(func() { close(p.stop) })
+	return nil
+}
+
+// read reads chunks in order, queues them for the caller and hands them to workers
+func (p *parallelStreamReader) read(counter uint64) {
+	defer close(p.work)
+	defer close(p.queue)
+	for {
+		var job *chunkJob
+		select {
+		case job = <-p.free:
+		case <-p.stop:
+			return
+		}
+		job.counter, job.out, job.done = counter, nil, make(chan struct{})
+		job.in, job.last, job.err = p.sr.readChunk(job.data, counter)
+		if job.err != nil {
+			close(job.done)
+		}
+
+		select {
+		case p.queue <- job:
+		case <-p.stop:
+			return
+		}
+		if job.err != nil {
+			return
+		}
+		p.work <- job
+		if job.last {
+			return
+		}
+		counter++
+	}
+}
+
+func (p *parallelStreamReader) open() {
+	for job := range p.work {
+		job.out, job.err = p.sr.openChunk(job.buf, job.in, job.counter, job.last)
+		close(job.done)
+	}
+}
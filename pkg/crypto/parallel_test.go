@@ -0,0 +1,202 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+)
+
+var parallelTestKey = []byte("parallel test key")
+
+func parallelTestData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*31 + i>>8)
+	}
+	return data
+}
+
+func encryptStreamForTest(t testing.TB, data []byte, opts *StreamOptions) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewEncryptWriter(&buf, parallelTestKey, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Odd write sizes so chunks are assembled from several writes
+	for p := data; len(p) > 0; {
+		n := min(len(p), 3001)
+		if _, err := w.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decryptStreamForTest(t testing.TB, data []byte, parallelism int) ([]byte, error) {
+	t.Helper()
+	r, err := NewDecryptReader(bytes.NewReader(data), parallelTestKey, &OpenOptions{Parallelism: parallelism})
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+	return io.ReadAll(r)
+}
+
+// Streams written and read on any number of goroutines are interchangeable
+func TestParallelMatchesSerial(t *testing.T) {
+	for _, size := range []int{0, 1, 1024, 1025, 10*1024 + 17} {
+		data := parallelTestData(size)
+		for _, parallelism := range []int{1, 2, 4, 7} {
+			for _, compression := range []CompressionAlgorithm{CompressionNone, CompressionGzip} {
+				opts := &StreamOptions{ChunkSize: 1024, Parallelism: parallelism, EnvelopeOptions: EnvelopeOptions{Compression: compression}}
+				ciphertext := encryptStreamForTest(t, data, opts)
+
+				serial := encryptStreamForTest(t, data, &StreamOptions{ChunkSize: 1024, EnvelopeOptions: EnvelopeOptions{Compression: compression}})
+				if len(serial) != len(ciphertext) {
+					t.Errorf("size %d, parallel %d: %d byte stream, serial writes %d", size, parallelism, len(ciphertext), len(serial))
+				}
+
+				for _, readers := range []int{1, 3} {
+					got, err := decryptStreamForTest(t, ciphertext, readers)
+					if err != nil {
+						t.Fatalf("size %d, parallel %d, %d readers: %v", size, parallelism, readers, err)
+					}
+					if !bytes.Equal(got, data) {
+						t.Errorf("size %d, parallel %d, %d readers: plaintext differs", size, parallelism, readers)
+					}
+				}
+			}
+		}
+	}
+}
+
+type failingWriter struct{ after int }
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if f.after < len(p) {
+		return 0, errors.New("disk full")
+	}
+	f.after -= len(p)
+	return len(p), nil
+}
+
+func TestParallelWriteError(t *testing.T) {
+	w, err := NewEncryptWriter(&failingWriter{after: 5000}, parallelTestKey, &StreamOptions{ChunkSize: 1024, Parallelism: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, werr := w.Write(parallelTestData(64 * 1024))
+	cerr := w.Close()
+	if werr == nil && cerr == nil {
+		t.Fatal("write error was not reported")
+	}
+}
+
+// waitGoroutines waits for the goroutine count to drop back to want
+func waitGoroutines(t *testing.T, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > want {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines still running, want %d", runtime.NumGoroutine(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAbortEncryptWriter(t *testing.T) {
+	for _, opts := range []*StreamOptions{
+		{ChunkSize: 1024, Parallelism: 4},
+		{ChunkSize: 1024, Parallelism: 4, EnvelopeOptions: EnvelopeOptions{Compression: CompressionGzip}},
+		{ChunkSize: 1024, Parallelism: 4, Progress: func(int64) {}},
+		{ChunkSize: 1024},
+	} {
+		before := runtime.NumGoroutine()
+		var buf bytes.Buffer
+		w, err := NewEncryptWriter(&buf, parallelTestKey, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(parallelTestData(20 * 1024)); err != nil {
+			t.Fatal(err)
+		}
+		AbortEncryptWriter(w)
+		waitGoroutines(t, before)
+
+		if _, err := w.Write([]byte("more")); err == nil {
+			t.Error("write after AbortEncryptWriter succeeded")
+		}
+		// Without a last chunk the output is truncated, never a shorter valid stream
+		if _, err := decryptStreamForTest(t, buf.Bytes(), 1); !errors.Is(err, ErrTruncated) {
+			t.Errorf("aborted stream: error = %v, want ErrTruncated", err)
+		}
+	}
+}
+
+func TestParallelReaderClose(t *testing.T) {
+	ciphertext := encryptStreamForTest(t, parallelTestData(64*1024), &StreamOptions{ChunkSize: 1024})
+	before := runtime.NumGoroutine()
+	r, err := NewDecryptReader(bytes.NewReader(ciphertext), parallelTestKey, &OpenOptions{Parallelism: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(r, make([]byte, 3000)); err != nil {
+		t.Fatal(err)
+	}
+	r.(io.Closer).Close()
+	waitGoroutines(t, before)
+}
+
+var benchmarkSizes = []int{64 << 10, 1 << 20, 16 << 20}
+
+func BenchmarkEncryptWriter(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		data := parallelTestData(size)
+		for _, parallelism := range []int{1, 2, 4, 8} {
+			b.Run(fmt.Sprintf("%dKiB/parallel-%d", size>>10, parallelism), func(b *testing.B) {
+				b.SetBytes(int64(size))
+				for i := 0; i < b.N; i++ {
+					w, err := NewEncryptWriter(io.Discard, parallelTestKey, &StreamOptions{Parallelism: parallelism})
+					if err != nil {
+						b.Fatal(err)
+					}
+					w.Write(data)
+					if err := w.Close(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkDecryptReader(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		ciphertext := encryptStreamForTest(b, parallelTestData(size), nil)
+		for _, parallelism := range []int{1, 2, 4, 8} {
+			b.Run(fmt.Sprintf("%dKiB/parallel-%d", size>>10, parallelism), func(b *testing.B) {
+				b.SetBytes(int64(size))
+				for i := 0; i < b.N; i++ {
+					r, err := NewDecryptReader(bytes.NewReader(ciphertext), parallelTestKey, &OpenOptions{Parallelism: parallelism})
+					if err != nil {
+						b.Fatal(err)
+					}
+					if _, err := io.Copy(io.Discard, r); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package crypto
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"unicode"
+)
+
+// passphraseWordData is the BIP-39 English wordlist: 2048 words whose first four
+// letters are unique, so each word adds 11 bits
+//
+//go:embed passphrase_words.txt
+var passphraseWordData string
+
+var passphraseWords = strings.Fields(passphraseWordData)
+
+var passphraseWordSet = func() map[string]bool {
+	set := make(map[string]bool, len(passphraseWords))
+	for _, w := range passphraseWords {
+		set[w] = true
+	}
+	return set
+}()
+
+// DefaultPassphraseWords is the default generated passphrase length, about 66 bits
+const DefaultPassphraseWords = 6
+
+// MinPassphraseEntropy is the estimated entropy in bits below which a passphrase is weak
+const MinPassphraseEntropy = 50
+
+// commonPasswords are passwords that top every leaked password list. A passphrase
+// built on one of them is guessed almost immediately, whatever its length.
+var commonPasswords = map[string]bool{
+	"password": true, "passw0rd": true, "123456": true, "12345678": true, "123456789": true,
+	"1234567890": true, "qwerty": true, "qwertyuiop": true, "abc123": true, "111111": true,
+	"000000": true, "letmein": true, "welcome": true, "admin": true, "administrator": true,
+	"iloveyou": true, "monkey": true, "dragon": true, "master": true, "sunshine": true,
+	"princess": true, "football": true, "baseball": true, "shadow": true, "superman": true,
+	"trustno1": true, "secret": true, "changeme": true, "default": true, "login": true,
+	"starwars": true, "whatever": true, "freedom": true, "hello": true, "test": true,
+}
+
+// wordLetterEntropy is roughly the entropy per letter of English text
+const wordLetterEntropy = 2.5
+
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+// GeneratePassphrase returns words random wordlist words joined by separator
+func GeneratePassphrase(words int, separator string) (string, error) {
+	if words < 1 || words > 64 {
+		return "", fmt.Errorf("word count must be between 1 and 64")
+	}
+
+	max := big.NewInt(int64(len(passphraseWords)))
+	chosen := make([]string, words)
+	for i := range chosen {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate passphrase: %w", err)
+		}
+		chosen[i] = passphraseWords[n.Int64()]
+	}
+	return strings.Join(chosen, separator), nil
+}
+
+// GeneratedPassphraseEntropy returns the entropy in bits of a generated passphrase
+func GeneratedPassphraseEntropy(words int) float64 {
+	return float64(words) * math.Log2(float64(len(passphraseWords)))
+}
+
+// PassphraseStrength is the result of EstimatePassphraseStrength
+type PassphraseStrength struct {
+	// Entropy is a rough estimate of the guessing work in bits
+	Entropy float64
+	// Warnings names the patterns that lowered the estimate
+	Warnings []string
+}
+
+// Weak reports whether the estimate is below MinPassphraseEntropy
+func (s PassphraseStrength) Weak() bool {
+	return s.Entropy < MinPassphraseEntropy
+}
+
+// Rating describes the estimate as very weak, weak, good or strong
+func (s PassphraseStrength) Rating() string {
+	switch {
+	case s.Entropy < 28:
+		return "very weak"
+	case s.Entropy < MinPassphraseEntropy:
+		return "weak"
+	case s.Entropy < 70:
+		return "good"
+	default:
+		return "strong"
+	}
+}
+
+// EstimatePassphraseStrength estimates the entropy of a human-chosen passphrase.
+// It assumes the attacker knows the wordlist and common patterns, so it counts
+// wordlist passphrases by words, and repeats, sequences, keyboard walks, years and
+// common passwords as a few bits each rather than by their length.
+func EstimatePassphraseStrength(passphrase string) PassphraseStrength {
+	if passphrase == "" {
+		return PassphraseStrength{Warnings: []string{"passphrase is empty"}}
+	}
+
+	if strength, ok := estimateCommonPassword(passphrase); ok {
+		return strength
+	}
+
+	if words := strings.FieldsFunc(strings.ToLower(passphrase), func(r rune) bool { return !unicode.IsLetter(r) }); len(words) > 1 {
+		allListed := true
+		for _, w := range words {
+			allListed = allListed && passphraseWordSet[w]
+		}
+		if allListed {
+			strength := PassphraseStrength{Entropy: GeneratedPassphraseEntropy(len(words))}
+			if strength.Weak() {
+				strength.Warnings = append(strength.Warnings, fmt.Sprintf("only %d words; use at least 5", len(words)))
+			}
+			return strength
+		}
+	}
+
+	strength := estimateCharacters(passphrase)
+	if strength.Weak() && len([]rune(passphrase)) < 12 {
+		strength.Warnings = append(strength.Warnings, "shorter than 12 characters")
+	}
+	return strength
+}
+
+// estimateCommonPassword catches a common password, optionally in leetspeak and
+// wrapped in digits or symbols such as "P@ssw0rd123!"
+func estimateCommonPassword(passphrase string) (PassphraseStrength, bool) {
+	lower := strings.ToLower(passphrase)
+	if commonPasswords[lower] {
+		return PassphraseStrength{Entropy: 10, Warnings: []string{"based on a common password"}}, true
+	}
+	// Some common passwords end in digits themselves, such as trustno1, so the
+	// wrapping is tried both as any non-letters and as symbols only
+	for _, wrapping := range []func(rune) bool{
+		func(r rune) bool { return !unicode.IsLetter(r) },
+		func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) },
+	} {
+		core := strings.TrimFunc(lower, wrapping)
+		if core != "" && (commonPasswords[core] || commonPasswords[unleet(core)]) {
+			extra := len([]rune(lower)) - len([]rune(core))
+			return PassphraseStrength{
+				Entropy:  10 + float64(extra)*math.Log2(10),
+				Warnings: []string{"based on a common password"},
+			}, true
+		}
+	}
+	return PassphraseStrength{}, false
+}
+
+func unleet(s string) string {
+	return strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "@", "a", "$", "s", "5", "s", "7", "t").Replace(s)
+}
+
+func estimateCharacters(passphrase string) PassphraseStrength {
+	runes := []rune(passphrase)
+	lower := []rune(strings.ToLower(passphrase))
+	bitsPerChar := math.Log2(characterPoolSize(runes))
+
+	var strength PassphraseStrength
+	separators := make(map[rune]bool)
+	warned := make(map[string]bool)
+	warn := func(w string) {
+		if !warned[w] {
+			warned[w] = true
+			strength.Warnings = append(strength.Warnings, w)
+		}
+	}
+
+	for i := 0; i < len(lower); {
+		if n := wordlistRun(lower, i); n > 0 {
+			strength.Entropy += GeneratedPassphraseEntropy(1)
+			if unicode.IsUpper(runes[i]) {
+				strength.Entropy++
+			}
+			i += n
+			continue
+		}
+		if n := repeatRun(lower, i); n >= 3 {
+			strength.Entropy += bitsPerChar + math.Log2(float64(n))
+			warn("contains repeated characters")
+			i += n
+			continue
+		}
+		// A reversed row such as lkjh starts with a sequence, so the longer match wins
+		walk := keyboardRun(lower, i)
+		if n := sequenceRun(lower, i); n >= 3 && n >= walk {
+			strength.Entropy += bitsPerChar + 1 + math.Log2(float64(n))
+			warn("contains a sequence such as abc or 123")
+			i += n
+			continue
+		}
+		if n := walk; n >= 4 {
+			strength.Entropy += 4 + math.Log2(float64(n))
+			warn("contains a keyboard pattern such as qwerty")
+			i += n
+			continue
+		}
+		if n := wordLikeRun(runes, i); n >= 3 {
+			// Natural-language words carry far less than their character count suggests
+			strength.Entropy += float64(n) * wordLetterEntropy
+			if unicode.IsUpper(runes[i]) {
+				strength.Entropy++
+			}
+			i += n
+			continue
+		}
+		if isYear(lower, i) {
+			strength.Entropy += math.Log2(200)
+			warn("contains a year")
+			i += 4
+			continue
+		}
+		// A separator repeated between words is chosen once
+		if !unicode.IsLetter(lower[i]) && !unicode.IsDigit(lower[i]) && separators[lower[i]] {
+			strength.Entropy++
+		} else {
+			strength.Entropy += bitsPerChar
+		}
+		if !unicode.IsLetter(lower[i]) && !unicode.IsDigit(lower[i]) {
+			separators[lower[i]] = true
+		}
+		i++
+	}
+
+	if allDigits(runes) {
+		warn("only digits")
+	}
+	return strength
+}
+
+func characterPoolSize(runes []rune) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < 0x80:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	pool := 0.0
+	for _, class := range []struct {
+		present bool
+		size    float64
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.present {
+			pool += class.size
+		}
+	}
+	return pool
+}
+
+// wordlistRun returns the length of the letter run starting at i if it is a
+// wordlist word, and 0 otherwise
+func wordlistRun(s []rune, i int) int {
+	if i > 0 && unicode.IsLetter(s[i-1]) {
+		return 0
+	}
+	n := 0
+	for i+n < len(s) && unicode.IsLetter(s[i+n]) {
+		n++
+	}
+	if n < 3 || !passphraseWordSet[string(s[i:i+n])] {
+		return 0
+	}
+	return n
+}
+
+// wordLikeRun returns the length of a lowercase letter run starting at i, allowing
+// a capital first letter, so CamelCase splits into words
+func wordLikeRun(s []rune, i int) int {
+	if i >= len(s) || !unicode.IsLetter(s[i]) || (i > 0 && unicode.IsLower(s[i-1]) && unicode.IsLower(s[i])) {
+		return 0
+	}
+	n := 1
+	for i+n < len(s) && unicode.IsLower(s[i+n]) {
+		n++
+	}
+	return n
+}
+
+func repeatRun(s []rune, i int) int {
+	n := 1
+	for i+n < len(s) && s[i+n] == s[i] {
+		n++
+	}
+	return n
+}
+
+// sequenceRun returns the length of an ascending or descending run of letters or digits
+func sequenceRun(s []rune, i int) int {
+	if i+1 >= len(s) || !isAlnum(s[i]) {
+		return 1
+	}
+	step := s[i+1] - s[i]
+	if step != 1 && step != -1 {
+		return 1
+	}
+	n := 1
+	for i+n < len(s) && isAlnum(s[i+n]) && s[i+n]-s[i+n-1] == step {
+		n++
+	}
+	return n
+}
+
+// keyboardRun returns the length of the longest keyboard row walk starting at i
+func keyboardRun(s []rune, i int) int {
+	best := 0
+	for _, row := range keyboardRows {
+		for _, r := range []string{row, reverseString(row)} {
+			n := 0
+			for i+n < len(s) && strings.Contains(r, string(s[i:i+n+1])) {
+				n++
+			}
+			if n > best {
+				best = n
+			}
+		}
+	}
+	return best
+}
+
+func isYear(s []rune, i int) bool {
+	if i+4 > len(s) || !allDigits(s[i:i+4]) {
+		return false
+	}
+	prefix := string(s[i : i+2])
+	return prefix == "19" || prefix == "20"
+}
+
+func isAlnum(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9')
+}
+
+func allDigits(runes []rune) bool {
+	for _, r := range runes {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return len(runes) > 0
+}
+
+func reverseString(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
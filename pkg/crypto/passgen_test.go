@@ -0,0 +1,136 @@
+package crypto
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func hasWarning(s PassphraseStrength, substr string) bool {
+	for _, w := range s.Warnings {
+		if strings.Contains(w, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestEstimatePassphraseStrength(t *testing.T) {
+	for _, tt := range []struct {
+		passphrase string
+		// min and max bound the estimate
+		min, max float64
+		warning  string
+	}{
+		// Common passwords, in leetspeak and wrapped in digits or symbols
+		{"password", 0, 12, "common password"},
+		{"PASSWORD", 0, 12, "common password"},
+		{"P@ssw0rd", 0, 12, "common password"},
+		{"p4$$w0rd", 0, 12, "common password"},
+		{"P@ssw0rd123!", 0, 28, "common password"},
+		{"letmein2024", 0, 28, "common password"},
+		{"Trustno1!", 0, 28, "common password"},
+		{"qwerty123", 0, 28, "common password"},
+
+		// Wordlist passphrases count by words, however long they are
+		{"abandon ability able", 30, 36, "only 3 words"},
+		{"abandon-ability-able-about-above", 50, 60, ""},
+		{"Abandon Ability Able About Above Absent", 60, 70, ""},
+		{"correct horse battery staple", 50, 70, ""},
+
+		// Keyboard walks
+		{"asdfghjkl", 0, 12, "keyboard pattern"},
+		{"lkjhgfdsa", 0, 12, "keyboard pattern"},
+		{"zxcvbnm", 0, 12, "keyboard pattern"},
+
+		// Years
+		{"1987", 0, 10, "year"},
+		{"Summer1987", 0, 28, "year"},
+		{"bob2019bob", 0, 40, "year"},
+
+		// Repeats and sequences
+		{"aaaaaaaaaaaa", 0, 10, "repeated characters"},
+		{"zzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzz", 0, 12, "repeated characters"},
+		{"abcdefgh", 0, 12, "sequence"},
+		{"98765432", 0, 12, "sequence"},
+		{"12345678987", 0, 20, "only digits"},
+
+		// Random characters
+		{"x9#Lq2!vZ7@mW4$e", 90, 110, ""},
+		{"gH7!", 20, 28, "shorter than 12 characters"},
+	} {
+		s := EstimatePassphraseStrength(tt.passphrase)
+		if s.Entropy < tt.min || s.Entropy > tt.max {
+			t.Errorf("EstimatePassphraseStrength(%q).Entropy = %.1f, want between %v and %v", tt.passphrase, s.Entropy, tt.min, tt.max)
+		}
+		if tt.warning != "" && !hasWarning(s, tt.warning) {
+			t.Errorf("EstimatePassphraseStrength(%q).Warnings = %q, want one about %q", tt.passphrase, s.Warnings, tt.warning)
+		}
+	}
+}
+
+func TestEstimatePassphraseStrengthEmpty(t *testing.T) {
+	s := EstimatePassphraseStrength("")
+	if s.Entropy != 0 || !s.Weak() || len(s.Warnings) == 0 {
+		t.Errorf("EstimatePassphraseStrength(\"\") = %+v", s)
+	}
+}
+
+func TestPassphraseStrengthRating(t *testing.T) {
+	for _, tt := range []struct {
+		entropy float64
+		weak    bool
+		rating  string
+	}{
+		{0, true, "very weak"},
+		{27.9, true, "very weak"},
+		{28, true, "weak"},
+		{MinPassphraseEntropy - 0.1, true, "weak"},
+		{MinPassphraseEntropy, false, "good"},
+		{69.9, false, "good"},
+		{70, false, "strong"},
+		{256, false, "strong"},
+	} {
+		s := PassphraseStrength{Entropy: tt.entropy}
+		if s.Weak() != tt.weak {
+			t.Errorf("PassphraseStrength{%v}.Weak() = %v, want %v", tt.entropy, s.Weak(), tt.weak)
+		}
+		if s.Rating() != tt.rating {
+			t.Errorf("PassphraseStrength{%v}.Rating() = %q, want %q", tt.entropy, s.Rating(), tt.rating)
+		}
+	}
+}
+
+func TestGeneratePassphrase(t *testing.T) {
+	p, err := GeneratePassphrase(DefaultPassphraseWords, "-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := strings.Split(p, "-")
+	if len(words) != DefaultPassphraseWords {
+		t.Fatalf("GeneratePassphrase returned %d words, want %d", len(words), DefaultPassphraseWords)
+	}
+	for _, w := range words {
+		if !passphraseWordSet[w] {
+			t.Errorf("GeneratePassphrase returned %q, which is not a wordlist word", w)
+		}
+	}
+
+	// A generated passphrase is estimated at its real entropy
+	want := GeneratedPassphraseEntropy(DefaultPassphraseWords)
+	if want != float64(DefaultPassphraseWords)*11 {
+		t.Errorf("GeneratedPassphraseEntropy(%d) = %v", DefaultPassphraseWords, want)
+	}
+	if got := EstimatePassphraseStrength(p).Entropy; math.Abs(got-want) > 1e-9 {
+		t.Errorf("EstimatePassphraseStrength(%q).Entropy = %v, want %v", p, got, want)
+	}
+	if EstimatePassphraseStrength(p).Weak() {
+		t.Errorf("generated passphrase %q is rated weak", p)
+	}
+
+	for _, n := range []int{0, -1, 65} {
+		if _, err := GeneratePassphrase(n, " "); err == nil {
+			t.Errorf("GeneratePassphrase(%d) succeeded", n)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+// EncryptWithPassphrase derives an AES-256 key from passphrase with params and
+// encrypts data with AES-256-GCM. The KDF choice, salt and costs are stored in the
+// envelope header, so decryption only needs the passphrase.
+func EncryptWithPassphrase(data, passphrase []byte, params *KDFParams) ([]byte, error) {
+	return encryptWithPassphrase(data, passphrase, params, EnvelopeOptions{})
+}
+
+func encryptWithPassphrase(data, passphrase []byte, params *KDFParams, opts EnvelopeOptions) ([]byte, error) {
+	utils.DebugLogf("EncryptWithPassphrase: encrypting %d bytes with %s", len(data), params.Algorithm)
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase must not be empty")
+	}
+
+	key, err := params.DeriveKey(passphrase, fileKeySize)
+	if err != nil {
+		return nil, err
+	}
+
+	header := &envelopeHeader{Algorithm: EnvelopePassphrase, KDF: params, Nonce: make([]byte, 12)}
+	if _, err := rand.Read(header.Nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	if data, err = opts.apply(header, data); err != nil {
+		return nil, err
+	}
+
+	headerBytes, err := header.marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := sealEnvelopeBody(key, header.Nonce, data, headerBytes)
+	if err != nil {
+		return nil, err
+	}
+	return append(headerBytes, body...), nil
+}
+
+// DecryptWithPassphrase decrypts data produced by EncryptWithPassphrase
+func DecryptWithPassphrase(data, passphrase []byte) ([]byte, error) {
+	utils.DebugLogf("DecryptWithPassphrase: decrypting %d bytes", len(data))
+	header, headerBytes, body, err := parseEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	if header.Algorithm != EnvelopePassphrase || header.KDF == nil {
+		return nil, fmt.Errorf("data was not encrypted with a passphrase")
+	}
+	if err := checkNotAfter(header); err != nil {
+		return nil, err
+	}
+	plaintext, err := openPassphraseEnvelope(header, headerBytes, body, passphrase, DefaultMaxDecompressedSize)
+	if err != nil {
+		return nil, err
+	}
+	_, content, err := splitFileMetadata(header, plaintext)
+	return content, err
+}
+
+func openPassphraseEnvelope(header *envelopeHeader, headerBytes, body, passphrase []byte, maxSize int64) ([]byte, error) {
+	key, err := passphraseBodyKey(header, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if header.ChunkSize != 0 {
+		return openStreamPayload(header, key, body, headerBytes, maxSize)
+	}
+
+	plaintext, err := openEnvelopeBody(key, header.Nonce, body, headerBytes)
+	if err != nil {
+		return nil, fmt.Errorf("wrong passphrase or corrupted data: %w", err)
+	}
+	return finishEnvelopePayload(header, plaintext, maxSize)
+}
+
+// passphraseBodyKey derives the body key from passphrase with the header's KDF parameters
+func passphraseBodyKey(header *envelopeHeader, passphrase []byte) ([]byte, error) {
+	if header.KDF == nil {
+		return nil, fmt.Errorf("passphrase envelope has no KDF parameters")
+	}
+	return header.KDF.DeriveKey(passphrase, fileKeySize)
+}
+
+// PassphraseProvider implements CryptoProvider with a passphrase as the key.
+// Params defaults to Argon2id; a fresh salt is generated for every Encrypt call.
+type PassphraseProvider struct {
+	Params *KDFParams
+	EnvelopeOptions
+}
+
+func (p *PassphraseProvider) Encrypt(data []byte, passphrase []byte) ([]byte, error) {
+	params := p.Params
+	if params == nil {
+		var err error
+		if params, err = NewKDFParams(KDFArgon2id); err != nil {
+			return nil, err
+		}
+	} else {
+		// Never reuse a salt across encryptions
+		fresh := *params
+		fresh.Salt = make([]byte, kdfSaltSize)
+		if _, err := rand.Read(fresh.Salt); err != nil {
+			return nil, fmt.Errorf("failed to generate salt: %w", err)
+		}
+		params = &fresh
+	}
+	return encryptWithPassphrase(data, passphrase, params, p.EnvelopeOptions)
+}
+
+func (p *PassphraseProvider) Decrypt(data []byte, passphrase []byte) ([]byte, error) {
+	return DecryptWithPassphrase(data, passphrase)
+}
+
+// GenerateKey returns 24 random bytes to use as a passphrase
+func (p *PassphraseProvider) GenerateKey() ([]byte, error) {
+	key := make([]byte, 24)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate passphrase: %w", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,53 @@
+package crypto
+
+import "io"
+
+// ProgressFunc is called as a stream is processed with the number of input bytes
+// consumed so far: plaintext written to NewEncryptWriter, or ciphertext (header
+// included) read by NewDecryptReader. It runs on the caller's goroutine after each
+// Write or Read and should return quickly.
+type ProgressFunc func(processed int64)
+
+// progressWriter reports the bytes written through it
+type progressWriter struct {
+	w  io.WriteCloser
+	n  int64
+	fn ProgressFunc
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.n += int64(n)
+	p.fn(p.n)
+	return n, err
+}
+
+func (p *progressWriter) Close() error {
+	return p.w.Close()
+}
+
+func (p *progressWriter) abort() {
+	AbortEncryptWriter(p.w)
+}
+
+// NewProgressReader returns a reader of r that calls fn with the number of bytes
+// read so far after each Read that returns data
+func NewProgressReader(r io.Reader, fn ProgressFunc) io.Reader {
+	return &progressReader{r: r, fn: fn}
+}
+
+// progressReader reports the bytes read through it
+type progressReader struct {
+	r  io.Reader
+	n  int64
+	fn ProgressFunc
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.n += int64(n)
+	if n > 0 {
+		p.fn(p.n)
+	}
+	return n, err
+}
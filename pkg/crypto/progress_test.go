@@ -0,0 +1,106 @@
+package crypto
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"testing/iotest"
+)
+
+// progressRecorder collects the values a ProgressFunc is called with
+type progressRecorder struct {
+	mu     sync.Mutex
+	values []int64
+}
+
+func (p *progressRecorder) update(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.values = append(p.values, n)
+}
+
+// check fails unless the values never decrease and end at want
+func (p *progressRecorder) check(t *testing.T, name string, want int64) {
+	t.Helper()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.values) == 0 {
+		t.Errorf("%s: progress was never reported", name)
+		return
+	}
+	for i := 1; i < len(p.values); i++ {
+		if p.values[i] < p.values[i-1] {
+			t.Errorf("%s: progress went back from %d to %d", name, p.values[i-1], p.values[i])
+		}
+	}
+	if last := p.values[len(p.values)-1]; last != want {
+		t.Errorf("%s: progress ended at %d, want %d", name, last, want)
+	}
+}
+
+func TestEncryptWriterProgress(t *testing.T) {
+	data := parallelTestData(10*streamTestChunkSize + 17)
+	for _, parallelism := range []int{1, 4} {
+		var rec progressRecorder
+		var buf bytes.Buffer
+		w, err := NewEncryptWriter(&buf, parallelTestKey, &StreamOptions{ChunkSize: streamTestChunkSize, Parallelism: parallelism, Progress: rec.update})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Uneven writes, smaller and larger than a chunk
+		for rest := data; len(rest) > 0; {
+			n := min(len(rest), 700+len(rest)%1500)
+			if _, err := w.Write(rest[:n]); err != nil {
+				t.Fatal(err)
+			}
+			rest = rest[n:]
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		rec.check(t, "encrypt", int64(len(data)))
+	}
+}
+
+func TestDecryptReaderProgress(t *testing.T) {
+	data := parallelTestData(10*streamTestChunkSize + 17)
+	stream := encryptStreamForTest(t, data, &StreamOptions{ChunkSize: streamTestChunkSize})
+	single, err := SealEnvelope(&AESGCMProvider{}, data, parallelTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name        string
+		ciphertext  []byte
+		parallelism int
+	}{
+		{"stream", stream, 1},
+		{"parallel stream", stream, 4},
+		{"single envelope", single, 1},
+	} {
+		var rec progressRecorder
+		r, err := NewDecryptReader(iotest.HalfReader(bytes.NewReader(tt.ciphertext)), parallelTestKey, &OpenOptions{Parallelism: tt.parallelism, Progress: rec.update})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("%s: read %d bytes, %v", tt.name, len(got), err)
+		}
+		rec.check(t, tt.name, int64(len(tt.ciphertext)))
+	}
+}
+
+func TestProgressReader(t *testing.T) {
+	var rec progressRecorder
+	got, err := io.ReadAll(NewProgressReader(iotest.OneByteReader(bytes.NewReader([]byte("counted"))), rec.update))
+	if err != nil || string(got) != "counted" {
+		t.Fatalf("read %q, %v", got, err)
+	}
+	if len(rec.values) != len("counted") {
+		t.Errorf("progress reported %v, want once per byte", rec.values)
+	}
+	rec.check(t, "reader", int64(len("counted")))
+}
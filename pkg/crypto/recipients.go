@@ -0,0 +1,410 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+// RecipientType identifies how the file key is wrapped for a recipient
+type RecipientType uint8
+
+const (
+	// RecipientRSA wraps the file key with RSA-OAEP-SHA256
+	RecipientRSA RecipientType = 1
+	// RecipientX25519 wraps the file key with HPKE DHKEM(X25519, HKDF-SHA256)
+	RecipientX25519 RecipientType = 2
+	// RecipientECIES wraps the file key with HPKE DHKEM(P-256, HKDF-SHA256)
+	RecipientECIES RecipientType = 3
+)
+
+func (t RecipientType) String() string {
+	switch t {
+	case RecipientRSA:
+		return "rsa"
+	case RecipientX25519:
+		return "x25519"
+	case RecipientECIES:
+		return "ecies-p256"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+}
+
+// recipientKeyIDSize is the length of the public key fingerprint stored per recipient
+const recipientKeyIDSize = 8
+
+// fileKeySize is the length of the random key that encrypts the body (AES-256)
+const fileKeySize = 32
+
+// recipientLabel binds wrapped keys to this format (OAEP label and HPKE info)
+var recipientLabel = []byte("thanhlv-ed recipient")
+
+// ErrNoMatchingRecipient is returned when the private key is not one of the recipients
+var ErrNoMatchingRecipient = errors.New("no recipient matches the given private key")
+
+// Recipient is a public key that a file can be encrypted to
+type Recipient struct {
+	Type  RecipientType
+	KeyID []byte
+
+	rsaKey  *rsa.PublicKey
+	ecdhKey *ecdh.PublicKey
+}
+
+type recipientStanza struct {
+	Type  RecipientType
+	KeyID []byte
+	Data  []byte
+}
+
+// identity is a private key that may unwrap one of the recipient stanzas
+type identity struct {
+	Type  RecipientType
+	KeyID []byte
+
+	rsaKey  *rsa.PrivateKey
+	ecdhKey *ecdh.PrivateKey
+}
+
+// ParseRecipient parses a recipient public key: an RSA, X25519 or P-256 (ECIES) key
+// in PKIX PEM form, or a raw X25519 (32 bytes) or uncompressed P-256 (65 bytes) key
+func ParseRecipient(key []byte) (*Recipient, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		switch {
+		case len(key) == 32:
+			pub, err := ecdh.X25519().NewPublicKey(key)
+			if err != nil {
+				return nil, fmt.Errorf("invalid X25519 public key: %w", err)
+			}
+			return newECDHRecipient(pub)
+		case len(key) == 65 && key[0] == 4:
+			pub, err := ecdh.P256().NewPublicKey(key)
+			if err != nil {
+				return nil, fmt.Errorf("invalid P-256 public key: %w", err)
+			}
+			return newECDHRecipient(pub)
+		default:
+			return nil, fmt.Errorf("failed to decode PEM block containing public key")
+		}
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		keyID, err := recipientKeyID(k)
+		if err != nil {
+			return nil, err
+		}
+		return &Recipient{Type: RecipientRSA, KeyID: keyID, rsaKey: k}, nil
+	case *ecdh.PublicKey:
+		return newECDHRecipient(k)
+	case *ecdsa.PublicKey:
+		ecdhKey, err := k.ECDH()
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert public key: %w", err)
+		}
+		return newECDHRecipient(ecdhKey)
+	default:
+		return nil, fmt.Errorf("unsupported recipient key type %T", pub)
+	}
+}
+
+func newECDHRecipient(pub *ecdh.PublicKey) (*Recipient, error) {
+	recipientType, err := ecdhRecipientType(pub.Curve())
+	if err != nil {
+		return nil, err
+	}
+	keyID, err := recipientKeyID(pub)
+	if err != nil {
+		return nil, err
+	}
+	return &Recipient{Type: recipientType, KeyID: keyID, ecdhKey: pub}, nil
+}
+
+func ecdhRecipientType(curve ecdh.Curve) (RecipientType, error) {
+	switch curve {
+	case ecdh.X25519():
+		return RecipientX25519, nil
+	case ecdh.P256():
+		return RecipientECIES, nil
+	default:
+		return 0, fmt.Errorf("unsupported recipient curve %v", curve)
+	}
+}
+
+func recipientSuite(recipientType RecipientType) HPKESuite {
+	suite := HPKESuite{KEM: KEMX25519HKDFSHA256, KDF: KDFHKDFSHA256, AEAD: AEADAES128GCM}
+	if recipientType == RecipientECIES {
+		suite.KEM = KEMP256HKDFSHA256
+	}
+	return suite
+}
+
+// recipientKeyID is the truncated SHA-256 of the PKIX encoding of the public key
+func recipientKeyID(pub interface{}) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	sum := sha256.Sum256(der)
+	return sum[:recipientKeyIDSize], nil
+}
+
+func (r *Recipient) wrap(fileKey []byte) (recipientStanza, error) {
+	stanza := recipientStanza{Type: r.Type, KeyID: r.KeyID}
+
+	switch r.Type {
+	case RecipientRSA:
+		wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, r.rsaKey, fileKey, recipientLabel)
+		if err != nil {
+			return stanza, fmt.Errorf("failed to wrap key for RSA recipient: %w", err)
+		}
+		stanza.Data = wrapped
+	case RecipientX25519, RecipientECIES:
+		enc, wrapped, err := HPKESeal(recipientSuite(r.Type), r.ecdhKey.Bytes(), recipientLabel, r.KeyID, fileKey, nil)
+		if err != nil {
+			return stanza, fmt.Errorf("failed to wrap key for %s recipient: %w", r.Type, err)
+		}
+		stanza.Data = append(enc, wrapped...)
+	default:
+		return stanza, fmt.Errorf("unsupported recipient type %s", r.Type)
+	}
+
+	return stanza, nil
+}
+
+func (s recipientStanza) marshal() []byte {
+	out := append([]byte{byte(s.Type)}, s.KeyID...)
+	return append(out, s.Data...)
+}
+
+func parseRecipientStanza(value []byte) (recipientStanza, error) {
+	if len(value) < 1+recipientKeyIDSize {
+		return recipientStanza{}, fmt.Errorf("recipient entry is truncated")
+	}
+	return recipientStanza{
+		Type:  RecipientType(value[0]),
+		KeyID: value[1 : 1+recipientKeyIDSize],
+		Data:  value[1+recipientKeyIDSize:],
+	}, nil
+}
+
+// parseIdentities parses a private key in PEM form (PKCS#1, PKCS#8 or SEC 1) or a
+// raw 32-byte key, which may be either an X25519 or a P-256 scalar
+func parseIdentities(key []byte) ([]identity, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("failed to decode PEM block containing private key")
+		}
+		var identities []identity
+		for _, curve := range []ecdh.Curve{ecdh.X25519(), ecdh.P256()} {
+			if priv, err := curve.NewPrivateKey(key); err == nil {
+				id, err := newECDHIdentity(priv)
+				if err != nil {
+					return nil, err
+				}
+				identities = append(identities, id)
+			}
+		}
+		if len(identities) == 0 {
+			return nil, fmt.Errorf("invalid raw private key")
+		}
+		return identities, nil
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		keyID, err := recipientKeyID(&k.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		return []identity{{Type: RecipientRSA, KeyID: keyID, rsaKey: k}}, nil
+	case *ecdh.PrivateKey:
+		id, err := newECDHIdentity(k)
+		return []identity{id}, err
+	case *ecdsa.PrivateKey:
+		ecdhKey, err := k.ECDH()
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert private key: %w", err)
+		}
+		id, err := newECDHIdentity(ecdhKey)
+		return []identity{id}, err
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+}
+
+func newECDHIdentity(priv *ecdh.PrivateKey) (identity, error) {
+	recipientType, err := ecdhRecipientType(priv.Curve())
+	if err != nil {
+		return identity{}, err
+	}
+	keyID, err := recipientKeyID(priv.PublicKey())
+	if err != nil {
+		return identity{}, err
+	}
+	return identity{Type: recipientType, KeyID: keyID, ecdhKey: priv}, nil
+}
+
+func (id identity) unwrap(stanza recipientStanza) ([]byte, error) {
+	switch id.Type {
+	case RecipientRSA:
+		return rsa.DecryptOAEP(sha256.New(), nil, id.rsaKey, stanza.Data, recipientLabel)
+	case RecipientX25519, RecipientECIES:
+		encSize := len(id.ecdhKey.PublicKey().Bytes())
+		if len(stanza.Data) < encSize {
+			return nil, fmt.Errorf("wrapped key is truncated")
+		}
+		return HPKEOpen(recipientSuite(id.Type), stanza.Data[:encSize], id.ecdhKey.Bytes(), recipientLabel, stanza.KeyID, stanza.Data[encSize:], nil)
+	default:
+		return nil, fmt.Errorf("unsupported recipient type %s", id.Type)
+	}
+}
+
+// EncryptForRecipients encrypts data under a random file key and wraps that key once
+// per recipient, so any one of the recipients' private keys can decrypt it
+func EncryptForRecipients(data []byte, recipients []*Recipient) ([]byte, error) {
+	return encryptForRecipients(data, recipients, EnvelopeOptions{})
+}
+
+func encryptForRecipients(data []byte, recipients []*Recipient, opts EnvelopeOptions) ([]byte, error) {
+	utils.DebugLogf("EncryptForRecipients: encrypting %d bytes for %d recipients", len(data), len(recipients))
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("at least one recipient is required")
+	}
+
+	fileKey := make([]byte, fileKeySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, fmt.Errorf("failed to generate file key: %w", err)
+	}
+
+	header := &envelopeHeader{Algorithm: EnvelopeMultiRecipient, Nonce: make([]byte, 12)}
+	if _, err := rand.Read(header.Nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	data, err := opts.apply(header, data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, recipient := range recipients {
+		stanza, err := recipient.wrap(fileKey)
+		if err != nil {
+			return nil, err
+		}
+		header.Recipients = append(header.Recipients, stanza)
+	}
+
+	headerBytes, err := header.marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := sealEnvelopeBody(fileKey, header.Nonce, data, headerBytes)
+	if err != nil {
+		return nil, err
+	}
+	return append(headerBytes, body...), nil
+}
+
+// DecryptForRecipient decrypts data produced by EncryptForRecipients with one recipient's private key
+func DecryptForRecipient(data []byte, privateKey []byte) ([]byte, error) {
+	utils.DebugLogf("DecryptForRecipient: decrypting %d bytes", len(data))
+	header, headerBytes, body, err := parseEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	if header.Algorithm != EnvelopeMultiRecipient {
+		return nil, fmt.Errorf("data is not a multi-recipient envelope")
+	}
+	if err := checkNotAfter(header); err != nil {
+		return nil, err
+	}
+	plaintext, err := openRecipientEnvelope(header, headerBytes, body, privateKey, DefaultMaxDecompressedSize)
+	if err != nil {
+		return nil, err
+	}
+	_, content, err := splitFileMetadata(header, plaintext)
+	return content, err
+}
+
+func openRecipientEnvelope(header *envelopeHeader, headerBytes, body, privateKey []byte, maxSize int64) ([]byte, error) {
+	fileKey, err := recipientFileKey(header, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return openEnvelopePayload(header, fileKey, body, headerBytes, maxSize)
+}
+
+// recipientFileKey unwraps the file key from the stanza addressed to privateKey
+func recipientFileKey(header *envelopeHeader, privateKey []byte) ([]byte, error) {
+	identities, err := parseIdentities(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range identities {
+		for _, stanza := range header.Recipients {
+			if stanza.Type != id.Type || string(stanza.KeyID) != string(id.KeyID) {
+				continue
+			}
+			utils.DebugLogf("DecryptForRecipient: unwrapping file key for %s recipient %x", stanza.Type, stanza.KeyID)
+			fileKey, err := id.unwrap(stanza)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unwrap file key: %w", err)
+			}
+			return fileKey, nil
+		}
+	}
+
+	return nil, ErrNoMatchingRecipient
+}
+
+// MultiRecipientProvider implements CryptoProvider on top of EncryptForRecipients.
+// Encrypt ignores its key argument and uses Recipients; Decrypt takes a private key.
+type MultiRecipientProvider struct {
+	Recipients []*Recipient
+	EnvelopeOptions
+}
+
+func (m *MultiRecipientProvider) Encrypt(data []byte, key []byte) ([]byte, error) {
+	return encryptForRecipients(data, m.Recipients, m.EnvelopeOptions)
+}
+
+func (m *MultiRecipientProvider) Decrypt(data []byte, key []byte) ([]byte, error) {
+	return DecryptForRecipient(data, key)
+}
+
+func (m *MultiRecipientProvider) GenerateKey() ([]byte, error) {
+	privateKeyPEM, _, err := GenerateHPKEKeyPair(recipientSuite(RecipientX25519))
+	return privateKeyPEM, err
+}
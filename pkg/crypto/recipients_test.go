@@ -0,0 +1,208 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+)
+
+type recipientTestKey struct {
+	name    string
+	private []byte
+	public  []byte
+	typ     RecipientType
+}
+
+// recipientTestKeys returns one key of every supported type and encoding
+func recipientTestKeys(t *testing.T) []recipientTestKey {
+	t.Helper()
+	var keys []recipientTestKey
+
+	rsaPrivate, rsaPublic, err := GenerateRSAKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys = append(keys, recipientTestKey{"rsa", rsaPrivate, rsaPublic, RecipientRSA})
+
+	for _, r := range []RecipientType{RecipientX25519, RecipientECIES} {
+		private, public, err := GenerateHPKEKeyPair(recipientSuite(r))
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, recipientTestKey{r.String() + " pem", private, public, r})
+	}
+
+	raw, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys = append(keys, recipientTestKey{"x25519 raw", raw.Bytes(), raw.PublicKey().Bytes(), RecipientX25519})
+
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec1, err := x509.MarshalECPrivateKey(ec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPublic, err := x509.MarshalPKIXPublicKey(&ec.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys = append(keys, recipientTestKey{
+		"ecdsa sec1",
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: ecPublic}),
+		RecipientECIES,
+	})
+	return keys
+}
+
+func TestMultiRecipientRoundTrip(t *testing.T) {
+	keys := recipientTestKeys(t)
+	var recipients []*Recipient
+	for _, k := range keys {
+		r, err := ParseRecipient(k.public)
+		if err != nil {
+			t.Fatalf("%s: ParseRecipient: %v", k.name, err)
+		}
+		if r.Type != k.typ || len(r.KeyID) != recipientKeyIDSize {
+			t.Errorf("%s: recipient type %s with %d byte key id", k.name, r.Type, len(r.KeyID))
+		}
+		recipients = append(recipients, r)
+	}
+
+	plaintext := []byte("for every recipient")
+	ciphertext, err := EncryptForRecipients(plaintext, recipients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range keys {
+		got, err := DecryptForRecipient(ciphertext, k.private)
+		if err != nil || !bytes.Equal(got, plaintext) {
+			t.Errorf("%s: DecryptForRecipient = %q, %v", k.name, got, err)
+		}
+	}
+
+	// Each recipient alone
+	for i, k := range keys {
+		single, err := EncryptForRecipients(plaintext, recipients[i:i+1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := DecryptForRecipient(single, k.private); err != nil || !bytes.Equal(got, plaintext) {
+			t.Errorf("%s alone: DecryptForRecipient = %q, %v", k.name, got, err)
+		}
+		other := keys[(i+1)%len(keys)]
+		if _, err := DecryptForRecipient(single, other.private); !errors.Is(err, ErrNoMatchingRecipient) {
+			t.Errorf("%s alone, opened with %s: error = %v, want ErrNoMatchingRecipient", k.name, other.name, err)
+		}
+	}
+}
+
+func TestMultiRecipientProvider(t *testing.T) {
+	private, err := (&MultiRecipientProvider{}).GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := ParseECDHPrivateKey(private, ecdh.X25519())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, err := ParseRecipient(priv.PublicKey().Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &MultiRecipientProvider{Recipients: []*Recipient{recipient}}
+	ciphertext, err := provider.Encrypt([]byte("provider"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := provider.Decrypt(ciphertext, private); err != nil || string(got) != "provider" {
+		t.Errorf("Decrypt = %q, %v", got, err)
+	}
+	if _, err := (&MultiRecipientProvider{}).Encrypt([]byte("nobody"), nil); err == nil {
+		t.Error("Encrypt without recipients succeeded")
+	}
+}
+
+func TestMultiRecipientTampered(t *testing.T) {
+	keys := recipientTestKeys(t)[1:3]
+	var recipients []*Recipient
+	for _, k := range keys {
+		r, err := ParseRecipient(k.public)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recipients = append(recipients, r)
+	}
+	ciphertext, err := EncryptForRecipients([]byte("tamper with me"), recipients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, _, body, err := parseEnvelope(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A changed wrapped key does not unwrap
+	header.Recipients[0].Data = append([]byte{}, header.Recipients[0].Data...)
+	header.Recipients[0].Data[len(header.Recipients[0].Data)-1] ^= 1
+	headerBytes, err := header.marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecryptForRecipient(append(headerBytes, body...), keys[0].private); err == nil {
+		t.Error("changed wrapped key was accepted")
+	}
+	// and although the other recipient's stanza still unwraps, the header is
+	// authenticated with the body
+	if _, err := DecryptForRecipient(append(headerBytes, body...), keys[1].private); err == nil {
+		t.Error("changed header was accepted")
+	}
+
+	tamperedBody := append([]byte{}, ciphertext...)
+	tamperedBody[len(tamperedBody)-1] ^= 1
+	for _, k := range keys {
+		if _, err := DecryptForRecipient(tamperedBody, k.private); err == nil {
+			t.Errorf("%s: changed body was accepted", k.name)
+		}
+	}
+}
+
+func TestRecipientErrors(t *testing.T) {
+	if _, err := EncryptForRecipients([]byte("x"), nil); err == nil {
+		t.Error("EncryptForRecipients without recipients succeeded")
+	}
+	for name, key := range map[string][]byte{
+		"empty":       nil,
+		"short raw":   make([]byte, 31),
+		"not a point": append([]byte{4}, make([]byte, 64)...),
+		"garbage pem": []byte("-----BEGIN PUBLIC KEY-----\nAAAA\n-----END PUBLIC KEY-----\n"),
+	} {
+		if _, err := ParseRecipient(key); err == nil {
+			t.Errorf("%s: ParseRecipient succeeded", name)
+		}
+	}
+
+	// Not a multi-recipient envelope
+	sealed, err := SealEnvelope(&AESGCMProvider{}, []byte("x"), parallelTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := recipientTestKeys(t)
+	if _, err := DecryptForRecipient(sealed, keys[1].private); err == nil {
+		t.Error("DecryptForRecipient of a symmetric envelope succeeded")
+	}
+	if _, err := DecryptForRecipient(sealed, []byte("not a key")); err == nil {
+		t.Error("DecryptForRecipient with an invalid key succeeded")
+	}
+}
@@ -0,0 +1,99 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+// An interrupted streamed encryption can continue after its last full chunk: the
+// header in the partial output holds the salt, so the chunk key is derived again
+// from the key and the chunk counter carries on. No key material has to be saved.
+// Multi-recipient streams cannot be resumed, as their file key is only stored
+// wrapped for the recipients, nor compressed ones, whose compressor state is lost.
+
+// ResumePoint says where a resumed encryption continues
+type ResumePoint struct {
+	// Offset is the size of the partial output to keep; anything after it is to be
+	// cut off before writing
+	Offset int64
+	// Plaintext is the number of plaintext bytes in the kept chunks
+	Plaintext int64
+	// LastChunk is the plaintext of the last kept chunk, for checking that the
+	// input has not changed since
+	LastChunk []byte
+}
+
+// ErrNothingToResume is returned by ResumeEncryptWriter when the partial output
+// holds no complete chunk, so the encryption has to start over
+var ErrNothingToResume = errors.New("partial output has no complete chunk to resume after")
+
+// ResumeEncryptWriter continues a stream of which NewEncryptWriter had written the
+// first size bytes to partial when it was interrupted. It opens the last full chunk
+// within them to check the key, and the returned writer seals the plaintext from
+// ResumePoint.Plaintext on into w, which must be positioned at ResumePoint.Offset.
+// Chunk size, expiry, algorithm and whether file metadata was stored come from the
+// partial header; of opts only Parallelism and Progress are used.
+func ResumeEncryptWriter(w io.Writer, partial io.ReaderAt, size int64, key []byte, opts *StreamOptions) (io.WriteCloser, *ResumePoint, error) {
+	if opts == nil {
+		opts = &StreamOptions{}
+	}
+	header, headerBytes, err := readEnvelopeHeader(io.NewSectionReader(partial, 0, size))
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case header.ChunkSize == 0:
+		return nil, nil, fmt.Errorf("partial output is not a streamed envelope")
+	case header.Compression != CompressionNone:
+		return nil, nil, fmt.Errorf("compressed streams cannot be resumed")
+	case header.Algorithm == EnvelopeMultiRecipient:
+		return nil, nil, fmt.Errorf("streams for recipients cannot be resumed; their file key is not stored")
+	}
+	bodyKey, err := streamBodyKey(header, key, &OpenOptions{IgnoreExpiry: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := newStreamAEAD(bodyKey, header.Nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	chunkSize := int(header.ChunkSize)
+	sealed := int64(chunkSize + aead.Overhead())
+	chunks := uint64((size - int64(len(headerBytes))) / sealed)
+	last := make([]byte, sealed)
+	var plaintext []byte
+	for {
+		if chunks == 0 {
+			return nil, nil, ErrNothingToResume
+		}
+		offset := int64(len(headerBytes)) + int64(chunks-1)*sealed
+		if _, err := partial.ReadAt(last, offset); err != nil {
+			return nil, nil, fmt.Errorf("failed to read chunk %d: %w", chunks-1, err)
+		}
+		if plaintext, err = aead.Open(nil, streamNonce(chunks-1, false), last, headerBytes); err == nil {
+			break
+		}
+		// A full last chunk is there if the run stopped after sealing it; it is
+		// sealed again when the input ends
+		if _, err := aead.Open(nil, streamNonce(chunks-1, true), last, headerBytes); err != nil {
+			return nil, nil, fmt.Errorf("failed to decrypt chunk %d: wrong key or corrupted data", chunks-1)
+		}
+		chunks--
+	}
+	utils.DebugLogf("ResumeEncryptWriter: %s stream resumed after %d chunks", header.Algorithm, chunks)
+
+	sw, err := newStreamWriter(w, aead, headerBytes, chunkSize, chunks, &StreamOptions{Parallelism: opts.Parallelism})
+	if err != nil {
+		return nil, nil, err
+	}
+	point := &ResumePoint{
+		Offset:    int64(len(headerBytes)) + int64(chunks)*sealed,
+		Plaintext: int64(chunks) * int64(chunkSize),
+		LastChunk: plaintext,
+	}
+	return withProgress(sw, opts.Progress), point, nil
+}
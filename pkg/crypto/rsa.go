@@ -14,9 +14,6 @@ type RSAProvider struct{}
 
 func (r *RSAProvider) Encrypt(data []byte, key []byte) ([]byte, error) {
 	utils.DebugLogf("RSAProvider.Encrypt: encrypting %d bytes of data", len(data))
-	// Apply byte transfer to the original data before RSA encryption
-	transferredData := ApplyByteTransfer(data, key)
-
 	block, _ := pem.Decode(key)
 	if block == nil {
 		return nil, fmt.Errorf("failed to decode PEM block containing public key")
@@ -32,6 +29,13 @@ func (r *RSAProvider) Encrypt(data []byte, key []byte) ([]byte, error) {
 		return nil, fmt.Errorf("key is not an RSA public key")
 	}
 
+	// Apply byte transfer to the original data before RSA encryption
+	transferKey, err := rsaTransferKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	transferredData := ApplyByteTransfer(data, transferKey)
+
 	// For large data, we need to chunk it since RSA has size limitations
 	maxChunkSize := publicKey.Size() - 2*sha256.Size - 2
 	var encryptedData []byte
@@ -99,11 +103,26 @@ func (r *RSAProvider) Decrypt(data []byte, key []byte) ([]byte, error) {
 	}
 
 	// Reverse the byte transfer applied during encryption
-	finalResult := ReverseByteTransfer(decryptedData, key)
+	transferKey, err := rsaTransferKey(&privateKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	finalResult := ReverseByteTransfer(decryptedData, transferKey)
 
 	return finalResult, nil
 }
 
+// rsaTransferKey is the byte transfer key of an RSA key pair. Encryption only has
+// the public key and decryption only the private key, so both use the DER encoding
+// of the public key rather than the PEM they were given.
+func rsaTransferKey(publicKey *rsa.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	return der, nil
+}
+
 func (r *RSAProvider) GenerateKey() ([]byte, error) {
 	utils.DebugLog("RSAProvider.GenerateKey: generating new RSA key pair")
 	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
@@ -0,0 +1,36 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Bare RSA output, as written with --legacy, round trips past the 11 bytes that the
+// public and private PEM headers have in common, and across OAEP chunks
+func TestRSALegacyRoundTrip(t *testing.T) {
+	private, public, err := GenerateRSAKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPrivate, _, err := GenerateRSAKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &RSAProvider{}
+	for _, n := range []int{0, 1, 11, 12, 100, 190, 191, 1000} {
+		data := parallelTestData(n)
+		ciphertext, err := provider.Encrypt(data, public)
+		if err != nil {
+			t.Fatalf("%d bytes: Encrypt: %v", n, err)
+		}
+		got, err := provider.Decrypt(ciphertext, private)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%d bytes: Decrypt = %x, %v", n, got, err)
+		}
+		if n > 0 {
+			if _, err := provider.Decrypt(ciphertext, otherPrivate); err == nil {
+				t.Errorf("%d bytes: decrypted with another private key", n)
+			}
+		}
+	}
+}
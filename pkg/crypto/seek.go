@@ -0,0 +1,203 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+// Chunks of a streamed envelope all have the same size except the last, so the
+// position of chunk i follows from the header size and the chunk size, and the
+// number of chunks from the size of the whole file. SeekableReader opens only the
+// chunks a read needs. Each one is still authenticated with its counter, so a chunk
+// moved to another position fails, and the last chunk is opened up front so a file
+// cut at a chunk boundary is reported before any read.
+
+// SeekableReader decrypts a streamed envelope at random offsets. It implements
+// io.ReaderAt, with ReadAt safe for concurrent use, and io.ReadSeeker. Offsets
+// count from the start of the content, after any file metadata.
+type SeekableReader struct {
+	r          io.ReaderAt
+	sr         *streamReader
+	bodyOffset int64
+	chunkSize  int64
+	chunks     int64
+	lastSize   int64
+	// contentOffset is the size of the file metadata in front of the content
+	contentOffset int64
+	size          int64
+	meta          *FileMetadata
+
+	// mu guards the decrypted chunk kept in sr.buf and the chunk buffer sr.chunk
+	mu     sync.Mutex
+	cached int64
+	plain  []byte
+
+	offset int64
+}
+
+// NewDecryptReaderAt opens the streamed envelope of size bytes in r for random access.
+// Compressed streams cannot be read at an offset without decompressing everything
+// before it, and envelopes without chunks have a single tag over the whole body, so
+// both are rejected.
+func NewDecryptReaderAt(r io.ReaderAt, size int64, key []byte, opts *OpenOptions) (*SeekableReader, error) {
+	header, headerBytes, err := readEnvelopeHeader(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+	if header.ChunkSize == 0 {
+		return nil, fmt.Errorf("random access needs a streamed envelope")
+	}
+	if header.Compression != CompressionNone {
+		return nil, fmt.Errorf("compressed streams cannot be read at random offsets")
+	}
+	if header.Padding.Kind != PaddingNone {
+		return nil, fmt.Errorf("streamed envelopes cannot be padded")
+	}
+	if opts == nil {
+		opts = &OpenOptions{}
+	}
+	bodyKey, err := streamBodyKey(header, key, opts)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newStreamAEAD(bodyKey, header.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	overhead := int64(aead.Overhead())
+	bodyOffset := int64(len(headerBytes))
+	bodySize := size - bodyOffset
+	if bodySize < overhead {
+		return nil, ErrTruncated
+	}
+	s := &SeekableReader{
+		r: r,
+		sr: &streamReader{
+			aead:  aead,
+			ad:    headerBytes,
+			chunk: make([]byte, int(header.ChunkSize)+aead.Overhead()),
+			buf:   make([]byte, 0, int(header.ChunkSize)),
+		},
+		bodyOffset: bodyOffset,
+		chunkSize:  int64(header.ChunkSize),
+		chunks:     (bodySize + int64(header.ChunkSize) + overhead - 1) / (int64(header.ChunkSize) + overhead),
+		cached:     -1,
+	}
+	s.lastSize = bodySize - (s.chunks-1)*(s.chunkSize+overhead) - overhead
+	if s.lastSize < 0 {
+		return nil, fmt.Errorf("%w: chunk %d is incomplete", ErrTruncated, s.chunks-1)
+	}
+	s.size = (s.chunks-1)*s.chunkSize + s.lastSize
+
+	// Opening the first chunk checks the key, so that the last chunk failing to open
+	// means that something was cut off the end
+	if s.chunks > 1 {
+		if _, err := s.chunk(0); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := s.chunk(s.chunks - 1); err != nil {
+		return nil, err
+	}
+	if header.Flags&EnvelopeFlagFileMetadata != 0 {
+		if s.meta, s.contentOffset, err = ReadFileMetadataAt(s, s.size); err != nil {
+			return nil, err
+		}
+		s.size -= s.contentOffset
+	}
+	utils.DebugLogf("NewDecryptReaderAt: %d chunks, %d bytes of plaintext", s.chunks, s.size)
+	return s, nil
+}
+
+// Size returns the size of the decrypted content
+func (s *SeekableReader) Size() int64 {
+	return s.size
+}
+
+// FileMetadata returns the file metadata stored in front of the content, or nil
+func (s *SeekableReader) FileMetadata() *FileMetadata {
+	return s.meta
+}
+
+// chunk returns the plaintext of chunk i, which is only valid while s.mu is held
+// or until the next call
+func (s *SeekableReader) chunk(i int64) ([]byte, error) {
+	if i == s.cached {
+		return s.plain, nil
+	}
+	last := i == s.chunks-1
+	n := s.chunkSize + int64(s.sr.aead.Overhead())
+	if last {
+		n = s.lastSize + int64(s.sr.aead.Overhead())
+	}
+	ciphertext := s.sr.chunk[:n]
+	if _, err := s.r.ReadAt(ciphertext, s.bodyOffset+i*(s.chunkSize+int64(s.sr.aead.Overhead()))); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to read chunk %d: %w", i, err)
+	}
+	plaintext, err := s.sr.openChunk(s.sr.buf, ciphertext, uint64(i), last)
+	if err != nil {
+		s.cached = -1
+		return nil, err
+	}
+	s.cached, s.plain = i, plaintext
+	return plaintext, nil
+}
+
+// ReadAt decrypts len(p) bytes starting at offset off of the plaintext
+func (s *SeekableReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for n < len(p) {
+		if off >= s.size {
+			return n, io.EOF
+		}
+		pos := s.contentOffset + off
+		plaintext, err := s.chunk(pos / s.chunkSize)
+		if err != nil {
+			return n, err
+		}
+		copied := copy(p[n:], plaintext[pos%s.chunkSize:])
+		n += copied
+		off += int64(copied)
+	}
+	return n, nil
+}
+
+func (s *SeekableReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n, err := s.ReadAt(p, s.offset)
+	s.offset += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (s *SeekableReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.offset
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset %d", offset)
+	}
+	s.offset = offset
+	return offset, nil
+}
@@ -0,0 +1,228 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+)
+
+const seekTestChunkSize = 1024
+
+// seekTestStream returns a plaintext of 5.5 chunks and its stream, with file
+// metadata in front of the content if meta is set
+func seekTestStream(t *testing.T, meta *FileMetadata) ([]byte, []byte) {
+	t.Helper()
+	plaintext := parallelTestData(5*seekTestChunkSize + seekTestChunkSize/2)
+	opts := &StreamOptions{ChunkSize: seekTestChunkSize, EnvelopeOptions: EnvelopeOptions{FileMetadata: meta}}
+	return plaintext, encryptStreamForTest(t, plaintext, opts)
+}
+
+func newSeekTestReader(t *testing.T, data []byte) (*SeekableReader, error) {
+	t.Helper()
+	return NewDecryptReaderAt(bytes.NewReader(data), int64(len(data)), parallelTestKey, nil)
+}
+
+func TestSeekableReaderReadAt(t *testing.T) {
+	for _, meta := range []*FileMetadata{nil, testFileMetadata} {
+		plaintext, data := seekTestStream(t, meta)
+		s, err := newSeekTestReader(t, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Size() != int64(len(plaintext)) {
+			t.Fatalf("Size = %d, want %d", s.Size(), len(plaintext))
+		}
+
+		for _, r := range []struct{ off, n int }{
+			{0, 1},
+			{0, seekTestChunkSize},
+			{seekTestChunkSize - 1, 2},
+			{seekTestChunkSize - 10, seekTestChunkSize + 20},
+			{100, 3*seekTestChunkSize + 5},
+			{2 * seekTestChunkSize, seekTestChunkSize},
+			{5 * seekTestChunkSize, seekTestChunkSize / 2},
+			{len(plaintext) - 1, 1},
+			{0, len(plaintext)},
+		} {
+			p := make([]byte, r.n)
+			n, err := s.ReadAt(p, int64(r.off))
+			if err != nil || n != r.n {
+				t.Errorf("metadata %v: ReadAt(%d, %d) = %d, %v", meta != nil, r.off, r.n, n, err)
+			}
+			if !bytes.Equal(p[:n], plaintext[r.off:r.off+n]) {
+				t.Errorf("metadata %v: ReadAt(%d, %d) returned the wrong bytes", meta != nil, r.off, r.n)
+			}
+		}
+	}
+}
+
+func TestSeekableReaderEOF(t *testing.T) {
+	plaintext, data := seekTestStream(t, nil)
+	s, err := newSeekTestReader(t, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := int64(len(plaintext))
+
+	// At the end
+	if n, err := s.ReadAt(make([]byte, 10), size); n != 0 || err != io.EOF {
+		t.Errorf("ReadAt at EOF = %d, %v, want 0, EOF", n, err)
+	}
+	if n, err := s.ReadAt(nil, size); n != 0 || err != nil {
+		t.Errorf("empty ReadAt at EOF = %d, %v", n, err)
+	}
+	// Past the end
+	if n, err := s.ReadAt(make([]byte, 10), size+100); n != 0 || err != io.EOF {
+		t.Errorf("ReadAt past EOF = %d, %v, want 0, EOF", n, err)
+	}
+	// Across the end
+	p := make([]byte, 100)
+	n, err := s.ReadAt(p, size-10)
+	if n != 10 || err != io.EOF || !bytes.Equal(p[:n], plaintext[size-10:]) {
+		t.Errorf("ReadAt across EOF = %d, %v", n, err)
+	}
+	if _, err := s.ReadAt(p, -1); err == nil {
+		t.Error("ReadAt at a negative offset succeeded")
+	}
+}
+
+func TestSeekableReaderSeek(t *testing.T) {
+	plaintext, data := seekTestStream(t, testFileMetadata)
+	s, err := newSeekTestReader(t, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := int64(len(plaintext))
+
+	if pos, err := s.Seek(-100, io.SeekEnd); err != nil || pos != size-100 {
+		t.Fatalf("Seek(-100, End) = %d, %v", pos, err)
+	}
+	rest, err := io.ReadAll(s)
+	if err != nil || !bytes.Equal(rest, plaintext[size-100:]) {
+		t.Errorf("read after Seek(-100, End) = %d bytes, %v", len(rest), err)
+	}
+
+	s.Seek(seekTestChunkSize-3, io.SeekStart)
+	if pos, _ := s.Seek(10, io.SeekCurrent); pos != seekTestChunkSize+7 {
+		t.Errorf("Seek(10, Current) = %d", pos)
+	}
+	p := make([]byte, 50)
+	if _, err := io.ReadFull(s, p); err != nil || !bytes.Equal(p, plaintext[seekTestChunkSize+7:seekTestChunkSize+57]) {
+		t.Errorf("read after Seek(10, Current) = %v", err)
+	}
+
+	if _, err := s.Seek(-1, io.SeekStart); err == nil {
+		t.Error("Seek to a negative offset succeeded")
+	}
+	if pos, err := s.Seek(size+10, io.SeekStart); err != nil || pos != size+10 {
+		t.Errorf("Seek past the end = %d, %v", pos, err)
+	}
+	if n, err := s.Read(p); n != 0 || err != io.EOF {
+		t.Errorf("Read past the end = %d, %v", n, err)
+	}
+}
+
+func TestSeekableReaderConcurrent(t *testing.T) {
+	plaintext, data := seekTestStream(t, nil)
+	s, err := newSeekTestReader(t, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				off := (g*977 + i*331) % (len(plaintext) - 300)
+				p := make([]byte, 300)
+				if _, err := s.ReadAt(p, int64(off)); err != nil || !bytes.Equal(p, plaintext[off:off+300]) {
+					t.Errorf("concurrent ReadAt(%d) = %v", off, err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestSeekableReaderTruncated(t *testing.T) {
+	_, data := seekTestStream(t, nil)
+	sealed := seekTestChunkSize + 16
+	lastSize := seekTestChunkSize/2 + 16
+	for name, end := range map[string]int{
+		"last chunk cut":            len(data) - 1,
+		"last chunk tag only":       len(data) - lastSize + 16,
+		"less than a tag left":      len(data) - lastSize + 10,
+		"last chunk dropped":        len(data) - lastSize,
+		"two chunks dropped":        len(data) - lastSize - sealed,
+		"cut inside a middle chunk": len(data) - lastSize - sealed/2,
+	} {
+		if _, err := newSeekTestReader(t, data[:end]); !errors.Is(err, ErrTruncated) {
+			t.Errorf("%s: error = %v, want ErrTruncated", name, err)
+		}
+	}
+}
+
+func TestSeekableReaderTampered(t *testing.T) {
+	plaintext, data := seekTestStream(t, nil)
+	sealed := seekTestChunkSize + 16
+	headerSize := len(data) - 5*sealed - (seekTestChunkSize/2 + 16)
+
+	// The last chunk is opened up front
+	tampered := append([]byte{}, data...)
+	tampered[len(tampered)-5] ^= 1
+	if _, err := newSeekTestReader(t, tampered); err == nil {
+		t.Error("tampered last chunk was accepted")
+	}
+
+	// A middle chunk only fails the reads that need it
+	tampered = append([]byte{}, data...)
+	tampered[headerSize+2*sealed+7] ^= 1
+	s, err := newSeekTestReader(t, tampered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := make([]byte, 100)
+	if _, err := s.ReadAt(p, 2*seekTestChunkSize+50); err == nil {
+		t.Error("ReadAt of a tampered chunk succeeded")
+	}
+	if n, err := s.ReadAt(p, 2*seekTestChunkSize-50); n != 50 || err == nil {
+		t.Errorf("ReadAt into a tampered chunk = %d, %v", n, err)
+	}
+	if _, err := s.ReadAt(p, 3*seekTestChunkSize); err != nil || !bytes.Equal(p, plaintext[3*seekTestChunkSize:3*seekTestChunkSize+100]) {
+		t.Errorf("ReadAt after a tampered chunk = %v", err)
+	}
+
+	// Swapped chunks fail where they are read
+	swapped := append([]byte{}, data...)
+	copy(swapped[headerSize+sealed:], data[headerSize+2*sealed:headerSize+3*sealed])
+	copy(swapped[headerSize+2*sealed:], data[headerSize+sealed:headerSize+2*sealed])
+	s, err = newSeekTestReader(t, swapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ReadAt(p, seekTestChunkSize); err == nil {
+		t.Error("ReadAt of a moved chunk succeeded")
+	}
+}
+
+func TestSeekableReaderRejects(t *testing.T) {
+	compressed := encryptStreamForTest(t, parallelTestData(5000), &StreamOptions{ChunkSize: seekTestChunkSize, EnvelopeOptions: EnvelopeOptions{Compression: CompressionGzip}})
+	if _, err := newSeekTestReader(t, compressed); err == nil {
+		t.Error("compressed stream was accepted")
+	}
+	whole, err := SealEnvelope(&AESGCMProvider{}, []byte("not streamed"), parallelTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newSeekTestReader(t, whole); err == nil {
+		t.Error("envelope without chunks was accepted")
+	}
+	_, data := seekTestStream(t, nil)
+	if _, err := NewDecryptReaderAt(bytes.NewReader(data), int64(len(data)), []byte("another key"), nil); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("wrong key: error = %v, want ErrKeyMismatch", err)
+	}
+}
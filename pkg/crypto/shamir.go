@@ -0,0 +1,269 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+// Shamir secret sharing over GF(256)
+
+// shareVersion is the first byte of every encoded share
+const shareVersion = 1
+
+// shareSetIDSize is the length of the identifier shared by all shares of one split
+const shareSetIDSize = 4
+
+// shareChecksumSize is the length of the truncated SHA-256 checksum at the end of a share
+const shareChecksumSize = 4
+
+// shareHeaderSize is version, set id, threshold and index
+const shareHeaderSize = 1 + shareSetIDSize + 1 + 1
+
+// MaxShares is the largest number of shares a secret can be split into
+const MaxShares = 255
+
+// ErrMismatchedShares is returned when shares do not come from the same split
+var ErrMismatchedShares = errors.New("shares come from different splits")
+
+// ErrInconsistentShares is returned when shares beyond the threshold do not agree with the others
+var ErrInconsistentShares = errors.New("shares do not agree; one of them has been altered")
+
+// Share is one share of a split secret
+type Share struct {
+	// SetID identifies the split; all shares of one split carry the same value
+	SetID [shareSetIDSize]byte
+	// Threshold is the number of shares needed to recover the secret
+	Threshold uint8
+	// Index is the x coordinate of the share, between 1 and 255
+	Index uint8
+	// Data holds one polynomial evaluation per secret byte
+	Data []byte
+}
+
+// SplitSecret splits secret into n shares so that any threshold of them recover it
+func SplitSecret(secret []byte, n, threshold int) ([]*Share, error) {
+	utils.DebugLogf("SplitSecret: splitting %d bytes into %d shares with threshold %d", len(secret), n, threshold)
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("secret must not be empty")
+	}
+	if threshold < 2 {
+		return nil, fmt.Errorf("threshold must be at least 2")
+	}
+	if n < threshold {
+		return nil, fmt.Errorf("number of shares must be at least the threshold")
+	}
+	if n > MaxShares {
+		return nil, fmt.Errorf("number of shares must be at most %d", MaxShares)
+	}
+
+	var setID [shareSetIDSize]byte
+	if _, err := rand.Read(setID[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate share set id: %w", err)
+	}
+
+	shares := make([]*Share, n)
+	for i := range shares {
+		shares[i] = &Share{
+			SetID:     setID,
+			Threshold: uint8(threshold),
+			Index:     uint8(i + 1),
+			Data:      make([]byte, len(secret)),
+		}
+	}
+
+	// One random polynomial of degree threshold-1 per secret byte, with the byte as constant term
+	coefficients := make([]byte, threshold)
+	for pos, b := range secret {
+		coefficients[0] = b
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, fmt.Errorf("failed to generate polynomial: %w", err)
+		}
+		for _, share := range shares {
+			share.Data[pos] = evaluatePolynomial(coefficients, share.Index)
+		}
+	}
+
+	return shares, nil
+}
+
+// CombineShares recovers the secret from at least Threshold shares of the same split.
+// The secret is interpolated from the first Threshold shares; every further share must
+// lie on the same polynomials, or ErrInconsistentShares is returned.
+func CombineShares(shares []*Share) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, fmt.Errorf("no shares given")
+	}
+	utils.DebugLogf("CombineShares: combining %d shares", len(shares))
+
+	first := shares[0]
+	seen := make(map[uint8]bool, len(shares))
+	for _, share := range shares {
+		if share.SetID != first.SetID || share.Threshold != first.Threshold || len(share.Data) != len(first.Data) {
+			return nil, ErrMismatchedShares
+		}
+		if share.Index == 0 {
+			return nil, fmt.Errorf("invalid share index 0")
+		}
+		if seen[share.Index] {
+			return nil, fmt.Errorf("duplicate share %d", share.Index)
+		}
+		seen[share.Index] = true
+	}
+
+	if len(shares) < int(first.Threshold) {
+		return nil, fmt.Errorf("need at least %d shares, got %d", first.Threshold, len(shares))
+	}
+	base, extra := shares[:first.Threshold], shares[first.Threshold:]
+
+	for _, share := range extra {
+		if subtle.ConstantTimeCompare(interpolateShares(base, share.Index), share.Data) != 1 {
+			return nil, fmt.Errorf("share %d: %w", share.Index, ErrInconsistentShares)
+		}
+	}
+	return interpolateShares(base, 0), nil
+}
+
+// interpolateShares evaluates the polynomials through shares at x (Lagrange interpolation)
+func interpolateShares(shares []*Share, x byte) []byte {
+	result := make([]byte, len(shares[0].Data))
+	for i, share := range shares {
+		basis := byte(1)
+		for j, other := range shares {
+			if i == j {
+				continue
+			}
+			basis = gfMul(basis, gfDiv(x^other.Index, share.Index^other.Index))
+		}
+		for pos := range result {
+			result[pos] ^= gfMul(share.Data[pos], basis)
+		}
+	}
+	return result
+}
+
+// Marshal encodes the share as version, set id, threshold, index, data and checksum
+func (s *Share) Marshal() []byte {
+	out := make([]byte, 0, shareHeaderSize+len(s.Data)+shareChecksumSize)
+	out = append(out, shareVersion)
+	out = append(out, s.SetID[:]...)
+	out = append(out, s.Threshold, s.Index)
+	out = append(out, s.Data...)
+	sum := sha256.Sum256(out)
+	return append(out, sum[:shareChecksumSize]...)
+}
+
+// String returns the base64 form of the share
+func (s *Share) String() string {
+	return base64.StdEncoding.EncodeToString(s.Marshal())
+}
+
+// Words returns the share as a space separated word list, one word per byte
+func (s *Share) Words() string {
+	encoded := s.Marshal()
+	words := make([]string, len(encoded))
+	for i, b := range encoded {
+		words[i] = shareWords[b]
+	}
+	return strings.Join(words, " ")
+}
+
+// UnmarshalShare decodes and verifies an encoded share
+func UnmarshalShare(data []byte) (*Share, error) {
+	if len(data) < shareHeaderSize+1+shareChecksumSize {
+		return nil, fmt.Errorf("share is too short")
+	}
+	if data[0] != shareVersion {
+		return nil, fmt.Errorf("unsupported share version %d", data[0])
+	}
+
+	body := data[:len(data)-shareChecksumSize]
+	sum := sha256.Sum256(body)
+	if !bytes.Equal(sum[:shareChecksumSize], data[len(body):]) {
+		return nil, fmt.Errorf("share checksum mismatch")
+	}
+
+	share := &Share{
+		Threshold: body[1+shareSetIDSize],
+		Index:     body[2+shareSetIDSize],
+		Data:      append([]byte{}, body[shareHeaderSize:]...),
+	}
+	copy(share.SetID[:], body[1:1+shareSetIDSize])
+	if share.Threshold < 2 || share.Index == 0 {
+		return nil, fmt.Errorf("invalid share header")
+	}
+	return share, nil
+}
+
+// ParseShare accepts a share in base64 or word list form
+func ParseShare(text string) (*Share, error) {
+	text = strings.TrimSpace(text)
+	if strings.ContainsAny(text, " \t\n") {
+		return parseShareWords(strings.Fields(text))
+	}
+
+	data, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		// A single word is not a valid share either way, report the base64 error
+		return nil, fmt.Errorf("error decoding base64 share: %w", err)
+	}
+	return UnmarshalShare(data)
+}
+
+func parseShareWords(words []string) (*Share, error) {
+	index := make(map[string]byte, len(shareWords))
+	for i, w := range shareWords {
+		index[w] = byte(i)
+	}
+
+	data := make([]byte, len(words))
+	for i, w := range words {
+		b, ok := index[strings.ToLower(w)]
+		if !ok {
+			return nil, fmt.Errorf("unknown share word %q at position %d", w, i+1)
+		}
+		data[i] = b
+	}
+	return UnmarshalShare(data)
+}
+
+func evaluatePolynomial(coefficients []byte, x byte) byte {
+	// Horner's method, highest degree first
+	result := byte(0)
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result = gfMul(result, x) ^ coefficients[i]
+	}
+	return result
+}
+
+// gfMul multiplies in GF(2^8) with the AES reduction polynomial x^8 + x^4 + x^3 + x + 1.
+// It does not branch on its inputs, which are secret.
+func gfMul(a, b byte) byte {
+	var product byte
+	for i := 0; i < 8; i++ {
+		product ^= a & (0 - (b & 1))
+		a = (a << 1) ^ (0x1b & (0 - (a >> 7)))
+		b >>= 1
+	}
+	return product
+}
+
+// gfInv returns the multiplicative inverse, a^254 in GF(2^8)
+func gfInv(a byte) byte {
+	result := byte(1)
+	for i := 0; i < 254; i++ {
+		result = gfMul(result, a)
+	}
+	return result
+}
+
+func gfDiv(a, b byte) byte {
+	return gfMul(a, gfInv(b))
+}
@@ -0,0 +1,248 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var shamirTestSecret = []byte("a 32-byte secret for shamir test")
+
+// subsets calls f with every subset of shares
+func subsets(shares []*Share, f func([]*Share)) {
+	for mask := 1; mask < 1<<len(shares); mask++ {
+		var subset []*Share
+		for i, share := range shares {
+			if mask&(1<<i) != 0 {
+				subset = append(subset, share)
+			}
+		}
+		f(subset)
+	}
+}
+
+func TestShamirEverySubset(t *testing.T) {
+	for _, tt := range []struct{ n, threshold int }{{2, 2}, {3, 2}, {5, 3}, {6, 4}, {5, 5}} {
+		shares, err := SplitSecret(shamirTestSecret, tt.n, tt.threshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(shares) != tt.n {
+			t.Fatalf("SplitSecret(%d, %d) returned %d shares", tt.n, tt.threshold, len(shares))
+		}
+
+		subsets(shares, func(subset []*Share) {
+			secret, err := CombineShares(subset)
+			if len(subset) < tt.threshold {
+				if err == nil {
+					t.Errorf("%d of %d with threshold %d: combine succeeded", len(subset), tt.n, tt.threshold)
+				}
+				return
+			}
+			if err != nil || !bytes.Equal(secret, shamirTestSecret) {
+				t.Errorf("%d of %d with threshold %d: combine = %q, %v", len(subset), tt.n, tt.threshold, secret, err)
+			}
+		})
+
+		// Order does not matter
+		reversed := make([]*Share, len(shares))
+		for i, share := range shares {
+			reversed[len(shares)-1-i] = share
+		}
+		if secret, err := CombineShares(reversed); err != nil || !bytes.Equal(secret, shamirTestSecret) {
+			t.Errorf("reversed shares: combine = %q, %v", secret, err)
+		}
+	}
+}
+
+func TestShamirBelowThresholdRevealsNothing(t *testing.T) {
+	// With fewer than threshold shares every secret is equally likely, so one share
+	// of the same byte takes every value over many splits
+	seen := make(map[byte]bool)
+	for i := 0; i < 2000 && len(seen) < 256; i++ {
+		shares, err := SplitSecret([]byte{0}, 3, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[shares[0].Data[0]] = true
+	}
+	if len(seen) < 250 {
+		t.Errorf("one share of a zero byte took only %d values", len(seen))
+	}
+}
+
+func TestShamirInvalidShares(t *testing.T) {
+	shares, err := SplitSecret(shamirTestSecret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := SplitSecret(shamirTestSecret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withThreshold := func(s *Share, threshold uint8) *Share {
+		c := *s
+		c.Threshold = threshold
+		return &c
+	}
+	withIndex := func(s *Share, index uint8) *Share {
+		c := *s
+		c.Index = index
+		return &c
+	}
+
+	for name, tt := range map[string]struct {
+		shares     []*Share
+		mismatched bool
+	}{
+		"none":                     {nil, false},
+		"duplicate":                {[]*Share{shares[0], shares[1], shares[0]}, false},
+		"duplicate index":          {[]*Share{shares[0], shares[1], withIndex(shares[2], 1)}, false},
+		"index 0":                  {[]*Share{shares[0], shares[1], withIndex(shares[2], 0)}, false},
+		"another split":            {[]*Share{shares[0], shares[1], other[2]}, true},
+		"another threshold":        {[]*Share{shares[0], shares[1], withThreshold(shares[2], 2)}, true},
+		"another length":           {[]*Share{shares[0], shares[1], {SetID: shares[0].SetID, Threshold: 3, Index: 3, Data: []byte{1}}}, true},
+		"too few":                  {shares[:2], false},
+		"too few, duplicates fill": {[]*Share{shares[0], shares[1], shares[1]}, false},
+	} {
+		_, err := CombineShares(tt.shares)
+		if err == nil {
+			t.Errorf("%s: combine succeeded", name)
+		}
+		if errors.Is(err, ErrMismatchedShares) != tt.mismatched {
+			t.Errorf("%s: error = %v, want ErrMismatchedShares %v", name, err, tt.mismatched)
+		}
+	}
+}
+
+func TestShamirExtraSharesChecked(t *testing.T) {
+	shares, err := SplitSecret(shamirTestSecret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	altered := *shares[4]
+	altered.Data = append([]byte{}, altered.Data...)
+	altered.Data[len(altered.Data)-1] ^= 1
+
+	// The altered share is beyond the threshold, or among the first three and caught by the others
+	for name, subset := range map[string][]*Share{
+		"fourth":       {shares[0], shares[1], shares[2], &altered},
+		"fifth":        {shares[0], shares[1], shares[2], shares[3], &altered},
+		"interpolated": {&altered, shares[0], shares[1], shares[2]},
+	} {
+		secret, err := CombineShares(subset)
+		if !errors.Is(err, ErrInconsistentShares) {
+			t.Errorf("%s: combine = %q, %v, want ErrInconsistentShares", name, secret, err)
+		}
+	}
+}
+
+func TestSplitSecretErrors(t *testing.T) {
+	for _, tt := range []struct {
+		secret       []byte
+		n, threshold int
+	}{
+		{nil, 3, 2},
+		{shamirTestSecret, 3, 1},
+		{shamirTestSecret, 2, 3},
+		{shamirTestSecret, MaxShares + 1, 2},
+	} {
+		if _, err := SplitSecret(tt.secret, tt.n, tt.threshold); err == nil {
+			t.Errorf("SplitSecret(%d bytes, %d, %d) succeeded", len(tt.secret), tt.n, tt.threshold)
+		}
+	}
+	if shares, err := SplitSecret([]byte{1}, MaxShares, MaxShares); err != nil || shares[MaxShares-1].Index != MaxShares {
+		t.Errorf("SplitSecret(%d, %d) = %v", MaxShares, MaxShares, err)
+	}
+}
+
+func TestShareEncoding(t *testing.T) {
+	shares, err := SplitSecret(shamirTestSecret, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	share := shares[1]
+
+	for name, text := range map[string]string{
+		"base64":      share.String(),
+		"words":       share.Words(),
+		"upper words": strings.ToUpper(share.Words()),
+		"wrapped":     "  " + strings.ReplaceAll(share.Words(), " ", "\n") + "\n",
+	} {
+		got, err := ParseShare(text)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got.SetID != share.SetID || got.Threshold != share.Threshold || got.Index != share.Index || !bytes.Equal(got.Data, share.Data) {
+			t.Errorf("%s: parsed %+v, want %+v", name, got, share)
+		}
+	}
+
+	if n := len(strings.Fields(share.Words())); n != len(share.Marshal()) {
+		t.Errorf("Words has %d words for %d bytes", n, len(share.Marshal()))
+	}
+	unique := make(map[string]bool)
+	for _, w := range shareWords {
+		unique[w] = true
+	}
+	if len(unique) != len(shareWords) {
+		t.Errorf("share wordlist has %d distinct words, want %d", len(unique), len(shareWords))
+	}
+}
+
+func TestParseShareErrors(t *testing.T) {
+	shares, err := SplitSecret(shamirTestSecret, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := shares[0].Marshal()
+	words := strings.Fields(shares[0].Words())
+
+	flipped := append([]byte{}, encoded...)
+	flipped[len(flipped)/2] ^= 1
+	version := append([]byte{}, encoded...)
+	version[0] = shareVersion + 1
+	changed := append([]string{}, words...)
+	changed[len(changed)/2] = shareWords[encoded[len(changed)/2]^1]
+	unknown := append([]string{}, words...)
+	unknown[2] = "notashareword"
+
+	for name, data := range map[string][]byte{
+		"flipped bit": flipped,
+		"version":     version,
+		"too short":   encoded[:shareHeaderSize+shareChecksumSize],
+		"cut":         encoded[:len(encoded)-1],
+	} {
+		if _, err := UnmarshalShare(data); err == nil {
+			t.Errorf("%s: UnmarshalShare succeeded", name)
+		}
+	}
+	for name, text := range map[string]string{
+		"not base64":   "not*base64",
+		"changed word": strings.Join(changed, " "),
+		"unknown word": strings.Join(unknown, " "),
+		"missing word": strings.Join(words[1:], " "),
+		"empty":        "",
+	} {
+		if _, err := ParseShare(text); err == nil {
+			t.Errorf("%s: ParseShare succeeded", name)
+		}
+	}
+}
+
+func TestGF256(t *testing.T) {
+	// FIPS 197 section 4.2
+	if got := gfMul(0x57, 0x83); got != 0xc1 {
+		t.Errorf("gfMul(0x57, 0x83) = %#x, want 0xc1", got)
+	}
+	if got := gfMul(0x57, 0x13); got != 0xfe {
+		t.Errorf("gfMul(0x57, 0x13) = %#x, want 0xfe", got)
+	}
+	for a := 1; a < 256; a++ {
+		if got := gfMul(byte(a), gfInv(byte(a))); got != 1 {
+			t.Errorf("%#x * gfInv(%#x) = %#x, want 1", a, a, got)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package crypto
+
+// shareWords maps each byte value to a word, so a share can be written down or read aloud.
+// The list is sorted and every word is unique.
+var shareWords = [256]string{
+	"acid", "acorn", "actor", "adult", "agent", "alarm", "album", "alert",
+	"alley", "amber", "angel", "ankle", "apple", "apron", "arena", "armor",
+	"arrow", "atlas", "attic", "audio", "autumn", "avenue", "bacon", "badge",
+	"bagel", "baker", "bamboo", "banjo", "barrel", "basil", "basket", "beach",
+	"beacon", "bean", "beaver", "bench", "berry", "bison", "blade", "board",
+	"boat", "bonus", "border", "bottle", "bread", "brick", "bridge", "broom",
+	"bubble", "bucket", "bundle", "burger", "butter", "cabin", "cactus", "camel",
+	"candle", "canoe", "canvas", "canyon", "carbon", "carpet", "carrot", "castle",
+	"cedar", "cement", "chalk", "cheese", "cherry", "chess", "cider", "circle",
+	"citrus", "clover", "cobalt", "cocoa", "coffee", "comet", "compass", "copper",
+	"coral", "cotton", "cougar", "crayon", "cube", "dagger", "daisy", "dancer",
+	"delta", "denim", "desert", "diamond", "dinner", "donkey", "dragon", "drum",
+	"eagle", "earth", "easel", "echo", "eclipse", "elbow", "ember", "engine",
+	"falcon", "fence", "fiddle", "filter", "flame", "flute", "forest", "fossil",
+	"fox", "galaxy", "garden", "garlic", "gazelle", "ginger", "globe", "goblet",
+	"gold", "grape", "gravel", "guitar", "hammer", "harbor", "hazel", "helmet",
+	"herald", "hollow", "honey", "hotel", "igloo", "indigo", "island", "ivory",
+	"jacket", "jaguar", "jelly", "jigsaw", "jungle", "kayak", "kernel", "kettle",
+	"kiwi", "koala", "ladder", "lagoon", "lantern", "laser", "lemon", "lilac",
+	"locket", "lotus", "magnet", "mango", "maple", "marble", "meadow", "melon",
+	"meteor", "mirror", "mitten", "monkey", "mosaic", "muffin", "museum", "napkin",
+	"nectar", "needle", "nickel", "noodle", "nutmeg", "oasis", "ocean", "olive",
+	"onion", "orbit", "orchid", "otter", "oyster", "paddle", "palace", "panda",
+	"parrot", "pearl", "pebble", "pepper", "piano", "pickle", "pillow", "pilot",
+	"pine", "planet", "plum", "pocket", "pony", "poppy", "potato", "prism",
+	"pumpkin", "puzzle", "quartz", "quill", "rabbit", "radar", "radish", "raven",
+	"ribbon", "river", "robot", "rocket", "saddle", "salmon", "sandal", "satin",
+	"scarf", "shadow", "shell", "silver", "sketch", "socket", "spider", "sponge",
+	"spruce", "squash", "stable", "statue", "summit", "sunset", "swan", "tablet",
+	"tango", "teapot", "temple", "thunder", "tiger", "timber", "tomato", "torch",
+	"tulip", "tunnel", "turtle", "valley", "velvet", "violet", "wagon", "walnut",
+	"whistle", "willow", "window", "winter", "wizard", "yogurt", "zebra", "zipper",
+}
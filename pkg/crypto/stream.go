@@ -0,0 +1,661 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+// Streamed envelopes have the usual header with a chunk size field, followed by the
+// plaintext split into chunks of ChunkSize bytes, each sealed with AES-256-GCM
+// (the STREAM construction of Hoang, Reyhanitabar, Rogaway and Vizár, "Online
+// Authenticated-Encryption and its Nonce-Reuse Misuse-Resistance", 2015):
+//
+//	chunk key = HKDF-SHA256(body key, salt = header nonce, "thanhlv-ed stream")
+//	nonce     = chunk counter (11, big endian) | last chunk flag (1)
+//
+// Every chunk but the last is full; the last one is flagged, so dropping chunks at
+// the end, reordering or splicing chunks fails authentication. Each chunk
+// authenticates the header as additional data. The body key is the one the
+// algorithm would use for a single-shot body: HKDF of the key for aes-256-gcm, the
+// KDF output for passphrases and the file key for multi-recipient envelopes.
+
+// DefaultChunkSize is the plaintext size of each chunk unless StreamOptions says otherwise
+const DefaultChunkSize = 64 << 10
+
+const (
+	minStreamChunkSize = 1 << 10
+	maxStreamChunkSize = 16 << 20
+	// streamSaltSize is the size of the per-stream salt stored as the header nonce
+	streamSaltSize = 16
+)
+
+var streamKeyInfo = []byte("thanhlv-ed stream")
+
+// ErrTruncated is returned when an encrypted stream ends before its last chunk
+var ErrTruncated = errors.New("encrypted stream is truncated")
+
+// StreamOptions configure NewEncryptWriter. Without KDF or Recipients the key is an
+// aes-256-gcm key of any length.
+type StreamOptions struct {
+	// ChunkSize is the plaintext size of each chunk, 0 for DefaultChunkSize
+	ChunkSize int
+	// KDF, if set, makes key a passphrase; a fresh salt is generated for every stream
+	KDF *KDFParams
+	// Recipients, if set, encrypts for these public keys and key is ignored
+	Recipients []*Recipient
+	// Parallelism is the number of goroutines sealing chunks, 0 or 1 for the caller's
+	Parallelism int
+	// Progress, if set, is called with the number of plaintext bytes written so far
+	Progress ProgressFunc
+	// EnvelopeOptions set the expiry, compression and file metadata. Padding needs
+	// the total length up front and is not supported.
+	EnvelopeOptions
+}
+
+// NewEncryptWriter returns a writer that encrypts everything written to it into w
+// as a streamed envelope, holding at most one chunk in memory. Close must be called
+// to write the last chunk; it does not close w.
+func NewEncryptWriter(w io.Writer, key []byte, opts *StreamOptions) (io.WriteCloser, error) {
+	if opts == nil {
+		opts = &StreamOptions{}
+	}
+	chunkSize := opts.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = DefaultChunkSize
+	}
+	if chunkSize < minStreamChunkSize || chunkSize > maxStreamChunkSize {
+		return nil, fmt.Errorf("chunk size must be between %d and %d bytes", minStreamChunkSize, maxStreamChunkSize)
+	}
+	if opts.Padding.Kind != PaddingNone {
+		return nil, fmt.Errorf("padding is not supported when streaming")
+	}
+
+	header := &envelopeHeader{
+		ChunkSize:   uint32(chunkSize),
+		NotAfter:    opts.NotAfter,
+		Compression: opts.Compression,
+		Nonce:       make([]byte, streamSaltSize),
+	}
+	if _, err := rand.Read(header.Nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	var frame []byte
+	if opts.FileMetadata != nil {
+		var err error
+		if frame, err = WrapFileMetadata(opts.FileMetadata, nil); err != nil {
+			return nil, err
+		}
+		header.Flags |= EnvelopeFlagFileMetadata
+	}
+
+	var bodyKey []byte
+	var err error
+	switch {
+	case len(opts.Recipients) > 0:
+		header.Algorithm = EnvelopeMultiRecipient
+		bodyKey = make([]byte, fileKeySize)
+		if _, err := rand.Read(bodyKey); err != nil {
+			return nil, fmt.Errorf("failed to generate file key: %w", err)
+		}
+		for _, recipient := range opts.Recipients {
+			stanza, err := recipient.wrap(bodyKey)
+			if err != nil {
+				return nil, err
+			}
+			header.Recipients = append(header.Recipients, stanza)
+		}
+	case opts.KDF != nil:
+		if len(key) == 0 {
+			return nil, fmt.Errorf("passphrase must not be empty")
+		}
+		// Never reuse a salt across encryptions
+		params := *opts.KDF
+		params.Salt = make([]byte, kdfSaltSize)
+		if _, err := rand.Read(params.Salt); err != nil {
+			return nil, fmt.Errorf("failed to generate salt: %w", err)
+		}
+		header.Algorithm = EnvelopePassphrase
+		header.KDF = &params
+		if bodyKey, err = params.DeriveKey(key, fileKeySize); err != nil {
+			return nil, err
+		}
+	default:
+		header.Algorithm = EnvelopeAES256GCM
+		if header.KeyID, err = symmetricKeyID(key); err != nil {
+			return nil, err
+		}
+		if bodyKey, err = DeriveKey(key, nil, aesGCMKeyInfo, fileKeySize); err != nil {
+			return nil, err
+		}
+	}
+	utils.DebugLogf("NewEncryptWriter: %s stream with %d byte chunks", header.Algorithm, chunkSize)
+
+	headerBytes, err := header.marshal()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newStreamAEAD(bodyKey, header.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(headerBytes); err != nil {
+		return nil, fmt.Errorf("failed to write envelope header: %w", err)
+	}
+	sw, err := newStreamWriter(w, aead, headerBytes, chunkSize, 0, opts)
+	if err != nil {
+		return nil, err
+	}
+	// The metadata goes first and is not counted as progress
+	if _, err := sw.Write(frame); err != nil {
+		return nil, err
+	}
+	return withProgress(sw, opts.Progress), nil
+}
+
+// newStreamWriter seals chunks from counter on, after the header has been written.
+// Progress is left to the caller.
+func newStreamWriter(w io.Writer, aead cipher.AEAD, headerBytes []byte, chunkSize int, counter uint64, opts *StreamOptions) (io.WriteCloser, error) {
+	sw := &streamWriter{w: w, aead: aead, ad: headerBytes, chunkSize: chunkSize, counter: counter}
+	if opts.Parallelism > 1 {
+		sw.pipeline = newSealPipeline(w, aead, headerBytes, opts.Parallelism, chunkSize+aead.Overhead())
+		sw.buf = sw.pipeline.buffer()
+	} else {
+		sw.buf = make([]byte, 0, chunkSize+aead.Overhead())
+	}
+	var out io.WriteCloser = sw
+	if opts.Compression != CompressionNone {
+		cw, err := opts.Compression.newWriter(sw, opts.CompressionLevel)
+		if err != nil {
+			return nil, err
+		}
+		out = &compressedStreamWriter{WriteCloser: cw, stream: sw}
+	}
+	return out, nil
+}
+
+var errWriterAborted = errors.New("encrypt writer aborted")
+
+// AbortEncryptWriter stops a writer from NewEncryptWriter or ResumeEncryptWriter
+// without sealing the last chunk, for callers that give up after a failed write or
+// read. Its goroutines exit, later writes fail and the output is left truncated.
+func AbortEncryptWriter(w io.Writer) {
+	if a, ok := w.(interface{ abort() }); ok {
+		a.abort()
+	}
+}
+
+// withProgress reports what is written to w to fn, if set
+func withProgress(w io.WriteCloser, fn ProgressFunc) io.WriteCloser {
+	if fn == nil {
+		return w
+	}
+	return &progressWriter{w: w, fn: fn}
+}
+
+// NewDecryptReader reads an envelope from r and returns a reader of its plaintext.
+// Streamed envelopes are decrypted chunk by chunk in constant memory, and data read
+// from a chunk has been authenticated; the reader fails with ErrTruncated if the
+// stream ends early. Other envelopes are read whole and opened with OpenEnvelope.
+// opts may be nil. With opts.Parallelism above 1 the reader implements io.Closer;
+// close it when giving up before the end of the data so its goroutines exit.
+// Stored file metadata is dropped; NewFileDecryptReader returns it.
+func NewDecryptReader(r io.Reader, key []byte, opts *OpenOptions) (io.Reader, error) {
+	_, plaintext, err := NewFileDecryptReader(r, key, opts)
+	return plaintext, err
+}
+
+// NewFileDecryptReader is NewDecryptReader that also returns the file metadata
+// stored in front of the content, or nil if there is none
+func NewFileDecryptReader(r io.Reader, key []byte, opts *OpenOptions) (*FileMetadata, io.Reader, error) {
+	header, plaintext, err := newDecryptReader(r, key, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if header.Flags&EnvelopeFlagFileMetadata == 0 {
+		return nil, plaintext, nil
+	}
+	meta, content, err := ReadFileMetadata(plaintext)
+	if err != nil {
+		if closer, ok := plaintext.(io.Closer); ok {
+			closer.Close()
+		}
+		return nil, nil, err
+	}
+	if closer, ok := plaintext.(io.Closer); ok {
+		content = &readCloser{Reader: content, Closer: closer}
+	}
+	return meta, content, nil
+}
+
+// readCloser keeps the Close of a stream reader wrapped by another reader
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func newDecryptReader(r io.Reader, key []byte, opts *OpenOptions) (*envelopeHeader, io.Reader, error) {
+	if opts == nil {
+		opts = &OpenOptions{}
+	}
+	if opts.Progress != nil {
+		r = NewProgressReader(r, opts.Progress)
+	}
+	header, headerBytes, err := readEnvelopeHeader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if header.ChunkSize == 0 {
+		body, err := io.ReadAll(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read envelope body: %w", err)
+		}
+		plaintext, err := openParsedEnvelope(header, headerBytes, body, key, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		return header, bytes.NewReader(plaintext), nil
+	}
+
+	bodyKey, err := streamBodyKey(header, key, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	maxSize := opts.MaxDecompressedSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxDecompressedSize
+	}
+	utils.DebugLogf("NewDecryptReader: %s stream with %d byte chunks", header.Algorithm, header.ChunkSize)
+	plaintext, err := newStreamReader(r, header, headerBytes, bodyKey, maxSize, opts.Parallelism)
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, plaintext, nil
+}
+
+// streamBodyKey checks the expiry of a streamed envelope and returns its body key
+func streamBodyKey(header *envelopeHeader, key []byte, opts *OpenOptions) ([]byte, error) {
+	if !opts.IgnoreExpiry {
+		if err := checkNotAfter(header); err != nil {
+			return nil, err
+		}
+	}
+	switch header.Algorithm {
+	case EnvelopeAES256GCM:
+		return aesGCMBodyKey(header, key)
+	case EnvelopePassphrase:
+		return passphraseBodyKey(header, key)
+	case EnvelopeMultiRecipient:
+		return recipientFileKey(header, key)
+	default:
+		return nil, fmt.Errorf("unsupported streamed envelope algorithm %s", header.Algorithm)
+	}
+}
+
+// readEnvelopeHeader reads exactly the envelope header from r, leaving r at the body
+func readEnvelopeHeader(r io.Reader) (*envelopeHeader, []byte, error) {
+	prefix := make([]byte, envelopePrefixSize)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, nil, fmt.Errorf("data is not an encrypted envelope")
+		}
+		return nil, nil, fmt.Errorf("failed to read envelope header: %w", err)
+	}
+	if !IsEnvelope(prefix) {
+		return nil, nil, fmt.Errorf("data is not an encrypted envelope")
+	}
+	headerLen := binary.BigEndian.Uint32(prefix[len(envelopeMagic)+1:])
+	if headerLen > maxEnvelopeHeaderSize {
+		return nil, nil, fmt.Errorf("envelope header is truncated")
+	}
+
+	data := make([]byte, envelopePrefixSize+int(headerLen))
+	copy(data, prefix)
+	if _, err := io.ReadFull(r, data[envelopePrefixSize:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, nil, fmt.Errorf("%w: envelope header is incomplete", ErrTruncated)
+		}
+		return nil, nil, fmt.Errorf("failed to read envelope header: %w", err)
+	}
+	header, headerBytes, _, err := parseEnvelope(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, headerBytes, nil
+}
+
+// openStreamPayload decrypts a whole streamed body held in memory
+func openStreamPayload(h *envelopeHeader, key, body, header []byte, maxSize int64) ([]byte, error) {
+	r, err := newStreamReader(bytes.NewReader(body), h, header, key, maxSize, 1)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// newStreamReader decrypts the chunks read from r on workers goroutines, then
+// decompresses if the header says so
+func newStreamReader(r io.Reader, h *envelopeHeader, header, bodyKey []byte, maxSize int64, workers int) (io.Reader, error) {
+	if h.Padding.Kind != PaddingNone {
+		return nil, fmt.Errorf("streamed envelopes cannot be padded")
+	}
+	aead, err := newStreamAEAD(bodyKey, h.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	sr := &streamReader{
+		r:     bufio.NewReader(r),
+		aead:  aead,
+		ad:    header,
+		chunk: make([]byte, int(h.ChunkSize)+aead.Overhead()),
+		buf:   make([]byte, 0, int(h.ChunkSize)),
+	}
+	// Decrypting the first chunk now reports a wrong key here rather than on Read
+	if err := sr.next(); err != nil {
+		return nil, err
+	}
+	var chunks io.Reader = sr
+	if workers > 1 {
+		chunks = newParallelStreamReader(sr, workers)
+	}
+	if h.Compression == CompressionNone {
+		return chunks, nil
+	}
+	zr, err := h.Compression.newReader(chunks)
+	if err != nil {
+		return nil, err
+	}
+	return &decompressingReader{r: zr, stream: chunks, remaining: maxSize, limit: maxSize}, nil
+}
+
+func newStreamAEAD(bodyKey, salt []byte) (cipher.AEAD, error) {
+	if len(salt) != streamSaltSize {
+		return nil, fmt.Errorf("invalid stream salt size %d", len(salt))
+	}
+	key, err := DeriveKey(bodyKey, salt, streamKeyInfo, fileKeySize)
+	if err != nil {
+		return nil, err
+	}
+	return newEnvelopeAEAD(key)
+}
+
+// streamNonce is the chunk counter followed by the last chunk flag
+func streamNonce(counter uint64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+type streamWriter struct {
+	w         io.Writer
+	aead      cipher.AEAD
+	ad        []byte
+	buf       []byte
+	chunkSize int
+	counter   uint64
+	closed    bool
+	err       error
+	// pipeline, if set, seals chunks on several goroutines
+	pipeline *sealPipeline
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, fmt.Errorf("write to closed encrypt writer")
+	}
+	written := 0
+	for len(p) > 0 {
+		if s.err != nil {
+			return written, s.err
+		}
+		// A full chunk is only sealed once more data arrives, so the last chunk is
+		// never empty unless the whole stream is
+		if len(s.buf) == s.chunkSize {
+			s.err = s.flush(false)
+			continue
+		}
+		n := copy(s.buf[len(s.buf):s.chunkSize], p)
+		s.buf = s.buf[:len(s.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, s.err
+}
+
+// Close seals the buffered data as the last chunk
+func (s *streamWriter) Close() error {
+	if s.closed {
+		return s.err
+	}
+	s.closed = true
+	if s.err != nil {
+		if s.pipeline != nil {
+			s.pipeline.wait()
+		}
+		return s.err
+	}
+	s.err = s.flush(true)
+	return s.err
+}
+
+// abort gives up on the stream without sealing the last chunk
+func (s *streamWriter) abort() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if s.err == nil {
+		s.err = errWriterAborted
+	}
+	if s.pipeline != nil {
+		s.pipeline.abort()
+	}
+}
+
+func (s *streamWriter) flush(last bool) error {
+	if s.pipeline != nil {
+		s.pipeline.submit(s.buf, s.counter, last)
+		s.counter++
+		if last {
+			return s.pipeline.wait()
+		}
+		s.buf = s.pipeline.buffer()
+		return s.pipeline.failed()
+	}
+
+	sealed := s.aead.Seal(s.buf[:0], streamNonce(s.counter, last), s.buf, s.ad)
+	if _, err := s.w.Write(sealed); err != nil {
+		return fmt.Errorf("failed to write chunk %d: %w", s.counter, err)
+	}
+	s.buf = s.buf[:0]
+	s.counter++
+	return nil
+}
+
+// compressedStreamWriter compresses into a streamWriter and closes both
+type compressedStreamWriter struct {
+	io.WriteCloser
+	stream *streamWriter
+}
+
+func (c *compressedStreamWriter) Close() error {
+	if err := c.WriteCloser.Close(); err != nil {
+		return fmt.Errorf("failed to compress: %w", err)
+	}
+	return c.stream.Close()
+}
+
+// Write fails once the stream is closed or aborted, even while gzip would buffer
+func (c *compressedStreamWriter) Write(p []byte) (int, error) {
+	if c.stream.closed {
+		return 0, fmt.Errorf("write to closed encrypt writer")
+	}
+	return c.WriteCloser.Write(p)
+}
+
+func (c *compressedStreamWriter) abort() {
+	c.stream.abort()
+}
+
+type streamReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	ad      []byte
+	chunk   []byte
+	buf     []byte
+	plain   []byte
+	counter uint64
+	done    bool
+	err     error
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.plain) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		if s.done {
+			return 0, io.EOF
+		}
+		s.err = s.next()
+	}
+	n := copy(p, s.plain)
+	s.plain = s.plain[n:]
+	return n, nil
+}
+
+// next reads and decrypts one chunk. A chunk is the last one when the input ends
+// right after it.
+func (s *streamReader) next() error {
+	ciphertext, last, err := s.readChunk(s.chunk, s.counter)
+	if err != nil {
+		return err
+	}
+	plaintext, err := s.openChunk(s.buf, ciphertext, s.counter, last)
+	if err != nil {
+		return err
+	}
+	s.plain = plaintext
+	s.counter++
+	s.done = last
+	return nil
+}
+
+// readChunk reads the ciphertext of chunk counter into buf, which holds a full chunk
+func (s *streamReader) readChunk(buf []byte, counter uint64) ([]byte, bool, error) {
+	n, err := io.ReadFull(s.r, buf)
+	last := false
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		last = true
+	case err != nil:
+		return nil, false, fmt.Errorf("failed to read chunk %d: %w", counter, err)
+	default:
+		if _, err := s.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return nil, false, fmt.Errorf("failed to read chunk %d: %w", counter, err)
+		}
+	}
+	if n == 0 && counter > 0 {
+		return nil, false, ErrTruncated
+	}
+	if n < s.aead.Overhead() {
+		return nil, false, fmt.Errorf("%w: chunk %d is incomplete", ErrTruncated, counter)
+	}
+	return buf[:n], last, nil
+}
+
+// openChunk decrypts a chunk into dst; it only reads the reader's immutable fields,
+// so chunks can be opened concurrently
+func (s *streamReader) openChunk(dst, ciphertext []byte, counter uint64, last bool) ([]byte, error) {
+	plaintext, err := s.aead.Open(dst[:0], streamNonce(counter, last), ciphertext, s.ad)
+	if err != nil {
+		// A full chunk that authenticates as a middle chunk means the rest was cut off
+		if last && len(ciphertext) == len(s.chunk) {
+			if _, err := s.aead.Open(nil, streamNonce(counter, false), ciphertext, s.ad); err == nil {
+				return nil, ErrTruncated
+			}
+		}
+		// A short chunk is only valid as the last one. When it does not open as such
+		// after an earlier chunk proved the key, the stream most likely ends inside a
+		// middle chunk; the tag cannot tell that apart from a modified last chunk.
+		// Callers open chunk 0 before any later chunk.
+		if last && len(ciphertext) < len(s.chunk) {
+			if counter > 0 {
+				return nil, fmt.Errorf("%w: chunk %d is incomplete", ErrTruncated, counter)
+			}
+			return nil, fmt.Errorf("failed to decrypt chunk 0: wrong key, corrupted or truncated data")
+		}
+		return nil, fmt.Errorf("failed to decrypt chunk %d: wrong key or corrupted data", counter)
+	}
+	if last && len(plaintext) == 0 && counter > 0 {
+		return nil, fmt.Errorf("encrypted stream has an empty last chunk")
+	}
+	return plaintext, nil
+}
+
+// decompressingReader bounds the decompressed size and, at the end of the
+// compressed data, reads the stream to its end so truncation is still detected
+type decompressingReader struct {
+	r         io.ReadCloser
+	stream    io.Reader
+	remaining int64
+	limit     int64
+}
+
+func (d *decompressingReader) Read(p []byte) (int, error) {
+	if d.remaining <= 0 {
+		// Only fail if there is more to come
+		var probe [1]byte
+		if n, _ := io.ReadFull(d.r, probe[:]); n > 0 {
+			return 0, fmt.Errorf("%w of %d bytes", ErrDecompressionLimit, d.limit)
+		}
+		return 0, d.finish()
+	}
+	if int64(len(p)) > d.remaining {
+		p = p[:d.remaining]
+	}
+	n, err := d.r.Read(p)
+	d.remaining -= int64(n)
+	if err == io.EOF {
+		return n, d.finish()
+	}
+	if err != nil {
+		return n, fmt.Errorf("failed to decompress: %w", err)
+	}
+	return n, nil
+}
+
+// Close stops a parallel stream reader underneath
+func (d *decompressingReader) Close() error {
+	d.r.Close()
+	if closer, ok := d.stream.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// finish checks that nothing but the end of the stream follows the compressed data
+func (d *decompressingReader) finish() error {
+	d.r.Close()
+	n, err := io.Copy(io.Discard, d.stream)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("unexpected data after the compressed stream")
+	}
+	return io.EOF
+}
@@ -0,0 +1,210 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+const streamTestChunkSize = 1024
+
+// streamTestCiphertext encrypts 3.5 chunks and returns the stream with the offsets
+// at which its chunks start; the last offset is the end of the stream
+func streamTestCiphertext(t *testing.T) ([]byte, []byte, []int) {
+	t.Helper()
+	plaintext := parallelTestData(3*streamTestChunkSize + streamTestChunkSize/2)
+	var buf bytes.Buffer
+	w, err := NewEncryptWriter(&buf, parallelTestKey, &StreamOptions{ChunkSize: streamTestChunkSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(plaintext)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	_, headerBytes, err := readEnvelopeHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	offsets := []int{len(headerBytes)}
+	for offsets[len(offsets)-1]+streamTestChunkSize+16 < len(data) {
+		offsets = append(offsets, offsets[len(offsets)-1]+streamTestChunkSize+16)
+	}
+	offsets = append(offsets, len(data))
+	if len(offsets) != 5 {
+		t.Fatalf("stream has %d chunks, want 4", len(offsets)-1)
+	}
+	return plaintext, data, offsets
+}
+
+// streamTestDecrypt decrypts data with one and with several goroutines, checks that
+// both agree and returns what was read before the error
+func streamTestDecrypt(t *testing.T, data []byte) ([]byte, error) {
+	t.Helper()
+	serial, serialErr := decryptStreamAll(data, 1)
+	parallel, parallelErr := decryptStreamAll(data, 4)
+	if (serialErr == nil) != (parallelErr == nil) || errors.Is(serialErr, ErrTruncated) != errors.Is(parallelErr, ErrTruncated) {
+		t.Errorf("serial error %v, parallel error %v", serialErr, parallelErr)
+	}
+	if !bytes.Equal(serial, parallel) {
+		t.Errorf("serial read %d bytes, parallel read %d", len(serial), len(parallel))
+	}
+	return serial, serialErr
+}
+
+func decryptStreamAll(data []byte, parallelism int) ([]byte, error) {
+	return decryptStreamWith(data, parallelTestKey, parallelism)
+}
+
+func decryptStreamWith(data, key []byte, parallelism int) ([]byte, error) {
+	r, err := NewDecryptReader(bytes.NewReader(data), key, &OpenOptions{Parallelism: parallelism})
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+	return io.ReadAll(r)
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, streamTestChunkSize - 1, streamTestChunkSize, streamTestChunkSize + 1, 5 * streamTestChunkSize} {
+		plaintext := parallelTestData(size)
+		ciphertext := encryptStreamForTest(t, plaintext, &StreamOptions{ChunkSize: streamTestChunkSize})
+		got, err := streamTestDecrypt(t, ciphertext)
+		if err != nil || !bytes.Equal(got, plaintext) {
+			t.Errorf("size %d: got %d bytes, %v", size, len(got), err)
+		}
+	}
+}
+
+func TestStreamTruncatedAtChunkBoundary(t *testing.T) {
+	plaintext, data, offsets := streamTestCiphertext(t)
+	for i, end := range offsets[:len(offsets)-1] {
+		got, err := streamTestDecrypt(t, data[:end])
+		if !errors.Is(err, ErrTruncated) {
+			t.Errorf("cut after %d chunks: error = %v, want ErrTruncated", i, err)
+		}
+		// Only whole authenticated chunks come out
+		if !bytes.Equal(got, plaintext[:len(got)]) || len(got) > i*streamTestChunkSize {
+			t.Errorf("cut after %d chunks: read %d bytes", i, len(got))
+		}
+	}
+}
+
+func TestStreamTruncatedMidChunk(t *testing.T) {
+	plaintext, data, offsets := streamTestCiphertext(t)
+	for i := 1; i < len(offsets)-1; i++ {
+		for _, cut := range []int{1, 15, 16, 17, streamTestChunkSize} {
+			end := offsets[i] + cut
+			if end >= offsets[i+1] {
+				continue
+			}
+			got, err := streamTestDecrypt(t, data[:end])
+			if !errors.Is(err, ErrTruncated) {
+				t.Errorf("cut %d bytes into chunk %d: error = %v, want ErrTruncated", cut, i, err)
+			}
+			if !bytes.Equal(got, plaintext[:len(got)]) || len(got) > i*streamTestChunkSize {
+				t.Errorf("cut %d bytes into chunk %d: read %d bytes", cut, i, len(got))
+			}
+		}
+	}
+
+	// Inside chunk 0 a cut cannot be told apart from a wrong key
+	if _, err := streamTestDecrypt(t, data[:offsets[0]+100]); err == nil {
+		t.Error("cut inside chunk 0 was accepted")
+	}
+	// and inside the header nothing is decrypted
+	if _, err := streamTestDecrypt(t, data[:offsets[0]-1]); !errors.Is(err, ErrTruncated) {
+		t.Errorf("cut inside the header: error = %v, want ErrTruncated", err)
+	}
+}
+
+func TestStreamDroppedFinalChunk(t *testing.T) {
+	_, data, offsets := streamTestCiphertext(t)
+	dropped := data[:offsets[3]]
+	if _, err := streamTestDecrypt(t, dropped); !errors.Is(err, ErrTruncated) {
+		t.Errorf("error = %v, want ErrTruncated", err)
+	}
+
+	// A middle chunk dropped shifts the counters of the rest
+	withoutMiddle := append(append([]byte{}, data[:offsets[1]]...), data[offsets[2]:]...)
+	got, err := streamTestDecrypt(t, withoutMiddle)
+	if err == nil || len(got) > streamTestChunkSize {
+		t.Errorf("dropped middle chunk: read %d bytes, %v", len(got), err)
+	}
+}
+
+func TestStreamReorderedChunks(t *testing.T) {
+	plaintext, data, offsets := streamTestCiphertext(t)
+	chunk := func(i int) []byte { return data[offsets[i]:offsets[i+1]] }
+
+	var swapped []byte
+	swapped = append(swapped, data[:offsets[1]]...)
+	swapped = append(swapped, chunk(2)...)
+	swapped = append(swapped, chunk(1)...)
+	swapped = append(swapped, chunk(3)...)
+	got, err := streamTestDecrypt(t, swapped)
+	if err == nil || errors.Is(err, ErrTruncated) {
+		t.Errorf("swapped chunks: error = %v, want a decryption error", err)
+	}
+	if !bytes.Equal(got, plaintext[:streamTestChunkSize]) {
+		t.Errorf("swapped chunks: read %d bytes, want chunk 0 only", len(got))
+	}
+
+	// A chunk from another stream under the same key has a different header
+	_, other, otherOffsets := streamTestCiphertext(t)
+	spliced := append(append(append([]byte{}, data[:offsets[1]]...), other[otherOffsets[1]:otherOffsets[2]]...), data[offsets[2]:]...)
+	if _, err := streamTestDecrypt(t, spliced); err == nil {
+		t.Error("chunk spliced from another stream was accepted")
+	}
+}
+
+func TestStreamTamperedChunk(t *testing.T) {
+	_, data, offsets := streamTestCiphertext(t)
+	for i := 0; i < len(offsets)-1; i++ {
+		tampered := append([]byte{}, data...)
+		tampered[offsets[i]+5] ^= 1
+		if _, err := streamTestDecrypt(t, tampered); err == nil {
+			t.Errorf("tampered chunk %d was accepted", i)
+		}
+	}
+}
+
+func TestStreamEmptyInput(t *testing.T) {
+	if _, err := NewDecryptReader(bytes.NewReader(nil), parallelTestKey, nil); err == nil {
+		t.Error("empty input was accepted")
+	}
+
+	// An empty plaintext is a single empty last chunk, which is not the same as none
+	ciphertext := encryptStreamForTest(t, nil, &StreamOptions{ChunkSize: streamTestChunkSize})
+	got, err := streamTestDecrypt(t, ciphertext)
+	if err != nil || len(got) != 0 {
+		t.Errorf("empty stream: read %d bytes, %v", len(got), err)
+	}
+	_, headerBytes, err := readEnvelopeHeader(bytes.NewReader(ciphertext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := streamTestDecrypt(t, ciphertext[:len(headerBytes)]); !errors.Is(err, ErrTruncated) {
+		t.Errorf("header without chunks: error = %v, want ErrTruncated", err)
+	}
+}
+
+func TestStreamWrongKey(t *testing.T) {
+	ciphertext := encryptStreamForTest(t, []byte("short"), &StreamOptions{ChunkSize: streamTestChunkSize})
+	if _, err := NewDecryptReader(bytes.NewReader(ciphertext), []byte("another key"), nil); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("wrong key: error = %v, want ErrKeyMismatch", err)
+	}
+
+	// A passphrase has no fingerprint, so a short chunk 0 that does not open is
+	// reported as a wrong key rather than as truncation
+	ciphertext = encryptStreamForTest(t, []byte("short"), &StreamOptions{ChunkSize: streamTestChunkSize, KDF: &KDFParams{Algorithm: KDFPBKDF2SHA256, Iterations: 1000}})
+	_, err := decryptStreamWith(ciphertext, []byte("another passphrase"), 1)
+	if err == nil || errors.Is(err, ErrTruncated) {
+		t.Errorf("wrong passphrase: error = %v, want a decryption error", err)
+	}
+}
@@ -0,0 +1,33 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+
+	"thanhlv-encryption-decryption/pkg/utils"
+)
+
+// ErrAlreadyUpgraded is returned by UpgradeLegacy for data that already has an envelope header
+var ErrAlreadyUpgraded = errors.New("data is already in the envelope format")
+
+// UpgradeLegacy decrypts a bare aes-256-cbc ciphertext from older versions and
+// re-encrypts the plaintext as an aes-256-gcm envelope under the same key.
+// The legacy format is not authenticated, so a wrong key is only caught when the
+// padding check fails; keep the originals until the upgraded files are verified.
+func UpgradeLegacy(data, key []byte) ([]byte, error) {
+	if IsEnvelope(data) {
+		return nil, ErrAlreadyUpgraded
+	}
+
+	plaintext, err := (&AESProvider{}).Decrypt(data, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt legacy ciphertext: %w", err)
+	}
+	utils.DebugLogf("UpgradeLegacy: re-encrypting %d bytes as aes-256-gcm", len(plaintext))
+
+	upgraded, err := SealEnvelope(&AESGCMProvider{}, plaintext, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to re-encrypt: %w", err)
+	}
+	return upgraded, nil
+}
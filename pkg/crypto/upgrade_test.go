@@ -0,0 +1,59 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestUpgradeLegacy(t *testing.T) {
+	for _, size := range []int{0, 1, 15, 16, 1000} {
+		plaintext := parallelTestData(size)
+		legacy, err := (&AESProvider{}).Encrypt(plaintext, parallelTestKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		upgraded, err := UpgradeLegacy(legacy, parallelTestKey)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+		if info := InspectCiphertext(upgraded); info.Algorithm != "aes-256-gcm" {
+			t.Errorf("%d bytes: upgraded to %s", size, info.Algorithm)
+		}
+		got, err := OpenEnvelope(upgraded, parallelTestKey, nil)
+		if err != nil || !bytes.Equal(got, plaintext) {
+			t.Errorf("%d bytes: upgraded file decrypts to %d bytes, %v", size, len(got), err)
+		}
+
+		// Upgrading twice is refused rather than wrapping the envelope again
+		if _, err := UpgradeLegacy(upgraded, parallelTestKey); !errors.Is(err, ErrAlreadyUpgraded) {
+			t.Errorf("%d bytes: second upgrade error = %v, want ErrAlreadyUpgraded", size, err)
+		}
+	}
+}
+
+func TestUpgradeLegacyWrongKey(t *testing.T) {
+	plaintext := []byte("legacy plaintext of some length")
+	legacy, err := (&AESProvider{}).Encrypt(plaintext, parallelTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The legacy format is not authenticated, so only the padding check can catch
+	// a wrong key; it must at least never give back the plaintext
+	upgraded, err := UpgradeLegacy(legacy, []byte("another key"))
+	if err == nil {
+		if got, _ := OpenEnvelope(upgraded, []byte("another key"), nil); bytes.Equal(got, plaintext) {
+			t.Error("wrong key upgraded to the original plaintext")
+		}
+	}
+
+	for name, data := range map[string][]byte{
+		"empty":       nil,
+		"not a block": legacy[:len(legacy)-1],
+		"only the IV": legacy[:16],
+	} {
+		if _, err := UpgradeLegacy(data, parallelTestKey); err == nil {
+			t.Errorf("%s: upgrade succeeded", name)
+		}
+	}
+}
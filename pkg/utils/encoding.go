@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Encoding names accepted by --encoding and --key-encoding
+const (
+	EncodingAuto      = "auto"
+	EncodingBase64    = "base64"
+	EncodingBase64URL = "base64url"
+	EncodingHex       = "hex"
+	EncodingBase32    = "base32"
+	EncodingRaw       = "raw"
+)
+
+// ValidateEncoding checks an encoding name; auto is only valid when reading
+func ValidateEncoding(name string, allowAuto bool) error {
+	switch name {
+	case EncodingBase64, EncodingBase64URL, EncodingHex, EncodingBase32, EncodingRaw:
+		return nil
+	case EncodingAuto:
+		if allowAuto {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported encoding: %s (use base64, base64url, hex, base32 or raw)", name)
+}
+
+// Encode encodes data as text. base64url is unpadded so it can go into URLs as is;
+// raw returns the bytes unchanged.
+func Encode(data []byte, encoding string) (string, error) {
+	switch encoding {
+	case EncodingBase64:
+		return base64.StdEncoding.EncodeToString(data), nil
+	case EncodingBase64URL:
+		return base64.RawURLEncoding.EncodeToString(data), nil
+	case EncodingHex:
+		return hex.EncodeToString(data), nil
+	case EncodingBase32:
+		return base32.StdEncoding.EncodeToString(data), nil
+	case EncodingRaw:
+		return string(data), nil
+	default:
+		return "", ValidateEncoding(encoding, false)
+	}
+}
+
+// Decode decodes text in the given encoding, or detects it with auto.
+// Surrounding whitespace is ignored except for raw.
+func Decode(s string, encoding string) ([]byte, error) {
+	if encoding == EncodingRaw {
+		return []byte(s), nil
+	}
+	s = strings.TrimSpace(s)
+
+	switch encoding {
+	case EncodingAuto:
+		data, detected, err := DecodeAuto(s)
+		if err != nil {
+			return nil, err
+		}
+		DebugLogf("Detected %s encoding", detected)
+		return data, nil
+	case EncodingBase64:
+		return base64.StdEncoding.DecodeString(s)
+	case EncodingBase64URL:
+		return decodeFirst(s, base64.RawURLEncoding.DecodeString, base64.URLEncoding.DecodeString)
+	case EncodingHex:
+		return hex.DecodeString(s)
+	case EncodingBase32:
+		return decodeFirst(strings.ToUpper(s), base32.StdEncoding.DecodeString, base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString)
+	default:
+		return nil, ValidateEncoding(encoding, true)
+	}
+}
+
+// DecodeAuto detects the encoding of s and decodes it. The alphabets overlap, so
+// the narrowest one that fits wins: hex, then base32 (upper case letters and 2-7
+// only), then standard base64 and finally base64url. Random base64 data practically
+// never fits the narrower alphabets; pass the encoding explicitly when it might.
+func DecodeAuto(s string) ([]byte, string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, "", fmt.Errorf("input is empty")
+	}
+
+	if len(s)%2 == 0 && onlyChars(s, "0123456789abcdefABCDEF") {
+		if data, err := hex.DecodeString(s); err == nil {
+			return data, EncodingHex, nil
+		}
+	}
+	if onlyChars(s, "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567=") {
+		if data, err := Decode(s, EncodingBase32); err == nil {
+			return data, EncodingBase32, nil
+		}
+	}
+	if data, err := decodeFirst(s, base64.StdEncoding.DecodeString, base64.RawStdEncoding.DecodeString); err == nil {
+		return data, EncodingBase64, nil
+	}
+	if data, err := Decode(s, EncodingBase64URL); err == nil {
+		return data, EncodingBase64URL, nil
+	}
+	return nil, "", fmt.Errorf("input is not valid base64, base64url, hex or base32")
+}
+
+func decodeFirst(s string, decoders ...func(string) ([]byte, error)) ([]byte, error) {
+	var err error
+	for _, decode := range decoders {
+		var data []byte
+		if data, err = decode(s); err == nil {
+			return data, nil
+		}
+	}
+	return nil, err
+}
+
+func onlyChars(s, alphabet string) bool {
+	for _, r := range s {
+		if !strings.ContainsRune(alphabet, r) {
+			return false
+		}
+	}
+	return true
+}
@@ -4,13 +4,30 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 )
 
-func ReadFile(filename string) ([]byte, error) {
+// Stdio is the file name that stands for standard input or standard output
+const Stdio = "-"
+
+// OpenFile opens filename for reading, or standard input for Stdio
+func OpenFile(filename string) (io.ReadCloser, error) {
+	if filename == Stdio {
+		return io.NopCloser(os.Stdin), nil
+	}
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file %s: %w", filename, err)
 	}
+	return file, nil
+}
+
+// ReadFile reads filename, or standard input for Stdio
+func ReadFile(filename string) ([]byte, error) {
+	file, err := OpenFile(filename)
+	if err != nil {
+		return nil, err
+	}
 	defer file.Close()
 
 	data, err := io.ReadAll(file)
@@ -21,7 +38,15 @@ func ReadFile(filename string) ([]byte, error) {
 	return data, nil
 }
 
+// WriteFile writes filename, or standard output for Stdio
 func WriteFile(filename string, data []byte) error {
+	if filename == Stdio {
+		if _, err := os.Stdout.Write(data); err != nil {
+			return fmt.Errorf("failed to write to standard output: %w", err)
+		}
+		return nil
+	}
+
 	file, err := os.Create(filename)
 	if err != nil {
 		return fmt.Errorf("failed to create file %s: %w", filename, err)
@@ -39,4 +64,101 @@ func WriteFile(filename string, data []byte) error {
 func FileExists(filename string) bool {
 	_, err := os.Stat(filename)
 	return !os.IsNotExist(err)
-}
\ No newline at end of file
+}
+
+// WriteFileAtomic writes data to a temporary file in the same directory and renames
+// it over filename, so readers see either the old or the new content, never a mix
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", filename, err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write to file %s: %w", tmpName, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync file %s: %w", tmpName, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close file %s: %w", tmpName, err)
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return fmt.Errorf("failed to set permissions on %s: %w", tmpName, err)
+	}
+	if err := os.Rename(tmpName, filename); err != nil {
+		return fmt.Errorf("failed to replace file %s: %w", filename, err)
+	}
+	return nil
+}
+
+// AtomicFile is a file written through a temporary file that Commit renames into
+// place, so a failed or interrupted write never leaves a partial file behind
+type AtomicFile struct {
+	*os.File
+	target string
+	// direct is set for standard output and existing non-regular files such as
+	// /dev/stdout, which are written in place
+	direct bool
+}
+
+// CreateFileAtomic starts writing filename, or standard output for Stdio
+func CreateFileAtomic(filename string) (*AtomicFile, error) {
+	if filename == Stdio {
+		return &AtomicFile{File: os.Stdout, target: filename, direct: true}, nil
+	}
+	if info, err := os.Stat(filename); err == nil && !info.Mode().IsRegular() {
+		file, err := os.OpenFile(filename, os.O_WRONLY, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file %s: %w", filename, err)
+		}
+		return &AtomicFile{File: file, target: filename, direct: true}, nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file for %s: %w", filename, err)
+	}
+	return &AtomicFile{File: tmp, target: filename}, nil
+}
+
+// Commit syncs the data and replaces the target file with it
+func (f *AtomicFile) Commit(perm os.FileMode) error {
+	if f.target == Stdio {
+		return nil
+	}
+	if f.direct {
+		return f.File.Close()
+	}
+	defer os.Remove(f.Name())
+
+	if err := f.Sync(); err != nil {
+		f.File.Close()
+		return fmt.Errorf("failed to sync file %s: %w", f.Name(), err)
+	}
+	if err := f.File.Close(); err != nil {
+		return fmt.Errorf("failed to close file %s: %w", f.Name(), err)
+	}
+	if err := os.Chmod(f.Name(), perm); err != nil {
+		return fmt.Errorf("failed to set permissions on %s: %w", f.Name(), err)
+	}
+	if err := os.Rename(f.Name(), f.target); err != nil {
+		return fmt.Errorf("failed to replace file %s: %w", f.target, err)
+	}
+	return nil
+}
+
+// Abort discards what was written, leaving the target file untouched
+func (f *AtomicFile) Abort() {
+	if f.target == Stdio {
+		return
+	}
+	f.File.Close()
+	if !f.direct {
+		os.Remove(f.Name())
+	}
+}